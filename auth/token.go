@@ -0,0 +1,137 @@
+// Package auth signs and verifies the tokens which grant operations
+// on the files of domains.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Op represents an operation on files which a token grants.
+type Op string
+
+const (
+	Read   Op = "read"
+	Write  Op = "write"
+	Delete Op = "delete"
+	Admin  Op = "admin" // for admin service.
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrUnknownKey   = errors.New("unknown key")
+	ErrBadSignature = errors.New("bad signature")
+	ErrExpired      = errors.New("token expired")
+)
+
+var encoding = base64.RawURLEncoding
+
+// Claims represents the content of a token, which grants the
+// operations on the files of domains.
+type Claims struct {
+	Id         string  `json:"jti"`           // token id, for revocation.
+	Subject    string  `json:"sub"`           // whom the token issued to.
+	KeyId      string  `json:"kid"`           // id of the key signing the token.
+	Ops        []Op    `json:"ops"`           // operations granted.
+	Domains    []int64 `json:"domains"`       // domains granted.
+	AllDomains bool    `json:"all,omitempty"` // true for all domains.
+	ExpireTime int64   `json:"exp,omitempty"` // in unix seconds, 0 for never.
+}
+
+// String returns a string for logging into file.
+func (c *Claims) String() string {
+	return fmt.Sprintf("Claims[Id %s, Subject %s, KeyId %s, Ops %v, Domains %v, AllDomains %t, ExpireTime %d]",
+		c.Id, c.Subject, c.KeyId, c.Ops, c.Domains, c.AllDomains, c.ExpireTime)
+}
+
+// Allows returns true if the claims grant op on domain. A domain
+// not positive is never granted, even with all domains.
+func (c *Claims) Allows(op Op, domain int64) bool {
+	if !c.HasOp(op) || domain <= 0 {
+		return false
+	}
+	if c.AllDomains {
+		return true
+	}
+
+	for _, d := range c.Domains {
+		if d == domain {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasOp returns true if the claims grant op, regardless of domains,
+// only for the operations without domain, such as admin.
+func (c *Claims) HasOp(op Op) bool {
+	for _, o := range c.Ops {
+		if o == op {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Sign returns a token of claims signed by key, in the form of
+// "payload.signature", both are encoded with base64 for url.
+func Sign(c *Claims, key []byte) (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	p := encoding.EncodeToString(payload)
+	return p + "." + encoding.EncodeToString(signature(p, key)), nil
+}
+
+// Parse verifies a token with the key got by its key id,
+// and returns the claims of token.
+func Parse(token string, key func(kid string) ([]byte, bool)) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := encoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	sig, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	c := new(Claims)
+	if err := json.Unmarshal(payload, c); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	k, ok := key(c.KeyId)
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if !hmac.Equal(sig, signature(parts[0], k)) {
+		return nil, ErrBadSignature
+	}
+
+	if c.ExpireTime > 0 && time.Now().Unix() >= c.ExpireTime {
+		return nil, ErrExpired
+	}
+
+	return c, nil
+}
+
+func signature(payload string, key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
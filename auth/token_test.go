@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func keyOf(kid string) ([]byte, bool) {
+	if kid == "k1" {
+		return []byte("secret-1"), true
+	}
+	return nil, false
+}
+
+func TestSignAndParse(t *testing.T) {
+	c := &Claims{
+		Id:      "t1",
+		Subject: "unit-test",
+		KeyId:   "k1",
+		Ops:     []Op{Read, Write},
+		Domains: []int64{2, 3},
+	}
+
+	token, err := Sign(c, []byte("secret-1"))
+	if err != nil {
+		t.Fatalf("Sign error %v", err)
+	}
+
+	parsed, err := Parse(token, keyOf)
+	if err != nil {
+		t.Fatalf("Parse error %v", err)
+	}
+	if parsed.String() != c.String() {
+		t.Errorf("expected %s, got %s", c, parsed)
+	}
+
+	cases := []struct {
+		op      Op
+		domain  int64
+		allowed bool
+	}{
+		{Read, 2, true},
+		{Write, 3, true},
+		{Delete, 2, false},
+		{Read, 4, false},
+		{Read, 0, false},
+		{Read, -2, false},
+	}
+	for i, cs := range cases {
+		if parsed.Allows(cs.op, cs.domain) != cs.allowed {
+			t.Errorf("case %d, expected %t", i, cs.allowed)
+		}
+	}
+
+	if !parsed.HasOp(Write) || parsed.HasOp(Admin) {
+		t.Errorf("unexpected ops granted")
+	}
+
+	parsed.AllDomains = true
+	if !parsed.Allows(Read, 4) {
+		t.Errorf("expected all domains allowed")
+	}
+	if parsed.Allows(Read, 0) {
+		t.Errorf("expected domain 0 denied with all domains")
+	}
+}
+
+func TestParseError(t *testing.T) {
+	c := &Claims{KeyId: "k1", Ops: []Op{Read}}
+
+	bad, _ := Sign(c, []byte("secret-2"))
+	if _, err := Parse(bad, keyOf); err != ErrBadSignature {
+		t.Errorf("expected bad signature, got %v", err)
+	}
+
+	good, _ := Sign(c, []byte("secret-1"))
+	parts := strings.Split(good, ".")
+	forged, _ := Sign(&Claims{KeyId: "k1", Ops: []Op{Read, Delete}}, []byte("secret-2"))
+	if _, err := Parse(strings.Split(forged, ".")[0]+"."+parts[1], keyOf); err != ErrBadSignature {
+		t.Errorf("expected bad signature of forged payload, got %v", err)
+	}
+
+	unknown, _ := Sign(&Claims{KeyId: "k2"}, []byte("secret-1"))
+	if _, err := Parse(unknown, keyOf); err != ErrUnknownKey {
+		t.Errorf("expected unknown key, got %v", err)
+	}
+
+	expired, _ := Sign(&Claims{KeyId: "k1", ExpireTime: time.Now().Unix() - 1}, []byte("secret-1"))
+	if _, err := Parse(expired, keyOf); err != ErrExpired {
+		t.Errorf("expected expired, got %v", err)
+	}
+
+	for _, s := range []string{"", "a", "a.b.c", "!!.!!"} {
+		if _, err := Parse(s, keyOf); err != ErrInvalidToken {
+			t.Errorf("expected invalid token %q, got %v", s, err)
+		}
+	}
+}
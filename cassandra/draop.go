@@ -1,5 +1,9 @@
 package cassandra
 
+import (
+	"jingoal.com/dfs/meta"
+)
+
 // Draop processes the operation against cassandra.
 type DraOp interface {
 	// LookupFileById looks up a file by its id.
@@ -8,12 +12,24 @@ type DraOp interface {
 	// LookupFileByMd5 looks up a file by its md5.
 	LookupFileByMd5(md5 string, domain int64) (*File, error)
 
+	// LookupFileBySha256 looks up a file by its sha256.
+	LookupFileBySha256(sha256 string, domain int64) (*File, error)
+
 	// SaveFile saves a file.
 	SaveFile(f *File) error
 
 	// RemoveFile removes a file by its id.
 	RemoveFile(id string) error
 
+	// UpdateFileAttrs updates attributes of a file.
+	UpdateFileAttrs(id string, domain int64, attrs map[string]string) error
+
+	// UpdateDuplAttrs updates attributes of a dupl.
+	UpdateDuplAttrs(id string, attrs map[string]string) error
+
+	// ListFiles lists files which match the filter, starts from pageState.
+	ListFiles(filter *meta.FileFilter, pageState []byte, limit int) ([]*File, []byte, error)
+
 	// SaveDupl saves a dupl.
 	SaveDupl(dupl *Dupl) error
 
@@ -26,6 +42,9 @@ type DraOp interface {
 	// RemoveDupl removes a dupl by its id.
 	RemoveDupl(id string) error
 
+	// ListDupls lists dupls which match the filter, starts from pageState.
+	ListDupls(filter *meta.FileFilter, pageState []byte, limit int) ([]*Dupl, []byte, error)
+
 	// SaveRef saves a reference.
 	SaveRef(ref *Ref) error
 
@@ -38,17 +38,24 @@ const (
 )
 
 const (
-	cqlSaveDupl          = `INSERT INTO dupl (id, domain, size, refid, cdate) VALUES (?, ?, ?, ?, ?)`
+	cqlSaveDupl          = `INSERT INTO dupl (id, domain, size, refid, cdate, attrs) VALUES (?, ?, ?, ?, ?, ?)`
 	cqlLookupDuplById    = `SELECT * FROM dupl WHERE id = ?`
 	cqlLookupDuplByRefid = `SELECT * FROM dupl WHERE refid = ?`
 	cqlRemoveDupl        = `DELETE FROM dupl WHERE id = ?`
+	cqlListDupls         = `SELECT id, refid, size, cdate, domain, attrs FROM duplda WHERE domain = ?`
+	cqlPutDuplAttrs      = `UPDATE dupl SET attrs = attrs + ? WHERE id = ?`
+	cqlDelDuplAttrs      = `UPDATE dupl SET attrs = attrs - ? WHERE id = ?`
 	cqlLookupRefById     = `SELECT * FROM rc WHERE id = ?`
 	cqlRemoveRef         = `DELETE FROM rc WHERE id = ?`
 	cqlUpdateRefCnt      = `UPDATE rc SET refcnt = refcnt + %d WHERE id = ?`
 	cqlLookupFileById    = `SELECT * FROM files WHERE id = ?`
 	calLookupFileByMd5   = `SELECT * FROM md5 WHERE md5 = ? AND domain = ?`
-	cqlSaveFile          = `INSERT INTO files (id, biz, cksize, domain, fn, size, md5, udate, uid, type, attrs) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	cqlLookupFileBySha   = `SELECT * FROM sha256a WHERE sha256 = ? AND domain = ?`
+	cqlSaveFile          = `INSERT INTO files (id, biz, cksize, domain, fn, size, md5, sha256, udate, uid, type, attrs) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	cqlRemoveFile        = `DELETE FROM files WHERE id = ?`
+	cqlPutFileAttrs      = `UPDATE files SET attrs = attrs + ? WHERE id = ? AND domain = ?`
+	cqlDelFileAttrs      = `UPDATE files SET attrs = attrs - ? WHERE id = ? AND domain = ?`
+	cqlListFiles         = `SELECT id, biz, cksize, domain, fn, size, md5, sha256, udate, uid, type, attrs FROM domaina WHERE domain = ?`
 
 	cqlTouchHealth = `INSERT INTO health (id, magic) VALUES (?, ?)`
 	cqlCheckHealth = `SELECT * FROM health WHERE id = ?`
@@ -66,6 +73,7 @@ type File struct {
 	Name       string            `cql:"fn"`
 	Size       int64             `cql:"size"`
 	Md5        string            `cql:"md5"`
+	Sha256     string            `cql:"sha256"`
 	UploadDate time.Time         `cql:"udate"`
 	UserId     string            `cql:"uid"`
 	Metadata   map[string]string `cql:"attrs"`
@@ -74,11 +82,12 @@ type File struct {
 
 // Dupl represents the metadata of a file duplication.
 type Dupl struct {
-	Id         string    `cql:"id"`
-	Ref        string    `cql:"refid"`
-	Length     int64     `cql:"size"`
-	CreateDate time.Time `cql:"cdate"`
-	Domain     int64     `cql:"domain"`
+	Id         string            `cql:"id"`
+	Ref        string            `cql:"refid"`
+	Length     int64             `cql:"size"`
+	CreateDate time.Time         `cql:"cdate"`
+	Domain     int64             `cql:"domain"`
+	Attrs      map[string]string `cql:"attrs"`
 }
 
 // Ref represents another metadata of a file duplication.
@@ -286,6 +295,24 @@ func (op *DraOpImpl) LookupFileByMd5(md5 string, domain int64) (*File, error) {
 	return f, err
 }
 
+// LookupFileBySha256 looks up a file by its sha256.
+func (op *DraOpImpl) LookupFileBySha256(sha256 string, domain int64) (*File, error) {
+	f := &File{}
+	err := op.execute(func(session *gocql.Session) error {
+		q := session.Query(cqlLookupFileBySha, sha256, domain)
+		b := cqlr.BindQuery(q)
+		defer b.Close()
+
+		if b.Scan(f) {
+			return nil
+		}
+
+		return meta.FileNotFound
+	})
+
+	return f, err
+}
+
 // SaveFile saves a file.
 func (op *DraOpImpl) SaveFile(f *File) error {
 	if f.Type == EntityNone {
@@ -305,6 +332,152 @@ func (op *DraOpImpl) RemoveFile(id string) error {
 	})
 }
 
+// UpdateFileAttrs updates attributes of a file.
+// An attribute with empty value will be removed.
+func (op *DraOpImpl) UpdateFileAttrs(id string, domain int64, attrs map[string]string) error {
+	put, del := splitAttrs(attrs)
+
+	return op.execute(func(session *gocql.Session) error {
+		if len(put) > 0 {
+			if err := session.Query(cqlPutFileAttrs, put, id, domain).Exec(); err != nil {
+				return err
+			}
+		}
+		if len(del) > 0 {
+			return session.Query(cqlDelFileAttrs, del, id, domain).Exec()
+		}
+		return nil
+	})
+}
+
+// UpdateDuplAttrs updates attributes of a dupl, the dupl must exist.
+func (op *DraOpImpl) UpdateDuplAttrs(id string, attrs map[string]string) error {
+	put, del := splitAttrs(attrs)
+
+	return op.execute(func(session *gocql.Session) error {
+		if len(put) > 0 {
+			if err := session.Query(cqlPutDuplAttrs, put, id).Exec(); err != nil {
+				return err
+			}
+		}
+		if len(del) > 0 {
+			return session.Query(cqlDelDuplAttrs, del, id).Exec()
+		}
+		return nil
+	})
+}
+
+// splitAttrs splits attributes into the ones to put and the keys
+// to delete, which have empty values.
+func splitAttrs(attrs map[string]string) (map[string]string, []string) {
+	put := make(map[string]string)
+	del := make([]string, 0, len(attrs))
+	for k, v := range attrs {
+		if len(v) == 0 {
+			del = append(del, k)
+			continue
+		}
+		put[k] = v
+	}
+
+	return put, del
+}
+
+// ListFiles lists files which match the filter, in descending order of
+// upload date. It starts from the given paging state and returns the
+// paging state for next page, which is nil if there is no more file.
+func (op *DraOpImpl) ListFiles(filter *meta.FileFilter, pageState []byte, limit int) ([]*File, []byte, error) {
+	stmt := cqlListFiles
+	values := []interface{}{filter.Domain}
+	if !filter.Start.IsZero() {
+		stmt += " AND udate >= ?"
+		values = append(values, filter.Start)
+	}
+	if !filter.End.IsZero() {
+		stmt += " AND udate < ?"
+		values = append(values, filter.End)
+	}
+
+	// uid and biz are not in the primary key of view.
+	filtering := false
+	if len(filter.UserId) > 0 {
+		stmt += " AND uid = ?"
+		values = append(values, filter.UserId)
+		filtering = true
+	}
+	if len(filter.Biz) > 0 {
+		stmt += " AND biz = ?"
+		values = append(values, filter.Biz)
+		filtering = true
+	}
+	if filtering {
+		stmt += " ALLOW FILTERING"
+	}
+
+	result := make([]*File, 0, limit)
+	var next []byte
+
+	err := op.execute(func(session *gocql.Session) error {
+		iter := session.Query(stmt, values...).PageSize(limit).PageState(pageState).Iter()
+
+		for i := iter.NumRows(); i > 0; i-- {
+			f := &File{}
+			if !iter.Scan(&f.Id, &f.Biz, &f.ChunkSize, &f.Domain, &f.Name, &f.Size, &f.Md5, &f.Sha256, &f.UploadDate, &f.UserId, &f.Type, &f.Metadata) {
+				break
+			}
+			result = append(result, f)
+		}
+		next = iter.PageState()
+
+		return iter.Close()
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return result, next, nil
+}
+
+// ListDupls lists dupls of the domain of filter, which are created in
+// the time range of filter, in descending order of create date, starts
+// from pageState. Filter of user and biz is not applied, since they
+// are the entity's.
+func (op *DraOpImpl) ListDupls(filter *meta.FileFilter, pageState []byte, limit int) ([]*Dupl, []byte, error) {
+	stmt := cqlListDupls
+	values := []interface{}{filter.Domain}
+	if !filter.Start.IsZero() {
+		stmt += " AND cdate >= ?"
+		values = append(values, filter.Start)
+	}
+	if !filter.End.IsZero() {
+		stmt += " AND cdate < ?"
+		values = append(values, filter.End)
+	}
+
+	result := make([]*Dupl, 0, limit)
+	var next []byte
+
+	err := op.execute(func(session *gocql.Session) error {
+		iter := session.Query(stmt, values...).PageSize(limit).PageState(pageState).Iter()
+
+		for i := iter.NumRows(); i > 0; i-- {
+			d := &Dupl{}
+			if !iter.Scan(&d.Id, &d.Ref, &d.Length, &d.CreateDate, &d.Domain, &d.Attrs) {
+				break
+			}
+			result = append(result, d)
+		}
+		next = iter.PageState()
+
+		return iter.Close()
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return result, next, nil
+}
+
 // Health checks the health of cql.
 func (op *DraOpImpl) HealthCheck(node string) error {
 	magic := time.Now().Unix()
@@ -1,6 +1,8 @@
 package cassandra
 
 import (
+	"encoding/base64"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
@@ -31,6 +33,16 @@ func (dupldra *DuplDra) FindByMd5(md5 string, domain int64) (*meta.File, error)
 	return MetaFile(f), nil
 }
 
+// FindBySha256 finds a file by its sha256.
+func (dupldra *DuplDra) FindBySha256(sha256 string, domain int64) (*meta.File, error) {
+	f, err := dupldra.LookupFileBySha256(sha256, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	return MetaFile(f), nil
+}
+
 // Find finds a file with given id.
 func (dupldra *DuplDra) Find(fid string) (*meta.File, error) {
 	draFile, err := dupldra.search(fid)
@@ -58,7 +70,16 @@ func (dupldra *DuplDra) search(givenId string) (*File, error) {
 		return nil, meta.FileNotFound
 	}
 
-	return dupldra.LookupFileById(dupl.Ref)
+	f, err := dupldra.LookupFileById(dupl.Ref)
+	if err != nil {
+		return nil, err
+	}
+
+	// A duplication has its own user attributes.
+	df := *f
+	df.Metadata = meta.DuplExtAttrs(f.Metadata, dupl.Attrs)
+
+	return &df, nil
 }
 
 // Duplicate duplicates an entry for a file, not the content.
@@ -82,12 +103,14 @@ func (dupldra *DuplDra) DuplicateWithId(fid string, dupId string, createDate tim
 		return "", err
 	}
 
+	// User attributes are copied from the file duplicated.
 	dupl := Dupl{
 		Id:         util.GetRealId(dupId),
 		Ref:        ref.Id,
 		Length:     primary.Size,
 		Domain:     primary.Domain,
 		CreateDate: createDate,
+		Attrs:      meta.DuplExtAttrs(nil, primary.Metadata),
 	}
 
 	if err := dupldra.SaveDupl(&dupl); err != nil {
@@ -196,6 +219,114 @@ func (dupldra *DuplDra) decAndRemove(id string) (int64, error) {
 	return ref.RefCnt, nil
 }
 
+// UpdateAttrs updates ext attributes of a file by its fid.
+// Attributes of a duplication are its own, not shared with the entity.
+func (dupldra *DuplDra) UpdateAttrs(fid string, attrs map[string]string) error {
+	if util.IsDuplId(fid) {
+		dupl, err := dupldra.LookupDuplById(util.GetRealId(fid))
+		if err != nil {
+			return err
+		}
+		if dupl == nil {
+			return meta.FileNotFound
+		}
+
+		return dupldra.UpdateDuplAttrs(dupl.Id, attrs)
+	}
+
+	f, err := dupldra.search(fid)
+	if err != nil {
+		return err
+	}
+	if f == nil {
+		return meta.FileNotFound
+	}
+
+	return dupldra.UpdateFileAttrs(f.Id, f.Domain, attrs)
+}
+
+// duplCursorPrefix prefixes the cursor of listing dupls.
+const duplCursorPrefix = "d."
+
+// List lists files which match the filter, starts after cursor.
+// The entities are listed first, then the duplications with their
+// own ids. The cursor is the encoded paging state of cassandra,
+// prefixed with duplCursorPrefix while listing duplications.
+func (dupldra *DuplDra) List(filter *meta.FileFilter, cursor string, limit int) ([]*meta.File, string, error) {
+	if strings.HasPrefix(cursor, duplCursorPrefix) {
+		return dupldra.listDupls(filter, strings.TrimPrefix(cursor, duplCursorPrefix), limit)
+	}
+
+	pageState, err := base64.URLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	files, next, err := dupldra.ListFiles(filter, pageState, limit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	result := make([]*meta.File, 0, len(files))
+	for _, f := range files {
+		result = append(result, MetaFile(f))
+	}
+
+	if len(next) == 0 {
+		// Entities are done, turns to duplications.
+		return result, duplCursorPrefix, nil
+	}
+
+	return result, base64.URLEncoding.EncodeToString(next), nil
+}
+
+// listDupls lists duplications which match the filter, the ones of
+// entities themselves are skipped.
+func (dupldra *DuplDra) listDupls(filter *meta.FileFilter, cursor string, limit int) ([]*meta.File, string, error) {
+	pageState, err := base64.URLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	dupls, next, err := dupldra.ListDupls(filter, pageState, limit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	result := make([]*meta.File, 0, len(dupls))
+	for _, d := range dupls {
+		if d.Id == d.Ref {
+			continue
+		}
+
+		f, err := dupldra.LookupFileById(d.Ref)
+		if err == meta.FileNotFound {
+			glog.V(4).Infof("Entity %s of dupl %s not found.", d.Ref, d.Id)
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		if (len(filter.UserId) > 0 && f.UserId != filter.UserId) ||
+			(len(filter.Biz) > 0 && f.Biz != filter.Biz) {
+			continue
+		}
+
+		mf := MetaFile(f)
+		mf.Id = util.GetDuplId(d.Id)
+		mf.UploadDate = d.CreateDate
+		mf.ExtAttr = meta.DuplExtAttrs(f.Metadata, d.Attrs)
+		result = append(result, mf)
+	}
+
+	if len(next) == 0 {
+		return result, "", nil
+	}
+
+	return result, duplCursorPrefix + base64.URLEncoding.EncodeToString(next), nil
+}
+
 func (dupldra *DuplDra) LookupFileMeta(id string) (*meta.File, error) {
 	f, err := dupldra.LookupFileById(id)
 	if err != nil {
@@ -222,3 +222,66 @@ func TestDraDeleteFalse(t *testing.T) {
 		So(eid, ShouldEqual, "")
 	})
 }
+
+func TestDraList(t *testing.T) {
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	mockDraOp := NewMockDraOp(ctl)
+	duplDra := NewDuplDra(mockDraOp)
+
+	filter := &meta.FileFilter{Domain: 2}
+	selfDupl := &Dupl{
+		Id:     draFileOk.Id,
+		Ref:    draFileOk.Id,
+		Domain: 2,
+	}
+
+	mockDraOp.EXPECT().ListFiles(gomock.Eq(filter), gomock.Eq([]byte{}), gomock.Eq(10)).Return([]*File{draFileOk}, nil, nil)
+	mockDraOp.EXPECT().ListDupls(gomock.Eq(filter), gomock.Eq([]byte{}), gomock.Eq(10)).Return([]*Dupl{selfDupl, dupl}, nil, nil)
+	mockDraOp.EXPECT().LookupFileById(gomock.Eq(dupl.Ref)).Return(draFileOk, nil)
+
+	Convey("List entities, then duplications.", t, func() {
+		files, next, err := duplDra.List(filter, "", 10)
+		So(err, ShouldBeNil)
+		So(len(files), ShouldEqual, 1)
+		So(files[0].Id, ShouldEqual, draFileOk.Id)
+		So(next, ShouldEqual, duplCursorPrefix)
+
+		files, next, err = duplDra.List(filter, next, 10)
+		So(err, ShouldBeNil)
+		So(len(files), ShouldEqual, 1)
+		So(files[0].Id, ShouldEqual, util.GetDuplId(dupl.Id))
+		So(files[0].Md5, ShouldEqual, draFileOk.Md5)
+		So(next, ShouldEqual, "")
+	})
+}
+
+func TestDraDuplAttrs(t *testing.T) {
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	mockDraOp := NewMockDraOp(ctl)
+	duplDra := NewDuplDra(mockDraOp)
+
+	entity := *draFileOk
+	entity.Metadata = map[string]string{"user.k": "entity", "expiretime": "1"}
+	rDupl := *dupl
+	rDupl.Attrs = map[string]string{"user.k": "dupl"}
+	attrs := map[string]string{"user.k": "new"}
+
+	mockDraOp.EXPECT().LookupDuplById(rDupl.Id).Return(&rDupl, nil).Times(2)
+	mockDraOp.EXPECT().LookupFileById(rDupl.Ref).Return(&entity, nil)
+	mockDraOp.EXPECT().UpdateDuplAttrs(rDupl.Id, gomock.Eq(attrs)).Return(nil)
+
+	Convey("Attributes of a duplication are its own.", t, func() {
+		f, err := duplDra.Find(util.GetDuplId(rDupl.Id))
+		So(err, ShouldBeNil)
+		So(f.ExtAttr["user.k"], ShouldEqual, "dupl")
+		So(f.ExtAttr["expiretime"], ShouldEqual, "1")
+		So(entity.Metadata["user.k"], ShouldEqual, "entity")
+
+		err = duplDra.UpdateAttrs(util.GetDuplId(rDupl.Id), attrs)
+		So(err, ShouldBeNil)
+	})
+}
@@ -7,6 +7,7 @@ import (
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
+	meta "jingoal.com/dfs/meta"
 )
 
 // MockDraOp is a mock of DraOp interface
@@ -58,6 +59,19 @@ func (_mr *MockDraOpMockRecorder) LookupFileByMd5(arg0, arg1 interface{}) *gomoc
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "LookupFileByMd5", reflect.TypeOf((*MockDraOp)(nil).LookupFileByMd5), arg0, arg1)
 }
 
+// LookupFileBySha256 mocks base method
+func (_m *MockDraOp) LookupFileBySha256(sha256 string, domain int64) (*File, error) {
+	ret := _m.ctrl.Call(_m, "LookupFileBySha256", sha256, domain)
+	ret0, _ := ret[0].(*File)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LookupFileBySha256 indicates an expected call of LookupFileBySha256
+func (_mr *MockDraOpMockRecorder) LookupFileBySha256(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "LookupFileBySha256", reflect.TypeOf((*MockDraOp)(nil).LookupFileBySha256), arg0, arg1)
+}
+
 // SaveFile mocks base method
 func (_m *MockDraOp) SaveFile(f *File) error {
 	ret := _m.ctrl.Call(_m, "SaveFile", f)
@@ -82,6 +96,44 @@ func (_mr *MockDraOpMockRecorder) RemoveFile(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "RemoveFile", reflect.TypeOf((*MockDraOp)(nil).RemoveFile), arg0)
 }
 
+// UpdateFileAttrs mocks base method
+func (_m *MockDraOp) UpdateFileAttrs(id string, domain int64, attrs map[string]string) error {
+	ret := _m.ctrl.Call(_m, "UpdateFileAttrs", id, domain, attrs)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateFileAttrs indicates an expected call of UpdateFileAttrs
+func (_mr *MockDraOpMockRecorder) UpdateFileAttrs(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "UpdateFileAttrs", reflect.TypeOf((*MockDraOp)(nil).UpdateFileAttrs), arg0, arg1, arg2)
+}
+
+// UpdateDuplAttrs mocks base method
+func (_m *MockDraOp) UpdateDuplAttrs(id string, attrs map[string]string) error {
+	ret := _m.ctrl.Call(_m, "UpdateDuplAttrs", id, attrs)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateDuplAttrs indicates an expected call of UpdateDuplAttrs
+func (_mr *MockDraOpMockRecorder) UpdateDuplAttrs(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "UpdateDuplAttrs", reflect.TypeOf((*MockDraOp)(nil).UpdateDuplAttrs), arg0, arg1)
+}
+
+// ListFiles mocks base method
+func (_m *MockDraOp) ListFiles(filter *meta.FileFilter, pageState []byte, limit int) ([]*File, []byte, error) {
+	ret := _m.ctrl.Call(_m, "ListFiles", filter, pageState, limit)
+	ret0, _ := ret[0].([]*File)
+	ret1, _ := ret[1].([]byte)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ListFiles indicates an expected call of ListFiles
+func (_mr *MockDraOpMockRecorder) ListFiles(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "ListFiles", reflect.TypeOf((*MockDraOp)(nil).ListFiles), arg0, arg1, arg2)
+}
+
 // SaveDupl mocks base method
 func (_m *MockDraOp) SaveDupl(dupl *Dupl) error {
 	ret := _m.ctrl.Call(_m, "SaveDupl", dupl)
@@ -131,6 +183,20 @@ func (_mr *MockDraOpMockRecorder) RemoveDupl(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "RemoveDupl", reflect.TypeOf((*MockDraOp)(nil).RemoveDupl), arg0)
 }
 
+// ListDupls mocks base method
+func (_m *MockDraOp) ListDupls(filter *meta.FileFilter, pageState []byte, limit int) ([]*Dupl, []byte, error) {
+	ret := _m.ctrl.Call(_m, "ListDupls", filter, pageState, limit)
+	ret0, _ := ret[0].([]*Dupl)
+	ret1, _ := ret[1].([]byte)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ListDupls indicates an expected call of ListDupls
+func (_mr *MockDraOpMockRecorder) ListDupls(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "ListDupls", reflect.TypeOf((*MockDraOp)(nil).ListDupls), arg0, arg1, arg2)
+}
+
 // SaveRef mocks base method
 func (_m *MockDraOp) SaveRef(ref *Ref) error {
 	ret := _m.ctrl.Call(_m, "SaveRef", ref)
@@ -12,6 +12,7 @@ func MetaFile(f *File) *meta.File {
 		Biz:        f.Biz,
 		Name:       f.Name,
 		Md5:        f.Md5,
+		Sha256:     f.Sha256,
 		UserId:     f.UserId,
 		Domain:     f.Domain,
 		Size:       f.Size,
@@ -32,6 +33,7 @@ func DraFile(m *meta.File) *File {
 		Biz:        m.Biz,
 		Name:       m.Name,
 		Md5:        m.Md5,
+		Sha256:     m.Sha256,
 		UserId:     m.UserId,
 		Domain:     m.Domain,
 		Size:       m.Size,
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"strconv"
+
+	"golang.org/x/net/context"
+
+	"jingoal.com/dfs/proto/admin"
+)
+
+// withAdmin calls f with a client of admin service.
+func withAdmin(f func(client admin.AdminClient) error) error {
+	conn, err := dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return f(admin.NewAdminClient(conn))
+}
+
+// subCommand returns the sub command and its args, "list" by default.
+func subCommand(args []string) (string, []string) {
+	if len(args) == 0 {
+		return "list", args
+	}
+
+	return args[0], args[1:]
+}
+
+// readShard reads a shard from json file given by flag -f.
+func readShard(name string, args []string) (*admin.Shard, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	file := fs.String("f", "", "json file of shard")
+	if err := fs.Parse(args); err != nil || *file == "" {
+		return nil, errUsage
+	}
+
+	b, err := ioutil.ReadFile(*file)
+	if err != nil {
+		return nil, err
+	}
+
+	shard := new(admin.Shard)
+	if err := json.Unmarshal(b, shard); err != nil {
+		return nil, err
+	}
+
+	return shard, nil
+}
+
+func shards(ctx context.Context, args []string) error {
+	sub, args := subCommand(args)
+
+	return withAdmin(func(client admin.AdminClient) error {
+		switch sub {
+		case "list":
+			rep, err := client.ListShards(ctx, &admin.ListShardsReq{})
+			if err != nil {
+				return err
+			}
+			return printJSON(rep)
+		case "add", "update":
+			shard, err := readShard(sub, args)
+			if err != nil {
+				return err
+			}
+
+			var rep *admin.PutShardRep
+			if sub == "add" {
+				rep, err = client.AddShard(ctx, &admin.PutShardReq{Shard: shard})
+			} else {
+				rep, err = client.UpdateShard(ctx, &admin.PutShardReq{Shard: shard})
+			}
+			if err != nil {
+				return err
+			}
+			return printJSON(rep.Shard)
+		case "rm":
+			if len(args) != 1 {
+				return errUsage
+			}
+			rep, err := client.RemoveShard(ctx, &admin.RemoveShardReq{Name: args[0]})
+			if err != nil {
+				return err
+			}
+			return printJSON(rep)
+		}
+
+		return errUsage
+	})
+}
+
+// readSegment reads a segment from flags.
+func readSegment(name string, args []string) (*admin.Segment, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	domain := fs.Int64("domain", 0, "the first domain of segment")
+	normal := fs.String("normal", "", "name of normal shard")
+	migrate := fs.String("migrate", "", "name of shard migrating to, empty for none")
+	if err := fs.Parse(args); err != nil || *domain <= 0 || *normal == "" {
+		return nil, errUsage
+	}
+
+	return &admin.Segment{
+		Domain:        *domain,
+		NormalServer:  *normal,
+		MigrateServer: *migrate,
+	}, nil
+}
+
+func segments(ctx context.Context, args []string) error {
+	sub, args := subCommand(args)
+
+	return withAdmin(func(client admin.AdminClient) error {
+		switch sub {
+		case "list":
+			rep, err := client.ListSegments(ctx, &admin.ListSegmentsReq{})
+			if err != nil {
+				return err
+			}
+			return printJSON(rep.Segments)
+		case "add", "update":
+			seg, err := readSegment(sub, args)
+			if err != nil {
+				return err
+			}
+
+			var rep *admin.PutSegmentRep
+			if sub == "add" {
+				rep, err = client.AddSegment(ctx, &admin.PutSegmentReq{Segment: seg})
+			} else {
+				rep, err = client.UpdateSegment(ctx, &admin.PutSegmentReq{Segment: seg})
+			}
+			if err != nil {
+				return err
+			}
+			return printJSON(rep.Segment)
+		case "rm":
+			if len(args) != 1 {
+				return errUsage
+			}
+			domain, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return errUsage
+			}
+			rep, err := client.RemoveSegment(ctx, &admin.RemoveSegmentReq{Domain: domain})
+			if err != nil {
+				return err
+			}
+			return printJSON(rep)
+		}
+
+		return errUsage
+	})
+}
+
+// updateFeatureFlag updates f with the flags set in args.
+func updateFeatureFlag(f *admin.FeatureFlag, args []string) error {
+	fs := flag.NewFlagSet("set", flag.ContinueOnError)
+	enabled := fs.Bool("enabled", f.Enabled, "true for enabled")
+	domains := fs.String("domains", "", "domains given access, separated by comma")
+	groups := fs.String("groups", "", "groups given access, separated by comma")
+	percentage := fs.Uint("percentage", uint(f.Percentage), "percentage of domains given access")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+
+	var err error
+	fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "enabled":
+			f.Enabled = *enabled
+		case "domains":
+			f.Domains = make([]uint32, 0)
+			for _, item := range splitList(*domains) {
+				d, er := strconv.ParseUint(item, 10, 32)
+				if er != nil {
+					err = errUsage
+					return
+				}
+				f.Domains = append(f.Domains, uint32(d))
+			}
+		case "groups":
+			f.Groups = splitList(*groups)
+		case "percentage":
+			f.Percentage = uint32(*percentage)
+		}
+	})
+
+	return err
+}
+
+func featureFlags(ctx context.Context, args []string) error {
+	sub, args := subCommand(args)
+
+	return withAdmin(func(client admin.AdminClient) error {
+		switch sub {
+		case "list":
+			rep, err := client.ListFeatureFlags(ctx, &admin.ListFeatureFlagsReq{})
+			if err != nil {
+				return err
+			}
+			return printJSON(rep.Flags)
+		case "get", "set":
+			if len(args) == 0 {
+				return errUsage
+			}
+			rep, err := client.GetFeatureFlag(ctx, &admin.GetFeatureFlagReq{Key: args[0]})
+			if err != nil {
+				return err
+			}
+			if sub == "get" {
+				return printJSON(rep.Flag)
+			}
+
+			if err := updateFeatureFlag(rep.Flag, args[1:]); err != nil {
+				return err
+			}
+			rep, err = client.SetFeatureFlag(ctx, &admin.SetFeatureFlagReq{Flag: rep.Flag})
+			if err != nil {
+				return err
+			}
+			return printJSON(rep.Flag)
+		}
+
+		return errUsage
+	})
+}
+
+func handler(ctx context.Context, args []string) error {
+	if len(args) != 2 || (args[0] != "up" && args[0] != "down") {
+		return errUsage
+	}
+
+	return withAdmin(func(client admin.AdminClient) error {
+		rep, err := client.SetHandlerStatus(ctx, &admin.SetHandlerStatusReq{
+			Name: args[1],
+			Up:   args[0] == "up",
+		})
+		if err != nil {
+			return err
+		}
+
+		return printJSON(rep.Status)
+	})
+}
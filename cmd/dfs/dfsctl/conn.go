@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// tokenCredentials implements credentials.PerRPCCredentials,
+// which carries token in the metadata of every request.
+type tokenCredentials string
+
+func (t tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{
+		"authorization": "Bearer " + string(t),
+	}, nil
+}
+
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+func clientTLSConfig() (*tls.Config, error) {
+	pem, err := ioutil.ReadFile(*tlsCA)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate in %s", *tlsCA)
+	}
+
+	config := &tls.Config{
+		RootCAs:    pool,
+		ServerName: *tlsName,
+	}
+	if *tlsCert != "" {
+		cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// dial connects to the dfs server.
+func dial() (*grpc.ClientConn, error) {
+	opts := make([]grpc.DialOption, 0, 2)
+
+	if *tlsCA != "" {
+		config, err := clientTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(config)))
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+	}
+
+	if *token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCredentials(*token)))
+	}
+
+	return grpc.Dial(*serverAddr, opts...)
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/net/context"
+
+	"jingoal.com/dfs/proto/transfer"
+)
+
+const defaultChunkSize = 512 * 1024
+
+// withTransfer calls f with a client of file transfer.
+func withTransfer(f func(client transfer.FileTransferClient) error) error {
+	conn, err := dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return f(transfer.NewFileTransferClient(conn))
+}
+
+// parseFileArgs parses the flags of a command on a file,
+// and returns the fid.
+func parseFileArgs(fs *flag.FlagSet, domain *int64, args []string) (string, error) {
+	if err := fs.Parse(args); err != nil {
+		return "", errUsage
+	}
+	if fs.NArg() != 1 || *domain <= 0 {
+		return "", errUsage
+	}
+
+	return fs.Arg(0), nil
+}
+
+func putFile(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("put", flag.ContinueOnError)
+	domain := fs.Int64("domain", 0, "domain of file")
+	biz := fs.String("biz", "", "biz of file")
+	user := fs.Int64("user", 0, "user of file")
+	name := fs.String("name", "", "name of file, default to the base name of path")
+	chunkSize := fs.Int("chunk-size", defaultChunkSize, "size of chunk in bytes")
+	path, err := parseFileArgs(fs, domain, args)
+	if err != nil {
+		return err
+	}
+	if *chunkSize <= 0 {
+		return errUsage
+	}
+	if *name == "" {
+		*name = filepath.Base(path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	md5sum := md5.New()
+	size, err := io.Copy(md5sum, f)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	info := &transfer.FileInfo{
+		Name:   *name,
+		Size:   size,
+		Domain: *domain,
+		User:   *user,
+		Md5:    hex.EncodeToString(md5sum.Sum(nil)),
+		Biz:    *biz,
+	}
+
+	return withTransfer(func(client transfer.FileTransferClient) error {
+		stream, err := client.PutFile(ctx)
+		if err != nil {
+			return err
+		}
+
+		buf := make([]byte, *chunkSize)
+		var pos int64
+		for first := true; ; first = false {
+			n, er := io.ReadFull(f, buf)
+			if er != nil && er != io.EOF && er != io.ErrUnexpectedEOF {
+				return er
+			}
+
+			// The first request carries file info, even if file is empty.
+			if n > 0 || first {
+				req := &transfer.PutFileReq{
+					Chunk: &transfer.Chunk{
+						Pos:     pos,
+						Length:  int64(n),
+						Payload: buf[:n],
+					},
+				}
+				if first {
+					req.Info = info
+				}
+				if err := stream.Send(req); err != nil {
+					return err
+				}
+				pos += int64(n)
+			}
+
+			if er != nil {
+				break
+			}
+		}
+
+		rep, err := stream.CloseAndRecv()
+		if err != nil {
+			return err
+		}
+
+		return printJSON(rep.File)
+	})
+}
+
+func getFile(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	domain := fs.Int64("domain", 0, "domain of file")
+	output := fs.String("o", "", "file to write content, empty for stdout")
+	fid, err := parseFileArgs(fs, domain, args)
+	if err != nil {
+		return err
+	}
+
+	w := io.Writer(os.Stdout)
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	return withTransfer(func(client transfer.FileTransferClient) error {
+		stream, err := client.GetFile(ctx, &transfer.GetFileReq{
+			Id:     fid,
+			Domain: *domain,
+		})
+		if err != nil {
+			return err
+		}
+
+		var info *transfer.FileInfo
+		md5sum := md5.New()
+		for {
+			rep, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+
+			if inf := rep.GetInfo(); inf != nil {
+				info = inf
+				continue
+			}
+			if chunk := rep.GetChunk(); chunk != nil {
+				if _, err := w.Write(chunk.Payload); err != nil {
+					return err
+				}
+				md5sum.Write(chunk.Payload)
+			}
+		}
+
+		if info != nil && info.Md5 != "" {
+			if m := hex.EncodeToString(md5sum.Sum(nil)); m != info.Md5 {
+				return fmt.Errorf("md5 mismatch, expected %s, got %s", info.Md5, m)
+			}
+		}
+
+		// Content is on stdout if no output file.
+		if *output == "" {
+			return nil
+		}
+		return printJSON(info)
+	})
+}
+
+func statFile(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("stat", flag.ContinueOnError)
+	domain := fs.Int64("domain", 0, "domain of file")
+	fid, err := parseFileArgs(fs, domain, args)
+	if err != nil {
+		return err
+	}
+
+	return withTransfer(func(client transfer.FileTransferClient) error {
+		rep, err := client.Stat(ctx, &transfer.GetFileReq{
+			Id:     fid,
+			Domain: *domain,
+		})
+		if err != nil {
+			return err
+		}
+
+		return printJSON(rep.File)
+	})
+}
+
+func removeFile(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("rm", flag.ContinueOnError)
+	domain := fs.Int64("domain", 0, "domain of file")
+	fid, err := parseFileArgs(fs, domain, args)
+	if err != nil {
+		return err
+	}
+
+	return withTransfer(func(client transfer.FileTransferClient) error {
+		rep, err := client.RemoveFile(ctx, &transfer.RemoveFileReq{
+			Id:     fid,
+			Domain: *domain,
+			Desc: &transfer.ClientDescription{
+				Desc: "dfsctl",
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		return printJSON(rep)
+	})
+}
+
+func duplicateFile(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("dup", flag.ContinueOnError)
+	domain := fs.Int64("domain", 0, "domain of file")
+	fid, err := parseFileArgs(fs, domain, args)
+	if err != nil {
+		return err
+	}
+
+	return withTransfer(func(client transfer.FileTransferClient) error {
+		rep, err := client.Duplicate(ctx, &transfer.DuplicateReq{
+			Id:     fid,
+			Domain: *domain,
+		})
+		if err != nil {
+			return err
+		}
+
+		return printJSON(rep)
+	})
+}
+
+func copyFile(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("copy", flag.ContinueOnError)
+	srcDomain := fs.Int64("src-domain", 0, "domain of source file")
+	dstDomain := fs.Int64("dst-domain", 0, "domain of destination file")
+	dstUid := fs.Int64("dst-uid", 0, "user of destination file")
+	dstBiz := fs.String("dst-biz", "", "biz of destination file")
+	fid, err := parseFileArgs(fs, srcDomain, args)
+	if err != nil {
+		return err
+	}
+	if *dstDomain <= 0 {
+		return errUsage
+	}
+
+	return withTransfer(func(client transfer.FileTransferClient) error {
+		rep, err := client.Copy(ctx, &transfer.CopyReq{
+			SrcFid:    fid,
+			SrcDomain: *srcDomain,
+			DstDomain: *dstDomain,
+			DstUid:    *dstUid,
+			DstBiz:    *dstBiz,
+		})
+		if err != nil {
+			return err
+		}
+
+		return printJSON(rep)
+	})
+}
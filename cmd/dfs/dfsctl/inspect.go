@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"jingoal.com/dfs/metadata"
+	"jingoal.com/dfs/recovery"
+)
+
+// parseLimit parses flag -limit of a command.
+func parseLimit(name string, args []string) (int, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	limit := fs.Int("limit", 100, "max number of records")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 || *limit <= 0 {
+		return 0, errUsage
+	}
+
+	return *limit, nil
+}
+
+// degradations prints the degradation events waiting for recovery.
+func degradations(ctx context.Context, args []string) error {
+	limit, err := parseLimit("degradations", args)
+	if err != nil {
+		return err
+	}
+
+	op, err := recovery.NewRecoveryEventOp(*eventDb, *eventDbUri)
+	if err != nil {
+		return err
+	}
+	defer op.Close()
+
+	events, err := op.GetEventsInBatch(limit, int64(*timeout/time.Millisecond))
+	if err != nil {
+		return err
+	}
+
+	return printJSON(events)
+}
+
+// cacheLogs prints the cache logs pending.
+func cacheLogs(ctx context.Context, args []string) error {
+	limit, err := parseLimit("cachelogs", args)
+	if err != nil {
+		return err
+	}
+
+	op, err := metadata.NewCacheLogOp(*eventDb, *eventDbUri)
+	if err != nil {
+		return err
+	}
+	defer op.Close()
+
+	iter, err := op.GetCacheLogs(limit)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	logs := make([]*metadata.CacheLog, 0, limit)
+	for log := new(metadata.CacheLog); iter.Next(log); log = new(metadata.CacheLog) {
+		logs = append(logs, log)
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	return printJSON(logs)
+}
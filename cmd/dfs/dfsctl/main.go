@@ -0,0 +1,119 @@
+// dfsctl is a command line tool for operating dfs servers,
+// its outputs are in json for scripting.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+var (
+	serverAddr = flag.String("server", "127.0.0.1:10000", "address of dfs server")
+	timeout    = flag.Duration("timeout", 10*time.Minute, "timeout of a command")
+	token      = flag.String("token", "", "token for authentication, empty for none")
+	tlsCA      = flag.String("tls-ca", "", "ca file for verifying server, empty for plaintext")
+	tlsCert    = flag.String("tls-cert", "", "client certificate file for mutual tls")
+	tlsKey     = flag.String("tls-key", "", "client private key file for mutual tls")
+	tlsName    = flag.String("tls-server-name", "", "server name for verifying server certificate")
+	eventDbUri = flag.String("event-dburi", "mongodb://127.0.0.1:27017", "event database uri")
+	eventDb    = flag.String("event-dbname", "dfsevent", "event database name")
+
+	errUsage = errors.New("invalid usage")
+)
+
+// command represents a sub command.
+type command struct {
+	usage string
+	run   func(ctx context.Context, args []string) error
+}
+
+var commands = map[string]*command{
+	"put":          {"put -domain d [-biz b] [-user u] [-name n] file", putFile},
+	"get":          {"get -domain d [-o file] fid", getFile},
+	"stat":         {"stat -domain d fid", statFile},
+	"rm":           {"rm -domain d fid", removeFile},
+	"dup":          {"dup -domain d fid", duplicateFile},
+	"copy":         {"copy -src-domain d -dst-domain d [-dst-uid u] [-dst-biz b] fid", copyFile},
+	"shards":       {"shards [list | add -f shard.json | update -f shard.json | rm name]", shards},
+	"segments":     {"segments [list | add -domain d -normal s [-migrate s] | update ... | rm domain]", segments},
+	"flags":        {"flags [list | get key | set key [-enabled] [-domains 1,2] [-groups a,b] [-percentage p]]", featureFlags},
+	"handler":      {"handler up|down shard", handler},
+	"degradations": {"degradations [-limit n]", degradations},
+	"cachelogs":    {"cachelogs [-limit n]", cacheLogs},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: dfsctl [flags] command [command flags] [args]\n\nCommands:\n")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", commands[name].usage)
+	}
+
+	fmt.Fprintf(os.Stderr, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// printJSON prints v in json to stdout.
+func printJSON(v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(os.Stdout, "%s\n", b)
+	return err
+}
+
+// splitList splits a list separated by comma, empty items are dropped.
+func splitList(s string) []string {
+	result := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %s.\n\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	if err := cmd.run(ctx, flag.Args()[1:]); err != nil {
+		if err == errUsage {
+			fmt.Fprintf(os.Stderr, "Usage: dfsctl %s\n", cmd.usage)
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "%s error: %v\n", flag.Arg(0), err)
+		os.Exit(1)
+	}
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"crypto/tls"
 	"flag"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
@@ -10,11 +12,15 @@ import (
 	"time"
 
 	"github.com/golang/glog"
+	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health/grpc_health_v1"
 
 	"jingoal.com/dfs/conf"
 	"jingoal.com/dfs/instrument"
 	"jingoal.com/dfs/notice"
+	"jingoal.com/dfs/proto/admin"
 	"jingoal.com/dfs/proto/discovery"
 	"jingoal.com/dfs/proto/transfer"
 	"jingoal.com/dfs/server"
@@ -25,6 +31,8 @@ var (
 	serverId = flag.String("server-name", "test-dfs-svr", "unique name")
 
 	lsnAddr          = flag.String("listen-addr", ":10000", "listen address")
+	httpAddr         = flag.String("http-addr", "", "listen address of http gateway, empty for disabled")
+	s3Addr           = flag.String("s3-addr", "", "listen address of s3 gateway, empty for disabled, which requires auth-enabled")
 	zkAddr           = flag.String("zk-addr", "127.0.0.1:2181", "zookeeper address")
 	zkTimeout        = flag.Uint("zk-timeout", 15000, "zookeeper timeout")
 	shardDbName      = flag.String("shard-name", "shard", "shard database name")
@@ -36,6 +44,10 @@ var (
 	logFlushInterval = flag.Uint("log-flush-interval", 10, "interval of glog print in second.")
 	compress         = flag.Bool("compress", false, "compressing transfer file")
 	concurrency      = flag.Uint("concurrency", 0, "Concurrency")
+	tlsCert          = flag.String("tls-cert", "", "certificate file of tls, empty for plaintext")
+	tlsKey           = flag.String("tls-key", "", "private key file of tls")
+	tlsClientCA      = flag.String("tls-client-ca", "", "ca file for verifying client certificates, empty for no mutual tls")
+	adminEnabled     = flag.Bool("admin-enabled", false, "true for serving admin service, which requires auth-enabled")
 
 	VERSION   = "2.0"
 	buildTime = ""
@@ -72,6 +84,21 @@ func checkFlags() {
 	if *concurrency < 0 {
 		*concurrency = 0
 	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		glog.Exit("Flags --tls-cert and --tls-key are required together.")
+	}
+	if *tlsClientCA != "" && *tlsCert == "" {
+		glog.Exit("Flag --tls-client-ca requires --tls-cert.")
+	}
+	if *server.HTTPWritable && !*server.AuthEnabled {
+		glog.Exit("Flag --http-writable requires --auth-enabled.")
+	}
+	if *s3Addr != "" && !*server.AuthEnabled {
+		glog.Exit("Flag --s3-addr requires --auth-enabled.")
+	}
+	if *adminEnabled && !*server.AuthEnabled {
+		glog.Exit("Flag --admin-enabled requires --auth-enabled.")
+	}
 }
 
 func init() {
@@ -135,12 +162,64 @@ func main() {
 		sopts = append(sopts, grpc.RPCDecompressor(grpc.NewGZIPDecompressor()))
 	}
 
-	sopts = append(sopts, grpc.UnaryInterceptor(util.UnaryRecoverServerInterceptor))
-	sopts = append(sopts, grpc.StreamInterceptor(util.StreamRecoverServerInterceptor))
+	var tlsConfig *tls.Config
+	if *tlsCert != "" {
+		tlsConfig, err = util.NewServerTLSConfig(*tlsCert, *tlsKey, *tlsClientCA)
+		if err != nil {
+			glog.Exitf("failed to load tls certificate %v", err)
+		}
+		sopts = append(sopts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		glog.Infof("TLS enabled, mutual %t", *tlsClientCA != "")
+	}
+
+	sopts = append(sopts, grpc.UnaryInterceptor(util.ChainUnaryServerInterceptors(
+		util.UnaryRecoverServerInterceptor,
+		util.NewUnaryLimitServerInterceptor(dfsServer.Authorize),
+		util.NewUnaryLimitServerInterceptor(server.LimitRequest),
+	)))
+	sopts = append(sopts, grpc.StreamInterceptor(util.ChainStreamServerInterceptors(
+		util.StreamRecoverServerInterceptor,
+		util.NewStreamLimitServerInterceptor(dfsServer.Authorize),
+		util.NewStreamLimitServerInterceptor(server.LimitRequest),
+	)))
 
 	grpcServer := grpc.NewServer(sopts...)
 	transfer.RegisterFileTransferServer(grpcServer, dfsServer)
 	discovery.RegisterDiscoveryServiceServer(grpcServer, dfsServer)
+	grpc_health_v1.RegisterHealthServer(grpcServer, dfsServer)
+	if *adminEnabled {
+		admin.RegisterAdminServer(grpcServer, dfsServer)
+	}
+
+	var httpServer *http.Server
+	if *httpAddr != "" {
+		httpServer = &http.Server{
+			Addr:      *httpAddr,
+			Handler:   server.NewHTTPGateway(dfsServer),
+			TLSConfig: tlsConfig,
+		}
+		go func() {
+			glog.Infof("HTTP gateway listened on %s, writable %t", *httpAddr, *server.HTTPWritable)
+			if err := listenAndServe(httpServer); err != nil && err != http.ErrServerClosed {
+				glog.Warningf("HTTP gateway stopped, %v", err)
+			}
+		}()
+	}
+
+	var s3Server *http.Server
+	if *s3Addr != "" {
+		s3Server = &http.Server{
+			Addr:      *s3Addr,
+			Handler:   server.NewS3Gateway(dfsServer),
+			TLSConfig: tlsConfig,
+		}
+		go func() {
+			glog.Infof("S3 gateway listened on %s", *s3Addr)
+			if err := listenAndServe(s3Server); err != nil && err != http.ErrServerClosed {
+				glog.Warningf("S3 gateway stopped, %v", err)
+			}
+		}()
+	}
 
 	glog.Flush()
 
@@ -148,6 +227,7 @@ func main() {
 		select {
 		case <-term:
 			glog.Infoln("Start to shutdown DFS server ...")
+			dfsServer.Drain()
 			dfsServer.Unregister()
 
 			go func() {
@@ -174,6 +254,12 @@ func main() {
 				}
 			}()
 
+			if httpServer != nil {
+				httpServer.Shutdown(context.Background())
+			}
+			if s3Server != nil {
+				s3Server.Shutdown(context.Background())
+			}
 			grpcServer.GracefulStop()
 
 			retire <- true
@@ -188,6 +274,16 @@ func main() {
 	glog.Flush()
 }
 
+// listenAndServe serves an http server, with tls if configured
+// the same as gRPC.
+func listenAndServe(s *http.Server) error {
+	if s.TLSConfig != nil {
+		return s.ListenAndServeTLS("", "")
+	}
+
+	return s.ListenAndServe()
+}
+
 func flushLogDaemon() {
 	for range time.Tick(time.Duration(*logFlushInterval) * time.Second) {
 		glog.Flush()
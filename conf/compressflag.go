@@ -0,0 +1,35 @@
+package conf
+
+import (
+	"github.com/golang/glog"
+)
+
+// Create a feature flag to work together with storage compression.
+
+const (
+	// Flag to enable/disable compression of stored files.
+	// Domains of the flag are domains, and groups of it are biz names.
+	FlagKeyCompress = "compress"
+)
+
+func initCompressFlag() {
+	PutFlag(&FeatureFlag{
+		Key:        FlagKeyCompress,
+		Enabled:    false,
+		Domains:    []uint32{},
+		Groups:     []string{},
+		Percentage: uint32(0),
+	})
+}
+
+// IsCompressEnabled returns true if the files of domain or biz
+// should be compressed on storing.
+func IsCompressEnabled(domain int64, biz string) bool {
+	ff, err := GetFlag(FlagKeyCompress)
+	if err != nil {
+		glog.Warningf("feature %s error %v", FlagKeyCompress, err)
+		return false
+	}
+
+	return ff.DomainHasAccess(uint32(domain)) || ff.GroupHasAccess(biz)
+}
@@ -0,0 +1,34 @@
+package conf
+
+import (
+	"github.com/golang/glog"
+)
+
+// Create a feature flag to work together with server side deduplication.
+
+const (
+	// Flag to enable/disable deduplication on put file.
+	FlagKeyDedup = "dedup"
+)
+
+func initDedupFlag() {
+	PutFlag(&FeatureFlag{
+		Key:        FlagKeyDedup,
+		Enabled:    false,
+		Domains:    []uint32{},
+		Groups:     []string{},
+		Percentage: uint32(0),
+	})
+}
+
+// IsDedupEnabled returns true if the files put into domain
+// should be deduplicated by server.
+func IsDedupEnabled(domain int64) bool {
+	ff, err := GetFlag(FlagKeyDedup)
+	if err != nil {
+		glog.Warningf("feature %s error %v", FlagKeyDedup, err)
+		return false
+	}
+
+	return ff.DomainHasAccess(uint32(domain))
+}
@@ -0,0 +1,189 @@
+package conf
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DomainDuration implements flag.Value, which holds durations of domains.
+// It is in the form of "domain:duration,domain:duration",
+// for example "1001:72h,1002:720h", and can be updated through conf.
+type DomainDuration struct {
+	lock sync.RWMutex
+	m    map[int64]time.Duration
+}
+
+// String returns the string of value.
+func (d *DomainDuration) String() string {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	result := make([]string, 0, len(d.m))
+	for domain, duration := range d.m {
+		result = append(result, fmt.Sprintf("%d:%s", domain, duration))
+	}
+	sort.Strings(result)
+
+	return strings.Join(result, ",")
+}
+
+// Set parses and sets the value, it replaces the previous value as a whole.
+func (d *DomainDuration) Set(value string) error {
+	m := make(map[int64]time.Duration)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+
+		kv := strings.SplitN(item, ":", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid domain duration %s", item)
+		}
+		domain, err := strconv.ParseInt(strings.TrimSpace(kv[0]), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid domain %s, %v", kv[0], err)
+		}
+		duration, err := time.ParseDuration(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return fmt.Errorf("invalid duration %s, %v", kv[1], err)
+		}
+		m[domain] = duration
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.m = m
+
+	return nil
+}
+
+// Get returns the duration of domain, ok is false if domain not set.
+func (d *DomainDuration) Get(domain int64) (duration time.Duration, ok bool) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	duration, ok = d.m[domain]
+	return
+}
+
+// DomainSize implements flag.Value, which holds sizes of domains in bytes.
+// It is in the form of "domain:size,domain:size", the size may have
+// one of the binary suffixes K, M, G and T, for example "1001:500M,1002:2T",
+// and can be updated through conf.
+type DomainSize struct {
+	lock sync.RWMutex
+	m    map[int64]int64
+}
+
+// String returns the string of value.
+func (d *DomainSize) String() string {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	result := make([]string, 0, len(d.m))
+	for domain, size := range d.m {
+		result = append(result, fmt.Sprintf("%d:%d", domain, size))
+	}
+	sort.Strings(result)
+
+	return strings.Join(result, ",")
+}
+
+// Set parses and sets the value, it replaces the previous value as a whole.
+func (d *DomainSize) Set(value string) error {
+	m := make(map[int64]int64)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+
+		kv := strings.SplitN(item, ":", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid domain size %s", item)
+		}
+		domain, err := strconv.ParseInt(strings.TrimSpace(kv[0]), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid domain %s, %v", kv[0], err)
+		}
+		size, err := parseSize(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return fmt.Errorf("invalid size %s, %v", kv[1], err)
+		}
+		m[domain] = size
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.m = m
+
+	return nil
+}
+
+// Get returns the size of domain, ok is false if domain not set.
+func (d *DomainSize) Get(domain int64) (size int64, ok bool) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	size, ok = d.m[domain]
+	return
+}
+
+// Domains returns the domains set, in ascending order.
+func (d *DomainSize) Domains() []int64 {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	domains := make([]int64, 0, len(d.m))
+	for domain := range d.m {
+		domains = append(domains, domain)
+	}
+	sort.Sort(int64s(domains))
+
+	return domains
+}
+
+type int64s []int64
+
+func (a int64s) Len() int           { return len(a) }
+func (a int64s) Less(i, j int) bool { return a[i] < a[j] }
+func (a int64s) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+// parseSize parses a size in bytes, with an optional binary suffix.
+func parseSize(s string) (int64, error) {
+	unit := int64(1)
+	if len(s) > 0 {
+		switch strings.ToUpper(s[len(s)-1:]) {
+		case "K":
+			unit = 1 << 10
+		case "M":
+			unit = 1 << 20
+		case "G":
+			unit = 1 << 30
+		case "T":
+			unit = 1 << 40
+		}
+		if unit > 1 {
+			s = s[:len(s)-1]
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("negative size %d", n)
+	}
+	if n > math.MaxInt64/unit {
+		return 0, fmt.Errorf("size %s overflows", s)
+	}
+
+	return n * unit, nil
+}
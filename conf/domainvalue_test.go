@@ -0,0 +1,66 @@
+package conf
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDomainDuration(t *testing.T) {
+	d := &DomainDuration{}
+
+	assert.Nil(t, d.Set("1001:72h, 1002:30m"))
+	assert.Equal(t, "1001:72h0m0s,1002:30m0s", d.String())
+
+	v, ok := d.Get(1001)
+	assert.True(t, ok)
+	assert.Equal(t, 72*time.Hour, v)
+
+	_, ok = d.Get(1003)
+	assert.False(t, ok)
+
+	assert.NotNil(t, d.Set("1001"))
+	assert.NotNil(t, d.Set("x:1h"))
+	assert.NotNil(t, d.Set("1001:1x"))
+
+	// A failed setting keeps the previous value.
+	v, ok = d.Get(1002)
+	assert.True(t, ok)
+	assert.Equal(t, 30*time.Minute, v)
+
+	assert.Nil(t, d.Set(""))
+	_, ok = d.Get(1001)
+	assert.False(t, ok)
+}
+
+func TestDomainSize(t *testing.T) {
+	d := &DomainSize{}
+
+	assert.Nil(t, d.Set("1001:500M, 1002:2g,1003:1024"))
+	assert.Equal(t, "1001:524288000,1002:2147483648,1003:1024", d.String())
+	assert.Equal(t, []int64{1001, 1002, 1003}, d.Domains())
+
+	v, ok := d.Get(1002)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2<<30), v)
+
+	_, ok = d.Get(1004)
+	assert.False(t, ok)
+
+	assert.NotNil(t, d.Set("1001"))
+	assert.NotNil(t, d.Set("x:1G"))
+	assert.NotNil(t, d.Set("1001:1X"))
+	assert.NotNil(t, d.Set("1001:-1"))
+	assert.NotNil(t, d.Set("1001:9000000000T"))
+
+	// A failed setting keeps the previous value.
+	v, ok = d.Get(1003)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1024), v)
+
+	assert.Nil(t, d.Set(""))
+	_, ok = d.Get(1001)
+	assert.False(t, ok)
+	assert.Empty(t, d.Domains())
+}
@@ -0,0 +1,34 @@
+package conf
+
+import (
+	"github.com/golang/glog"
+)
+
+// Create a feature flag to work together with encryption at rest.
+
+const (
+	// Flag to enable/disable encryption of new files.
+	flagKeyEncrypt = "encrypt"
+)
+
+func initEncryptFlag() {
+	PutFlag(&FeatureFlag{
+		Key:        flagKeyEncrypt,
+		Enabled:    false,
+		Domains:    []uint32{},
+		Groups:     []string{},
+		Percentage: uint32(0),
+	})
+}
+
+// IsEncryptEnabled returns true if the files put into domain
+// should be encrypted at rest.
+func IsEncryptEnabled(domain int64) bool {
+	ff, err := GetFlag(flagKeyEncrypt)
+	if err != nil {
+		glog.Warningf("feature %s error %v", flagKeyEncrypt, err)
+		return false
+	}
+
+	return ff.DomainHasAccess(uint32(domain))
+}
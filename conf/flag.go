@@ -87,8 +87,13 @@ func updateFeature(key string, value string) {
 }
 
 func updateGeneral(key string, value string) {
-	if privateValue, ok := privateMap[key]; ok {
-		glog.Infof("key %s has private value %s, general %s", key, privateValue, value)
+	if _, ok := privateMap[key]; ok {
+		// Values are not logged but by flag, which masks secrets.
+		if f, ok := flagMap[key]; ok {
+			glog.Infof("key %s has private value %s, general ignored", key, f.Value.String())
+		} else {
+			glog.Infof("key %s has private value, general ignored", key)
+		}
 		return
 	}
 	UpdateFlagValue(key, value)
@@ -103,11 +108,11 @@ func updatePrivate(key string, value string) {
 func UpdateFlagValue(key string, value string) {
 	if f, ok := flagMap[key]; ok {
 		f.Value.Set(value)
-		glog.Infof("Update flag:\t%s->%s\n", key, value)
+		glog.Infof("Update flag:\t%s->%s\n", key, f.Value.String())
 		return
 	}
 
-	glog.Warningf("Failed to update flag %s to value %, invalid parameter.", key, value)
+	glog.Warningf("Failed to update flag %s, invalid parameter.", key)
 }
 
 // GetAllFlags returns a string which describes all flags and their values.
@@ -19,6 +19,10 @@ func init() {
 	initBackStoreFlag()
 	initCacheFileFlag()
 	initTeeFlag()
+	initTrashFlag()
+	initDedupFlag()
+	initCompressFlag()
+	initEncryptFlag()
 }
 
 func initBackStoreFlag() {
@@ -0,0 +1,126 @@
+package conf
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Limit represents a rate limit of a token bucket.
+type Limit struct {
+	Rate  float64 // tokens filled per second, 0 for unlimited.
+	Burst int     // capacity of bucket.
+}
+
+// String returns the string of limit.
+func (l Limit) String() string {
+	return fmt.Sprintf("%s:%d", strconv.FormatFloat(l.Rate, 'f', -1, 64), l.Burst)
+}
+
+// RateLimit implements flag.Value, which holds a default limit and
+// the limits of given keys. It is in the form of
+// "rate:burst,key=rate:burst,key=rate:burst", for example
+// "100:200,1001=10:20,1002=0", where the item without key is the
+// default, a rate of 0 means unlimited, and burst defaults to rate.
+// It can be updated through conf.
+type RateLimit struct {
+	lock sync.RWMutex
+	def  Limit
+	m    map[string]Limit
+}
+
+// String returns the string of value.
+func (r *RateLimit) String() string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	result := make([]string, 0, len(r.m)+1)
+	for key, l := range r.m {
+		result = append(result, fmt.Sprintf("%s=%s", key, l))
+	}
+	sort.Strings(result)
+
+	if r.def.Rate > 0 {
+		result = append([]string{r.def.String()}, result...)
+	}
+
+	return strings.Join(result, ",")
+}
+
+// Set parses and sets the value, it replaces the previous value as a whole.
+func (r *RateLimit) Set(value string) error {
+	var def Limit
+	m := make(map[string]Limit)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) == 1 {
+			l, err := parseLimit(kv[0])
+			if err != nil {
+				return err
+			}
+			def = l
+			continue
+		}
+
+		key := strings.TrimSpace(kv[0])
+		if len(key) == 0 {
+			return fmt.Errorf("invalid rate limit %s, empty key", item)
+		}
+		l, err := parseLimit(kv[1])
+		if err != nil {
+			return err
+		}
+		m[key] = l
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.def = def
+	r.m = m
+
+	return nil
+}
+
+// Get returns the limit of key, or the default if key not set.
+func (r *RateLimit) Get(key string) Limit {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if l, ok := r.m[key]; ok {
+		return l
+	}
+
+	return r.def
+}
+
+func parseLimit(s string) (Limit, error) {
+	rb := strings.SplitN(strings.TrimSpace(s), ":", 2)
+
+	rate, err := strconv.ParseFloat(strings.TrimSpace(rb[0]), 64)
+	if err != nil || rate < 0 {
+		return Limit{}, fmt.Errorf("invalid rate %s", rb[0])
+	}
+
+	burst := int(rate)
+	if len(rb) == 2 {
+		burst, err = strconv.Atoi(strings.TrimSpace(rb[1]))
+		if err != nil || burst < 0 {
+			return Limit{}, fmt.Errorf("invalid burst %s", rb[1])
+		}
+	}
+	if rate > 0 && burst < 1 {
+		burst = 1
+	}
+
+	return Limit{
+		Rate:  rate,
+		Burst: burst,
+	}, nil
+}
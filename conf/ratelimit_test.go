@@ -0,0 +1,32 @@
+package conf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	r := &RateLimit{}
+
+	assert.Equal(t, Limit{}, r.Get("1001"))
+
+	assert.Nil(t, r.Set("100:200, 1001=10:20, 1002=0, client-a=0.5"))
+	assert.Equal(t, "100:200,1001=10:20,1002=0:0,client-a=0.5:1", r.String())
+
+	assert.Equal(t, Limit{10, 20}, r.Get("1001"))
+	assert.Equal(t, Limit{0, 0}, r.Get("1002"))
+	assert.Equal(t, Limit{100, 200}, r.Get("1003"))
+
+	assert.NotNil(t, r.Set("x"))
+	assert.NotNil(t, r.Set("=10"))
+	assert.NotNil(t, r.Set("1001=-1"))
+	assert.NotNil(t, r.Set("1001=10:x"))
+
+	// A failed setting keeps the previous value.
+	assert.Equal(t, Limit{10, 20}, r.Get("1001"))
+
+	assert.Nil(t, r.Set("1001=5"))
+	assert.Equal(t, Limit{5, 5}, r.Get("1001"))
+	assert.Equal(t, Limit{}, r.Get("1003"))
+}
@@ -0,0 +1,107 @@
+package conf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SecretMap implements flag.Value, which holds secrets by their ids.
+// It is in the form of "id=secret,id=secret", and can be updated
+// through conf. Secrets are never shown by String.
+type SecretMap struct {
+	lock sync.RWMutex
+	m    map[string][]byte
+}
+
+// String returns the string of value, with secrets masked.
+func (s *SecretMap) String() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	result := make([]string, 0, len(s.m))
+	for id := range s.m {
+		result = append(result, fmt.Sprintf("%s=***", id))
+	}
+	sort.Strings(result)
+
+	return strings.Join(result, ",")
+}
+
+// Set parses and sets the value, it replaces the previous value as a whole.
+func (s *SecretMap) Set(value string) error {
+	m := make(map[string][]byte)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || len(strings.TrimSpace(kv[0])) == 0 || len(kv[1]) == 0 {
+			return fmt.Errorf("invalid secret of %s", kv[0])
+		}
+		m[strings.TrimSpace(kv[0])] = []byte(kv[1])
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.m = m
+
+	return nil
+}
+
+// Get returns the secret of id, ok is false if id not set.
+func (s *SecretMap) Get(id string) (secret []byte, ok bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	secret, ok = s.m[id]
+	return
+}
+
+// StringSet implements flag.Value, which holds a set of strings.
+// It is in the form of "a,b,c", and can be updated through conf.
+type StringSet struct {
+	lock sync.RWMutex
+	m    map[string]bool
+}
+
+// String returns the string of value.
+func (s *StringSet) String() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	result := make([]string, 0, len(s.m))
+	for item := range s.m {
+		result = append(result, item)
+	}
+	sort.Strings(result)
+
+	return strings.Join(result, ",")
+}
+
+// Set parses and sets the value, it replaces the previous value as a whole.
+func (s *StringSet) Set(value string) error {
+	m := make(map[string]bool)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			m[item] = true
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.m = m
+
+	return nil
+}
+
+// Contains returns true if item is in the set.
+func (s *StringSet) Contains(item string) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.m[item]
+}
@@ -0,0 +1,39 @@
+package conf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretMap(t *testing.T) {
+	s := &SecretMap{}
+
+	assert.Nil(t, s.Set("k1=abc, k2=a=b"))
+	assert.Equal(t, "k1=***,k2=***", s.String())
+
+	v, ok := s.Get("k2")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("a=b"), v)
+
+	assert.NotNil(t, s.Set("k1"))
+	assert.NotNil(t, s.Set("=abc"))
+	assert.NotNil(t, s.Set("k1="))
+
+	// A failed setting keeps the previous value.
+	_, ok = s.Get("k1")
+	assert.True(t, ok)
+
+	assert.Nil(t, s.Set(""))
+	_, ok = s.Get("k1")
+	assert.False(t, ok)
+}
+
+func TestStringSet(t *testing.T) {
+	s := &StringSet{}
+
+	assert.Nil(t, s.Set("b, a,,c"))
+	assert.Equal(t, "a,b,c", s.String())
+	assert.True(t, s.Contains("a"))
+	assert.False(t, s.Contains("d"))
+}
@@ -0,0 +1,34 @@
+package conf
+
+import (
+	"github.com/golang/glog"
+)
+
+// Create a feature flag to work together with trash bin.
+
+const (
+	// Flag to enable/disable trash bin.
+	FlagKeyTrash = "trash"
+)
+
+func initTrashFlag() {
+	PutFlag(&FeatureFlag{
+		Key:        FlagKeyTrash,
+		Enabled:    false,
+		Domains:    []uint32{},
+		Groups:     []string{},
+		Percentage: uint32(0),
+	})
+}
+
+// IsTrashEnabled returns true if the removed files of domain
+// should be put into trash bin.
+func IsTrashEnabled(domain int64) bool {
+	ff, err := GetFlag(FlagKeyTrash)
+	if err != nil {
+		glog.Warningf("feature %s error %v", FlagKeyTrash, err)
+		return false
+	}
+
+	return ff.DomainHasAccess(uint32(domain))
+}
@@ -1,10 +1,14 @@
 package conf
 
 import (
+	"encoding/json"
 	"fmt"
+	"path/filepath"
+	"sort"
 	"sync"
 
 	"jingoal.com/dfs/instrument"
+	"jingoal.com/dfs/notice"
 )
 
 var (
@@ -59,6 +63,48 @@ func UpdateFlag(f *FeatureFlag) error {
 	return nil
 }
 
+// ListFlags returns all feature flags, sorted by key.
+func ListFlags() []*FeatureFlag {
+	flock.RLock()
+	defer flock.RUnlock()
+
+	keys := make([]string, 0, len(features))
+	for key := range features {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]*FeatureFlag, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, features[key])
+	}
+
+	return result
+}
+
+// SetFlag sets an existed feature flag through notice, so every
+// server watching configuration will update it, including this one.
+func SetFlag(n notice.Notice, f *FeatureFlag) error {
+	if err := f.validate(); err != nil {
+		return err
+	}
+	if _, err := GetFlag(f.Key); err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(DfssvrConfPath, DfssvrPrefix+FeatureFlagPrefix+"."+f.Key)
+	if err := n.SetData(path, value); err != nil {
+		return err
+	}
+
+	return UpdateFlag(f)
+}
+
 func flagToMeasure(f *FeatureFlag) *instrument.Measurements {
 	v := uint32(1e9)
 	v += f.Percentage * 1e7
@@ -0,0 +1,54 @@
+package conf
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"jingoal.com/dfs/notice"
+)
+
+type fakeNotice struct {
+	notice.Notice
+	data map[string]string
+}
+
+func (n *fakeNotice) SetData(path string, data []byte) error {
+	n.data[path] = string(data)
+	return nil
+}
+
+func TestListFlags(t *testing.T) {
+	flags := ListFlags()
+
+	keys := make([]string, 0, len(flags))
+	for _, f := range flags {
+		keys = append(keys, f.Key)
+	}
+	assert.True(t, sort.StringsAreSorted(keys))
+	assert.Contains(t, keys, FlagKeyBackStore)
+}
+
+func TestSetFlag(t *testing.T) {
+	n := &fakeNotice{
+		data: make(map[string]string),
+	}
+
+	f := &FeatureFlag{
+		Key:        FlagKeyCacheFile,
+		Enabled:    true,
+		Domains:    []uint32{},
+		Groups:     []string{},
+		Percentage: 0,
+	}
+	assert.Nil(t, SetFlag(n, f))
+	assert.Contains(t, n.data["/shard/conf/dfs.svr.featureflag.cachefile"], `"enabled":true`)
+
+	got, err := GetFlag(FlagKeyCacheFile)
+	assert.Nil(t, err)
+	assert.True(t, got.Enabled)
+
+	assert.NotNil(t, SetFlag(n, &FeatureFlag{Key: "not_exist"}))
+	assert.NotNil(t, SetFlag(n, &FeatureFlag{Key: "Bad-Key"}))
+}
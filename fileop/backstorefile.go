@@ -1,6 +1,7 @@
 package fileop
 
 import (
+	"crypto/cipher"
 	"flag"
 	"io"
 	"strings"
@@ -19,8 +20,12 @@ import (
 var (
 	bsWithRealName = flag.Bool("bs-with-real-name", false, "create backstore file with the real name.")
 	cacheDuration  = flag.Duration("cache-duration", 3*time.Hour, "duration for cache file arbitrarily")
+)
 
-	NegotiatedChunkSize = int64(1048576)
+const (
+	// DefaultCacheChunkSize is the chunk size of back store file
+	// if client not given.
+	DefaultCacheChunkSize = int64(1048576)
 )
 
 // BackStoreHandler implements interface DFSFileHandler.
@@ -37,14 +42,24 @@ type BackStoreHandler struct {
 
 // Create creates a DFSFile for write
 func (bsh *BackStoreHandler) Create(info *transfer.FileInfo) (DFSFile, error) {
-	originalFile, err := bsh.DFSFileHandler.Create(info)
+	return bsh.CreateWithChunkSize(info, DefaultCacheChunkSize)
+}
+
+// CreateWithChunkSize creates a DFSFile for write with the given chunk size,
+// DefaultCacheChunkSize is used if it is not positive.
+func (bsh *BackStoreHandler) CreateWithChunkSize(info *transfer.FileInfo, chunkSize int64) (DFSFile, error) {
+	if chunkSize <= 0 {
+		chunkSize = DefaultCacheChunkSize
+	}
+
+	originalFile, err := CreateWithChunkSize(bsh.DFSFileHandler, info, chunkSize)
 	if reErr, ok := err.(RecoverableFileError); ok {
 		if !(isCacheFile(info.Domain) ||
 			(isWriteToBackStore(info.Domain) && time.Since(instrument.ProgramStartTime) < *cacheDuration)) {
 			return nil, reErr.Orig
 		}
 
-		wFile, er := bsh.createCacheFile(info, originalFile)
+		wFile, er := bsh.createCacheFile(info, originalFile, chunkSize)
 		if er != nil {
 			glog.Warningf("Failed to create cache file %v, %v", info, reErr.Orig)
 			return nil, er
@@ -77,7 +92,7 @@ func (bsh *BackStoreHandler) Create(info *transfer.FileInfo) (DFSFile, error) {
 
 	var wFile *weedfs.WeedFile
 	if isWriteToBackStore(info.Domain) {
-		wFile, err = bsh.createCacheFile(info, originalFile)
+		wFile, err = bsh.createCacheFile(info, originalFile, chunkSize)
 		if err != nil {
 			return NewBackStoreFile(nil, originalFile, info), nil
 		}
@@ -86,12 +101,12 @@ func (bsh *BackStoreHandler) Create(info *transfer.FileInfo) (DFSFile, error) {
 	return NewBackStoreFile(wFile, originalFile, info), nil
 }
 
-func (bsh *BackStoreHandler) createCacheFile(info *transfer.FileInfo, originalFile DFSFile) (*weedfs.WeedFile, error) {
+func (bsh *BackStoreHandler) createCacheFile(info *transfer.FileInfo, originalFile DFSFile, chunkSize int64) (*weedfs.WeedFile, error) {
 	fn := ""
 	if *bsWithRealName {
 		fn = info.Name
 	}
-	wFile, err := weedfs.Create(fn, info.Domain, bsh.BackStoreShard.MasterUri, bsh.BackStoreShard.Replica, bsh.BackStoreShard.DataCenter, bsh.BackStoreShard.Rack, NegotiatedChunkSize)
+	wFile, err := weedfs.Create(fn, info.Domain, bsh.BackStoreShard.MasterUri, bsh.BackStoreShard.Replica, bsh.BackStoreShard.DataCenter, bsh.BackStoreShard.Rack, chunkSize)
 	if err != nil {
 		instrument.BackstoreFileCounter <- &instrument.Measurements{
 			Name:  "create_failed",
@@ -228,6 +243,21 @@ func (bsh *BackStoreHandler) FindByMd5(md5 string, domain int64, size int64) (st
 	return bsh.DFSFileHandler.FindByMd5(md5, domain, size)
 }
 
+// FindBySha256 finds a file by its sha256.
+func (bsh *BackStoreHandler) FindBySha256(sha256 string, domain int64, size int64) (string, error) {
+	return bsh.DFSFileHandler.FindBySha256(sha256, domain, size)
+}
+
+// List lists files which match the filter, starts after cursor.
+func (bsh *BackStoreHandler) List(filter *meta.FileFilter, cursor string, limit int) ([]*transfer.FileInfo, string, error) {
+	return ListFiles(bsh.DFSFileHandler, filter, cursor, limit)
+}
+
+// UpdateAttrs updates custom attributes of a file.
+func (bsh *BackStoreHandler) UpdateAttrs(id string, domain int64, attrs map[string]string) error {
+	return UpdateAttrs(bsh.DFSFileHandler, id, domain, attrs)
+}
+
 func NewBackStoreHandler(originalHandler DFSFileHandler, bsShard *metadata.Shard, logOp *metadata.CacheLogOp) *BackStoreHandler {
 	handler := BackStoreHandler{
 		DFSFileHandler: originalHandler,
@@ -248,6 +278,7 @@ type BackStoreFile struct {
 	// back store file
 	bs    *weedfs.WeedFile
 	bsErr error
+	bsEc  *entityCipher // cipher of back store file, nil for plain.
 }
 
 // GetFileInfo returns file info.
@@ -266,7 +297,11 @@ func (d *BackStoreFile) Write(p []byte) (n int, err error) {
 	}
 
 	if d.bs != nil && d.bsErr == nil {
-		_, d.bsErr = d.bs.Write(p)
+		if d.bsEc != nil {
+			_, d.bsErr = d.bs.Write(d.bsEc.encrypt(p))
+		} else {
+			_, d.bsErr = d.bs.Write(p)
+		}
 	}
 
 	return
@@ -276,6 +311,9 @@ func (d *BackStoreFile) Write(p []byte) (n int, err error) {
 func (d *BackStoreFile) Read(p []byte) (n int, err error) {
 	if d.bs != nil {
 		n, err = d.bs.Read(p)
+		if n > 0 && d.bsEc != nil {
+			d.bsEc.decrypt(p[:n])
+		}
 		if glog.V(6) {
 			glog.Infof("read from weed %d, %v", n, err)
 		}
@@ -289,6 +327,23 @@ func (d *BackStoreFile) Read(p []byte) (n int, err error) {
 	return 0, NoEntityError
 }
 
+// Seek sets the offset for the next Read of back store file.
+func (d *BackStoreFile) Seek(offset int64, whence int) (int64, error) {
+	if d.bs != nil {
+		pos, err := seekOrSkip(d.bs, offset, whence)
+		if err == nil && d.bsEc != nil {
+			d.bsEc.seek(pos)
+		}
+		return pos, err
+	}
+
+	if d.DFSFile != nil {
+		return d.DFSFile.Seek(offset, whence)
+	}
+
+	return 0, NoEntityError
+}
+
 // Close closes a back store file.
 func (d *BackStoreFile) Close() (err error) {
 	if d.bs != nil && d.bsErr == nil {
@@ -307,6 +362,23 @@ func (d *BackStoreFile) hasEntity() bool {
 	return true
 }
 
+// encryptEntity encrypts entities of both original and back store file.
+// The back store file is encrypted raw, so it is recovered as is into
+// an original file which failed to create its entity.
+func (d *BackStoreFile) encryptEntity(block cipher.Block, iv []byte) error {
+	if d.DFSFile != nil {
+		if err := encryptEntity(d.DFSFile, block, iv); err != nil {
+			return err
+		}
+	}
+
+	if d.bs != nil {
+		d.bsEc = newEntityCipher(block, iv)
+	}
+
+	return nil
+}
+
 // NewBackStoreFile creates a new back store file.
 func NewBackStoreFile(bs *weedfs.WeedFile, file DFSFile, info *transfer.FileInfo) *BackStoreFile {
 	return &BackStoreFile{
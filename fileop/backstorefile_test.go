@@ -0,0 +1,30 @@
+package fileop
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBackStoreCreateWithChunkSize(t *testing.T) {
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	major := NewMockDFSFileHandler(ctl)
+	chunked := &chunkedHandler{DFSFileHandler: major}
+	handler := &BackStoreHandler{DFSFileHandler: chunked}
+
+	mockFile := NewMockDFSFile(ctl)
+	major.EXPECT().Create(info).Return(mockFile, nil).Times(2)
+
+	Convey("Create a file without chunk size.", t, func() {
+		_, err := handler.CreateWithChunkSize(info, 0)
+		So(err, ShouldBeNil)
+		So(chunked.chunkSize, ShouldEqual, DefaultCacheChunkSize)
+
+		_, err = handler.Create(info)
+		So(err, ShouldBeNil)
+		So(chunked.chunkSize, ShouldEqual, DefaultCacheChunkSize)
+	})
+}
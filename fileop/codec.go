@@ -0,0 +1,101 @@
+package fileop
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"jingoal.com/dfs/conf"
+	"jingoal.com/dfs/proto/transfer"
+)
+
+const (
+	// MetaKey_Codec is the key of the codec which compressed the
+	// entity. A file without it is stored raw.
+	MetaKey_Codec = "codec"
+
+	CodecGzip = "gzip"
+)
+
+// chooseCodec returns the codec to compress a new file, empty for none.
+func chooseCodec(info *transfer.FileInfo) string {
+	if conf.IsCompressEnabled(info.Domain, info.Biz) {
+		return CodecGzip
+	}
+
+	return ""
+}
+
+// newCodecWriter returns a writer which compresses content into w.
+// Closing it flushes the compressed content but leaves w open.
+// Its Write returns the length of uncompressed content, so size and
+// md5 computed by caller keep referring to the original content.
+func newCodecWriter(codec string, w io.Writer) (io.WriteCloser, error) {
+	switch codec {
+	case CodecGzip:
+		return gzip.NewWriter(nonEmptyWriter{w}), nil
+	}
+
+	return nil, fmt.Errorf("unknown codec '%s'", codec)
+}
+
+// newCodecReader returns a reader which decompresses content from r.
+// Nothing is read from r before its first Read, so it is cheap to
+// replace it with another one over a decrypted r.
+func newCodecReader(codec string, r io.Reader) (io.Reader, error) {
+	switch codec {
+	case CodecGzip:
+		return &lazyReader{
+			open: func() (io.Reader, error) {
+				return gzip.NewReader(r)
+			},
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown codec '%s'", codec)
+}
+
+// lazyReader opens its underlying reader on the first Read.
+type lazyReader struct {
+	open func() (io.Reader, error)
+	r    io.Reader
+	err  error
+}
+
+func (l *lazyReader) Read(p []byte) (int, error) {
+	if l.r == nil && l.err == nil {
+		l.r, l.err = l.open()
+	}
+	if l.err != nil {
+		return 0, l.err
+	}
+
+	return l.r.Read(p)
+}
+
+// nonEmptyWriter skips empty writes, gfapi panics on them.
+type nonEmptyWriter struct {
+	w io.Writer
+}
+
+func (w nonEmptyWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	return w.w.Write(p)
+}
+
+// readerFunc adapts a read function to io.Reader.
+type readerFunc func([]byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+// writerFunc adapts a write function to io.Writer.
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
@@ -0,0 +1,92 @@
+package fileop
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	content := bytes.Repeat([]byte("compressible content "), 1000)
+
+	buf := new(bytes.Buffer)
+	zw, err := newCodecWriter(CodecGzip, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, chunk := range [][]byte{content[:1], {}, content[1:4096], content[4096:]} {
+		n, err := zw.Write(chunk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(chunk) {
+			t.Errorf("expected %d bytes written, got %d", len(chunk), n)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() >= len(content) {
+		t.Errorf("content not compressed, %d bytes stored", buf.Len())
+	}
+
+	zr, err := newCodecReader(CodecGzip, bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(zr)
+	if err != nil || !bytes.Equal(got, content) {
+		t.Errorf("content not decompressed, %v", err)
+	}
+
+	if _, err := newCodecWriter("unknown", buf); err == nil {
+		t.Errorf("expected error of unknown codec")
+	}
+	if _, err := newCodecReader("unknown", buf); err == nil {
+		t.Errorf("expected error of unknown codec")
+	}
+}
+
+func TestSeekCompressed(t *testing.T) {
+	content := make([]byte, 100000)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+
+	buf := new(bytes.Buffer)
+	zw, _ := newCodecWriter(CodecGzip, buf)
+	zw.Write(content)
+	zw.Close()
+
+	for _, offset := range []int64{0, 1, 4095, 4096, 65536, 99999, 100000} {
+		zr, err := newCodecReader(CodecGzip, bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pos, err := seekOrSkip(zr, offset, io.SeekStart)
+		if err != nil || pos != offset {
+			t.Fatalf("seek to %d, got %d, %v", offset, pos, err)
+		}
+		got, err := ioutil.ReadAll(zr)
+		if err != nil || !bytes.Equal(got, content[offset:]) {
+			t.Errorf("content not read from offset %d, %v", offset, err)
+		}
+	}
+
+	zr, _ := newCodecReader(CodecGzip, bytes.NewReader(buf.Bytes()))
+	if _, err := seekOrSkip(zr, 10, io.SeekCurrent); err != UnsupportedSeekError {
+		t.Errorf("expected UnsupportedSeekError, got %v", err)
+	}
+}
+
+func TestCodecReaderIsLazy(t *testing.T) {
+	// A corrupted entity fails on reading other than on opening.
+	zr, err := newCodecReader(CodecGzip, bytes.NewReader([]byte("not gzip")))
+	if err != nil {
+		t.Fatalf("expected no error before reading, got %v", err)
+	}
+	if _, err := ioutil.ReadAll(zr); err == nil {
+		t.Errorf("expected error of reading a corrupted entity")
+	}
+}
@@ -22,7 +22,22 @@ func (h *DegradeHandler) Name() string {
 
 // Create creates a DFSFile for write
 func (h *DegradeHandler) Create(info *transfer.FileInfo) (DFSFile, error) {
-	f, err := h.fh.Create(info)
+	return h.createFile(info, func() (DFSFile, error) {
+		return h.fh.Create(info)
+	})
+}
+
+// CreateWithChunkSize creates a DFSFile for write with the given chunk size.
+func (h *DegradeHandler) CreateWithChunkSize(info *transfer.FileInfo, chunkSize int64) (DFSFile, error) {
+	return h.createFile(info, func() (DFSFile, error) {
+		return CreateWithChunkSize(h.fh, info, chunkSize)
+	})
+}
+
+// createFile creates a file with function create, and saves
+// a degradation event for recovery.
+func (h *DegradeHandler) createFile(info *transfer.FileInfo, create func() (DFSFile, error)) (DFSFile, error) {
+	f, err := create()
 	if err != nil {
 		return nil, err
 	}
@@ -78,6 +93,21 @@ func (h *DegradeHandler) FindByMd5(md5 string, domain int64, size int64) (string
 	return h.fh.FindByMd5(md5, domain, size)
 }
 
+// FindBySha256 finds a file by its sha256.
+func (h *DegradeHandler) FindBySha256(sha256 string, domain int64, size int64) (string, error) {
+	return h.fh.FindBySha256(sha256, domain, size)
+}
+
+// List lists files which match the filter, starts after cursor.
+func (h *DegradeHandler) List(filter *meta.FileFilter, cursor string, limit int) ([]*transfer.FileInfo, string, error) {
+	return ListFiles(h.fh, filter, cursor, limit)
+}
+
+// UpdateAttrs updates custom attributes of a file.
+func (h *DegradeHandler) UpdateAttrs(id string, domain int64, attrs map[string]string) error {
+	return UpdateAttrs(h.fh, id, domain, attrs)
+}
+
 // NewDegradeHandler returns a handler for processing Degraded files.
 func NewDegradeHandler(handler DFSFileHandler, reop *recovery.RecoveryEventOp) *DegradeHandler {
 	return &DegradeHandler{
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/golang/glog"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
@@ -36,6 +37,26 @@ func (duplfs *DuplFs) FindByMd5(gridfs *mgo.GridFS, md5 string, domain int64, si
 	return nil, meta.FileNotFound
 }
 
+// FindBySha256 finds a gridfs file by its sha256.
+func (duplfs *DuplFs) FindBySha256(gridfs *mgo.GridFS, sha256 string, domain int64, size int64) (*mgo.GridFile, error) {
+	file := new(mgo.GridFile)
+
+	query := bson.D{
+		{"domain", domain},
+		{"sha256", sha256},
+		{"length", size},
+	}
+
+	iter := gridfs.Find(query).Sort("-uploadDate").Iter()
+	defer iter.Close()
+
+	if ok := gridfs.OpenNext(iter, &file); ok {
+		return file, nil
+	}
+
+	return nil, meta.FileNotFound
+}
+
 // Find finds a file with given id.
 func (duplfs *DuplFs) Find(gridfs *mgo.GridFS, givenId string) (f *mgo.GridFile, err error) {
 	defer func() {
@@ -151,9 +172,14 @@ func (duplfs *DuplFs) DuplicateWithId(gridfs *mgo.GridFS, oid string, dupId stri
 		return "", err
 	}
 
+	// Domain of dupl is the entity's, for listing files of domain,
+	// and attributes are copied from the file duplicated.
+	ext := lookupExtMeta(gridfs, pid)
 	dupl := metadata.Dupl{
 		Ref:    ref.Id,
 		Length: ref.Length,
+		Domain: ext.Domain,
+		Attrs:  duplfs.attrsOf(oid, ext),
 	}
 
 	if dupId != "" {
@@ -199,7 +225,6 @@ func (duplfs *DuplFs) LazyDelete(gridfs *mgo.GridFS, dId string) (bool, *bson.Ob
 				return false, nil, err
 			}
 			if ref == nil {
-				lazyRemove(gridfs, *realId)
 				result = true
 			} else {
 				status = -20000
@@ -228,7 +253,6 @@ func (duplfs *DuplFs) decAndRemove(gridfs *mgo.GridFS, id bson.ObjectId) (int64,
 	ref, err := duplfs.DecRefCnt(id)
 	if err == mgo.ErrNotFound {
 		duplfs.RemoveRef(id)
-		lazyRemove(gridfs, id)
 		return -1, nil
 	}
 	if err != nil {
@@ -237,12 +261,35 @@ func (duplfs *DuplFs) decAndRemove(gridfs *mgo.GridFS, id bson.ObjectId) (int64,
 
 	if ref.RefCnt < 0 {
 		duplfs.RemoveRef(id)
-		lazyRemove(gridfs, id)
 	}
 
 	return ref.RefCnt, nil
 }
 
+// EnsureIndexes ensures the indexes for the queries of DuplFs,
+// failures are only logged.
+func (duplfs *DuplFs) EnsureIndexes(gridfs *mgo.GridFS) {
+	if err := duplfs.EnsureDuplIndex(); err != nil {
+		glog.Warningf("Failed to ensure index of dupl, %v.", err)
+	}
+
+	// For listing files of a domain in order of id.
+	if err := gridfs.Files.EnsureIndex(mgo.Index{
+		Key:        []string{"domain", "_id"},
+		Background: true,
+	}); err != nil {
+		glog.Warningf("Failed to ensure index of domain, %v.", err)
+	}
+
+	// For FindBySha256, legacy files without sha256 are indexed as null.
+	if err := gridfs.Files.EnsureIndex(mgo.Index{
+		Key:        []string{"domain", "sha256", "length"},
+		Background: true,
+	}); err != nil {
+		glog.Warningf("Failed to ensure index of sha256, %v.", err)
+	}
+}
+
 func NewDuplFs(dOp *metadata.DuplicateOp) *DuplFs {
 	duplfs := &DuplFs{
 		DuplicateOp: dOp,
@@ -257,12 +304,16 @@ type FileMeta struct {
 	UploadDate  time.Time   "uploadDate"
 	Length      int64       "length,minsize"
 	MD5         string      "md5"
+	Sha256      string      "sha256,omitempty"
 	Filename    string      "filename,omitempty"
 	ContentType string      "contentType,omitempty"
 
-	Domain int64  "domain"
-	UserId string "userid"
-	Biz    string "bizname"
+	Domain     int64             "domain"
+	UserId     string            "userid"
+	Biz        string            "bizname"
+	Attrs      map[string]string "attrs,omitempty"
+	ExpireTime int64             "expiretime,omitempty"
+	Codec      string            "codec,omitempty"
 }
 
 func LookupFileMeta(gridfs *mgo.GridFS, query bson.D) (*meta.File, error) {
@@ -272,23 +323,323 @@ func LookupFileMeta(gridfs *mgo.GridFS, query bson.D) (*meta.File, error) {
 	fm := new(FileMeta)
 	if iter.Next(fm) {
 		if oid, ok := fm.Id.(bson.ObjectId); ok {
-			return &meta.File{
-				Id:         oid.Hex(),
-				Biz:        fm.Biz,
-				Md5:        fm.MD5,
-				Name:       fm.Filename,
-				UserId:     fm.UserId,
-				ChunkSize:  fm.ChunkSize,
-				UploadDate: fm.UploadDate,
-				Size:       fm.Length,
-				Domain:     fm.Domain,
-			}, nil
+			return fm.metaFile(oid.Hex()), nil
 		}
 	}
 
 	return nil, meta.FileNotFound
 }
 
+// metaFile returns the metadata of file with given id.
+func (fm *FileMeta) metaFile(id string) *meta.File {
+	return &meta.File{
+		Id:         id,
+		Biz:        fm.Biz,
+		Md5:        fm.MD5,
+		Sha256:     fm.Sha256,
+		Name:       fm.Filename,
+		UserId:     fm.UserId,
+		ChunkSize:  fm.ChunkSize,
+		UploadDate: fm.UploadDate,
+		Size:       fm.Length,
+		Domain:     fm.Domain,
+		ExtAttr:    meta.ExtAttrs(fm.Attrs, fm.ExpireTime),
+	}
+}
+
+// List lists files of gridfs which match the filter, in ascending
+// order of id, starts after cursor. Both entities and duplications
+// are listed, a duplication shares the metadata of its entity but
+// has its own id, upload date and attributes.
+func (duplfs *DuplFs) List(gridfs *mgo.GridFS, filter *meta.FileFilter, cursor string, limit int) ([]*meta.File, string, error) {
+	var after bson.ObjectId
+	if len(cursor) > 0 {
+		oid, err := hexString2ObjectId(util.GetRealId(cursor))
+		if err != nil {
+			return nil, "", err
+		}
+		after = *oid
+	}
+
+	entities, err := duplfs.listEntities(gridfs, filter, after, limit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	dupls, err := duplfs.listDupls(gridfs, filter, after, limit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Merge them in ascending order of id.
+	result := make([]*meta.File, 0, limit)
+	for len(result) < limit && (len(entities) > 0 || len(dupls) > 0) {
+		if len(dupls) == 0 || (len(entities) > 0 && entities[0].Id < util.GetRealId(dupls[0].Id)) {
+			result = append(result, entities[0])
+			entities = entities[1:]
+			continue
+		}
+		result = append(result, dupls[0])
+		dupls = dupls[1:]
+	}
+
+	next := ""
+	if len(result) == limit {
+		next = util.GetRealId(result[len(result)-1].Id)
+	}
+
+	return result, next, nil
+}
+
+// listEntities lists at most limit entities of gridfs which match
+// the filter, in ascending order of id, starts after the given id.
+// An entity deleted lazily, which is kept for its duplications, is
+// not listed.
+func (duplfs *DuplFs) listEntities(gridfs *mgo.GridFS, filter *meta.FileFilter, after bson.ObjectId, limit int) ([]*meta.File, error) {
+	query := bson.M{"domain": filter.Domain}
+	if len(filter.UserId) > 0 {
+		query["userid"] = filter.UserId
+	}
+	if len(filter.Biz) > 0 {
+		query["bizname"] = filter.Biz
+	}
+
+	date := bson.M{}
+	if !filter.Start.IsZero() {
+		date["$gte"] = filter.Start
+	}
+	if !filter.End.IsZero() {
+		date["$lt"] = filter.End
+	}
+	if len(date) > 0 {
+		query["uploadDate"] = date
+	}
+
+	if after.Valid() {
+		query["_id"] = bson.M{"$gt": after}
+	}
+
+	iter := gridfs.Find(query).Sort("_id").Iter()
+	defer iter.Close()
+
+	// Entities are read in batches, the lazily deleted ones of a batch
+	// are found at once.
+	result := make([]*meta.File, 0, limit)
+	for more := true; more && len(result) < limit; {
+		batch := make([]*FileMeta, 0, limit-len(result))
+		ids := make([]bson.ObjectId, 0, cap(batch))
+		for len(batch) < cap(batch) {
+			fm := new(FileMeta)
+			if more = iter.Next(fm); !more {
+				break
+			}
+			if oid, ok := fm.Id.(bson.ObjectId); ok {
+				batch = append(batch, fm)
+				ids = append(ids, oid)
+			}
+		}
+
+		deleted, err := duplfs.lazilyDeleted(ids)
+		if err != nil {
+			return nil, err
+		}
+		for i, fm := range batch {
+			if !deleted[ids[i]] {
+				result = append(result, fm.metaFile(ids[i].Hex()))
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// lazilyDeleted returns the set of entities which have been deleted
+// by their own ids, but kept for their duplications.
+func (duplfs *DuplFs) lazilyDeleted(ids []bson.ObjectId) (map[bson.ObjectId]bool, error) {
+	refs, err := duplfs.LookupRefsByIds(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[bson.ObjectId]bool, len(refs))
+	if len(refs) == 0 {
+		return result, nil
+	}
+
+	refIds := make([]bson.ObjectId, 0, len(refs))
+	for _, ref := range refs {
+		refIds = append(refIds, ref.Id)
+		result[ref.Id] = true
+	}
+
+	dupls, err := duplfs.LookupDuplsByIds(refIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, dupl := range dupls {
+		delete(result, dupl.Id)
+	}
+
+	return result, nil
+}
+
+// listDupls lists at most limit duplications of gridfs which match
+// the filter, in ascending order of id, starts after the given id.
+// User and biz of a duplication are the ones of its entity.
+func (duplfs *DuplFs) listDupls(gridfs *mgo.GridFS, filter *meta.FileFilter, after bson.ObjectId, limit int) ([]*meta.File, error) {
+	result := make([]*meta.File, 0, limit)
+
+	// Duplications are read in batches, the entities of a batch
+	// are found at once.
+	for len(result) < limit {
+		want := limit - len(result)
+		dupls := make([]*metadata.Dupl, 0, want)
+		if err := duplfs.ListDupls(filter.Domain, after, filter.Start, filter.End, func(dupl *metadata.Dupl) bool {
+			dupls = append(dupls, dupl)
+			return len(dupls) < want
+		}); err != nil {
+			return nil, err
+		}
+		if len(dupls) == 0 {
+			break
+		}
+		after = dupls[len(dupls)-1].Id
+
+		entities, err := lookupEntities(gridfs, dupls)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, dupl := range dupls {
+			fm, ok := entities[dupl.Ref]
+			if !ok {
+				glog.V(4).Infof("Entity %s of dupl %s not found.", dupl.Ref.Hex(), dupl.Id.Hex())
+				continue
+			}
+
+			if (len(filter.UserId) > 0 && fm.UserId != filter.UserId) ||
+				(len(filter.Biz) > 0 && fm.Biz != filter.Biz) {
+				continue
+			}
+
+			f := fm.metaFile(util.GetDuplId(dupl.Id.Hex()))
+			f.UploadDate = dupl.UploadDate
+			f.ExtAttr = meta.ExtAttrs(dupl.Attrs, fm.ExpireTime)
+			result = append(result, f)
+		}
+
+		if len(dupls) < want {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+// lookupEntities returns the metadata of entities referred by dupls,
+// by their ids.
+func lookupEntities(gridfs *mgo.GridFS, dupls []*metadata.Dupl) (map[bson.ObjectId]*FileMeta, error) {
+	refs := make([]bson.ObjectId, 0, len(dupls))
+	for _, dupl := range dupls {
+		refs = append(refs, dupl.Ref)
+	}
+
+	var fms []*FileMeta
+	if err := gridfs.Files.Find(bson.M{"_id": bson.M{"$in": refs}}).All(&fms); err != nil {
+		return nil, err
+	}
+
+	result := make(map[bson.ObjectId]*FileMeta, len(fms))
+	for _, fm := range fms {
+		if oid, ok := fm.Id.(bson.ObjectId); ok {
+			result[oid] = fm
+		}
+	}
+
+	return result, nil
+}
+
+// UpdateAttrs updates custom attributes of a gridfs file.
+// An attribute with empty value will be removed. Attributes of a
+// duplication are its own, not shared with the entity.
+func (duplfs *DuplFs) UpdateAttrs(gridfs *mgo.GridFS, id string, attrs map[string]string) error {
+	if util.IsDuplId(id) {
+		realId, err := hexString2ObjectId(util.GetRealId(id))
+		if err != nil {
+			return err
+		}
+
+		err = duplfs.UpdateDuplAttrs(*realId, attrs)
+		if err == mgo.ErrNotFound {
+			return meta.FileNotFound
+		}
+		return err
+	}
+
+	gridFile, err := duplfs.Find(gridfs, id)
+	if err == mgo.ErrNotFound {
+		return meta.FileNotFound
+	}
+	if err != nil {
+		return err
+	}
+	defer gridFile.Close()
+
+	update := metadata.AttrsUpdate(attrs)
+	if len(update) == 0 {
+		return nil
+	}
+
+	return gridfs.Files.UpdateId(gridFile.Id(), update)
+}
+
+// attrsOf returns custom attributes of file with given id, ext is the
+// ext metadata of its entity. A duplication has its own attributes.
+func (duplfs *DuplFs) attrsOf(id string, ext *FileMeta) map[string]string {
+	if len(id) == 0 || !util.IsDuplId(id) {
+		return ext.Attrs
+	}
+
+	realId, err := hexString2ObjectId(util.GetRealId(id))
+	if err != nil {
+		return nil
+	}
+
+	dupl, err := duplfs.LookupDuplById(*realId)
+	if err != nil || dupl == nil {
+		glog.V(4).Infof("Failed to lookup attributes of dupl %s, %v.", id, err)
+		return nil
+	}
+
+	return dupl.Attrs
+}
+
+// domainOr returns the domain stored, or domain given for a legacy
+// file stored without one.
+func (fm *FileMeta) domainOr(domain int64) int64 {
+	if fm.Domain == 0 {
+		return domain
+	}
+
+	return fm.Domain
+}
+
+// lookupExtMeta returns the metadata of a gridfs file which
+// mgo.GridFile does not carry, such as sha256, custom attributes,
+// expire time and codec. It never returns nil.
+func lookupExtMeta(gridfs *mgo.GridFS, id interface{}) *FileMeta {
+	fm := new(FileMeta)
+	if err := gridfs.Files.FindId(id).Select(bson.M{"domain": 1, "sha256": 1, "attrs": 1, "expiretime": 1, "codec": 1}).One(fm); err != nil {
+		glog.V(4).Infof("Failed to lookup ext metadata of %v, %v.", id, err)
+		return new(FileMeta)
+	}
+
+	return fm
+}
+
 func hexString2ObjectId(hex string) (*bson.ObjectId, error) {
 	if bson.IsObjectIdHex(hex) {
 		oid := bson.ObjectIdHex(hex)
@@ -0,0 +1,329 @@
+package fileop
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/golang/glog"
+
+	"jingoal.com/dfs/conf"
+	"jingoal.com/dfs/meta"
+	"jingoal.com/dfs/proto/transfer"
+)
+
+const (
+	// MetaKey_KeyId is the key of the id of data key which encrypted
+	// the entity. A file without it is stored in plain.
+	MetaKey_KeyId = "keyid"
+	// MetaKey_KeyIv is the key of the initial vector of entity in hex.
+	MetaKey_KeyIv = "keyiv"
+)
+
+// EncryptHandler implements interface DFSFileHandler.
+// It encrypts entities of the domains which have encryption enabled
+// on creating, and decrypts entities which have a key id on opening.
+// Entities are encrypted with AES in CTR mode by the underlying files,
+// under their codecs, so content is compressed before encrypted, and
+// md5 and sha256 kept are of the plain content.
+type EncryptHandler struct {
+	// embedded DFSFileHandler
+	DFSFileHandler
+
+	provider KeyProvider
+}
+
+// Create creates a DFSFile for write
+func (eh *EncryptHandler) Create(info *transfer.FileInfo) (DFSFile, error) {
+	return eh.createFile(info, func() (DFSFile, error) {
+		return eh.DFSFileHandler.Create(info)
+	})
+}
+
+// CreateWithChunkSize creates a DFSFile for write with the given chunk size.
+func (eh *EncryptHandler) CreateWithChunkSize(info *transfer.FileInfo, chunkSize int64) (DFSFile, error) {
+	return eh.createFile(info, func() (DFSFile, error) {
+		return CreateWithChunkSize(eh.DFSFileHandler, info, chunkSize)
+	})
+}
+
+// createFile creates a file with function create, and encrypts it
+// if encryption is enabled for its domain.
+func (eh *EncryptHandler) createFile(info *transfer.FileInfo, create func() (DFSFile, error)) (DFSFile, error) {
+	if !conf.IsEncryptEnabled(info.Domain) {
+		return create()
+	}
+
+	// Get key before creating, to leave nothing behind on failure.
+	keyId, key, err := eh.provider.DataKey(info.Domain)
+	if err != nil {
+		glog.Warningf("Failed to get data key of domain %d, %v", info.Domain, err)
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	iv := make([]byte, block.BlockSize())
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+
+	f, err := create()
+	if err != nil {
+		return f, err
+	}
+
+	if err := encryptEntity(f, block, iv); err != nil {
+		glog.Warningf("Failed to encrypt file %s, %v", f.GetFileInfo().Id, err)
+		f.Close()
+		return nil, err
+	}
+
+	f.updateFileMeta(map[string]interface{}{
+		MetaKey_KeyId: keyId,
+		MetaKey_KeyIv: hex.EncodeToString(iv),
+	})
+	glog.V(3).Infof("Create encrypted file %s with key %s.", f.GetFileInfo().Id, keyId)
+
+	return f, nil
+}
+
+// Open opens a DFSFile for read
+func (eh *EncryptHandler) Open(id string, domain int64) (DFSFile, error) {
+	_, m, info, err := eh.DFSFileHandler.Find(id)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := eh.DFSFileHandler.Open(id, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	if m == nil || len(m.KeyId) == 0 {
+		return f, nil
+	}
+
+	// A duplication may be in another domain than its entity.
+	keyDomain := domain
+	if info != nil {
+		keyDomain = info.Domain
+	}
+
+	block, iv, err := eh.cipherOf(keyDomain, m)
+	if err == nil {
+		err = encryptEntity(f, block, iv)
+	}
+	if err != nil {
+		f.Close()
+		glog.Warningf("Failed to open encrypted file %s, %v", id, err)
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (eh *EncryptHandler) cipherOf(domain int64, m *DFSFileMeta) (cipher.Block, []byte, error) {
+	key, err := eh.provider.KeyById(domain, m.KeyId)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	iv, err := hex.DecodeString(m.KeyIv)
+	if err != nil || len(iv) != block.BlockSize() {
+		return nil, nil, fmt.Errorf("invalid iv '%s'", m.KeyIv)
+	}
+
+	return block, iv, nil
+}
+
+// Remove deletes a file by its id.
+func (eh *EncryptHandler) Remove(id string, domain int64) (bool, *meta.File, error) {
+	return eh.DFSFileHandler.Remove(id, domain)
+}
+
+// Close releases resources the handler holds.
+func (eh *EncryptHandler) Close() error {
+	return eh.DFSFileHandler.Close()
+}
+
+// Duplicate duplicates an entry for a file.
+func (eh *EncryptHandler) Duplicate(oid string, domain int64) (string, error) {
+	return eh.DFSFileHandler.Duplicate(oid, domain)
+}
+
+// Find finds a file, if the file not exists, return empty string.
+// If the file exists, return its file id.
+// If the file exists and is a duplication, return its primitive file id.
+func (eh *EncryptHandler) Find(fid string) (string, *DFSFileMeta, *transfer.FileInfo, error) {
+	return eh.DFSFileHandler.Find(fid)
+}
+
+// Name returns handler's name.
+func (eh *EncryptHandler) Name() string {
+	return eh.DFSFileHandler.Name()
+}
+
+// HealthStatus returns the status of node health.
+func (eh *EncryptHandler) HealthStatus() int {
+	return eh.DFSFileHandler.HealthStatus()
+}
+
+// FindByMd5 finds a file by its md5. Nothing is found for the domains
+// which have encryption enabled, since a file put before encryption
+// enabled has the same md5, and a new file should never share a plain
+// entity.
+func (eh *EncryptHandler) FindByMd5(md5 string, domain int64, size int64) (string, error) {
+	if conf.IsEncryptEnabled(domain) {
+		return "", meta.FileNotFound
+	}
+
+	return eh.DFSFileHandler.FindByMd5(md5, domain, size)
+}
+
+// FindBySha256 finds a file by its sha256. As FindByMd5, nothing is
+// found for the domains which have encryption enabled.
+func (eh *EncryptHandler) FindBySha256(sha256 string, domain int64, size int64) (string, error) {
+	if conf.IsEncryptEnabled(domain) {
+		return "", meta.FileNotFound
+	}
+
+	return eh.DFSFileHandler.FindBySha256(sha256, domain, size)
+}
+
+// List lists files which match the filter, starts after cursor.
+func (eh *EncryptHandler) List(filter *meta.FileFilter, cursor string, limit int) ([]*transfer.FileInfo, string, error) {
+	return ListFiles(eh.DFSFileHandler, filter, cursor, limit)
+}
+
+// UpdateAttrs updates custom attributes of a file.
+func (eh *EncryptHandler) UpdateAttrs(id string, domain int64, attrs map[string]string) error {
+	return UpdateAttrs(eh.DFSFileHandler, id, domain, attrs)
+}
+
+// NewEncryptHandler creates an EncryptHandler which gets data keys
+// from provider.
+func NewEncryptHandler(originalHandler DFSFileHandler, provider KeyProvider) *EncryptHandler {
+	return &EncryptHandler{
+		DFSFileHandler: originalHandler,
+		provider:       provider,
+	}
+}
+
+// entityEncrypter represents a file which encrypts its entity.
+// Files encrypt entities under their codecs, and hash the content
+// before compressed and encrypted.
+type entityEncrypter interface {
+	// encryptEntity encrypts the entity with block and iv from now on.
+	// It must be called before anything read or written.
+	encryptEntity(block cipher.Block, iv []byte) error
+}
+
+// encryptEntity encrypts the entity of file f with block and iv.
+func encryptEntity(f DFSFile, block cipher.Block, iv []byte) error {
+	ee, ok := f.(entityEncrypter)
+	if !ok {
+		return fmt.Errorf("file %T not support encryption", f)
+	}
+
+	return ee.encryptEntity(block, iv)
+}
+
+// entityCipher encrypts and decrypts an entity with AES in CTR mode,
+// so the size of entity is kept and seeking is supported.
+type entityCipher struct {
+	block  cipher.Block
+	iv     []byte
+	stream cipher.Stream
+	buf    []byte
+}
+
+// encrypt returns the cipher text of p, in a buffer reused by the
+// next call.
+func (c *entityCipher) encrypt(p []byte) []byte {
+	if cap(c.buf) < len(p) {
+		c.buf = make([]byte, len(p))
+	}
+	buf := c.buf[:len(p)]
+	c.stream.XORKeyStream(buf, p)
+
+	return buf
+}
+
+// decrypt decrypts p in place.
+func (c *entityCipher) decrypt(p []byte) {
+	c.stream.XORKeyStream(p, p)
+}
+
+// seek sets the offset of entity for the next encrypt or decrypt.
+func (c *entityCipher) seek(offset int64) {
+	c.stream = newCTRAt(c.block, c.iv, offset)
+}
+
+// writer returns a writer which encrypts content into w.
+func (c *entityCipher) writer(w io.Writer) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		return w.Write(c.encrypt(p))
+	})
+}
+
+// reader returns a reader which decrypts content from r.
+func (c *entityCipher) reader(r io.Reader) io.Reader {
+	return readerFunc(func(p []byte) (int, error) {
+		n, err := r.Read(p)
+		if n > 0 {
+			c.decrypt(p[:n])
+		}
+		return n, err
+	})
+}
+
+// newEntityCipher creates an entityCipher with block and iv, which
+// starts at the beginning of entity.
+func newEntityCipher(block cipher.Block, iv []byte) *entityCipher {
+	return &entityCipher{
+		block:  block,
+		iv:     iv,
+		stream: newCTRAt(block, iv, 0),
+	}
+}
+
+// newCTRAt returns a CTR stream which starts at offset of content.
+func newCTRAt(block cipher.Block, iv []byte, offset int64) cipher.Stream {
+	bs := int64(block.BlockSize())
+
+	ctr := make([]byte, len(iv))
+	copy(ctr, iv)
+	// Add the number of blocks before offset to counter, in big endian.
+	n := uint64(offset / bs)
+	for i := len(ctr) - 1; i >= 0 && n > 0; i-- {
+		n += uint64(ctr[i])
+		ctr[i] = byte(n)
+		n >>= 8
+	}
+
+	stream := cipher.NewCTR(block, ctr)
+	if skip := offset % bs; skip > 0 {
+		discard := make([]byte, skip)
+		stream.XORKeyStream(discard, discard)
+	}
+
+	return stream
+}
+
+// checkDataKey checks the length of an AES key.
+func checkDataKey(key []byte) error {
+	switch len(key) {
+	case 16, 24, 32:
+		return nil
+	}
+
+	return fmt.Errorf("invalid key size %d", len(key))
+}
@@ -0,0 +1,127 @@
+package fileop
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func testCipher(t *testing.T) (cipher.Block, []byte) {
+	block, err := aes.NewCipher(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := bytes.Repeat([]byte{0xff}, block.BlockSize()) // counter overflows.
+
+	return block, iv
+}
+
+func TestEntityCipher(t *testing.T) {
+	block, iv := testCipher(t)
+
+	content := make([]byte, 1000)
+	for i := range content {
+		content[i] = byte(i)
+	}
+
+	buf := new(bytes.Buffer)
+	w := newEntityCipher(block, iv).writer(buf)
+	for _, chunk := range [][]byte{content[:1], content[1:333], content[333:]} {
+		if _, err := w.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if buf.Len() != len(content) || bytes.Equal(buf.Bytes(), content) {
+		t.Fatalf("content not encrypted")
+	}
+
+	entity := bytes.NewReader(buf.Bytes())
+	ec := newEntityCipher(block, iv)
+	got, err := ioutil.ReadAll(ec.reader(entity))
+	if err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("content not decrypted, %v", err)
+	}
+
+	for _, offset := range []int64{0, 15, 16, 17, 500, 999} {
+		pos, err := entity.Seek(offset, io.SeekStart)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ec.seek(pos)
+		got, err := ioutil.ReadAll(ec.reader(entity))
+		if err != nil || !bytes.Equal(got, content[offset:]) {
+			t.Errorf("content not decrypted from offset %d, %v", offset, err)
+		}
+	}
+}
+
+func TestCompressThenEncrypt(t *testing.T) {
+	block, iv := testCipher(t)
+	content := bytes.Repeat([]byte("compressible content "), 100)
+
+	buf := new(bytes.Buffer)
+	zw, err := newCodecWriter(CodecGzip, newEntityCipher(block, iv).writer(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zw.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cipher text does not compress, so content is compressed first.
+	if buf.Len() >= len(content) {
+		t.Fatalf("content not compressed, %d bytes stored", buf.Len())
+	}
+	plain := append([]byte(nil), buf.Bytes()...)
+	newEntityCipher(block, iv).decrypt(plain)
+	if plain[0] != 0x1f || plain[1] != 0x8b {
+		t.Fatalf("entity is not a gzip stream encrypted")
+	}
+
+	zr, err := newCodecReader(CodecGzip, newEntityCipher(block, iv).reader(bytes.NewReader(buf.Bytes())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(zr)
+	if err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("content not restored, %v", err)
+	}
+}
+
+func TestFileKeyProvider(t *testing.T) {
+	f, err := ioutil.TempFile("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	k1 := "00112233445566778899aabbccddeeff"
+	k2 := "ffeeddccbbaa99887766554433221100"
+	f.WriteString("# test keys\n\n0 k0 " + k1 + "\n2 k1 " + k1 + "\n2 k2 " + k2 + "\n")
+	f.Close()
+
+	p, err := NewFileKeyProvider(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id, _, err := p.DataKey(2); err != nil || id != "k2" {
+		t.Errorf("current key of domain 2, expected k2, got %s, %v", id, err)
+	}
+	if id, _, err := p.DataKey(3); err != nil || id != "k0" {
+		t.Errorf("current key of domain 3, expected k0, got %s, %v", id, err)
+	}
+	if _, err := p.KeyById(2, "k1"); err != nil {
+		t.Errorf("rotated key k1 of domain 2 not found, %v", err)
+	}
+	if _, err := p.KeyById(3, "k1"); err == nil {
+		t.Errorf("key k1 of domain 2 found for domain 3")
+	}
+}
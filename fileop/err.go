@@ -10,7 +10,8 @@ const (
 )
 
 var (
-	NoEntityError = fmt.Errorf("no entity")
+	NoEntityError        = fmt.Errorf("no entity")
+	UnsupportedSeekError = fmt.Errorf("unsupported seek")
 )
 
 type RecoverableFileError struct {
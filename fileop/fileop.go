@@ -2,7 +2,9 @@
 package fileop
 
 import (
+	"fmt"
 	"io"
+	"io/ioutil"
 
 	"jingoal.com/dfs/meta"
 	"jingoal.com/dfs/proto/transfer"
@@ -25,12 +27,17 @@ type DFSFileMeta struct {
 	Bizname   string `bson:"bizname"`
 	Fid       string `bson:"weedfid"`
 	ChunkSize int64  `bson:"chunksize"`
+	KeyId     string `bson:"keyid,omitempty"`
+	KeyIv     string `bson:"keyiv,omitempty"`
 }
 
 // DFSFile represents a file of the underlying storage.
 type DFSFile interface {
 	io.ReadWriteCloser
 
+	// Seek sets the offset for the next Read, only valid for read mode.
+	io.Seeker
+
 	// GetFileInfo returns file info.
 	GetFileInfo() *transfer.FileInfo
 
@@ -66,6 +73,9 @@ type DFSFileHandler interface {
 	// FindByMd5 finds a file by its md5.
 	FindByMd5(md5 string, domain int64, size int64) (string, error)
 
+	// FindBySha256 finds a file by its sha256.
+	FindBySha256(sha256 string, domain int64, size int64) (string, error)
+
 	// Name returns handler's name.
 	Name() string
 
@@ -76,6 +86,70 @@ type DFSFileHandler interface {
 	Close() error
 }
 
+// DFSFileChunkedCreator represents a handler which can create a file
+// with the chunk size given by client.
+type DFSFileChunkedCreator interface {
+	// CreateWithChunkSize creates a DFSFile for write with the given chunk size.
+	CreateWithChunkSize(info *transfer.FileInfo, chunkSize int64) (DFSFile, error)
+}
+
+// CreateWithChunkSize creates a DFSFile for write with the given chunk size
+// if the handler supports it, otherwise the chunk size is ignored.
+func CreateWithChunkSize(h DFSFileHandler, info *transfer.FileInfo, chunkSize int64) (DFSFile, error) {
+	if creator, ok := h.(DFSFileChunkedCreator); ok {
+		return creator.CreateWithChunkSize(info, chunkSize)
+	}
+
+	return h.Create(info)
+}
+
+// DFSFileLister represents a handler which can enumerate its files.
+type DFSFileLister interface {
+	// List lists files which match the filter, starts after cursor.
+	// It returns an empty cursor when there is no more file.
+	List(filter *meta.FileFilter, cursor string, limit int) ([]*transfer.FileInfo, string, error)
+}
+
+// ListFiles lists files of the handler if it supports listing.
+func ListFiles(h DFSFileHandler, filter *meta.FileFilter, cursor string, limit int) ([]*transfer.FileInfo, string, error) {
+	if lister, ok := h.(DFSFileLister); ok {
+		return lister.List(filter, cursor, limit)
+	}
+
+	return nil, "", fmt.Errorf("handler %s does not support listing", h.Name())
+}
+
+// listFileMeta converts the files listed from metadata into file infos.
+func listFileMeta(files []*meta.File, next string, err error) ([]*transfer.FileInfo, string, error) {
+	if err != nil {
+		return nil, "", err
+	}
+
+	result := make([]*transfer.FileInfo, 0, len(files))
+	for _, f := range files {
+		result = append(result, transfer.File2Info(f))
+	}
+
+	return result, next, nil
+}
+
+// DFSFileAttrUpdater represents a handler which can update custom
+// attributes of its files.
+type DFSFileAttrUpdater interface {
+	// UpdateAttrs updates custom attributes of a file.
+	// An attribute with empty value will be removed.
+	UpdateAttrs(id string, domain int64, attrs map[string]string) error
+}
+
+// UpdateAttrs updates custom attributes of a file if the handler supports it.
+func UpdateAttrs(h DFSFileHandler, id string, domain int64, attrs map[string]string) error {
+	if updater, ok := h.(DFSFileAttrUpdater); ok {
+		return updater.UpdateAttrs(id, domain, attrs)
+	}
+
+	return fmt.Errorf("handler %s does not support attributes", h.Name())
+}
+
 type DFSFileMinorHandler interface {
 	DFSFileHandler
 
@@ -89,6 +163,21 @@ type DFSFileMinorHandler interface {
 	InitVolumeCB(host, name, base string) error
 }
 
+// seekOrSkip sets the offset for the next Read on r. If r can not seek,
+// the bytes before offset are read and discarded, so only io.SeekStart
+// on a freshly opened reader is supported.
+func seekOrSkip(r io.Reader, offset int64, whence int) (int64, error) {
+	if s, ok := r.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+
+	if whence != io.SeekStart || offset < 0 {
+		return 0, UnsupportedSeekError
+	}
+
+	return io.CopyN(ioutil.Discard, r, offset)
+}
+
 func healthStatus2String(status int) string {
 	switch status {
 	case HealthOk:
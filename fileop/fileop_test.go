@@ -0,0 +1,45 @@
+package fileop
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// onlyReader hides the Seek method of the underlying reader.
+type onlyReader struct {
+	io.Reader
+}
+
+func TestSeekOrSkip(t *testing.T) {
+	content := []byte("0123456789")
+
+	for _, offset := range []int64{0, 3, 9, 10} {
+		// A seeker seeks, others skip the bytes before offset.
+		for _, r := range []io.Reader{bytes.NewReader(content), onlyReader{bytes.NewReader(content)}} {
+			pos, err := seekOrSkip(r, offset, io.SeekStart)
+			if err != nil || pos != offset {
+				t.Fatalf("seek %T to %d, got %d, %v", r, offset, pos, err)
+			}
+			got, err := ioutil.ReadAll(r)
+			if err != nil || !bytes.Equal(got, content[offset:]) {
+				t.Errorf("%T, expected %q from %d, got %q, %v", r, content[offset:], offset, got, err)
+			}
+		}
+	}
+
+	// Skipping beyond the end stops at the end.
+	if pos, err := seekOrSkip(onlyReader{bytes.NewReader(content)}, 11, io.SeekStart); err != io.EOF || pos != 10 {
+		t.Errorf("expected EOF at 10, got %d, %v", pos, err)
+	}
+
+	for _, whence := range []int{io.SeekCurrent, io.SeekEnd} {
+		if _, err := seekOrSkip(onlyReader{bytes.NewReader(content)}, 1, whence); err != UnsupportedSeekError {
+			t.Errorf("whence %d, expected UnsupportedSeekError, got %v", whence, err)
+		}
+	}
+	if _, err := seekOrSkip(onlyReader{bytes.NewReader(content)}, -1, io.SeekStart); err != UnsupportedSeekError {
+		t.Errorf("expected UnsupportedSeekError of negative offset, got %v", err)
+	}
+}
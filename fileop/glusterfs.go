@@ -1,7 +1,9 @@
 package fileop
 
 import (
+	"crypto/cipher"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"hash"
@@ -158,6 +160,7 @@ func (h *GlusterHandler) Create(info *transfer.FileInfo) (f DFSFile, err error)
 
 	file := &GlusterFile{
 		md5:     md5.New(),
+		sha256:  sha256.New(),
 		mode:    FileModeWrite,
 		handler: h,
 		meta:    make(map[string]interface{}),
@@ -178,6 +181,14 @@ func (h *GlusterHandler) Create(info *transfer.FileInfo) (f DFSFile, err error)
 	}
 
 	file.glf, err = h.CreateGlusterFile(file.info.Domain, file.info.Id)
+	if err != nil {
+		return
+	}
+
+	if codec := chooseCodec(info); codec != "" {
+		file.codec = codec
+		file.zw, err = newCodecWriter(codec, file.glf)
+	}
 	return
 }
 
@@ -258,13 +269,26 @@ func (h *GlusterHandler) Open(id string, domain int64) (f DFSFile, err error) {
 	result.grf = gridFile
 	result.session = session
 	result.gridfs = gridfs
+
+	ext := lookupExtMeta(gridfs, oid)
 	result.info = &transfer.FileInfo{
-		Id:     id,
-		Domain: domain,
-		Name:   gridFile.Name(),
-		Size:   gridFile.Size(),
-		Md5:    gridFile.MD5(),
-		Biz:    gridMeta.Bizname,
+		Id:         id,
+		Domain:     ext.domainOr(domain),
+		Name:       gridFile.Name(),
+		Size:       gridFile.Size(),
+		Md5:        gridFile.MD5(),
+		Sha256:     ext.Sha256,
+		Biz:        gridMeta.Bizname,
+		Attrs:      h.duplfs.attrsOf(id, ext),
+		ExpireTime: ext.ExpireTime,
+	}
+
+	if len(ext.Codec) > 0 && result.hasEntity() {
+		result.codec = ext.Codec
+		if result.zr, err = newCodecReader(ext.Codec, readerFunc(result.readEntity)); err != nil {
+			result.glf.Close()
+			return
+		}
 	}
 	f = result
 
@@ -304,13 +328,18 @@ func (h *GlusterHandler) Find(id string) (string, *DFSFileMeta, *transfer.FileIn
 		return "", nil, nil, err
 	}
 
+	ext := lookupExtMeta(gridfs, oid)
 	info := &transfer.FileInfo{
-		Id:   id,
-		Name: gridFile.Name(),
-		Size: gridFile.Size(),
-		Md5:  gridFile.MD5(),
-		Biz:  meta.Bizname,
-		// TODO(hanyh): add Domain and User
+		Id:         id,
+		Name:       gridFile.Name(),
+		Size:       gridFile.Size(),
+		Md5:        gridFile.MD5(),
+		Sha256:     ext.Sha256,
+		Biz:        meta.Bizname,
+		Attrs:      h.duplfs.attrsOf(id, ext),
+		Domain:     ext.Domain,
+		ExpireTime: ext.ExpireTime,
+		// TODO(hanyh): add User
 	}
 
 	glog.V(3).Infof("Succeeded to find file %s, return %s", id, oid.Hex())
@@ -414,6 +443,41 @@ func (h *GlusterHandler) FindByMd5(md5 string, domain int64, size int64) (string
 	return oid.Hex(), nil
 }
 
+// FindBySha256 finds a file by its sha256.
+func (h *GlusterHandler) FindBySha256(sha256 string, domain int64, size int64) (string, error) {
+	file, err := h.duplfs.FindBySha256(h.gridfs, sha256, domain, size)
+	if err != nil {
+		return "", err
+	}
+
+	oid, ok := file.Id().(bson.ObjectId)
+	if !ok {
+		return "", fmt.Errorf("Invalid id, %T, %v", file.Id(), file.Id())
+	}
+
+	return oid.Hex(), nil
+}
+
+// List lists files which match the filter, starts after cursor.
+func (h *GlusterHandler) List(filter *meta.FileFilter, cursor string, limit int) ([]*transfer.FileInfo, string, error) {
+	session, gridfs := h.copySessionAndGridFS()
+	defer func() {
+		h.ensureReleaseSession(session)
+	}()
+
+	return listFileMeta(h.duplfs.List(gridfs, filter, cursor, limit))
+}
+
+// UpdateAttrs updates custom attributes of a file.
+func (h *GlusterHandler) UpdateAttrs(id string, domain int64, attrs map[string]string) error {
+	session, gridfs := h.copySessionAndGridFS()
+	defer func() {
+		h.ensureReleaseSession(session)
+	}()
+
+	return h.duplfs.UpdateAttrs(gridfs, id, attrs)
+}
+
 // NewGlusterHandler creates a GlusterHandler.
 func NewGlusterHandler(shardInfo *metadata.Shard, volLog string) (*GlusterHandler, error) {
 	handler := &GlusterHandler{
@@ -457,6 +521,7 @@ func NewGlusterHandler(shardInfo *metadata.Shard, volLog string) (*GlusterHandle
 	}
 
 	handler.duplfs = NewDuplFs(duplOp)
+	handler.duplfs.EnsureIndexes(handler.gridfs)
 
 	return handler, nil
 }
@@ -467,6 +532,7 @@ type GlusterFile struct {
 	glf     *gfapi.File   // Gluster file
 	grf     *mgo.GridFile // GridFile
 	md5     hash.Hash
+	sha256  hash.Hash
 	mode    dfsFileMode
 	handler *GlusterHandler
 
@@ -474,6 +540,11 @@ type GlusterFile struct {
 
 	session *mgo.Session
 	gridfs  *mgo.GridFS
+
+	codec string         // codec of entity, empty for raw.
+	zw    io.WriteCloser // compressor of entity, nil for raw.
+	zr    io.Reader      // decompressor of entity, nil for raw.
+	ec    *entityCipher  // cipher of entity, nil for plain.
 }
 
 // GetFileInfo returns file meta info.
@@ -503,14 +574,44 @@ func (f GlusterFile) Read(p []byte) (int, error) {
 		return 0, NoEntityError
 	}
 
+	if f.zr != nil {
+		return f.zr.Read(p)
+	}
+
+	return f.readEntity(p)
+}
+
+// readEntity reads the content of entity decrypted, but still
+// compressed if a codec is used.
+func (f GlusterFile) readEntity(p []byte) (int, error) {
 	nr, er := f.glf.Read(p)
 	// When reached EOF, glf returns nr=0 other than er=io.EOF, fix it.
 	if nr <= 0 {
 		return 0, io.EOF
 	}
+	if f.ec != nil {
+		f.ec.decrypt(p[:nr])
+	}
 	return nr, er
 }
 
+// Seek sets the offset for the next Read.
+func (f GlusterFile) Seek(offset int64, whence int) (int64, error) {
+	if !f.hasEntity() {
+		return 0, NoEntityError
+	}
+
+	if f.zr != nil {
+		return seekOrSkip(f.zr, offset, whence)
+	}
+
+	pos, err := f.glf.Seek(offset, whence)
+	if err == nil && f.ec != nil {
+		f.ec.seek(pos)
+	}
+	return pos, err
+}
+
 // Write writes len(p) bytes to the file.
 // Returns number of bytes written and an error if any.
 func (f GlusterFile) Write(p []byte) (int, error) {
@@ -522,7 +623,7 @@ func (f GlusterFile) Write(p []byte) (int, error) {
 		}
 
 		var err error
-		n, err = f.glf.Write(p)
+		n, err = f.entityWriter().Write(p)
 		if err != nil {
 			return 0, err
 		}
@@ -532,10 +633,45 @@ func (f GlusterFile) Write(p []byte) (int, error) {
 
 	f.info.Size += int64(n)
 	f.md5.Write(p)
+	f.sha256.Write(p)
 
 	return n, nil
 }
 
+// entityWriter returns the writer of entity, which compresses
+// content if a codec is chosen.
+func (f GlusterFile) entityWriter() io.Writer {
+	if f.zw != nil {
+		return f.zw
+	}
+
+	return f.encryptedWriter()
+}
+
+// encryptedWriter returns the writer of entity under the codec,
+// which encrypts content if a cipher is set.
+func (f GlusterFile) encryptedWriter() io.Writer {
+	if f.ec != nil {
+		return f.ec.writer(f.glf)
+	}
+
+	return f.glf
+}
+
+// encryptEntity encrypts the entity with block and iv, under the codec.
+func (f *GlusterFile) encryptEntity(block cipher.Block, iv []byte) (err error) {
+	f.ec = newEntityCipher(block, iv)
+
+	if f.zw != nil {
+		f.zw, err = newCodecWriter(f.codec, f.encryptedWriter())
+	}
+	if f.zr != nil {
+		f.zr, err = newCodecReader(f.codec, readerFunc(f.readEntity))
+	}
+
+	return
+}
+
 // Close closes an open GlusterFile.
 // Returns an error on failure.
 func (f GlusterFile) Close() error {
@@ -546,6 +682,12 @@ func (f GlusterFile) Close() error {
 		}
 	}()
 
+	if f.zw != nil {
+		if err := f.zw.Close(); err != nil {
+			return err
+		}
+	}
+
 	if f.hasEntity() {
 		if err := f.glf.Close(); err != nil {
 			return err
@@ -562,6 +704,7 @@ func (f GlusterFile) Close() error {
 	}
 
 	if f.mode == FileModeWrite {
+		f.info.Sha256 = hex.EncodeToString(f.sha256.Sum(nil))
 		return f.updateMetadata()
 	}
 
@@ -603,6 +746,24 @@ func (f GlusterFile) additionalMetadata() bson.D {
 	opdata = append(opdata, bson.DocElem{
 		"md5", hex.EncodeToString(f.md5.Sum(nil)),
 	})
+	opdata = append(opdata, bson.DocElem{
+		"sha256", f.info.Sha256,
+	})
+	if len(f.info.Attrs) > 0 {
+		opdata = append(opdata, bson.DocElem{
+			"attrs", f.info.Attrs,
+		})
+	}
+	if f.info.ExpireTime > 0 {
+		opdata = append(opdata, bson.DocElem{
+			"expiretime", f.info.ExpireTime,
+		})
+	}
+	if len(f.codec) > 0 {
+		opdata = append(opdata, bson.DocElem{
+			MetaKey_Codec, f.codec,
+		})
+	}
 
 	return opdata
 }
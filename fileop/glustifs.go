@@ -1,7 +1,9 @@
 package fileop
 
 import (
+	"crypto/cipher"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
 	"flag"
 	"fmt"
@@ -104,7 +106,14 @@ func (h *GlustiHandler) Create(info *transfer.FileInfo) (DFSFile, error) {
 		Domain:    info.Domain,
 		ChunkSize: -1, // means no use.
 		Type:      meta.EntityGlusterFS,
-		ExtAttr:   make(map[string]string),
+		ExtAttr:   meta.ExtAttrs(info.Attrs, info.ExpireTime),
+	}
+
+	if codec := chooseCodec(info); codec != "" && file.hasEntity() {
+		if file.zw, err = newCodecWriter(codec, file.glf); err != nil {
+			return nil, err
+		}
+		file.sdf.ExtAttr[MetaKey_Codec] = codec
 	}
 
 	// Make a copy of file info to hold information of file.
@@ -122,6 +131,7 @@ func (h *GlustiHandler) createGlustiFile(name string) (*GlustiFile, error) {
 		return &GlustiFile{
 			glf:     nil,
 			md5:     md5.New(),
+			sha256:  sha256.New(),
 			mode:    FileModeWrite,
 			handler: h,
 		}, nil
@@ -140,6 +150,7 @@ func (h *GlustiHandler) createGlustiFile(name string) (*GlustiFile, error) {
 	return &GlustiFile{
 		glf:     f,
 		md5:     md5.New(),
+		sha256:  sha256.New(),
 		mode:    FileModeWrite,
 		handler: h,
 	}, nil
@@ -160,12 +171,22 @@ func (h *GlustiHandler) Open(id string, domain int64) (DFSFile, error) {
 
 	f.sdf = fm
 	f.info = &transfer.FileInfo{
-		Id:     fm.Id,
-		Domain: fm.Domain,
-		Name:   fm.Name,
-		Size:   fm.Size,
-		Md5:    fm.Md5,
-		Biz:    fm.Biz,
+		Id:         fm.Id,
+		Domain:     fm.Domain,
+		Name:       fm.Name,
+		Size:       fm.Size,
+		Md5:        fm.Md5,
+		Sha256:     fm.Sha256,
+		Biz:        fm.Biz,
+		Attrs:      meta.UserAttrs(fm.ExtAttr),
+		ExpireTime: meta.ExpireTime(fm.ExtAttr),
+	}
+
+	if codec := fm.ExtAttr[MetaKey_Codec]; codec != "" {
+		if f.zr, err = newCodecReader(codec, readerFunc(f.readEntity)); err != nil {
+			f.glf.Close()
+			return nil, err
+		}
 	}
 
 	glog.V(2).Infof("Succeeded to open file %s, from %s.", id, h.Name())
@@ -193,10 +214,14 @@ func (h *GlustiHandler) Find(id string) (string, *DFSFileMeta, *transfer.FileInf
 		chunksize = -1
 	}
 
+	attrs := meta.UserAttrs(f.ExtAttr)
+	expireTime := meta.ExpireTime(f.ExtAttr)
 	meta := &DFSFileMeta{
 		Bizname:   f.Biz,
 		Fid:       f.ExtAttr[MetaKey_WeedFid],
 		ChunkSize: chunksize,
+		KeyId:     f.ExtAttr[MetaKey_KeyId],
+		KeyIv:     f.ExtAttr[MetaKey_KeyIv],
 	}
 
 	var userId int64
@@ -206,13 +231,16 @@ func (h *GlustiHandler) Find(id string) (string, *DFSFileMeta, *transfer.FileInf
 	}
 
 	info := &transfer.FileInfo{
-		Id:     id,
-		Name:   f.Name,
-		Size:   f.Size,
-		Md5:    f.Md5,
-		Biz:    f.Biz,
-		Domain: f.Domain,
-		User:   userId,
+		Id:         id,
+		Name:       f.Name,
+		Size:       f.Size,
+		Md5:        f.Md5,
+		Sha256:     f.Sha256,
+		Biz:        f.Biz,
+		Domain:     f.Domain,
+		User:       userId,
+		Attrs:      attrs,
+		ExpireTime: expireTime,
 	}
 
 	glog.V(2).Infof("Succeeded to find file %s, entity %s, from %s.", id, f.Id, h.Name())
@@ -297,6 +325,28 @@ func (h *GlustiHandler) FindByMd5(md5 string, domain int64, size int64) (string,
 	return file.Id, nil
 }
 
+// FindBySha256 finds a file by its sha256.
+func (h *GlustiHandler) FindBySha256(sha256 string, domain int64, size int64) (string, error) {
+	file, err := h.tiop.FindBySha256(sha256, domain) // ignore size
+	if err != nil {
+		return "", err
+	}
+
+	glog.V(2).Infof("Succeeded to find by sha256 %s %d, from %s.", sha256, domain, h.Name())
+
+	return file.Id, nil
+}
+
+// List lists files which match the filter, starts after cursor.
+func (h *GlustiHandler) List(filter *meta.FileFilter, cursor string, limit int) ([]*transfer.FileInfo, string, error) {
+	return listFileMeta(h.tiop.List(filter, cursor, limit))
+}
+
+// UpdateAttrs updates custom attributes of a file.
+func (h *GlustiHandler) UpdateAttrs(id string, domain int64, attrs map[string]string) error {
+	return h.tiop.UpdateAttrs(id, meta.ExtUserAttrs(attrs))
+}
+
 // CreateWithGivenId creates a DFSFile with the given id.
 func (h *GlustiHandler) CreateWithGivenId(info *transfer.FileInfo) (DFSFile, error) {
 	return h.Create(info)
@@ -351,8 +401,13 @@ type GlustiFile struct {
 	glf     *gfapi.File // Gluster file
 	sdf     *meta.File
 	md5     hash.Hash
+	sha256  hash.Hash
 	mode    dfsFileMode
 	handler *GlustiHandler
+
+	zw io.WriteCloser // compressor of entity, nil for raw.
+	zr io.Reader      // decompressor of entity, nil for raw.
+	ec *entityCipher  // cipher of entity, nil for plain.
 }
 
 // GetFileInfo returns file meta info.
@@ -363,14 +418,40 @@ func (f GlustiFile) GetFileInfo() *transfer.FileInfo {
 // Read reads atmost len(p) bytes into p.
 // Returns number of bytes read and an error if any.
 func (f GlustiFile) Read(p []byte) (int, error) {
+	if f.zr != nil {
+		return f.zr.Read(p)
+	}
+
+	return f.readEntity(p)
+}
+
+// readEntity reads the content of entity decrypted, but still
+// compressed if a codec is used.
+func (f GlustiFile) readEntity(p []byte) (int, error) {
 	nr, er := f.glf.Read(p)
 	// When reached EOF, glf returns nr=0 other than er=io.EOF, fix it.
 	if nr <= 0 {
 		return 0, io.EOF
 	}
+	if f.ec != nil {
+		f.ec.decrypt(p[:nr])
+	}
 	return nr, er
 }
 
+// Seek sets the offset for the next Read.
+func (f GlustiFile) Seek(offset int64, whence int) (int64, error) {
+	if f.zr != nil {
+		return seekOrSkip(f.zr, offset, whence)
+	}
+
+	pos, err := f.glf.Seek(offset, whence)
+	if err == nil && f.ec != nil {
+		f.ec.seek(pos)
+	}
+	return pos, err
+}
+
 // Write writes len(p) bytes to the file.
 // Returns number of bytes written and an error if any.
 func (f GlustiFile) Write(p []byte) (int, error) {
@@ -382,7 +463,7 @@ func (f GlustiFile) Write(p []byte) (int, error) {
 		}
 
 		var err error
-		n, err = f.glf.Write(p)
+		n, err = f.entityWriter().Write(p)
 		if err != nil {
 			return 0, err
 		}
@@ -391,14 +472,56 @@ func (f GlustiFile) Write(p []byte) (int, error) {
 	}
 
 	f.md5.Write(p)
+	f.sha256.Write(p)
 	f.info.Size += int64(n)
 	f.sdf.Size += int64(n)
 
 	return n, nil
 }
 
+// entityWriter returns the writer of entity, which compresses
+// content if a codec is chosen.
+func (f GlustiFile) entityWriter() io.Writer {
+	if f.zw != nil {
+		return f.zw
+	}
+
+	return f.encryptedWriter()
+}
+
+// encryptedWriter returns the writer of entity under the codec,
+// which encrypts content if a cipher is set.
+func (f GlustiFile) encryptedWriter() io.Writer {
+	if f.ec != nil {
+		return f.ec.writer(f.glf)
+	}
+
+	return f.glf
+}
+
+// encryptEntity encrypts the entity with block and iv, under the codec.
+func (f *GlustiFile) encryptEntity(block cipher.Block, iv []byte) (err error) {
+	f.ec = newEntityCipher(block, iv)
+
+	codec := f.sdf.ExtAttr[MetaKey_Codec]
+	if f.zw != nil {
+		f.zw, err = newCodecWriter(codec, f.encryptedWriter())
+	}
+	if f.zr != nil {
+		f.zr, err = newCodecReader(codec, readerFunc(f.readEntity))
+	}
+
+	return
+}
+
 // Close closes an opened GlustiFile.
 func (f GlustiFile) Close() error {
+	if f.zw != nil {
+		if err := f.zw.Close(); err != nil {
+			return err
+		}
+	}
+
 	if f.hasEntity() {
 		if err := f.glf.Close(); err != nil {
 			return err
@@ -408,6 +531,7 @@ func (f GlustiFile) Close() error {
 	if f.mode == FileModeWrite {
 		f.sdf.UploadDate = time.Now()
 		f.sdf.Md5 = hex.EncodeToString(f.md5.Sum(nil))
+		f.sdf.Sha256 = hex.EncodeToString(f.sha256.Sum(nil))
 		if err := f.handler.tiop.Save(f.sdf); err != nil {
 			glog.Warningf("Failed to save metadata to tidb, %v", err)
 
@@ -430,7 +554,9 @@ func (f GlustiFile) Close() error {
 
 // updateFileMeta updates file dfs meta.
 func (f GlustiFile) updateFileMeta(m map[string]interface{}) {
-	f.sdf.ExtAttr = make(map[string]string)
+	if f.sdf.ExtAttr == nil {
+		f.sdf.ExtAttr = make(map[string]string)
+	}
 	for k, v := range m {
 		f.sdf.ExtAttr[k] = toString(v)
 	}
@@ -447,6 +573,8 @@ func (f GlustiFile) getFileMeta() *DFSFileMeta {
 		Bizname:   f.sdf.Biz,
 		Fid:       f.sdf.ExtAttr[MetaKey_WeedFid],
 		ChunkSize: ck,
+		KeyId:     f.sdf.ExtAttr[MetaKey_KeyId],
+		KeyIv:     f.sdf.ExtAttr[MetaKey_KeyIv],
 	}
 }
 
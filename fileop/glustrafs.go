@@ -1,7 +1,9 @@
 package fileop
 
 import (
+	"crypto/cipher"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"hash"
@@ -107,7 +109,14 @@ func (h *GlustraHandler) Create(info *transfer.FileInfo) (DFSFile, error) {
 		Domain:    info.Domain,
 		ChunkSize: -1, // means no use.
 		Type:      meta.EntityGlusterFS,
-		ExtAttr:   make(map[string]string),
+		ExtAttr:   meta.ExtAttrs(info.Attrs, info.ExpireTime),
+	}
+
+	if codec := chooseCodec(info); codec != "" && file.hasEntity() {
+		if file.zw, err = newCodecWriter(codec, file.glf); err != nil {
+			return nil, err
+		}
+		file.sdf.ExtAttr[MetaKey_Codec] = codec
 	}
 
 	// Make a copy of file info to hold information of file.
@@ -128,6 +137,7 @@ func (h *GlustraHandler) createGlustraFile(name string) (*GlustraFile, error) {
 	return &GlustraFile{
 		glf:     f,
 		md5:     md5.New(),
+		sha256:  sha256.New(),
 		mode:    FileModeWrite,
 		handler: h,
 	}, nil
@@ -148,12 +158,22 @@ func (h *GlustraHandler) Open(id string, domain int64) (DFSFile, error) {
 
 	result.sdf = f
 	result.info = &transfer.FileInfo{
-		Id:     f.Id,
-		Domain: f.Domain,
-		Name:   f.Name,
-		Size:   f.Size,
-		Md5:    f.Md5,
-		Biz:    f.Biz,
+		Id:         f.Id,
+		Domain:     f.Domain,
+		Name:       f.Name,
+		Size:       f.Size,
+		Md5:        f.Md5,
+		Sha256:     f.Sha256,
+		Biz:        f.Biz,
+		Attrs:      meta.UserAttrs(f.ExtAttr),
+		ExpireTime: meta.ExpireTime(f.ExtAttr),
+	}
+
+	if codec := f.ExtAttr[MetaKey_Codec]; codec != "" {
+		if result.zr, err = newCodecReader(codec, readerFunc(result.readEntity)); err != nil {
+			result.glf.Close()
+			return nil, err
+		}
 	}
 	return result, nil
 }
@@ -178,10 +198,14 @@ func (h *GlustraHandler) Find(id string) (string, *DFSFileMeta, *transfer.FileIn
 		glog.V(4).Infof("Failed to parse chunk size %s, %v.", f.ExtAttr["chunksize"], err)
 	}
 
+	attrs := meta.UserAttrs(f.ExtAttr)
+	expireTime := meta.ExpireTime(f.ExtAttr)
 	meta := &DFSFileMeta{
 		Bizname:   f.Biz,
 		Fid:       f.ExtAttr[MetaKey_WeedFid],
 		ChunkSize: chunksize,
+		KeyId:     f.ExtAttr[MetaKey_KeyId],
+		KeyIv:     f.ExtAttr[MetaKey_KeyIv],
 	}
 
 	var userId int64
@@ -191,13 +215,16 @@ func (h *GlustraHandler) Find(id string) (string, *DFSFileMeta, *transfer.FileIn
 	}
 
 	info := &transfer.FileInfo{
-		Id:     id,
-		Name:   f.Name,
-		Size:   f.Size,
-		Md5:    f.Md5,
-		Biz:    f.Biz,
-		Domain: f.Domain,
-		User:   userId,
+		Id:         id,
+		Name:       f.Name,
+		Size:       f.Size,
+		Md5:        f.Md5,
+		Sha256:     f.Sha256,
+		Biz:        f.Biz,
+		Domain:     f.Domain,
+		User:       userId,
+		Attrs:      attrs,
+		ExpireTime: expireTime,
 	}
 
 	glog.V(3).Infof("Succeeded to find file %s, return %s", id, f.Id)
@@ -280,6 +307,26 @@ func (h *GlustraHandler) FindByMd5(md5 string, domain int64, size int64) (string
 	return file.Id, nil
 }
 
+// FindBySha256 finds a file by its sha256.
+func (h *GlustraHandler) FindBySha256(sha256 string, domain int64, size int64) (string, error) {
+	file, err := h.duplfs.FindBySha256(sha256, domain) // ignore size
+	if err != nil {
+		return "", err
+	}
+
+	return file.Id, nil
+}
+
+// List lists files which match the filter, starts after cursor.
+func (h *GlustraHandler) List(filter *meta.FileFilter, cursor string, limit int) ([]*transfer.FileInfo, string, error) {
+	return listFileMeta(h.duplfs.List(filter, cursor, limit))
+}
+
+// UpdateAttrs updates custom attributes of a file.
+func (h *GlustraHandler) UpdateAttrs(id string, domain int64, attrs map[string]string) error {
+	return h.duplfs.UpdateAttrs(id, meta.ExtUserAttrs(attrs))
+}
+
 // Create creates a DFSFile with the given id.
 func (h *GlustraHandler) CreateWithGivenId(info *transfer.FileInfo) (DFSFile, error) {
 	return h.Create(info)
@@ -325,8 +372,13 @@ type GlustraFile struct {
 	glf     *gfapi.File // Gluster file
 	sdf     *meta.File
 	md5     hash.Hash
+	sha256  hash.Hash
 	mode    dfsFileMode
 	handler *GlustraHandler
+
+	zw io.WriteCloser // compressor of entity, nil for raw.
+	zr io.Reader      // decompressor of entity, nil for raw.
+	ec *entityCipher  // cipher of entity, nil for plain.
 }
 
 // GetFileInfo returns file meta info.
@@ -337,14 +389,40 @@ func (f GlustraFile) GetFileInfo() *transfer.FileInfo {
 // Read reads atmost len(p) bytes into p.
 // Returns number of bytes read and an error if any.
 func (f GlustraFile) Read(p []byte) (int, error) {
+	if f.zr != nil {
+		return f.zr.Read(p)
+	}
+
+	return f.readEntity(p)
+}
+
+// readEntity reads the content of entity decrypted, but still
+// compressed if a codec is used.
+func (f GlustraFile) readEntity(p []byte) (int, error) {
 	nr, er := f.glf.Read(p)
 	// When reached EOF, glf returns nr=0 other than er=io.EOF, fix it.
 	if nr <= 0 {
 		return 0, io.EOF
 	}
+	if f.ec != nil {
+		f.ec.decrypt(p[:nr])
+	}
 	return nr, er
 }
 
+// Seek sets the offset for the next Read.
+func (f GlustraFile) Seek(offset int64, whence int) (int64, error) {
+	if f.zr != nil {
+		return seekOrSkip(f.zr, offset, whence)
+	}
+
+	pos, err := f.glf.Seek(offset, whence)
+	if err == nil && f.ec != nil {
+		f.ec.seek(pos)
+	}
+	return pos, err
+}
+
 // Write writes len(p) bytes to the file.
 // Returns number of bytes written and an error if any.
 func (f GlustraFile) Write(p []byte) (int, error) {
@@ -353,20 +431,62 @@ func (f GlustraFile) Write(p []byte) (int, error) {
 		return 0, nil
 	}
 
-	n, err := f.glf.Write(p)
+	n, err := f.entityWriter().Write(p)
 	if err != nil {
 		return 0, err
 	}
 
 	f.md5.Write(p)
+	f.sha256.Write(p)
 	f.info.Size += int64(n)
 	f.sdf.Size += int64(n)
 
 	return n, nil
 }
 
+// entityWriter returns the writer of entity, which compresses
+// content if a codec is chosen.
+func (f GlustraFile) entityWriter() io.Writer {
+	if f.zw != nil {
+		return f.zw
+	}
+
+	return f.encryptedWriter()
+}
+
+// encryptedWriter returns the writer of entity under the codec,
+// which encrypts content if a cipher is set.
+func (f GlustraFile) encryptedWriter() io.Writer {
+	if f.ec != nil {
+		return f.ec.writer(f.glf)
+	}
+
+	return f.glf
+}
+
+// encryptEntity encrypts the entity with block and iv, under the codec.
+func (f *GlustraFile) encryptEntity(block cipher.Block, iv []byte) (err error) {
+	f.ec = newEntityCipher(block, iv)
+
+	codec := f.sdf.ExtAttr[MetaKey_Codec]
+	if f.zw != nil {
+		f.zw, err = newCodecWriter(codec, f.encryptedWriter())
+	}
+	if f.zr != nil {
+		f.zr, err = newCodecReader(codec, readerFunc(f.readEntity))
+	}
+
+	return
+}
+
 // Close closes an opened GlustraFile.
 func (f GlustraFile) Close() error {
+	if f.zw != nil {
+		if err := f.zw.Close(); err != nil {
+			return err
+		}
+	}
+
 	if err := f.glf.Close(); err != nil {
 		return err
 	}
@@ -374,6 +494,7 @@ func (f GlustraFile) Close() error {
 	if f.mode == FileModeWrite {
 		f.sdf.UploadDate = time.Now()
 		f.sdf.Md5 = hex.EncodeToString(f.md5.Sum(nil))
+		f.sdf.Sha256 = hex.EncodeToString(f.sha256.Sum(nil))
 		if err := f.handler.duplfs.Save(f.sdf); err != nil {
 			h := f.handler
 			inf := f.info
@@ -391,7 +512,9 @@ func (f GlustraFile) Close() error {
 
 // updateFileMeta updates file dfs meta.
 func (f GlustraFile) updateFileMeta(m map[string]interface{}) {
-	f.sdf.ExtAttr = make(map[string]string)
+	if f.sdf.ExtAttr == nil {
+		f.sdf.ExtAttr = make(map[string]string)
+	}
 	for k, v := range m {
 		f.sdf.ExtAttr[k] = toString(v)
 	}
@@ -429,6 +552,8 @@ func (f GlustraFile) getFileMeta() *DFSFileMeta {
 		Bizname:   f.sdf.Biz,
 		Fid:       f.sdf.ExtAttr[MetaKey_WeedFid],
 		ChunkSize: ck,
+		KeyId:     f.sdf.ExtAttr[MetaKey_KeyId],
+		KeyIv:     f.sdf.ExtAttr[MetaKey_KeyIv],
 	}
 }
 
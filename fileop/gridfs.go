@@ -1,7 +1,13 @@
 package fileop
 
 import (
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"hash"
+	"io"
 
 	"github.com/golang/glog"
 	"gopkg.in/mgo.v2"
@@ -82,8 +88,9 @@ func (h *GridFsHandler) Create(info *transfer.FileInfo) (f DFSFile, err error) {
 	// Make a copy of file info to hold information of file.
 	inf := *info
 	inf.Id = oid.Hex()
+	inf.Size = 0
 
-	f = &GridFsFile{
+	gf := &GridFsFile{
 		GridFile: file,
 		info:     &inf,
 		handler:  h,
@@ -91,8 +98,19 @@ func (h *GridFsHandler) Create(info *transfer.FileInfo) (f DFSFile, err error) {
 		session:  session,
 		gridfs:   gridfs,
 		meta:     make(map[string]interface{}),
+		sha256:   sha256.New(),
 	}
 
+	if codec := chooseCodec(info); codec != "" {
+		gf.codec = codec
+		gf.md5 = md5.New()
+		if gf.zw, err = newCodecWriter(codec, gf.GridFile); err != nil {
+			file.Close()
+			return
+		}
+	}
+	f = gf
+
 	return
 }
 
@@ -114,16 +132,20 @@ func (h *GridFsHandler) Open(id string, domain int64) (dfsFile DFSFile, err erro
 		return
 	}
 
+	ext := lookupExtMeta(gridfs, gridFile.Id())
 	inf := &transfer.FileInfo{
-		Id:     id,
-		Domain: domain,
-		Name:   gridFile.Name(),
-		Size:   gridFile.Size(),
-		Md5:    gridFile.MD5(),
-		Biz:    gridMeta.Bizname,
+		Id:         id,
+		Domain:     ext.domainOr(domain),
+		Name:       gridFile.Name(),
+		Size:       gridFile.Size(),
+		Md5:        gridFile.MD5(),
+		Sha256:     ext.Sha256,
+		Biz:        gridMeta.Bizname,
+		Attrs:      h.duplfs.attrsOf(id, ext),
+		ExpireTime: ext.ExpireTime,
 	}
 
-	dfsFile = &GridFsFile{
+	gf := &GridFsFile{
 		GridFile: gridFile,
 		info:     inf,
 		handler:  h,
@@ -133,6 +155,17 @@ func (h *GridFsHandler) Open(id string, domain int64) (dfsFile DFSFile, err erro
 		meta:     make(map[string]interface{}),
 	}
 
+	if len(ext.Codec) > 0 {
+		gf.codec = ext.Codec
+		gf.chunks = newChunkReader(gridfs, gridFile.Id())
+		if gf.zr, err = newCodecReader(ext.Codec, readerFunc(gf.readEntity)); err != nil {
+			gf.chunks.Close()
+			gridFile.Close()
+			return
+		}
+	}
+	dfsFile = gf
+
 	return
 }
 
@@ -169,13 +202,18 @@ func (h *GridFsHandler) Find(id string) (string, *DFSFileMeta, *transfer.FileInf
 		return "", nil, nil, err
 	}
 
+	ext := lookupExtMeta(gridfs, oid)
 	info := &transfer.FileInfo{
-		Id:   id,
-		Name: gridFile.Name(),
-		Size: gridFile.Size(),
-		Md5:  gridFile.MD5(),
-		Biz:  meta.Bizname,
-		// TODO(hanyh): add Domain and User
+		Id:         id,
+		Name:       gridFile.Name(),
+		Size:       gridFile.Size(),
+		Md5:        gridFile.MD5(),
+		Sha256:     ext.Sha256,
+		Biz:        meta.Bizname,
+		Attrs:      h.duplfs.attrsOf(id, ext),
+		Domain:     ext.Domain,
+		ExpireTime: ext.ExpireTime,
+		// TODO(hanyh): add User
 	}
 
 	glog.V(3).Infof("Succeeded to find file %s, return %s", id, oid.Hex())
@@ -241,6 +279,41 @@ func (h *GridFsHandler) FindByMd5(md5 string, domain int64, size int64) (string,
 	return oid.Hex(), nil
 }
 
+// FindBySha256 finds a file by its sha256.
+func (h *GridFsHandler) FindBySha256(sha256 string, domain int64, size int64) (string, error) {
+	file, err := h.duplfs.FindBySha256(h.gridfs, sha256, domain, size)
+	if err != nil {
+		return "", err
+	}
+
+	oid, ok := file.Id().(bson.ObjectId)
+	if !ok {
+		return "", fmt.Errorf("Invalid id, %T, %v", file.Id(), file.Id())
+	}
+
+	return oid.Hex(), nil
+}
+
+// List lists files which match the filter, starts after cursor.
+func (h *GridFsHandler) List(filter *meta.FileFilter, cursor string, limit int) ([]*transfer.FileInfo, string, error) {
+	session, gridfs := h.copySessionAndGridFS()
+	defer func() {
+		h.ensureReleaseSession(session)
+	}()
+
+	return listFileMeta(h.duplfs.List(gridfs, filter, cursor, limit))
+}
+
+// UpdateAttrs updates custom attributes of a file.
+func (h *GridFsHandler) UpdateAttrs(id string, domain int64, attrs map[string]string) error {
+	session, gridfs := h.copySessionAndGridFS()
+	defer func() {
+		h.ensureReleaseSession(session)
+	}()
+
+	return h.duplfs.UpdateAttrs(gridfs, id, attrs)
+}
+
 // NewGridFsHandler returns a handler for processing Grid files.
 func NewGridFsHandler(shardInfo *metadata.Shard) (*GridFsHandler, error) {
 	handler := &GridFsHandler{
@@ -261,6 +334,7 @@ func NewGridFsHandler(shardInfo *metadata.Shard) (*GridFsHandler, error) {
 	}
 
 	handler.duplfs = NewDuplFs(duplOp)
+	handler.duplfs.EnsureIndexes(handler.gridfs)
 
 	return handler, nil
 }
@@ -276,6 +350,17 @@ type GridFsFile struct {
 
 	session *mgo.Session
 	gridfs  *mgo.GridFS
+
+	sha256 hash.Hash // md5 is computed by mgo.GridFile itself.
+	// md5 of content, only for the entity not stored as it is,
+	// whose md5 computed by mgo.GridFile is not of the content.
+	md5 hash.Hash
+
+	codec  string         // codec of entity, empty for raw.
+	zw     io.WriteCloser // compressor of entity, nil for raw.
+	zr     io.Reader      // decompressor of entity, nil for raw.
+	chunks *chunkReader   // reader of compressed entity, nil for raw.
+	ec     *entityCipher  // cipher of entity, nil for plain.
 }
 
 // GetFileInfo returns file meta info.
@@ -283,6 +368,95 @@ func (f GridFsFile) GetFileInfo() *transfer.FileInfo {
 	return f.info
 }
 
+// Write writes len(p) bytes to the file.
+// Returns number of bytes written and an error if any.
+func (f GridFsFile) Write(p []byte) (int, error) {
+	n, err := f.entityWriter().Write(p)
+	f.sha256.Write(p[:n])
+	if f.md5 != nil {
+		f.md5.Write(p[:n])
+	}
+	f.info.Size += int64(n)
+
+	return n, err
+}
+
+// entityWriter returns the writer of entity, which compresses
+// content if a codec is chosen.
+func (f GridFsFile) entityWriter() io.Writer {
+	if f.zw != nil {
+		return f.zw
+	}
+
+	return f.encryptedWriter()
+}
+
+// encryptedWriter returns the writer of entity under the codec,
+// which encrypts content if a cipher is set.
+func (f GridFsFile) encryptedWriter() io.Writer {
+	if f.ec != nil {
+		return f.ec.writer(f.GridFile)
+	}
+
+	return f.GridFile
+}
+
+// Read reads atmost len(p) bytes into p.
+// Returns number of bytes read and an error if any.
+func (f GridFsFile) Read(p []byte) (int, error) {
+	if f.zr != nil {
+		return f.zr.Read(p)
+	}
+
+	return f.readEntity(p)
+}
+
+// readEntity reads the content of entity decrypted, but still
+// compressed if a codec is used.
+func (f GridFsFile) readEntity(p []byte) (n int, err error) {
+	if f.chunks != nil {
+		n, err = f.chunks.Read(p)
+	} else {
+		n, err = f.GridFile.Read(p)
+	}
+	if n > 0 && f.ec != nil {
+		f.ec.decrypt(p[:n])
+	}
+
+	return
+}
+
+// Seek sets the offset for the next Read.
+func (f GridFsFile) Seek(offset int64, whence int) (int64, error) {
+	if f.zr != nil {
+		return seekOrSkip(f.zr, offset, whence)
+	}
+
+	pos, err := f.GridFile.Seek(offset, whence)
+	if err == nil && f.ec != nil {
+		f.ec.seek(pos)
+	}
+
+	return pos, err
+}
+
+// encryptEntity encrypts the entity with block and iv, under the codec.
+func (f *GridFsFile) encryptEntity(block cipher.Block, iv []byte) (err error) {
+	f.ec = newEntityCipher(block, iv)
+	if f.mode == FileModeWrite && f.md5 == nil {
+		f.md5 = md5.New()
+	}
+
+	if f.zw != nil {
+		f.zw, err = newCodecWriter(f.codec, f.encryptedWriter())
+	}
+	if f.zr != nil {
+		f.zr, err = newCodecReader(f.codec, readerFunc(f.readEntity))
+	}
+
+	return
+}
+
 func (f GridFsFile) updateFileMeta(m map[string]interface{}) {
 	for k, v := range m {
 		f.meta[k] = v
@@ -307,6 +481,15 @@ func (f *GridFsFile) Close() error {
 		}
 	}()
 
+	if f.zw != nil {
+		if err := f.zw.Close(); err != nil {
+			return err
+		}
+	}
+	if f.chunks != nil {
+		f.chunks.Close()
+	}
+
 	if f.mode == FileModeWrite {
 		f.meta["bizname"] = f.info.Biz
 		f.SetMeta(f.meta)
@@ -317,6 +500,7 @@ func (f *GridFsFile) Close() error {
 	}
 
 	if f.mode == FileModeWrite {
+		f.info.Sha256 = hex.EncodeToString(f.sha256.Sum(nil))
 		return f.updateGridMetadata()
 	}
 	return nil
@@ -351,6 +535,33 @@ func (f GridFsFile) additionalMetadata() bson.D {
 	opdata = append(opdata, bson.DocElem{
 		"aliases", nil, // For compatible with dfs 1.0
 	})
+	opdata = append(opdata, bson.DocElem{
+		"sha256", f.info.Sha256,
+	})
+	if f.md5 != nil {
+		opdata = append(opdata, bson.DocElem{
+			"md5", hex.EncodeToString(f.md5.Sum(nil)),
+		})
+	}
+	if len(f.codec) > 0 {
+		// length computed by mgo.GridFile is of the compressed.
+		opdata = append(opdata, bson.DocElem{
+			"length", f.info.Size,
+		})
+		opdata = append(opdata, bson.DocElem{
+			MetaKey_Codec, f.codec,
+		})
+	}
+	if len(f.info.Attrs) > 0 {
+		opdata = append(opdata, bson.DocElem{
+			"attrs", f.info.Attrs,
+		})
+	}
+	if f.info.ExpireTime > 0 {
+		opdata = append(opdata, bson.DocElem{
+			"expiretime", f.info.ExpireTime,
+		})
+	}
 
 	return opdata
 }
@@ -368,3 +579,43 @@ func getDFSFileMeta(g *mgo.GridFile) (*DFSFileMeta, error) {
 func (f GridFsFile) hasEntity() bool {
 	return true
 }
+
+// chunkReader reads the chunks of a gridfs file in order. Unlike
+// mgo.GridFile, it reads to the last chunk regardless of the length
+// of file, which is the length of content before compressed.
+type chunkReader struct {
+	iter *mgo.Iter
+	buf  []byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		var chunk struct {
+			Data []byte "data"
+		}
+		if !r.iter.Next(&chunk) {
+			if err := r.iter.Err(); err != nil {
+				return 0, err
+			}
+			return 0, io.EOF
+		}
+		r.buf = chunk.Data
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+
+	return n, nil
+}
+
+// Close closes the iterator of chunks.
+func (r *chunkReader) Close() error {
+	return r.iter.Close()
+}
+
+func newChunkReader(gridfs *mgo.GridFS, id interface{}) *chunkReader {
+	iter := gridfs.Chunks.Find(bson.M{"files_id": id}).Sort("n").Iter()
+	return &chunkReader{
+		iter: iter,
+	}
+}
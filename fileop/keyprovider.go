@@ -0,0 +1,139 @@
+package fileop
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// KeyProvider provides data keys to encrypt file entities.
+type KeyProvider interface {
+	// DataKey returns the current data key of a domain and its id.
+	DataKey(domain int64) (string, []byte, error)
+
+	// KeyById returns the data key of a domain by its id. It is used
+	// to decrypt files encrypted with a rotated key.
+	KeyById(domain int64, keyId string) ([]byte, error)
+}
+
+// FileKeyProvider implements interface KeyProvider, which loads data
+// keys from a local file. It is intended for testing.
+//
+// Each line of the file is in form of 'domain keyid hexkey', domain 0
+// is for the domains without their own keys. The last key of a domain
+// is the current one, earlier keys are kept for the existed files.
+// Empty lines and lines start with '#' are ignored.
+type FileKeyProvider struct {
+	path string
+
+	current map[int64]string            // domain -> current key id
+	keys    map[int64]map[string][]byte // domain -> key id -> key
+	lock    sync.RWMutex
+}
+
+// DataKey returns the current data key of a domain and its id.
+func (p *FileKeyProvider) DataKey(domain int64) (string, []byte, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	d := domain
+	keyId, ok := p.current[d]
+	if !ok {
+		d = 0
+		if keyId, ok = p.current[d]; !ok {
+			return "", nil, fmt.Errorf("no data key for domain %d", domain)
+		}
+	}
+
+	return keyId, p.keys[d][keyId], nil
+}
+
+// KeyById returns the data key of a domain by its id.
+func (p *FileKeyProvider) KeyById(domain int64, keyId string) ([]byte, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	if key, ok := p.keys[domain][keyId]; ok {
+		return key, nil
+	}
+	if key, ok := p.keys[0][keyId]; ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("data key %s of domain %d not found", keyId, domain)
+}
+
+// Reload reloads keys from the file, keys loaded before are
+// replaced on success.
+func (p *FileKeyProvider) Reload() error {
+	f, err := os.Open(p.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	current := make(map[int64]string)
+	keys := make(map[int64]map[string][]byte)
+
+	lineNo := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return fmt.Errorf("%s:%d, invalid key line", p.path, lineNo)
+		}
+
+		domain, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil || domain < 0 {
+			return fmt.Errorf("%s:%d, invalid domain %s", p.path, lineNo, fields[0])
+		}
+
+		key, err := hex.DecodeString(fields[2])
+		if err != nil {
+			return fmt.Errorf("%s:%d, invalid key, %v", p.path, lineNo, err)
+		}
+		if err = checkDataKey(key); err != nil {
+			return fmt.Errorf("%s:%d, %v", p.path, lineNo, err)
+		}
+
+		if _, ok := keys[domain]; !ok {
+			keys[domain] = make(map[string][]byte)
+		}
+		keys[domain][fields[1]] = key
+		current[domain] = fields[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.current = current
+	p.keys = keys
+
+	return nil
+}
+
+// NewFileKeyProvider creates a FileKeyProvider with the keys in file.
+func NewFileKeyProvider(path string) (*FileKeyProvider, error) {
+	p := &FileKeyProvider{
+		path: path,
+	}
+
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
@@ -73,6 +73,19 @@ func (_mr *MockDFSFileMockRecorder) Close() *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Close", reflect.TypeOf((*MockDFSFile)(nil).Close))
 }
 
+// Seek mocks base method
+func (_m *MockDFSFile) Seek(offset int64, whence int) (int64, error) {
+	ret := _m.ctrl.Call(_m, "Seek", offset, whence)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Seek indicates an expected call of Seek
+func (_mr *MockDFSFileMockRecorder) Seek(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Seek", reflect.TypeOf((*MockDFSFile)(nil).Seek), arg0, arg1)
+}
+
 // GetFileInfo mocks base method
 func (_m *MockDFSFile) GetFileInfo() *transfer.FileInfo {
 	ret := _m.ctrl.Call(_m, "GetFileInfo")
@@ -247,6 +260,19 @@ func (_mr *MockDFSFileHandlerMockRecorder) FindByMd5(arg0, arg1, arg2 interface{
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "FindByMd5", reflect.TypeOf((*MockDFSFileHandler)(nil).FindByMd5), arg0, arg1, arg2)
 }
 
+// FindBySha256 mocks base method
+func (_m *MockDFSFileHandler) FindBySha256(sha256 string, domain int64, size int64) (string, error) {
+	ret := _m.ctrl.Call(_m, "FindBySha256", sha256, domain, size)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindBySha256 indicates an expected call of FindBySha256
+func (_mr *MockDFSFileHandlerMockRecorder) FindBySha256(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "FindBySha256", reflect.TypeOf((*MockDFSFileHandler)(nil).FindBySha256), arg0, arg1, arg2)
+}
+
 // MockDFSFileMinorHandler is a mock of DFSFileMinorHandler interface
 type MockDFSFileMinorHandler struct {
 	ctrl     *gomock.Controller
@@ -387,6 +413,19 @@ func (_mr *MockDFSFileMinorHandlerMockRecorder) FindByMd5(arg0, arg1, arg2 inter
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "FindByMd5", reflect.TypeOf((*MockDFSFileMinorHandler)(nil).FindByMd5), arg0, arg1, arg2)
 }
 
+// FindBySha256 mocks base method
+func (_m *MockDFSFileMinorHandler) FindBySha256(sha256 string, domain int64, size int64) (string, error) {
+	ret := _m.ctrl.Call(_m, "FindBySha256", sha256, domain, size)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindBySha256 indicates an expected call of FindBySha256
+func (_mr *MockDFSFileMinorHandlerMockRecorder) FindBySha256(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "FindBySha256", reflect.TypeOf((*MockDFSFileMinorHandler)(nil).FindBySha256), arg0, arg1, arg2)
+}
+
 // CreateWithGivenId mocks base method
 func (_m *MockDFSFileMinorHandler) CreateWithGivenId(info *transfer.FileInfo) (DFSFile, error) {
 	ret := _m.ctrl.Call(_m, "CreateWithGivenId", info)
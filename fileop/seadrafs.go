@@ -1,10 +1,13 @@
 package fileop
 
 import (
+	"crypto/cipher"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"hash"
+	"io"
 	"strings"
 	"time"
 
@@ -40,6 +43,12 @@ func (h *SeadraHandler) Close() error {
 
 // Create creates a DFSFile for write.
 func (h *SeadraHandler) Create(info *transfer.FileInfo) (DFSFile, error) {
+	return h.CreateWithChunkSize(info, 0)
+}
+
+// CreateWithChunkSize creates a DFSFile for write with the given chunk size,
+// 0 for the default chunk size of seaweedfs.
+func (h *SeadraHandler) CreateWithChunkSize(info *transfer.FileInfo, chunkSize int64) (DFSFile, error) {
 	oid := bson.NewObjectId()
 	if bson.IsObjectIdHex(info.Id) {
 		oid = bson.ObjectIdHex(info.Id)
@@ -47,7 +56,7 @@ func (h *SeadraHandler) Create(info *transfer.FileInfo) (DFSFile, error) {
 
 	fn := "" // file name ignored
 
-	wFile, err := weedfs.Create(fn, info.Domain, h.MasterUri, h.Replica, h.DataCenter, h.Rack, 0)
+	wFile, err := weedfs.Create(fn, info.Domain, h.MasterUri, h.Replica, h.DataCenter, h.Rack, chunkSize)
 	if err != nil {
 		return nil, err
 	}
@@ -64,15 +73,26 @@ func (h *SeadraHandler) Create(info *transfer.FileInfo) (DFSFile, error) {
 			MetaKey_WeedFid: wFile.Fid,
 		},
 	}
+	for k, v := range meta.ExtAttrs(info.Attrs, info.ExpireTime) {
+		mf.ExtAttr[k] = v
+	}
 
 	file := &SeadraFile{
 		handler:  h,
 		md5:      md5.New(),
+		sha256:   sha256.New(),
 		mode:     FileModeWrite,
 		meta:     mf,
 		WeedFile: wFile,
 	}
 
+	if codec := chooseCodec(info); codec != "" {
+		if file.zw, err = newCodecWriter(codec, wFile); err != nil {
+			return nil, err
+		}
+		mf.ExtAttr[MetaKey_Codec] = codec
+	}
+
 	return file, nil
 }
 
@@ -96,6 +116,13 @@ func (h *SeadraHandler) Open(id string, domain int64) (DFSFile, error) {
 		WeedFile: wFile,
 	}
 
+	if codec := mf.ExtAttr[MetaKey_Codec]; codec != "" {
+		if file.zr, err = newCodecReader(codec, wFile); err != nil {
+			wFile.Close()
+			return nil, err
+		}
+	}
+
 	return file, nil
 }
 
@@ -155,6 +182,26 @@ func (h *SeadraHandler) FindByMd5(md5 string, domain int64, size int64) (string,
 	return file.Id, nil
 }
 
+// FindBySha256 finds a file by its sha256.
+func (h *SeadraHandler) FindBySha256(sha256 string, domain int64, size int64) (string, error) {
+	file, err := h.duplfs.FindBySha256(sha256, domain) // ignore size
+	if err != nil {
+		return "", err
+	}
+
+	return file.Id, nil
+}
+
+// List lists files which match the filter, starts after cursor.
+func (h *SeadraHandler) List(filter *meta.FileFilter, cursor string, limit int) ([]*transfer.FileInfo, string, error) {
+	return listFileMeta(h.duplfs.List(filter, cursor, limit))
+}
+
+// UpdateAttrs updates custom attributes of a file.
+func (h *SeadraHandler) UpdateAttrs(id string, domain int64, attrs map[string]string) error {
+	return h.duplfs.UpdateAttrs(id, meta.ExtUserAttrs(attrs))
+}
+
 // Create creates a DFSFile with the given id.
 func (h *SeadraHandler) CreateWithGivenId(info *transfer.FileInfo) (DFSFile, error) {
 	return h.Create(info)
@@ -263,8 +310,13 @@ type SeadraFile struct {
 	handler *SeadraHandler
 	meta    *meta.File
 
-	md5  hash.Hash
-	mode dfsFileMode
+	md5    hash.Hash
+	sha256 hash.Hash
+	mode   dfsFileMode
+
+	zw io.WriteCloser // compressor of entity, nil for raw.
+	zr io.Reader      // decompressor of entity, nil for raw.
+	ec *entityCipher  // cipher of entity, nil for plain.
 }
 
 // GetFileInfo returns file meta info.
@@ -275,7 +327,34 @@ func (f SeadraFile) GetFileInfo() *transfer.FileInfo {
 // Read reads atmost len(p) bytes into p.
 // Returns number of bytes read and an error if any.
 func (f SeadraFile) Read(p []byte) (int, error) {
-	return f.WeedFile.Read(p)
+	if f.zr != nil {
+		return f.zr.Read(p)
+	}
+
+	return f.readEntity(p)
+}
+
+// readEntity reads the content of entity decrypted, but still
+// compressed if a codec is used.
+func (f SeadraFile) readEntity(p []byte) (int, error) {
+	n, err := f.WeedFile.Read(p)
+	if n > 0 && f.ec != nil {
+		f.ec.decrypt(p[:n])
+	}
+	return n, err
+}
+
+// Seek sets the offset for the next Read.
+func (f SeadraFile) Seek(offset int64, whence int) (int64, error) {
+	if f.zr != nil {
+		return seekOrSkip(f.zr, offset, whence)
+	}
+
+	pos, err := seekOrSkip(f.WeedFile, offset, whence)
+	if err == nil && f.ec != nil {
+		f.ec.seek(pos)
+	}
+	return pos, err
 }
 
 // Write writes len(p) bytes to the file.
@@ -285,19 +364,61 @@ func (f SeadraFile) Write(p []byte) (int, error) {
 		return 0, nil
 	}
 
-	n, err := f.WeedFile.Write(p)
+	n, err := f.entityWriter().Write(p)
 	if err != nil {
 		return 0, err
 	}
 
 	f.md5.Write(p)
+	f.sha256.Write(p)
 	f.meta.Size += int64(n)
 
 	return n, nil
 }
 
+// entityWriter returns the writer of entity, which compresses
+// content if a codec is chosen.
+func (f SeadraFile) entityWriter() io.Writer {
+	if f.zw != nil {
+		return f.zw
+	}
+
+	return f.encryptedWriter()
+}
+
+// encryptedWriter returns the writer of entity under the codec,
+// which encrypts content if a cipher is set.
+func (f SeadraFile) encryptedWriter() io.Writer {
+	if f.ec != nil {
+		return f.ec.writer(f.WeedFile)
+	}
+
+	return f.WeedFile
+}
+
+// encryptEntity encrypts the entity with block and iv, under the codec.
+func (f *SeadraFile) encryptEntity(block cipher.Block, iv []byte) (err error) {
+	f.ec = newEntityCipher(block, iv)
+
+	codec := f.meta.ExtAttr[MetaKey_Codec]
+	if f.zw != nil {
+		f.zw, err = newCodecWriter(codec, f.encryptedWriter())
+	}
+	if f.zr != nil {
+		f.zr, err = newCodecReader(codec, readerFunc(f.readEntity))
+	}
+
+	return
+}
+
 // Close closes an opened SeadraFile.
 func (f SeadraFile) Close() error {
+	if f.zw != nil {
+		if err := f.zw.Close(); err != nil {
+			return err
+		}
+	}
+
 	if err := f.WeedFile.Close(); err != nil {
 		return err
 	}
@@ -305,6 +426,7 @@ func (f SeadraFile) Close() error {
 	if f.mode == FileModeWrite {
 		f.meta.UploadDate = time.Now()
 		f.meta.Md5 = hex.EncodeToString(f.md5.Sum(nil))
+		f.meta.Sha256 = hex.EncodeToString(f.sha256.Sum(nil))
 		if err := f.handler.duplfs.Save(f.meta); err != nil {
 			// try to remove the entity.
 			weedfs.Remove(f.meta.ExtAttr[MetaKey_WeedFid], f.meta.Domain, f.handler.Shard.MasterUri)
@@ -319,7 +441,9 @@ func (f SeadraFile) Close() error {
 
 // updateFileMeta updates file dfs meta.
 func (f SeadraFile) updateFileMeta(m map[string]interface{}) {
-	f.meta.ExtAttr = make(map[string]string)
+	if f.meta.ExtAttr == nil {
+		f.meta.ExtAttr = make(map[string]string)
+	}
 	for k, v := range m {
 		f.meta.ExtAttr[k] = toString(v)
 	}
@@ -335,6 +459,8 @@ func getFileMeta(m *meta.File) *DFSFileMeta {
 		Bizname:   m.Biz,
 		ChunkSize: int64(m.ChunkSize),
 		Fid:       m.ExtAttr[MetaKey_WeedFid],
+		KeyId:     m.ExtAttr[MetaKey_KeyId],
+		KeyIv:     m.ExtAttr[MetaKey_KeyIv],
 	}
 }
 
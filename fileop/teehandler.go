@@ -1,6 +1,7 @@
 package fileop
 
 import (
+	"crypto/cipher"
 	"io"
 
 	"github.com/golang/glog"
@@ -18,10 +19,26 @@ type TeeHandler struct {
 
 // Create creates a DFSFile for write
 func (h *TeeHandler) Create(info *transfer.FileInfo) (DFSFile, error) {
+	return h.createFile(info, func() (DFSFile, error) {
+		return h.major.Create(info)
+	})
+}
+
+// CreateWithChunkSize creates a DFSFile for write with the given chunk size,
+// which is taken by major only.
+func (h *TeeHandler) CreateWithChunkSize(info *transfer.FileInfo, chunkSize int64) (DFSFile, error) {
+	return h.createFile(info, func() (DFSFile, error) {
+		return CreateWithChunkSize(h.major, info, chunkSize)
+	})
+}
+
+// createFile creates a file on major with function create,
+// and the one with the same id on minor if writing minor is ok.
+func (h *TeeHandler) createFile(info *transfer.FileInfo, create func() (DFSFile, error)) (DFSFile, error) {
 	tf := &TeeFile{}
 
 	var err error
-	tf.majorFile, err = h.major.Create(info)
+	tf.majorFile, err = create()
 	if err != nil {
 		glog.Warningf("Failed to create file %v on major %s, %v.", info, h.Name(), err)
 		return tf, err
@@ -170,6 +187,39 @@ func (h *TeeHandler) FindByMd5(md5 string, domain int64, size int64) (string, er
 	return h.major.FindByMd5(md5, domain, size)
 }
 
+// FindBySha256 finds a file by its sha256.
+func (h *TeeHandler) FindBySha256(sha256 string, domain int64, size int64) (string, error) {
+	if conf.IsMinorReadOk(domain) {
+		fid, err := h.minor.FindBySha256(sha256, domain, size)
+		if err == nil {
+			return fid, nil
+		}
+	}
+
+	return h.major.FindBySha256(sha256, domain, size)
+}
+
+// List lists files on major which match the filter, starts after cursor.
+func (h *TeeHandler) List(filter *meta.FileFilter, cursor string, limit int) ([]*transfer.FileInfo, string, error) {
+	return ListFiles(h.major, filter, cursor, limit)
+}
+
+// UpdateAttrs updates custom attributes of a file on major, and on minor
+// if writing to minor is enabled.
+func (h *TeeHandler) UpdateAttrs(id string, domain int64, attrs map[string]string) error {
+	if err := UpdateAttrs(h.major, id, domain, attrs); err != nil {
+		return err
+	}
+
+	if conf.IsMinorWriteOk(domain) {
+		if err := UpdateAttrs(h.minor, id, domain, attrs); err != nil {
+			glog.Warningf("Failed to update attributes of file %s on minor %s, %v.", id, h.Name(), err)
+		}
+	}
+
+	return nil
+}
+
 // Name returns handler's name.
 func (h *TeeHandler) Name() string {
 	return h.major.Name()
@@ -270,6 +320,15 @@ func (f *TeeFile) Read(p []byte) (n int, err error) {
 	return f.majorFile.Read(p)
 }
 
+// Seek sets the offset for the next Read of tee file.
+func (f *TeeFile) Seek(offset int64, whence int) (int64, error) {
+	if f.minorFile != nil {
+		return f.minorFile.Seek(offset, whence)
+	}
+
+	return f.majorFile.Seek(offset, whence)
+}
+
 // Close closes a tee file.
 func (f *TeeFile) Close() (err error) {
 	if f.minorFile != nil {
@@ -292,3 +351,19 @@ func (f *TeeFile) Close() (err error) {
 func (f *TeeFile) hasEntity() bool {
 	return true
 }
+
+// encryptEntity encrypts entities of both major and minor.
+func (f *TeeFile) encryptEntity(block cipher.Block, iv []byte) error {
+	if err := encryptEntity(f.majorFile, block, iv); err != nil {
+		return err
+	}
+
+	if f.minorFile != nil {
+		if err := encryptEntity(f.minorFile, block, iv); err != nil {
+			f.minorFile = nil
+			glog.Warningf("Failed to encrypt minor %s.", err)
+		}
+	}
+
+	return nil
+}
@@ -3,6 +3,7 @@
 package fileop
 
 import (
+	"io"
 	"testing"
 
 	"github.com/golang/mock/gomock"
@@ -54,6 +55,44 @@ func TestTeeCreate(t *testing.T) {
 	})
 }
 
+type chunkedHandler struct {
+	DFSFileHandler
+	chunkSize int64
+}
+
+func (h *chunkedHandler) CreateWithChunkSize(info *transfer.FileInfo, chunkSize int64) (DFSFile, error) {
+	h.chunkSize = chunkSize
+	return h.DFSFileHandler.Create(info)
+}
+
+func TestTeeCreateWithChunkSize(t *testing.T) {
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	major := NewMockDFSFileHandler(ctl)
+	minor := NewMockDFSFileMinorHandler(ctl)
+	chunked := &chunkedHandler{DFSFileHandler: major}
+	handler := NewTeeHandler(chunked, minor)
+
+	mockFile := NewMockDFSFile(ctl)
+	rInfo.Id = rId
+	mockFile.EXPECT().GetFileInfo().Return(&rInfo)
+
+	major.EXPECT().Create(info).Return(mockFile, nil)
+	minor.EXPECT().CreateWithGivenId(&rInfo).Return(mockFile, nil)
+
+	Convey("Create a file with chunk size.", t, func() {
+		tf, err := CreateWithChunkSize(handler, info, 4096)
+		So(err, ShouldBeNil)
+		So(chunked.chunkSize, ShouldEqual, 4096)
+		f, ok := tf.(*TeeFile)
+		if ok {
+			So(f.majorFile, ShouldNotBeNil)
+			So(f.minorFile, ShouldNotBeNil)
+		}
+	})
+}
+
 func TestTeeOpen(t *testing.T) {
 	ctl := gomock.NewController(t)
 	defer ctl.Finish()
@@ -119,3 +158,23 @@ func TestTeeRemove(t *testing.T) {
 	})
 
 }
+
+func TestTeeSeek(t *testing.T) {
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	majorFile := NewMockDFSFile(ctl)
+	minorFile := NewMockDFSFile(ctl)
+	tf := &TeeFile{
+		majorFile: majorFile,
+		minorFile: minorFile,
+	}
+
+	minorFile.EXPECT().Seek(int64(1024), io.SeekStart).Return(int64(1024), nil)
+
+	Convey("Seek a file.", t, func() {
+		pos, err := tf.Seek(1024, io.SeekStart)
+		So(err, ShouldBeNil)
+		So(pos, ShouldEqual, 1024)
+	})
+}
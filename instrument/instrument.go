@@ -144,6 +144,31 @@ var (
 	)
 	GrpcErrorByCode = make(chan *Measurements, *metricsBufSize)
 
+	// rateLimitedCounter instruments number of requests rejected by
+	// rate limit, by the kind of key limited.
+	rateLimitedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "dfs2_0",
+			Subsystem: "server",
+			Name:      "rate_limited",
+			Help:      "Rate limited RPC counter.",
+		},
+		[]string{"service", "key"},
+	)
+	RateLimited = make(chan *Measurements, *metricsBufSize)
+
+	// throttledTime instruments time of streams throttled by bandwidth.
+	throttledTime = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "dfs2_0",
+			Subsystem: "server",
+			Name:      "throttled_time",
+			Help:      "Time of streams throttled in millisecond.",
+		},
+		[]string{"service", "biz"},
+	)
+	ThrottledTime = make(chan *Measurements, *metricsBufSize)
+
 	// transferRate instruments rate of file transfer.
 	transferRate = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -361,6 +386,8 @@ func init() {
 	prometheus.MustRegister(mergedQuery)
 	prometheus.MustRegister(healthCheckStatus)
 	prometheus.MustRegister(grpcErrorByCode)
+	prometheus.MustRegister(rateLimitedCounter)
+	prometheus.MustRegister(throttledTime)
 	prometheus.MustRegister(CachedFileCount)
 	prometheus.MustRegister(CachedFileRetryTimes)
 	prometheus.MustRegister(CachedFileRetryTimesGauge)
@@ -427,6 +454,11 @@ func StartMetrics() {
 					healthCheckStatus.WithLabelValues(m.Name, m.Biz).Inc()
 				case m := <-GrpcErrorByCode:
 					grpcErrorByCode.WithLabelValues(m.Name).Inc()
+				case m := <-RateLimited:
+					rateLimitedCounter.WithLabelValues(m.Name, m.Biz).Inc()
+				case m := <-ThrottledTime:
+					// in millisecond
+					throttledTime.WithLabelValues(m.Name, m.Biz).Add(m.Value / 1e6)
 				}
 			}
 		}()
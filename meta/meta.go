@@ -2,6 +2,8 @@ package meta
 
 import (
 	"errors"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -12,6 +14,14 @@ const (
 	EntitySeaweedFS
 )
 
+// UserAttrPrefix is the prefix of keys of user attributes in ExtAttr,
+// which keeps them apart from the internal attributes.
+const UserAttrPrefix = "user."
+
+// ExpireTimeKey is the key of expire time in ExtAttr, its value is
+// in milliseconds since epoch.
+const ExpireTimeKey = "expiretime"
+
 // Type of file entity.
 type EntityType uint8
 
@@ -21,6 +31,7 @@ type File struct {
 	Biz        string
 	Name       string
 	Md5        string
+	Sha256     string
 	UserId     string
 	Domain     int64
 	Size       int64
@@ -30,6 +41,16 @@ type File struct {
 	Type       EntityType
 }
 
+// FileFilter represents the conditions to list files.
+// Zero value of a field means no restriction on it.
+type FileFilter struct {
+	Domain int64
+	UserId string
+	Biz    string
+	Start  time.Time // inclusive
+	End    time.Time // exclusive
+}
+
 type FileMetaOp interface {
 	// Find looks up the metadata of a file by its fid.
 	Find(fid string) (*File, error)
@@ -40,14 +61,94 @@ type FileMetaOp interface {
 	// FindByMd5 looks up the metadata of a file by its md5 and domain.
 	FindByMd5(md5 string, domain int64) (*File, error)
 
+	// FindBySha256 looks up the metadata of a file by its sha256 and domain.
+	FindBySha256(sha256 string, domain int64) (*File, error)
+
 	// DuplicateWithId duplicates a given file by its fid.
 	DuplicateWithId(fid string, did string, createDate time.Time) (string, error)
 
 	// Delete deletes a file.
 	Delete(fid string) (tobeDeleted bool, entityIdToBeDeleted string, err error)
+
+	// List lists files which match the filter, starts after cursor.
+	// It returns an empty cursor when there is no more file.
+	List(filter *FileFilter, cursor string, limit int) ([]*File, string, error)
+
+	// UpdateAttrs updates ext attributes of a file by its fid.
+	// An attribute with empty value will be removed.
+	UpdateAttrs(fid string, attrs map[string]string) error
+}
+
+// UserAttrs returns the user attributes in ext attributes.
+func UserAttrs(ext map[string]string) map[string]string {
+	var attrs map[string]string
+	for k, v := range ext {
+		if strings.HasPrefix(k, UserAttrPrefix) {
+			if attrs == nil {
+				attrs = make(map[string]string)
+			}
+			attrs[strings.TrimPrefix(k, UserAttrPrefix)] = v
+		}
+	}
+
+	return attrs
+}
+
+// ExtUserAttrs returns the ext attributes of user attributes.
+func ExtUserAttrs(attrs map[string]string) map[string]string {
+	ext := make(map[string]string, len(attrs))
+	for k, v := range attrs {
+		ext[UserAttrPrefix+k] = v
+	}
+
+	return ext
 }
 
 var (
 	FileNotFound      = errors.New("file not found")
 	FileAlreadyExists = errors.New("file already exists")
 )
+
+// DuplExtAttrs returns the ext attributes of a duplication, which has
+// its own user attributes but shares the others with its entity.
+func DuplExtAttrs(entity map[string]string, dupl map[string]string) map[string]string {
+	ext := make(map[string]string, len(entity)+len(dupl))
+	for k, v := range entity {
+		if !strings.HasPrefix(k, UserAttrPrefix) {
+			ext[k] = v
+		}
+	}
+	for k, v := range dupl {
+		if strings.HasPrefix(k, UserAttrPrefix) {
+			ext[k] = v
+		}
+	}
+
+	return ext
+}
+
+// ExtAttrs returns the ext attributes of user attributes and expire
+// time, a zero expire time is omitted.
+func ExtAttrs(attrs map[string]string, expireTime int64) map[string]string {
+	ext := ExtUserAttrs(attrs)
+	if expireTime > 0 {
+		ext[ExpireTimeKey] = strconv.FormatInt(expireTime, 10)
+	}
+
+	return ext
+}
+
+// ExpireTime returns the expire time in ext attributes, 0 for never.
+func ExpireTime(ext map[string]string) int64 {
+	v, ok := ext[ExpireTimeKey]
+	if !ok {
+		return 0
+	}
+
+	t, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return t
+}
@@ -14,11 +14,12 @@ const (
 )
 
 type Dupl struct {
-	Id         bson.ObjectId `bson:"_id"`              // id
-	Ref        bson.ObjectId `bson:"reference"`        // reference
-	Length     int64         `bson:"length"`           // length
-	UploadDate time.Time     `bson:"uploadDate"`       // upload date
-	Domain     int64         `bson:"domain,omitempty"` // domain
+	Id         bson.ObjectId     `bson:"_id"`              // id
+	Ref        bson.ObjectId     `bson:"reference"`        // reference
+	Length     int64             `bson:"length"`           // length
+	UploadDate time.Time         `bson:"uploadDate"`       // upload date
+	Domain     int64             `bson:"domain,omitempty"` // domain
+	Attrs      map[string]string `bson:"attrs,omitempty"`  // custom attributes
 }
 
 type Ref struct {
@@ -116,6 +117,34 @@ func (d *DuplicateOp) LookupDuplById(id bson.ObjectId) (*Dupl, error) {
 	return dupl, nil
 }
 
+// LookupRefsByIds looks up the refs of ids, in one query.
+// Ids without ref are absent from the result.
+func (d *DuplicateOp) LookupRefsByIds(ids []bson.ObjectId) ([]*Ref, error) {
+	var result []*Ref
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	err := d.execute(func(session *mgo.Session) error {
+		return session.DB(d.dbName).C(d.rcColName).Find(bson.M{"_id": bson.M{"$in": ids}}).All(&result)
+	})
+	return result, err
+}
+
+// LookupDuplsByIds looks up the dupls of ids, in one query.
+// Ids without dupl are absent from the result.
+func (d *DuplicateOp) LookupDuplsByIds(ids []bson.ObjectId) ([]*Dupl, error) {
+	var result []*Dupl
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	err := d.execute(func(session *mgo.Session) error {
+		return session.DB(d.dbName).C(d.duplColName).Find(bson.M{"_id": bson.M{"$in": ids}}).All(&result)
+	})
+	return result, err
+}
+
 // LookupDuplByRefid looks up a dupl by its ref id.
 func (d *DuplicateOp) LookupDuplByRefid(rid bson.ObjectId) []*Dupl {
 	result := make([]*Dupl, 0, 10)
@@ -134,6 +163,80 @@ func (d *DuplicateOp) LookupDuplByRefid(rid bson.ObjectId) []*Dupl {
 	return result
 }
 
+// ListDupls calls f with the dupls of domain uploaded in [start, end)
+// in ascending order of id, starts after the given id if it is valid,
+// until f returns false. A zero time means no restriction on it.
+// Dupls saved without domain are never listed.
+func (d *DuplicateOp) ListDupls(domain int64, after bson.ObjectId, start time.Time, end time.Time, f func(*Dupl) bool) error {
+	query := bson.M{"domain": domain}
+	if after.Valid() {
+		query["_id"] = bson.M{"$gt": after}
+	}
+
+	date := bson.M{}
+	if !start.IsZero() {
+		date["$gte"] = start
+	}
+	if !end.IsZero() {
+		date["$lt"] = end
+	}
+	if len(date) > 0 {
+		query["uploadDate"] = date
+	}
+
+	return d.execute(func(session *mgo.Session) error {
+		iter := session.DB(d.dbName).C(d.duplColName).Find(query).Sort("_id").Iter()
+		defer iter.Close()
+
+		for dupl := new(Dupl); iter.Next(dupl); dupl = new(Dupl) {
+			if !f(dupl) {
+				break
+			}
+		}
+
+		return iter.Err()
+	})
+}
+
+// UpdateDuplAttrs updates custom attributes of a dupl, an attribute
+// with empty value will be removed. It returns mgo.ErrNotFound if the
+// dupl does not exist.
+func (d *DuplicateOp) UpdateDuplAttrs(id bson.ObjectId, attrs map[string]string) error {
+	update := AttrsUpdate(attrs)
+	if len(update) == 0 {
+		return nil
+	}
+
+	return d.execute(func(session *mgo.Session) error {
+		return session.DB(d.dbName).C(d.duplColName).UpdateId(id, update)
+	})
+}
+
+// AttrsUpdate returns the update document of custom attributes stored
+// in field attrs, an attribute with empty value will be removed. It
+// returns an empty document if there is nothing to update.
+func AttrsUpdate(attrs map[string]string) bson.M {
+	set := bson.M{}
+	unset := bson.M{}
+	for k, v := range attrs {
+		if len(v) == 0 {
+			unset["attrs."+k] = ""
+			continue
+		}
+		set["attrs."+k] = v
+	}
+
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	return update
+}
+
 // RemoveDupl removes a dupl by its id.
 func (d *DuplicateOp) RemoveDupl(id bson.ObjectId) error {
 	if err := d.execute(func(session *mgo.Session) error {
@@ -200,6 +303,16 @@ func (d *DuplicateOp) DecRefCnt(id bson.ObjectId) (*Ref, error) {
 	return result, nil
 }
 
+// EnsureDuplIndex ensures the index of dupls for listing them by domain.
+func (d *DuplicateOp) EnsureDuplIndex() error {
+	return d.execute(func(session *mgo.Session) error {
+		return session.DB(d.dbName).C(d.duplColName).EnsureIndex(mgo.Index{
+			Key:        []string{"domain", "_id"},
+			Background: true,
+		})
+	})
+}
+
 // NewDuplicateOp creates a DuplicateOp object with given session
 // and database name.
 func NewDuplicateOp(dbName string, uri string, prefix string) (*DuplicateOp, error) {
@@ -2,6 +2,8 @@ package metadata
 
 import (
 	"testing"
+
+	"gopkg.in/mgo.v2/bson"
 )
 
 func TestSaveAndRemoveRef(t *testing.T) {
@@ -145,6 +147,22 @@ func TestDupl(t *testing.T) {
 		t.Errorf("LookupDuplbyRefid error: nothing.")
 	}
 
+	ids := []bson.ObjectId{ref.Id, dupl.Id}
+	refs, err := op.LookupRefsByIds(ids)
+	if err != nil {
+		t.Errorf("LookupRefsByIds error %v", err)
+	}
+	if len(refs) != 1 || refs[0].Id != ref.Id {
+		t.Errorf("LookupRefsByIds error, expected ref %s only, got %v", ref.Id.Hex(), refs)
+	}
+	found, err := op.LookupDuplsByIds(ids)
+	if err != nil {
+		t.Errorf("LookupDuplsByIds error %v", err)
+	}
+	if len(found) != 1 || found[0].Id != dupl.Id {
+		t.Errorf("LookupDuplsByIds error, expected dupl %s only, got %v", dupl.Id.Hex(), found)
+	}
+
 	err = op.RemoveDupl(dupl.Id)
 	if err != nil {
 		t.Errorf("RemoveDupl error %v", err)
@@ -26,6 +26,14 @@ const (
 	FailDupl                // 9
 	SucMd5                  // 10
 	FailMd5                 // 11
+	FailVerify              // 12
+	SucTrash                // 13
+	SucRestore              // 14
+	SucDedup                // 15
+	SucSha256               // 16
+	FailSha256              // 17
+	Unauthorized            // 18
+	AdminCommand            // 19
 )
 
 const (
@@ -66,6 +74,22 @@ func (t EventType) String() string {
 		return "SucMd5"
 	case FailMd5:
 		return "FailMd5"
+	case FailVerify:
+		return "FailVerify"
+	case SucTrash:
+		return "SucTrash"
+	case SucRestore:
+		return "SucRestore"
+	case SucDedup:
+		return "SucDedup"
+	case SucSha256:
+		return "SucSha256"
+	case FailSha256:
+		return "FailSha256"
+	case Unauthorized:
+		return "Unauthorized"
+	case AdminCommand:
+		return "AdminCommand"
 	}
 }
 
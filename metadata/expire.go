@@ -0,0 +1,81 @@
+package metadata
+
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	EXPIRE_COL = "expire" // expire collection name
+)
+
+// Expiry represents a file which will be removed at its expire time.
+type Expiry struct {
+	Id         string `bson:"_id"`        // fid
+	Domain     int64  `bson:"domain"`     // domain
+	ExpireTime int64  `bson:"expiretime"` // expire time in milliseconds
+}
+
+// String returns a string for Expiry.
+func (e *Expiry) String() string {
+	return fmt.Sprintf("Expiry[Fid %s, Domain %d, Expire at %s]",
+		e.Id, e.Domain, time.Unix(0, e.ExpireTime*1e6).Format("2006-01-02 15:04:05"))
+}
+
+// ExpireOp processes the expiries of files.
+type ExpireOp struct {
+	uri    string
+	dbName string
+}
+
+func (op *ExpireOp) execute(target func(session *mgo.Session) error) error {
+	s, err := CopySession(op.uri)
+	if err != nil {
+		return err
+	}
+	defer ReleaseSession(s)
+
+	return target(s)
+}
+
+func (op *ExpireOp) Close() {
+}
+
+// SaveExpiry saves an expiry.
+func (op *ExpireOp) SaveExpiry(e *Expiry) error {
+	return op.execute(func(session *mgo.Session) error {
+		_, err := session.DB(op.dbName).C(EXPIRE_COL).UpsertId(e.Id, e)
+		return err
+	})
+}
+
+// GetExpiries gets expiries which expired before timestamp in milliseconds.
+func (op *ExpireOp) GetExpiries(timestamp int64, limit int) ([]Expiry, error) {
+	var result []Expiry
+	err := op.execute(func(session *mgo.Session) error {
+		q := bson.M{"expiretime": bson.M{"$lte": timestamp}}
+		return session.DB(op.dbName).C(EXPIRE_COL).Find(q).Sort("expiretime").Limit(limit).All(&result)
+	})
+
+	return result, err
+}
+
+// RemoveExpiryById removes an expiry by fid, returns mgo.ErrNotFound
+// if it has been removed already.
+func (op *ExpireOp) RemoveExpiryById(fid string) error {
+	return op.execute(func(session *mgo.Session) error {
+		return session.DB(op.dbName).C(EXPIRE_COL).RemoveId(fid)
+	})
+}
+
+// NewExpireOp creates an ExpireOp object with given mongodb uri
+// and database name.
+func NewExpireOp(dbName string, uri string) (*ExpireOp, error) {
+	return &ExpireOp{
+		uri:    uri,
+		dbName: dbName,
+	}, nil
+}
@@ -38,6 +38,13 @@ func (op *MongoMetaOp) execute(target func(session *mgo.Session) error) error {
 func (op *MongoMetaOp) Close() {
 }
 
+// Ping checks whether the database is reachable.
+func (op *MongoMetaOp) Ping() error {
+	return op.execute(func(session *mgo.Session) error {
+		return session.Ping()
+	})
+}
+
 // SaveSegment saves a Segment object into "chunks" collection.
 // If id of the saved object is nil, it will be set to a new ObjectId.
 func (op *MongoMetaOp) SaveSegment(seg *Segment) error {
@@ -142,6 +149,42 @@ func (op *MongoMetaOp) FindAllShards() []*Shard {
 	return result
 }
 
+// SaveShard saves a shard server into collection "servers".
+// If id of the saved object is nil, it will be set to a new ObjectId.
+func (op *MongoMetaOp) SaveShard(s *Shard) error {
+	if string(s.Id) == "" {
+		s.Id = bson.NewObjectId()
+	}
+	if !s.Id.Valid() {
+		return ObjectIdInvalidError
+	}
+
+	return op.execute(func(session *mgo.Session) error {
+		return session.DB(op.dbName).C(SHARD_COL).Insert(s)
+	})
+}
+
+// UpdateShard updates a shard server by its name, its id keeps unchanged.
+func (op *MongoMetaOp) UpdateShard(s *Shard) error {
+	return op.execute(func(session *mgo.Session) error {
+		old := new(Shard)
+		c := session.DB(op.dbName).C(SHARD_COL)
+		if err := c.Find(bson.M{"name": s.Name}).One(old); err != nil {
+			return err
+		}
+
+		s.Id = old.Id
+		return c.UpdateId(old.Id, s)
+	})
+}
+
+// RemoveShard removes a shard server by its name.
+func (op *MongoMetaOp) RemoveShard(name string) error {
+	return op.execute(func(session *mgo.Session) error {
+		return session.DB(op.dbName).C(SHARD_COL).Remove(bson.M{"name": name})
+	})
+}
+
 // NewMongoMetaOp creates a MongoMetaOp object with given mongodb uri
 // and database name.
 func NewMongoMetaOp(dbName string, uri string) (*MongoMetaOp, error) {
@@ -109,3 +109,35 @@ func TestFindAllShards(t *testing.T) {
 		t.Errorf("degrade server not found.")
 	}
 }
+
+func TestSaveUpdateRemoveShard(t *testing.T) {
+	sop, err := NewMongoMetaOp(dbName, dbUri)
+	if err != nil {
+		t.Errorf("init server col error: %v\n", err)
+	}
+
+	shard := &Shard{Name: "shard-admin", Uri: "mongodb://127.0.0.1:27017", ShdType: Gridgo}
+	if err := sop.SaveShard(shard); err != nil {
+		t.Errorf("save server error: %v\n", err)
+	}
+
+	update := &Shard{Name: "shard-admin", Uri: "mongodb://127.0.0.2:27017", ShdType: Gridgo}
+	if err := sop.UpdateShard(update); err != nil {
+		t.Errorf("update server error: %v\n", err)
+	}
+	if update.Id != shard.Id {
+		t.Errorf("update server error: id changed.")
+	}
+
+	s, err := sop.LookupShardByName("shard-admin")
+	if err != nil || s.Uri != update.Uri {
+		t.Errorf("find server shard-admin error %v, %v.", s, err)
+	}
+
+	if err := sop.RemoveShard("shard-admin"); err != nil {
+		t.Errorf("remove server error: %v\n", err)
+	}
+	if _, err := sop.LookupShardByName("shard-admin"); err == nil {
+		t.Errorf("server shard-admin not removed.")
+	}
+}
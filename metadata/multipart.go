@@ -0,0 +1,202 @@
+package metadata
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	MULTIPART_COL = "multipart" // multipart upload collection name
+)
+
+// Part represents a part of a multipart upload, which is kept as
+// a file until the upload completes.
+type Part struct {
+	Number int    `bson:"number"` // part number
+	Fid    string `bson:"fid"`    // fid of the file of part
+	Size   int64  `bson:"size"`   // size of part
+	Md5    string `bson:"md5"`    // md5 of part
+	Sha256 string `bson:"sha256"` // sha256 of part
+}
+
+// Multipart represents an upload which puts a file part by part.
+type Multipart struct {
+	Id         bson.ObjectId     `bson:"_id"`                  // upload id
+	Domain     int64             `bson:"domain"`               // domain
+	User       int64             `bson:"user"`                 // user id
+	Biz        string            `bson:"biz"`                  // biz
+	Name       string            `bson:"name"`                 // file name
+	Key        string            `bson:"key,omitempty"`        // object key, empty for a file
+	Md5        string            `bson:"md5,omitempty"`        // declared md5 of whole file
+	Size       int64             `bson:"size,omitempty"`       // declared size of whole file
+	Attrs      map[string]string `bson:"attrs,omitempty"`      // custom attributes
+	ExpireTime int64             `bson:"expiretime,omitempty"` // expire time in milliseconds
+	Parts      map[string]Part   `bson:"parts,omitempty"`      // parts by number
+	CreateTime int64             `bson:"createtime"`           // create timestamp
+	Fid        string            `bson:"fid,omitempty"`        // fid of the file completing into
+	Numbers    []int             `bson:"numbers,omitempty"`    // numbers of parts completing
+}
+
+// String returns a string for Multipart.
+func (m *Multipart) String() string {
+	return fmt.Sprintf("Multipart[Id %s, Domain %d, User %d, Biz %s, Name %s, Parts %d, %s]",
+		m.Id.Hex(), m.Domain, m.User, m.Biz, m.Name, len(m.Parts), time.Unix(m.CreateTime, 0).Format("2006-01-02 15:04:05"))
+}
+
+// SortedParts returns the parts in order of number.
+func (m *Multipart) SortedParts() []Part {
+	parts := make([]Part, 0, len(m.Parts))
+	for _, p := range m.Parts {
+		parts = append(parts, p)
+	}
+	sort.Sort(partsByNumber(parts))
+
+	return parts
+}
+
+type partsByNumber []Part
+
+func (p partsByNumber) Len() int           { return len(p) }
+func (p partsByNumber) Less(i, j int) bool { return p[i].Number < p[j].Number }
+func (p partsByNumber) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// MultipartOp processes multipart uploads.
+type MultipartOp struct {
+	uri    string
+	dbName string
+}
+
+func (op *MultipartOp) execute(target func(session *mgo.Session) error) error {
+	s, err := CopySession(op.uri)
+	if err != nil {
+		return err
+	}
+	defer ReleaseSession(s)
+
+	return target(s)
+}
+
+func (op *MultipartOp) Close() {
+}
+
+// SaveMultipart saves a multipart upload.
+func (op *MultipartOp) SaveMultipart(m *Multipart) error {
+	if m.Id == "" {
+		m.Id = bson.NewObjectId()
+	}
+
+	return op.execute(func(session *mgo.Session) error {
+		return session.DB(op.dbName).C(MULTIPART_COL).Insert(m)
+	})
+}
+
+// LookupMultipartById finds a multipart upload by its id, returns nil
+// if not found.
+func (op *MultipartOp) LookupMultipartById(id bson.ObjectId) (*Multipart, error) {
+	m := &Multipart{}
+	err := op.execute(func(session *mgo.Session) error {
+		return session.DB(op.dbName).C(MULTIPART_COL).FindId(id).One(m)
+	})
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// SavePart saves a part of a multipart upload, returns the part
+// replaced by it, nil if there is none. It returns mgo.ErrNotFound
+// if the upload does not exist or is completing.
+func (op *MultipartOp) SavePart(id bson.ObjectId, p *Part) (*Part, error) {
+	num := strconv.Itoa(p.Number)
+
+	old := &Multipart{}
+	err := op.execute(func(session *mgo.Session) error {
+		q := bson.M{"_id": id, "fid": bson.M{"$exists": false}}
+		_, err := session.DB(op.dbName).C(MULTIPART_COL).Find(q).Apply(mgo.Change{
+			Update: bson.M{"$set": bson.M{"parts." + num: p}},
+		}, old)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if prev, ok := old.Parts[num]; ok {
+		return &prev, nil
+	}
+
+	return nil, nil
+}
+
+// ClaimMultipart claims a multipart upload to complete its parts of
+// numbers into file fid, returns the upload claimed. An upload is
+// claimed only once, the one claimed before is returned with the fid
+// and numbers claimed by others. It returns mgo.ErrNotFound if the
+// upload does not exist.
+func (op *MultipartOp) ClaimMultipart(id bson.ObjectId, fid string, numbers []int) (*Multipart, error) {
+	m := &Multipart{}
+	err := op.execute(func(session *mgo.Session) error {
+		q := bson.M{"_id": id, "fid": bson.M{"$exists": false}}
+		_, err := session.DB(op.dbName).C(MULTIPART_COL).Find(q).Apply(mgo.Change{
+			Update:    bson.M{"$set": bson.M{"fid": fid, "numbers": numbers}},
+			ReturnNew: true,
+		}, m)
+		if err == mgo.ErrNotFound {
+			return session.DB(op.dbName).C(MULTIPART_COL).FindId(id).One(m)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// ReleaseMultipart releases a multipart upload claimed with fid, so
+// it can be completed again.
+func (op *MultipartOp) ReleaseMultipart(id bson.ObjectId, fid string) error {
+	return op.execute(func(session *mgo.Session) error {
+		return session.DB(op.dbName).C(MULTIPART_COL).Update(
+			bson.M{"_id": id, "fid": fid},
+			bson.M{"$unset": bson.M{"fid": "", "numbers": ""}},
+		)
+	})
+}
+
+// GetExpiredMultiparts gets multipart uploads created before timestamp.
+func (op *MultipartOp) GetExpiredMultiparts(timestamp int64, limit int) ([]Multipart, error) {
+	var result []Multipart
+	err := op.execute(func(session *mgo.Session) error {
+		q := bson.M{"createtime": bson.M{"$lte": timestamp}}
+		return session.DB(op.dbName).C(MULTIPART_COL).Find(q).Limit(limit).All(&result)
+	})
+
+	return result, err
+}
+
+// RemoveMultipartById removes a multipart upload by its id, returns
+// mgo.ErrNotFound if it has been removed already.
+func (op *MultipartOp) RemoveMultipartById(id bson.ObjectId) error {
+	return op.execute(func(session *mgo.Session) error {
+		return session.DB(op.dbName).C(MULTIPART_COL).RemoveId(id)
+	})
+}
+
+// NewMultipartOp creates a MultipartOp object with given mongodb uri
+// and database name.
+func NewMultipartOp(dbName string, uri string) (*MultipartOp, error) {
+	return &MultipartOp{
+		uri:    uri,
+		dbName: dbName,
+	}, nil
+}
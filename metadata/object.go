@@ -0,0 +1,144 @@
+package metadata
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	OBJECT_COL = "object" // object collection name
+)
+
+// Object represents a file which is addressed by a key in its domain.
+type Object struct {
+	Id       string `bson:"_id"`      // domain/key
+	Domain   int64  `bson:"domain"`   // domain
+	Key      string `bson:"key"`      // key
+	Fid      string `bson:"fid"`      // fid of file
+	Size     int64  `bson:"size"`     // size of file
+	Md5      string `bson:"md5"`      // md5 of file
+	Modified int64  `bson:"modified"` // timestamp of last modification in milliseconds
+}
+
+// String returns a string for Object.
+func (o *Object) String() string {
+	return fmt.Sprintf("Object[Domain %d, Key %s, Fid %s, Size %d, Modified at %s]",
+		o.Domain, o.Key, o.Fid, o.Size, time.Unix(0, o.Modified*1e6).Format("2006-01-02 15:04:05"))
+}
+
+// ObjectId returns the id of object by its domain and key.
+func ObjectId(domain int64, key string) string {
+	return fmt.Sprintf("%d/%s", domain, key)
+}
+
+// ObjectOp processes the objects.
+type ObjectOp struct {
+	uri    string
+	dbName string
+}
+
+func (op *ObjectOp) execute(target func(session *mgo.Session) error) error {
+	s, err := CopySession(op.uri)
+	if err != nil {
+		return err
+	}
+	defer ReleaseSession(s)
+
+	return target(s)
+}
+
+func (op *ObjectOp) Close() {
+}
+
+// SaveObject saves an object, returns the object replaced by it,
+// nil if there is none.
+func (op *ObjectOp) SaveObject(o *Object) (*Object, error) {
+	o.Id = ObjectId(o.Domain, o.Key)
+
+	old := &Object{}
+	var info *mgo.ChangeInfo
+	err := op.execute(func(session *mgo.Session) error {
+		var err error
+		info, err = session.DB(op.dbName).C(OBJECT_COL).FindId(o.Id).Apply(mgo.Change{
+			Update: o,
+			Upsert: true,
+		}, old)
+		return err
+	})
+	if err == mgo.ErrNotFound || (err == nil && info.UpsertedId != nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return old, nil
+}
+
+// LookupObject finds an object by its domain and key, returns nil
+// if not found.
+func (op *ObjectOp) LookupObject(domain int64, key string) (*Object, error) {
+	o := &Object{}
+	err := op.execute(func(session *mgo.Session) error {
+		return session.DB(op.dbName).C(OBJECT_COL).FindId(ObjectId(domain, key)).One(o)
+	})
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// RemoveObject removes an object by its domain and key, returns the
+// removed object, nil if not found.
+func (op *ObjectOp) RemoveObject(domain int64, key string) (*Object, error) {
+	o := &Object{}
+	err := op.execute(func(session *mgo.Session) error {
+		_, err := session.DB(op.dbName).C(OBJECT_COL).FindId(ObjectId(domain, key)).Apply(mgo.Change{
+			Remove: true,
+		}, o)
+		return err
+	})
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// ListObjects lists objects of a domain in order of key, whose keys
+// have the given prefix and are after the given key.
+func (op *ObjectOp) ListObjects(domain int64, prefix string, after string, limit int) ([]Object, error) {
+	q := bson.M{
+		"_id": bson.M{
+			"$gt":    ObjectId(domain, after),
+			"$regex": bson.RegEx{Pattern: "^" + regexp.QuoteMeta(ObjectId(domain, prefix))},
+		},
+	}
+
+	var result []Object
+	err := op.execute(func(session *mgo.Session) error {
+		return session.DB(op.dbName).C(OBJECT_COL).Find(q).Sort("_id").Limit(limit).All(&result)
+	})
+
+	return result, err
+}
+
+// NewObjectOp creates an ObjectOp object with given mongodb uri
+// and database name.
+func NewObjectOp(dbName string, uri string) (*ObjectOp, error) {
+	return &ObjectOp{
+		uri:    uri,
+		dbName: dbName,
+	}, nil
+}
@@ -31,6 +31,18 @@ type MetaOp interface {
 	// FindAllShards finds all shard servers.
 	FindAllShards() []*Shard
 
+	// SaveShard saves a shard server into database.
+	SaveShard(s *Shard) error
+
+	// UpdateShard updates a shard server by its name.
+	UpdateShard(s *Shard) error
+
+	// RemoveShard removes a shard server by its name.
+	RemoveShard(name string) error
+
+	// Ping checks whether the database is reachable.
+	Ping() error
+
 	// Close releases session hold by MetaOp.
 	Close()
 }
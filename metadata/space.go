@@ -17,6 +17,11 @@ const (
 	DeleteType
 )
 
+const (
+	SLOG_COL  = "slog"  // space log collection name
+	USAGE_COL = "usage" // usage collection name
+)
+
 // SpaceLogType represents the type of space log.
 type SpaceLogType uint
 
@@ -54,6 +59,19 @@ func (s *SpaceLog) String() string {
 		s.Domain, s.Uid, s.Fid, s.Biz, s.Size, s.Timestamp, s.Type)
 }
 
+// Usage represents the storage usage of a domain, which is
+// accumulated from its space logs when they are saved.
+type Usage struct {
+	Domain int64 `bson:"_id"`   // domain
+	Size   int64 `bson:"size"`  // bytes of entities
+	Files  int64 `bson:"files"` // number of entities
+}
+
+// String returns a string for logging into file.
+func (u *Usage) String() string {
+	return fmt.Sprintf("Usage[Domain %d, Size %d, Files %d]", u.Domain, u.Size, u.Files)
+}
+
 type SpaceLogOp struct {
 	uri    string
 	dbName string
@@ -111,11 +129,114 @@ func (op *SpaceLogOp) saveSpaceLog(log *SpaceLog) error {
 		log.Biz = "general"
 	}
 
+	err := op.execute(func(session *mgo.Session) error {
+		return session.DB(op.dbName).C(SLOG_COL).Insert(*log)
+	})
+	if err != nil {
+		return err
+	}
+
+	return op.accumulate(log)
+}
+
+// accumulate adds a space log to the usage of its domain.
+func (op *SpaceLogOp) accumulate(log *SpaceLog) error {
+	size, files := log.Size, int64(1)
+	if NewSpaceLogType(log.Type) == DeleteType {
+		size, files = -size, -files
+	}
+
 	return op.execute(func(session *mgo.Session) error {
-		return session.DB(op.dbName).C("slog").Insert(*log)
+		_, err := session.DB(op.dbName).C(USAGE_COL).UpsertId(log.Domain, bson.M{
+			"$inc": bson.M{
+				"size":  size,
+				"files": files,
+			},
+		})
+		return err
 	})
 }
 
+// LookupUsage returns the usage of a domain, which is zero if nothing
+// accumulated yet.
+func (op *SpaceLogOp) LookupUsage(domain int64) (*Usage, error) {
+	u := new(Usage)
+	err := op.execute(func(session *mgo.Session) error {
+		return session.DB(op.dbName).C(USAGE_COL).FindId(domain).One(u)
+	})
+	if err == mgo.ErrNotFound {
+		return &Usage{Domain: domain}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// RebuildUsage rebuilds the usage of a domain from all its space logs,
+// for the domain which has space logs saved before usage is accumulated.
+// It is run once, while no file of the domain is being stored, since
+// the space logs saved during rebuilding may be counted twice or lost.
+func (op *SpaceLogOp) RebuildUsage(domain int64) (*Usage, error) {
+	u, err := op.buildUsage(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	err = op.execute(func(session *mgo.Session) error {
+		_, err := session.DB(op.dbName).C(USAGE_COL).UpsertId(domain, bson.M{
+			"$set": bson.M{
+				"size":  u.Size,
+				"files": u.Files,
+			},
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	glog.Infof("Succeeded to rebuild %s from space logs.", u.String())
+	return u, nil
+}
+
+// buildUsage sums up the space logs of a domain.
+func (op *SpaceLogOp) buildUsage(domain int64) (*Usage, error) {
+	var sums []struct {
+		Type  string `bson:"_id"`
+		Size  int64  `bson:"size"`
+		Files int64  `bson:"files"`
+	}
+
+	err := op.execute(func(session *mgo.Session) error {
+		return session.DB(op.dbName).C(SLOG_COL).Pipe([]bson.M{
+			{"$match": bson.M{"domain": domain}},
+			{"$group": bson.M{
+				"_id":   "$type",
+				"size":  bson.M{"$sum": "$size"},
+				"files": bson.M{"$sum": 1},
+			}},
+		}).All(&sums)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	u := &Usage{Domain: domain}
+	for _, sum := range sums {
+		if NewSpaceLogType(sum.Type) == DeleteType {
+			u.Size -= sum.Size
+			u.Files -= sum.Files
+			continue
+		}
+		u.Size += sum.Size
+		u.Files += sum.Files
+	}
+
+	return u, nil
+}
+
 // NewSpaceLogOp creates a SpaceLogOp object with given mongodb uri
 // and database name.
 func NewSpaceLogOp(dbName string, uri string) (*SpaceLogOp, error) {
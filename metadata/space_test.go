@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -46,3 +47,91 @@ func TestSaveSpaceLog(t *testing.T) {
 	}
 	lop.SaveSpaceLog(log3)
 }
+
+func TestLookupUsage(t *testing.T) {
+	lop, err := NewSpaceLogOp(dbName, dbUri)
+	if err != nil {
+		t.Errorf("NewSpaceLogOp error %v", err)
+	}
+
+	domain := time.Now().UnixNano()
+	u, err := lop.LookupUsage(domain)
+	if err != nil {
+		t.Errorf("LookupUsage error %v", err)
+	}
+	if u.Size != 0 || u.Files != 0 {
+		t.Errorf("expected zero usage, got %s", u.String())
+	}
+
+	for _, typ := range []SpaceLogType{CreateType, CreateType, DeleteType} {
+		if err := lop.saveSpaceLog(&SpaceLog{
+			Domain: domain,
+			Fid:    bson.NewObjectId().Hex(),
+			Size:   1000,
+			Type:   typ.String(),
+		}); err != nil {
+			t.Errorf("saveSpaceLog error %v", err)
+		}
+	}
+
+	u, err = lop.LookupUsage(domain)
+	if err != nil {
+		t.Errorf("LookupUsage error %v", err)
+	}
+	if u.Size != 1000 || u.Files != 1 {
+		t.Errorf("unexpected usage accumulated %s", u.String())
+	}
+}
+
+func TestRebuildUsage(t *testing.T) {
+	lop, err := NewSpaceLogOp(dbName, dbUri)
+	if err != nil {
+		t.Errorf("NewSpaceLogOp error %v", err)
+	}
+
+	// Space logs saved before usage is accumulated.
+	domain := time.Now().UnixNano()
+	err = lop.execute(func(session *mgo.Session) error {
+		for _, size := range []int64{1000, 500} {
+			if err := session.DB(dbName).C(SLOG_COL).Insert(&SpaceLog{
+				Id:        bson.NewObjectId(),
+				Domain:    domain,
+				Fid:       bson.NewObjectId().Hex(),
+				Size:      size,
+				Timestamp: time.Now(),
+				Type:      CreateType.String(),
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Insert error %v", err)
+	}
+
+	u, err := lop.RebuildUsage(domain)
+	if err != nil {
+		t.Errorf("RebuildUsage error %v", err)
+	}
+	if u.Size != 1500 || u.Files != 2 {
+		t.Errorf("unexpected usage rebuilt %s", u.String())
+	}
+
+	if err := lop.saveSpaceLog(&SpaceLog{
+		Domain: domain,
+		Fid:    bson.NewObjectId().Hex(),
+		Size:   500,
+		Type:   DeleteType.String(),
+	}); err != nil {
+		t.Errorf("saveSpaceLog error %v", err)
+	}
+
+	u, err = lop.LookupUsage(domain)
+	if err != nil {
+		t.Errorf("LookupUsage error %v", err)
+	}
+	if u.Size != 1000 || u.Files != 1 {
+		t.Errorf("unexpected usage accumulated %s", u.String())
+	}
+}
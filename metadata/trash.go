@@ -0,0 +1,110 @@
+package metadata
+
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	TRASH_COL = "trash" // trash collection name
+)
+
+// Trash represents a removed file which is kept in trash bin.
+type Trash struct {
+	Id        string `bson:"_id"`       // fid of removed file
+	Domain    int64  `bson:"domain"`    // domain
+	TrashTime int64  `bson:"trashtime"` // timestamp of removing
+	PurgeTime int64  `bson:"purgetime"` // timestamp to purge
+	Client    string `bson:"client"`    // client which removed the file
+}
+
+// String returns a string for Trash.
+func (t *Trash) String() string {
+	return fmt.Sprintf("Trash[Fid %s, Domain %d, Client %s, Purge at %s]",
+		t.Id, t.Domain, t.Client, time.Unix(t.PurgeTime, 0).Format("2006-01-02 15:04:05"))
+}
+
+// TrashOp processes the trash bin.
+type TrashOp struct {
+	uri    string
+	dbName string
+}
+
+func (op *TrashOp) execute(target func(session *mgo.Session) error) error {
+	s, err := CopySession(op.uri)
+	if err != nil {
+		return err
+	}
+	defer ReleaseSession(s)
+
+	return target(s)
+}
+
+func (op *TrashOp) Close() {
+}
+
+// SaveTrash saves a file into trash bin.
+func (op *TrashOp) SaveTrash(t *Trash) error {
+	return op.execute(func(session *mgo.Session) error {
+		_, err := session.DB(op.dbName).C(TRASH_COL).UpsertId(t.Id, t)
+		return err
+	})
+}
+
+// LookupTrashById finds a trash by fid, returns nil if not found.
+func (op *TrashOp) LookupTrashById(fid string) (*Trash, error) {
+	t := &Trash{}
+	err := op.execute(func(session *mgo.Session) error {
+		return session.DB(op.dbName).C(TRASH_COL).FindId(fid).One(t)
+	})
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// LookupTrashes finds trashes of the given fids.
+func (op *TrashOp) LookupTrashes(fids []string) ([]Trash, error) {
+	var result []Trash
+	err := op.execute(func(session *mgo.Session) error {
+		q := bson.M{"_id": bson.M{"$in": fids}}
+		return session.DB(op.dbName).C(TRASH_COL).Find(q).All(&result)
+	})
+
+	return result, err
+}
+
+// GetExpiredTrashes gets trashes which should be purged before timestamp.
+func (op *TrashOp) GetExpiredTrashes(timestamp int64, limit int) ([]Trash, error) {
+	var result []Trash
+	err := op.execute(func(session *mgo.Session) error {
+		q := bson.M{"purgetime": bson.M{"$lte": timestamp}}
+		return session.DB(op.dbName).C(TRASH_COL).Find(q).Sort("purgetime").Limit(limit).All(&result)
+	})
+
+	return result, err
+}
+
+// RemoveTrashById removes a trash by fid, returns mgo.ErrNotFound
+// if it has been removed already.
+func (op *TrashOp) RemoveTrashById(fid string) error {
+	return op.execute(func(session *mgo.Session) error {
+		return session.DB(op.dbName).C(TRASH_COL).RemoveId(fid)
+	})
+}
+
+// NewTrashOp creates a TrashOp object with given mongodb uri
+// and database name.
+func NewTrashOp(dbName string, uri string) (*TrashOp, error) {
+	return &TrashOp{
+		uri:    uri,
+		dbName: dbName,
+	}, nil
+}
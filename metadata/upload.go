@@ -0,0 +1,232 @@
+package metadata
+
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	UPLOAD_COL       = "upload"       // upload session collection name
+	UPLOAD_PIECE_COL = "upload.piece" // upload piece collection name
+)
+
+// UploadSession represents a resumable upload session.
+// Its content is kept in database as pieces, so that
+// any node can resume or commit it.
+type UploadSession struct {
+	Id         bson.ObjectId     `bson:"_id"`             // id, same as session id
+	Domain     int64             `bson:"domain"`          // domain
+	User       int64             `bson:"user"`            // user id
+	Biz        string            `bson:"biz"`             // biz
+	Name       string            `bson:"name"`            // file name
+	Md5        string            `bson:"md5"`             // md5 declared by client
+	Size       int64             `bson:"size"`            // size declared by client
+	Attrs      map[string]string `bson:"attrs,omitempty"` // custom attributes
+	ExpireTime int64             `bson:"expiretime"`      // expire time of file in milliseconds
+	Offset     int64             `bson:"offset"`          // bytes received
+	CreateTime int64             `bson:"createtime"`      // create timestamp
+	UpdateTime int64             `bson:"updatetime"`      // update timestamp
+}
+
+// String returns a string for UploadSession.
+func (u *UploadSession) String() string {
+	return fmt.Sprintf("UploadSession[Id %s, Domain %d, User %d, Biz %s, Name %s, Size %d, Offset %d, %s]",
+		u.Id.Hex(), u.Domain, u.User, u.Biz, u.Name, u.Size, u.Offset, time.Unix(u.UpdateTime, 0).Format("2006-01-02 15:04:05"))
+}
+
+// A piece not referred by the offset of its session for so long is
+// left by a failed stream.
+const stalePieceTime = time.Minute
+
+// UploadPiece represents a piece of content of an upload session.
+// Pieces are looked up by session and position, content of a session
+// is the pieces before its offset.
+type UploadPiece struct {
+	Id      bson.ObjectId `bson:"_id"`     // id
+	Session bson.ObjectId `bson:"session"` // session id
+	Pos     int64         `bson:"pos"`     // position in content
+	Data    []byte        `bson:"data"`    // content
+}
+
+// UploadSessionOp processes upload sessions.
+type UploadSessionOp struct {
+	uri    string
+	dbName string
+}
+
+func (op *UploadSessionOp) execute(target func(session *mgo.Session) error) error {
+	s, err := CopySession(op.uri)
+	if err != nil {
+		return err
+	}
+	defer ReleaseSession(s)
+
+	return target(s)
+}
+
+func (op *UploadSessionOp) Close() {
+}
+
+// SaveUploadSession saves an upload session.
+func (op *UploadSessionOp) SaveUploadSession(u *UploadSession) error {
+	if u.Id == "" {
+		u.Id = bson.NewObjectId()
+	}
+
+	return op.execute(func(session *mgo.Session) error {
+		return session.DB(op.dbName).C(UPLOAD_COL).Insert(u)
+	})
+}
+
+// LookupUploadSessionById finds an upload session by its id.
+func (op *UploadSessionOp) LookupUploadSessionById(id bson.ObjectId) (*UploadSession, error) {
+	u := &UploadSession{}
+	if err := op.execute(func(session *mgo.Session) error {
+		return session.DB(op.dbName).C(UPLOAD_COL).FindId(id).One(u)
+	}); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// EnsurePieceIndex ensures the unique index of pieces by session and
+// position, so that only one piece is kept at a position.
+func (op *UploadSessionOp) EnsurePieceIndex() error {
+	return op.execute(func(session *mgo.Session) error {
+		return session.DB(op.dbName).C(UPLOAD_PIECE_COL).EnsureIndex(mgo.Index{
+			Key:        []string{"session", "pos"},
+			Unique:     true,
+			Background: true,
+		})
+	})
+}
+
+// AppendPiece appends data to the content of an upload session at
+// u.Offset, and advances u.Offset on success. It returns
+// mgo.ErrNotFound if the session has been removed or its offset
+// has been advanced by another stream since u was read.
+func (op *UploadSessionOp) AppendPiece(u *UploadSession, data []byte) error {
+	p := &UploadPiece{
+		Id:      bson.NewObjectId(),
+		Session: u.Id,
+		Pos:     u.Offset,
+		Data:    data,
+	}
+
+	return op.execute(func(session *mgo.Session) error {
+		pieces := session.DB(op.dbName).C(UPLOAD_PIECE_COL)
+		err := pieces.Insert(p)
+		if mgo.IsDup(err) {
+			// Another stream is writing at the same position,
+			// unless the piece there is stale.
+			if er := op.removeStalePiece(session, u); er != nil {
+				return er
+			}
+			err = pieces.Insert(p)
+		}
+		if mgo.IsDup(err) {
+			return mgo.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		// The piece is referred only if the offset is unchanged,
+		// the one failed to refer is an orphan and removed.
+		err = session.DB(op.dbName).C(UPLOAD_COL).Update(
+			bson.M{"_id": u.Id, "offset": u.Offset},
+			bson.M{
+				"$set": bson.M{"updatetime": time.Now().Unix()},
+				"$inc": bson.M{"offset": int64(len(data))},
+			})
+		if err != nil {
+			pieces.RemoveId(p.Id) // ignore error
+			return err
+		}
+
+		u.Offset += int64(len(data))
+		return nil
+	})
+}
+
+// removeStalePiece removes the piece at u.Offset left by a failed
+// stream. It returns mgo.ErrNotFound if the offset of session has been
+// advanced, or the piece is being written by another stream.
+func (op *UploadSessionOp) removeStalePiece(session *mgo.Session, u *UploadSession) error {
+	n, err := session.DB(op.dbName).C(UPLOAD_COL).Find(bson.M{"_id": u.Id, "offset": u.Offset}).Count()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return mgo.ErrNotFound
+	}
+
+	_, err = session.DB(op.dbName).C(UPLOAD_PIECE_COL).RemoveAll(bson.M{
+		"session": u.Id,
+		"pos":     u.Offset,
+		"_id":     bson.M{"$lt": bson.NewObjectIdWithTime(time.Now().Add(-stalePieceTime))},
+	})
+	return err
+}
+
+// ReadPieces calls f with every piece of content of an
+// upload session in order.
+func (op *UploadSessionOp) ReadPieces(u *UploadSession, f func(data []byte) error) error {
+	return op.execute(func(session *mgo.Session) error {
+		pieces := session.DB(op.dbName).C(UPLOAD_PIECE_COL)
+
+		for pos := int64(0); pos < u.Offset; {
+			p := &UploadPiece{}
+			if err := pieces.Find(bson.M{"session": u.Id, "pos": pos}).One(p); err != nil {
+				return fmt.Errorf("piece at %d of upload session %s, %v", pos, u.Id.Hex(), err)
+			}
+			if len(p.Data) == 0 {
+				return fmt.Errorf("piece %s of upload session %s at %d is empty", p.Id.Hex(), u.Id.Hex(), pos)
+			}
+			if err := f(p.Data); err != nil {
+				return err
+			}
+			pos += int64(len(p.Data))
+		}
+
+		return nil
+	})
+}
+
+// GetExpiredUploadSessions gets upload sessions which have
+// not been updated since timestamp.
+func (op *UploadSessionOp) GetExpiredUploadSessions(timestamp int64, limit int) ([]UploadSession, error) {
+	var result []UploadSession
+	err := op.execute(func(session *mgo.Session) error {
+		q := bson.M{"updatetime": bson.M{"$lte": timestamp}}
+		return session.DB(op.dbName).C(UPLOAD_COL).Find(q).Limit(limit).All(&result)
+	})
+
+	return result, err
+}
+
+// RemoveUploadSessionById removes an upload session by its id,
+// together with its content.
+func (op *UploadSessionOp) RemoveUploadSessionById(id bson.ObjectId) error {
+	return op.execute(func(session *mgo.Session) error {
+		if err := session.DB(op.dbName).C(UPLOAD_COL).RemoveId(id); err != nil {
+			return err
+		}
+
+		_, err := session.DB(op.dbName).C(UPLOAD_PIECE_COL).RemoveAll(bson.M{"session": id})
+		return err
+	})
+}
+
+// NewUploadSessionOp creates an UploadSessionOp object with given
+// mongodb uri and database name.
+func NewUploadSessionOp(dbName string, uri string) (*UploadSessionOp, error) {
+	return &UploadSessionOp{
+		uri:    uri,
+		dbName: dbName,
+	}, nil
+}
@@ -0,0 +1,75 @@
+package metadata
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestAppendPiece(t *testing.T) {
+	op, err := NewUploadSessionOp("upload-test", dbUri)
+	if err != nil {
+		t.Errorf("NewUploadSessionOp error %v", err)
+	}
+	if err := op.EnsurePieceIndex(); err != nil {
+		t.Fatalf("EnsurePieceIndex error %v", err)
+	}
+
+	u := &UploadSession{
+		Domain:     2,
+		Size:       6,
+		UpdateTime: time.Now().Unix(),
+	}
+	if err := op.SaveUploadSession(u); err != nil {
+		t.Fatalf("SaveUploadSession error %v", err)
+	}
+	defer op.RemoveUploadSessionById(u.Id)
+
+	// A stale copy of session, as read by another stream.
+	stale := *u
+
+	if err := op.AppendPiece(u, []byte("abc")); err != nil {
+		t.Errorf("AppendPiece error %v", err)
+	}
+	if err := op.AppendPiece(&stale, []byte("xyz")); err != mgo.ErrNotFound {
+		t.Errorf("expected ErrNotFound for stale offset, got %v", err)
+	}
+
+	// A piece left by a failed stream is replaced.
+	orphan := &UploadPiece{
+		Id:      bson.NewObjectIdWithTime(time.Now().Add(-2 * stalePieceTime)),
+		Session: u.Id,
+		Pos:     u.Offset,
+		Data:    []byte("xyz"),
+	}
+	if err := op.execute(func(session *mgo.Session) error {
+		return session.DB(op.dbName).C(UPLOAD_PIECE_COL).Insert(orphan)
+	}); err != nil {
+		t.Fatalf("Insert error %v", err)
+	}
+	if err := op.AppendPiece(u, []byte("def")); err != nil {
+		t.Errorf("AppendPiece error %v", err)
+	}
+
+	u, err = op.LookupUploadSessionById(u.Id)
+	if err != nil {
+		t.Fatalf("LookupUploadSessionById error %v", err)
+	}
+	if u.Offset != 6 {
+		t.Errorf("unexpected session %s", u.String())
+	}
+
+	var content bytes.Buffer
+	if err := op.ReadPieces(u, func(data []byte) error {
+		_, err := content.Write(data)
+		return err
+	}); err != nil {
+		t.Errorf("ReadPieces error %v", err)
+	}
+	if content.String() != "abcdef" {
+		t.Errorf("expected abcdef, got %s", content.String())
+	}
+}
@@ -17,6 +17,10 @@ type Notice interface {
 	// GetData returns the data of given path
 	GetData(path string) ([]byte, error)
 
+	// SetData sets the data of given path, creates it if not exist.
+	// The watchers on path will be noticed.
+	SetData(path string, data []byte) error
+
 	// Register registers a server. returned chan will be noticed
 	// when its sibling nodes changed. If check is true,
 	// will start a routine to process the nodes change, otherwise not.
@@ -149,6 +149,23 @@ func (k *DfsZK) GetData(path string) ([]byte, error) {
 	return data, err
 }
 
+// SetData sets the data of given path, creates it if not exist.
+func (k *DfsZK) SetData(path string, data []byte) error {
+	exists, _, err := k.Exists(path)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		_, err := k.Create(path, data, 0, zk.WorldACL(zk.PermAll))
+		if err != zk.ErrNodeExists {
+			return err
+		}
+	}
+
+	_, err = k.Set(path, data, -1)
+	return err
+}
+
 func (k *DfsZK) createEphemeralSequenceNode(prefix string, data []byte) (string, error) {
 	flags := int32(zk.FlagEphemeral | zk.FlagSequence)
 	acl := zk.WorldACL(zk.PermAll)
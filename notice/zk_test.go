@@ -38,3 +38,25 @@ func TestZkEphemetral(t *testing.T) {
 
 	time.Sleep(1 * time.Second)
 }
+
+func TestSetData(t *testing.T) {
+	zk := NewDfsZK([]string{"127.0.0.1:2181"}, 1*time.Second)
+	if zk == nil {
+		t.Error(" create zk error")
+	}
+	defer zk.CloseZk()
+
+	path := "/shard/test-set-data"
+	defer zk.Delete(path, -1)
+
+	for _, d := range []string{"a", "b"} {
+		if err := zk.SetData(path, []byte(d)); err != nil {
+			t.Error(err)
+		}
+
+		data, err := zk.GetData(path)
+		if err != nil || string(data) != d {
+			t.Errorf("expected %s, got %s, %v", d, data, err)
+		}
+	}
+}
@@ -23,12 +23,15 @@ func File2Info(f *meta.File) *FileInfo {
 	}
 
 	return &FileInfo{
-		Id:     f.Id,
-		Name:   f.Name,
-		Md5:    f.Md5,
-		Biz:    f.Biz,
-		Size:   f.Size,
-		Domain: f.Domain,
-		User:   userId,
+		Id:         f.Id,
+		Name:       f.Name,
+		Md5:        f.Md5,
+		Sha256:     f.Sha256,
+		Biz:        f.Biz,
+		Size:       f.Size,
+		Domain:     f.Domain,
+		User:       userId,
+		Attrs:      meta.UserAttrs(f.ExtAttr),
+		ExpireTime: meta.ExpireTime(f.ExtAttr),
 	}
 }
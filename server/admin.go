@@ -0,0 +1,478 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/transport"
+	"gopkg.in/mgo.v2"
+
+	"jingoal.com/dfs/conf"
+	"jingoal.com/dfs/metadata"
+	"jingoal.com/dfs/notice"
+	"jingoal.com/dfs/proto/admin"
+	"jingoal.com/dfs/util"
+)
+
+// Data of the segment notice for reloading all segments.
+const allSegments = "-1"
+
+func adminError(code codes.Code, format string, args ...interface{}) error {
+	return transport.StreamError{
+		Code: code,
+		Desc: fmt.Sprintf(format, args...),
+	}
+}
+
+// storeError converts an error of metadata into an admin error.
+func storeError(err error, format string, args ...interface{}) error {
+	if err == mgo.ErrNotFound {
+		return adminError(codes.NotFound, format+" not found", args...)
+	}
+
+	return err
+}
+
+func shardToPb(shard *metadata.Shard) *admin.Shard {
+	attr := ""
+	if len(shard.Attr) > 0 {
+		if b, err := json.Marshal(shard.Attr); err == nil {
+			attr = string(b)
+		}
+	}
+
+	return &admin.Shard{
+		Name:        shard.Name,
+		Age:         shard.Age,
+		Uri:         shard.Uri,
+		MountPoint:  shard.MountPoint,
+		PathVersion: int32(shard.PathVersion),
+		PathDigit:   int32(shard.PathDigit),
+		VolHost:     shard.VolHost,
+		VolName:     shard.VolName,
+		VolBase:     shard.VolBase,
+		ShdType:     uint32(shard.ShdType),
+		MasterUri:   shard.MasterUri,
+		Replica:     shard.Replica,
+		DataCenter:  shard.DataCenter,
+		Rack:        shard.Rack,
+		Attr:        attr,
+	}
+}
+
+func shardFromPb(shard *admin.Shard) (*metadata.Shard, error) {
+	if shard == nil || len(shard.Name) == 0 {
+		return nil, fmt.Errorf("invalid shard [%v]", shard)
+	}
+
+	var attr map[string]interface{}
+	if len(shard.Attr) > 0 {
+		if err := json.Unmarshal([]byte(shard.Attr), &attr); err != nil {
+			return nil, fmt.Errorf("invalid attr of shard %s, %v", shard.Name, err)
+		}
+	}
+
+	return &metadata.Shard{
+		Name:        shard.Name,
+		Age:         shard.Age,
+		Uri:         shard.Uri,
+		MountPoint:  shard.MountPoint,
+		PathVersion: int(shard.PathVersion),
+		PathDigit:   int(shard.PathDigit),
+		VolHost:     shard.VolHost,
+		VolName:     shard.VolName,
+		VolBase:     shard.VolBase,
+		ShdType:     metadata.ShardType(shard.ShdType),
+		MasterUri:   shard.MasterUri,
+		Replica:     shard.Replica,
+		DataCenter:  shard.DataCenter,
+		Rack:        shard.Rack,
+		Attr:        attr,
+	}, nil
+}
+
+func segmentToPb(seg *metadata.Segment) *admin.Segment {
+	return &admin.Segment{
+		Domain:        seg.Domain,
+		NormalServer:  seg.NormalServer,
+		MigrateServer: seg.MigrateServer,
+	}
+}
+
+func featureToPb(f *conf.FeatureFlag) *admin.FeatureFlag {
+	return &admin.FeatureFlag{
+		Key:        f.Key,
+		Enabled:    f.Enabled,
+		Domains:    f.Domains,
+		Groups:     f.Groups,
+		Percentage: f.Percentage,
+	}
+}
+
+// shardStatus returns the status of shard on this server, including
+// the status of its handler and the handlers attached to it.
+func (hs *HandlerSelector) shardStatus(shard *metadata.Shard) *admin.ShardStatus {
+	status := &admin.ShardStatus{
+		Shard: shardToPb(shard),
+	}
+
+	sh, ok := hs.getShardHandler(shard.Name)
+	if !ok {
+		return status
+	}
+
+	status.Loaded = true
+	status.Up = hs.shardServing(sh)
+	if sh == hs.degradeShardHandler {
+		status.Degrade = true
+		return status
+	}
+
+	if hs.minorHandler != nil && shard.ShdType == metadata.Glustergo {
+		status.Minor = hs.minorHandler.Name()
+	}
+	if hs.backStoreShard != nil {
+		status.Backstore = hs.backStoreShard.Name
+	}
+
+	return status
+}
+
+// segmentsInUse returns the segments used by selector.
+func (hs *HandlerSelector) segmentsInUse() []*metadata.Segment {
+	hs.segmentLock.RLock()
+	defer hs.segmentLock.RUnlock()
+
+	return append([]*metadata.Segment{}, hs.segments...)
+}
+
+// noticeShard notices all servers that a shard changed.
+func (s *DFSServer) noticeShard(name string) error {
+	if err := s.notice.SetData(notice.ShardServerPath, []byte(name)); err != nil {
+		return fmt.Errorf("failed to notice shard %s, %v", name, err)
+	}
+
+	return nil
+}
+
+// noticeSegment notices all servers that a segment changed.
+func (s *DFSServer) noticeSegment(domain string) error {
+	if err := s.notice.SetData(notice.ShardChunkPath, []byte(domain)); err != nil {
+		return fmt.Errorf("failed to notice segment %s, %v", domain, err)
+	}
+
+	return nil
+}
+
+// auditAdmin saves an event of a succeeded admin command, with the
+// client and the subject of its token.
+func (s *DFSServer) auditAdmin(ctx context.Context, domain int64, format string, args ...interface{}) {
+	peerAddr := getPeerAddressString(ctx)
+	subject := tokenSubject(ctx)
+	desc := fmt.Sprintf(format, args...)
+
+	event := &metadata.Event{
+		EType:     metadata.AdminCommand,
+		Timestamp: util.GetTimeInMilliSecond(),
+		Domain:    domain,
+		Description: fmt.Sprintf("%s, %s, client %s, subject %s",
+			metadata.AdminCommand.String(), desc, peerAddr, subject),
+	}
+	if er := s.eventOp.SaveEvent(event); er != nil {
+		glog.Warningf("%s, error: %v", event.String(), er)
+	}
+	glog.Infof("Succeeded to %s, client %s, subject %s", desc, peerAddr, subject)
+}
+
+// ListShards lists all shards, with the status of their handlers.
+func (s *DFSServer) ListShards(ctx context.Context, req *admin.ListShardsReq) (*admin.ListShardsRep, error) {
+	glog.V(3).Infof("ListShards, client: %s, %v", getPeerAddressString(ctx), req)
+
+	rep := &admin.ListShardsRep{}
+	for _, shard := range s.mOp.FindAllShards() {
+		rep.Shards = append(rep.Shards, s.selector.shardStatus(shard))
+	}
+	if s.selector.minorHandler != nil {
+		rep.Minor = s.selector.minorHandler.Name()
+	}
+	if s.selector.backStoreShard != nil {
+		rep.Backstore = s.selector.backStoreShard.Name
+	}
+
+	return rep, nil
+}
+
+// AddShard adds a shard, and notices all servers to create its handler.
+func (s *DFSServer) AddShard(ctx context.Context, req *admin.PutShardReq) (*admin.PutShardRep, error) {
+	glog.Infof("AddShard, client: %s, %v", getPeerAddressString(ctx), req)
+
+	shard, err := shardFromPb(req.Shard)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request [%v], %v", req, err)
+	}
+
+	if _, err := s.mOp.LookupShardByName(shard.Name); err == nil {
+		return nil, adminError(codes.AlreadyExists, "shard %s already exists", shard.Name)
+	} else if err != mgo.ErrNotFound {
+		return nil, err
+	}
+
+	if err := s.mOp.SaveShard(shard); err != nil {
+		return nil, err
+	}
+	if err := s.noticeShard(shard.Name); err != nil {
+		return nil, err
+	}
+
+	s.auditAdmin(ctx, 0, "add shard %s", shard.Name)
+	return &admin.PutShardRep{
+		Shard: shardToPb(shard),
+	}, nil
+}
+
+// UpdateShard updates a shard, and notices all servers to recreate its handler.
+func (s *DFSServer) UpdateShard(ctx context.Context, req *admin.PutShardReq) (*admin.PutShardRep, error) {
+	glog.Infof("UpdateShard, client: %s, %v", getPeerAddressString(ctx), req)
+
+	shard, err := shardFromPb(req.Shard)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request [%v], %v", req, err)
+	}
+
+	if err := s.mOp.UpdateShard(shard); err != nil {
+		return nil, storeError(err, "shard %s", shard.Name)
+	}
+	if err := s.noticeShard(shard.Name); err != nil {
+		return nil, err
+	}
+
+	s.auditAdmin(ctx, 0, "update shard %s", shard.Name)
+	return &admin.PutShardRep{
+		Shard: shardToPb(shard),
+	}, nil
+}
+
+// RemoveShard removes a shard not used by any segment, and notices
+// all servers to close its handler.
+func (s *DFSServer) RemoveShard(ctx context.Context, req *admin.RemoveShardReq) (*admin.RemoveShardRep, error) {
+	glog.Infof("RemoveShard, client: %s, %v", getPeerAddressString(ctx), req)
+
+	if len(req.Name) == 0 {
+		return nil, fmt.Errorf("invalid request [%v]", req)
+	}
+
+	for _, seg := range s.selector.segmentsInUse() {
+		if seg.NormalServer == req.Name || seg.MigrateServer == req.Name {
+			return nil, adminError(codes.FailedPrecondition, "shard %s is used by segment %d", req.Name, seg.Domain)
+		}
+	}
+
+	if err := s.mOp.RemoveShard(req.Name); err != nil {
+		return nil, storeError(err, "shard %s", req.Name)
+	}
+	if err := s.noticeShard(req.Name); err != nil {
+		return nil, err
+	}
+
+	s.auditAdmin(ctx, 0, "remove shard %s", req.Name)
+	return &admin.RemoveShardRep{}, nil
+}
+
+// ListSegments lists the segments in use.
+func (s *DFSServer) ListSegments(ctx context.Context, req *admin.ListSegmentsReq) (*admin.ListSegmentsRep, error) {
+	glog.V(3).Infof("ListSegments, client: %s, %v", getPeerAddressString(ctx), req)
+
+	rep := &admin.ListSegmentsRep{}
+	for _, seg := range s.selector.segmentsInUse() {
+		rep.Segments = append(rep.Segments, segmentToPb(seg))
+	}
+
+	return rep, nil
+}
+
+// checkSegment checks that the servers of segment exist.
+func (s *DFSServer) checkSegment(seg *admin.Segment) error {
+	if seg == nil || seg.Domain <= 0 || len(seg.NormalServer) == 0 {
+		return fmt.Errorf("invalid segment [%v]", seg)
+	}
+
+	for _, name := range []string{seg.NormalServer, seg.MigrateServer} {
+		if len(name) == 0 {
+			continue
+		}
+		if _, err := s.mOp.LookupShardByName(name); err != nil {
+			if err == mgo.ErrNotFound {
+				return adminError(codes.FailedPrecondition, "shard %s of segment %d not found", name, seg.Domain)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddSegment adds a segment, and notices all servers.
+func (s *DFSServer) AddSegment(ctx context.Context, req *admin.PutSegmentReq) (*admin.PutSegmentRep, error) {
+	glog.Infof("AddSegment, client: %s, %v", getPeerAddressString(ctx), req)
+
+	if err := s.checkSegment(req.Segment); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.mOp.LookupSegmentByDomain(req.Segment.Domain); err == nil {
+		return nil, adminError(codes.AlreadyExists, "segment %d already exists", req.Segment.Domain)
+	} else if err != mgo.ErrNotFound {
+		return nil, err
+	}
+
+	seg := &metadata.Segment{
+		Domain:        req.Segment.Domain,
+		NormalServer:  req.Segment.NormalServer,
+		MigrateServer: req.Segment.MigrateServer,
+	}
+	if err := s.mOp.SaveSegment(seg); err != nil {
+		return nil, err
+	}
+	if err := s.noticeSegment(strconv.FormatInt(seg.Domain, 10)); err != nil {
+		return nil, err
+	}
+
+	s.auditAdmin(ctx, seg.Domain, "add segment %d", seg.Domain)
+	return &admin.PutSegmentRep{
+		Segment: segmentToPb(seg),
+	}, nil
+}
+
+// UpdateSegment updates a segment, and notices all servers.
+func (s *DFSServer) UpdateSegment(ctx context.Context, req *admin.PutSegmentReq) (*admin.PutSegmentRep, error) {
+	glog.Infof("UpdateSegment, client: %s, %v", getPeerAddressString(ctx), req)
+
+	if err := s.checkSegment(req.Segment); err != nil {
+		return nil, err
+	}
+
+	seg := &metadata.Segment{
+		Domain:        req.Segment.Domain,
+		NormalServer:  req.Segment.NormalServer,
+		MigrateServer: req.Segment.MigrateServer,
+	}
+	if err := s.mOp.UpdateSegment(seg); err != nil {
+		return nil, storeError(err, "segment %d", seg.Domain)
+	}
+	if err := s.noticeSegment(strconv.FormatInt(seg.Domain, 10)); err != nil {
+		return nil, err
+	}
+
+	s.auditAdmin(ctx, seg.Domain, "update segment %d", seg.Domain)
+	return &admin.PutSegmentRep{
+		Segment: segmentToPb(seg),
+	}, nil
+}
+
+// RemoveSegment removes a segment, and notices all servers to
+// reload segments, since a removed segment can not be looked up.
+func (s *DFSServer) RemoveSegment(ctx context.Context, req *admin.RemoveSegmentReq) (*admin.RemoveSegmentRep, error) {
+	glog.Infof("RemoveSegment, client: %s, %v", getPeerAddressString(ctx), req)
+
+	if req.Domain <= 0 {
+		return nil, fmt.Errorf("invalid request [%v]", req)
+	}
+
+	if err := s.mOp.RemoveSegment(req.Domain); err != nil {
+		return nil, storeError(err, "segment %d", req.Domain)
+	}
+	if err := s.noticeSegment(allSegments); err != nil {
+		return nil, err
+	}
+
+	s.auditAdmin(ctx, req.Domain, "remove segment %d", req.Domain)
+	return &admin.RemoveSegmentRep{}, nil
+}
+
+// ListFeatureFlags lists all feature flags.
+func (s *DFSServer) ListFeatureFlags(ctx context.Context, req *admin.ListFeatureFlagsReq) (*admin.ListFeatureFlagsRep, error) {
+	glog.V(3).Infof("ListFeatureFlags, client: %s, %v", getPeerAddressString(ctx), req)
+
+	rep := &admin.ListFeatureFlagsRep{}
+	for _, f := range conf.ListFlags() {
+		rep.Flags = append(rep.Flags, featureToPb(f))
+	}
+
+	return rep, nil
+}
+
+// GetFeatureFlag gets a feature flag.
+func (s *DFSServer) GetFeatureFlag(ctx context.Context, req *admin.GetFeatureFlagReq) (*admin.FeatureFlagRep, error) {
+	glog.V(3).Infof("GetFeatureFlag, client: %s, %v", getPeerAddressString(ctx), req)
+
+	f, err := conf.GetFlag(req.Key)
+	if err != nil {
+		return nil, adminError(codes.NotFound, "feature %s not found", req.Key)
+	}
+
+	return &admin.FeatureFlagRep{
+		Flag: featureToPb(f),
+	}, nil
+}
+
+// SetFeatureFlag sets a feature flag on all servers.
+func (s *DFSServer) SetFeatureFlag(ctx context.Context, req *admin.SetFeatureFlagReq) (*admin.FeatureFlagRep, error) {
+	glog.Infof("SetFeatureFlag, client: %s, %v", getPeerAddressString(ctx), req)
+
+	if req.Flag == nil {
+		return nil, fmt.Errorf("invalid request [%v]", req)
+	}
+	if _, err := conf.GetFlag(req.Flag.Key); err != nil {
+		return nil, adminError(codes.NotFound, "feature %s not found", req.Flag.Key)
+	}
+
+	f := &conf.FeatureFlag{
+		Key:        req.Flag.Key,
+		Enabled:    req.Flag.Enabled,
+		Domains:    req.Flag.Domains,
+		Groups:     req.Flag.Groups,
+		Percentage: req.Flag.Percentage,
+	}
+	if err := conf.SetFlag(s.notice, f); err != nil {
+		return nil, adminError(codes.InvalidArgument, "failed to set feature %s, %v", f.Key, err)
+	}
+
+	s.auditAdmin(ctx, 0, "set feature %v", f)
+	return &admin.FeatureFlagRep{
+		Flag: featureToPb(f),
+	}, nil
+}
+
+// SetHandlerStatus forces the handler of a shard up or down on this
+// server. If health check is not manual, the status may be changed
+// again by the next health check.
+func (s *DFSServer) SetHandlerStatus(ctx context.Context, req *admin.SetHandlerStatusReq) (*admin.SetHandlerStatusRep, error) {
+	glog.Infof("SetHandlerStatus, client: %s, %v", getPeerAddressString(ctx), req)
+
+	sh, ok := s.selector.getShardHandler(req.Name)
+	if !ok {
+		return nil, adminError(codes.NotFound, "handler %s not found", req.Name)
+	}
+
+	status := NewHandlerStatus(req.Up)
+	s.selector.updateHandlerStatus(sh.handler, status)
+	if !*HealthCheckManually {
+		glog.Warningf("Handler %s forced %s, which may be changed by health check", req.Name, status)
+	}
+
+	shard, err := s.mOp.LookupShardByName(req.Name)
+	if err != nil {
+		shard = &metadata.Shard{
+			Name: req.Name,
+		}
+	}
+
+	s.auditAdmin(ctx, 0, "force handler %s %s", req.Name, status)
+	return &admin.SetHandlerStatusRep{
+		Status: s.selector.shardStatus(shard),
+	}, nil
+}
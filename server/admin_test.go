@@ -0,0 +1,141 @@
+package server
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/transport"
+	"gopkg.in/mgo.v2"
+
+	"jingoal.com/dfs/fileop"
+	"jingoal.com/dfs/metadata"
+	"jingoal.com/dfs/notice"
+	"jingoal.com/dfs/proto/admin"
+)
+
+type namedHandler struct {
+	fileop.DFSFileHandler
+	name string
+}
+
+func (h *namedHandler) Name() string {
+	return h.name
+}
+
+type shardMetaOp struct {
+	metadata.MetaOp
+	shards map[string]*metadata.Shard
+}
+
+func (op *shardMetaOp) LookupShardByName(name string) (*metadata.Shard, error) {
+	if s, ok := op.shards[name]; ok {
+		return s, nil
+	}
+	return nil, mgo.ErrNotFound
+}
+
+func (op *shardMetaOp) SaveShard(s *metadata.Shard) error {
+	op.shards[s.Name] = s
+	return nil
+}
+
+type recordNotice struct {
+	notice.Notice
+	data map[string]string
+}
+
+func (n *recordNotice) SetData(path string, data []byte) error {
+	n.data[path] = string(data)
+	return nil
+}
+
+func codeOf(err error) codes.Code {
+	if se, ok := err.(transport.StreamError); ok {
+		return se.Code
+	}
+	return codes.Unknown
+}
+
+func TestShardPb(t *testing.T) {
+	shard := &metadata.Shard{
+		Name:    "glustra1",
+		Uri:     "mongodb://127.0.0.1:27017",
+		ShdType: metadata.Glustra,
+		Attr:    map[string]interface{}{"keyspace": "dfs"},
+	}
+
+	s, err := shardFromPb(shardToPb(shard))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != shard.Name || s.ShdType != shard.ShdType || s.Attr["keyspace"] != "dfs" {
+		t.Errorf("expected %v, got %v", shard, s)
+	}
+
+	if _, err := shardFromPb(&admin.Shard{Name: "a", Attr: "{"}); err == nil {
+		t.Errorf("expected error of invalid attr")
+	}
+	if _, err := shardFromPb(&admin.Shard{}); err == nil {
+		t.Errorf("expected error of empty name")
+	}
+}
+
+func TestAdminShard(t *testing.T) {
+	shard1 := &ShardHandler{
+		status:  statusOk,
+		handler: &namedHandler{name: "shard1"},
+	}
+
+	n := &recordNotice{
+		data: make(map[string]string),
+	}
+	eventOp, _ := metadata.NewEventOp(testEventDb, testDbUri)
+	ctx := context.Background()
+	s := &DFSServer{
+		eventOp: eventOp,
+		mOp: &shardMetaOp{
+			shards: map[string]*metadata.Shard{
+				"shard1": {Name: "shard1", ShdType: metadata.Gridgo},
+			},
+		},
+		notice: n,
+		selector: &HandlerSelector{
+			shardHandlers: map[string]*ShardHandler{
+				"shard1": shard1,
+			},
+			segments: []*metadata.Segment{
+				{Domain: 1, NormalServer: "shard1"},
+			},
+		},
+	}
+
+	if _, err := s.AddShard(ctx, &admin.PutShardReq{Shard: &admin.Shard{Name: "shard1"}}); codeOf(err) != codes.AlreadyExists {
+		t.Errorf("expected AlreadyExists, got %v", err)
+	}
+	if _, err := s.AddShard(ctx, &admin.PutShardReq{Shard: &admin.Shard{Name: "shard2"}}); err != nil {
+		t.Errorf("add shard error %v", err)
+	}
+	if d := n.data[notice.ShardServerPath]; d != "shard2" {
+		t.Errorf("expected notice of shard2, got %s", d)
+	}
+
+	if _, err := s.RemoveShard(ctx, &admin.RemoveShardReq{Name: "shard1"}); codeOf(err) != codes.FailedPrecondition {
+		t.Errorf("expected FailedPrecondition, got %v", err)
+	}
+
+	rep, err := s.SetHandlerStatus(ctx, &admin.SetHandlerStatusReq{Name: "shard1", Up: false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rep.Status.Loaded || rep.Status.Up {
+		t.Errorf("expected shard1 loaded and down, got %v", rep.Status)
+	}
+	if status, _ := s.selector.getHandlerStatus(shard1.handler); status != statusFailure {
+		t.Errorf("expected shard1 failure, got %s", status)
+	}
+
+	if _, err := s.SetHandlerStatus(ctx, &admin.SetHandlerStatusReq{Name: "shard3"}); codeOf(err) != codes.NotFound {
+		t.Errorf("expected NotFound, got %v", err)
+	}
+}
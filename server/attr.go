@@ -0,0 +1,107 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+
+	"jingoal.com/dfs/fileop"
+	"jingoal.com/dfs/meta"
+	"jingoal.com/dfs/proto/transfer"
+)
+
+const (
+	maxAttrCount    = 32
+	maxAttrKeyLen   = 128
+	maxAttrValueLen = 255
+)
+
+// checkAttributes checks custom attributes of a file.
+// Empty value is allowed only for removing an attribute.
+func checkAttributes(attrs map[string]string, allowEmpty bool) error {
+	if len(attrs) > maxAttrCount {
+		return fmt.Errorf("too many attributes, %d > %d", len(attrs), maxAttrCount)
+	}
+
+	for k, v := range attrs {
+		if len(k) == 0 || len(k) > maxAttrKeyLen || strings.ContainsAny(k, ".$") {
+			return fmt.Errorf("invalid attribute key '%s'", k)
+		}
+		if len(v) > maxAttrValueLen || (len(v) == 0 && !allowEmpty) {
+			return fmt.Errorf("invalid attribute value of '%s'", k)
+		}
+	}
+
+	return nil
+}
+
+// UpdateAttributes updates custom attributes of a file.
+func (s *DFSServer) UpdateAttributes(ctx context.Context, req *transfer.UpdateAttributesReq) (*transfer.PutFileRep, error) {
+	serviceName := "UpdateAttributes"
+	peerAddr := getPeerAddressString(ctx)
+	glog.V(3).Infof("%s, client: %s, %v", serviceName, peerAddr, req)
+
+	if len(req.Id) == 0 || req.Domain <= 0 || len(req.Attrs) == 0 {
+		return nil, fmt.Errorf("invalid request [%v]", req)
+	}
+	if err := checkAttributes(req.Attrs, true); err != nil {
+		return nil, err
+	}
+
+	t, err := bizFunc(s.updateAttributesBiz).withDeadline(serviceName, ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	result, ok := t.(*transfer.PutFileRep)
+	if ok {
+		return result, nil
+	}
+
+	return nil, AssertionError
+}
+
+func (s *DFSServer) updateAttributesBiz(c interface{}, r interface{}, args []interface{}) (interface{}, error) {
+	req, ok := r.(*transfer.UpdateAttributesReq)
+	if !ok {
+		return nil, AssertionError
+	}
+
+	var mf msgFunc
+	mf = func() (interface{}, string) {
+		return nil, fmt.Sprintf("updateattributes, fid %s, domain %d", req.Id, req.Domain)
+	}
+
+	h, fid, _, err := s.findFileForRead(req.Id, req.Domain)
+	if err != nil {
+		return mf, err
+	}
+	if fid == "" {
+		return mf, meta.FileNotFound
+	}
+
+	if err := fileop.UpdateAttrs(h, req.Id, req.Domain, req.Attrs); err != nil {
+		return mf, err
+	}
+
+	_, _, info, err := h.Find(req.Id)
+	if err != nil {
+		return mf, err
+	}
+	if info == nil {
+		return mf, meta.FileNotFound
+	}
+	if err := checkDomain(info, req.Domain); err != nil {
+		return mf, err
+	}
+	mf = func() (interface{}, string) {
+		return &transfer.PutFileRep{
+				File: info,
+			},
+			fmt.Sprintf("updateattributes, fid %s, domain %d, %d attributes", info.Id, info.Domain, len(info.Attrs))
+	}
+
+	return mf, nil
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"jingoal.com/dfs/proto/transfer"
+)
+
+func TestCheckAttributes(t *testing.T) {
+	cases := []struct {
+		attrs      map[string]string
+		allowEmpty bool
+		ok         bool
+	}{
+		{nil, false, true},
+		{map[string]string{"content-type": "image/png"}, false, true},
+		{map[string]string{"content-type": ""}, false, false},
+		{map[string]string{"content-type": ""}, true, true},
+		{map[string]string{"": "v"}, false, false},
+		{map[string]string{"a.b": "v"}, false, false},
+		{map[string]string{"$set": "v"}, false, false},
+		{map[string]string{"k": strings.Repeat("v", maxAttrValueLen+1)}, false, false},
+	}
+
+	for i, c := range cases {
+		err := checkAttributes(c.attrs, c.allowEmpty)
+		if (err == nil) != c.ok {
+			t.Errorf("case %d, expected ok %t, got %v", i, c.ok, err)
+		}
+	}
+}
+
+func TestAttributesPerFid(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	domain := testDomain()
+
+	inf, err := putFile(s, &transfer.FileInfo{
+		Domain: domain,
+		Name:   "attr.txt",
+		Biz:    "unit-test",
+		Attrs:  map[string]string{"k": "entity"},
+	}, []byte("attributes per fid"), 1024)
+	if err != nil {
+		t.Fatalf("PutFile error %v", err)
+	}
+
+	did, err := s.duplicate(inf.Id, domain)
+	if err != nil {
+		t.Fatalf("Duplicate error %v", err)
+	}
+
+	attrsOf := func(id string) map[string]string {
+		_, _, info, err := s.findFileForRead(id, domain)
+		if err != nil || info == nil {
+			t.Fatalf("find %s error %v", id, err)
+		}
+		return info.Attrs
+	}
+
+	// A duplication copies attributes of the file duplicated.
+	if v := attrsOf(did)["k"]; v != "entity" {
+		t.Errorf("expected copied attribute, got %q", v)
+	}
+
+	if _, err := s.UpdateAttributes(ctx, &transfer.UpdateAttributesReq{
+		Id:     did,
+		Domain: domain,
+		Attrs:  map[string]string{"k": "dupl"},
+	}); err != nil {
+		t.Fatalf("UpdateAttributes error %v", err)
+	}
+
+	if v := attrsOf(did)["k"]; v != "dupl" {
+		t.Errorf("expected attribute of dupl, got %q", v)
+	}
+	if v := attrsOf(inf.Id)["k"]; v != "entity" {
+		t.Errorf("expected attribute of entity unchanged, got %q", v)
+	}
+}
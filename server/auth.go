@@ -0,0 +1,286 @@
+package server
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	grpcmd "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/transport"
+
+	"jingoal.com/dfs/auth"
+	"jingoal.com/dfs/conf"
+	"jingoal.com/dfs/metadata"
+	"jingoal.com/dfs/proto/transfer"
+	"jingoal.com/dfs/util"
+)
+
+const (
+	transferServicePrefix = "/transfer.FileTransfer/"
+	adminServicePrefix    = "/admin.Admin/"
+
+	// Key of the metadata carrying token, in the form of "Bearer token".
+	authorizationKey = "authorization"
+	bearerPrefix     = "Bearer "
+)
+
+var (
+	AuthEnabled = flag.Bool("auth-enabled", false, "true for authenticating the requests of file transfer and admin with token.")
+	authKeys    conf.SecretMap
+	authRevoked conf.StringSet
+
+	// Operations of the services which only read.
+	readServices = map[string]bool{
+		"NegotiateChunkSize": true,
+		"GetFile":            true,
+		"Exist":              true,
+		"ExistByMd5":         true,
+		"ExistBySha256":      true,
+		"Stat":               true,
+		"BatchStat":          true,
+		"BatchExist":         true,
+		"ListFiles":          true,
+		"GetUsage":           true,
+	}
+
+	// Services without domain, which need the operation only.
+	domainlessServices = map[string]bool{
+		"NegotiateChunkSize": true,
+	}
+)
+
+func init() {
+	flag.Var(&authKeys, "auth-keys", "keys for verifying tokens, in the form of 'kid=secret,kid=secret'.")
+	flag.Var(&authRevoked, "auth-revoked", "ids of revoked tokens, in the form of 'id,id'.")
+}
+
+// authError is an error of authentication or authorization.
+type authError struct {
+	code   codes.Code
+	reason string
+}
+
+func (e *authError) Error() string {
+	return e.reason
+}
+
+// serviceOp returns the operation a service of file transfer needs.
+func serviceOp(serviceName string) auth.Op {
+	if readServices[serviceName] {
+		return auth.Read
+	}
+	if serviceName == "RemoveFile" {
+		return auth.Delete
+	}
+
+	return auth.Write
+}
+
+// bearerToken returns the token carried by the metadata of ctx.
+func bearerToken(ctx context.Context) (string, bool) {
+	md, ok := grpcmd.FromContext(ctx)
+	if !ok {
+		return "", false
+	}
+
+	for _, v := range md[authorizationKey] {
+		if strings.HasPrefix(v, bearerPrefix) {
+			return strings.TrimSpace(strings.TrimPrefix(v, bearerPrefix)), true
+		}
+	}
+
+	return "", false
+}
+
+// checkRevoked returns an error if the token of claims is revoked.
+func checkRevoked(c *auth.Claims) *authError {
+	if authRevoked.Contains(c.Id) {
+		return &authError{codes.Unauthenticated, fmt.Sprintf("token %s revoked", c.Id)}
+	}
+
+	return nil
+}
+
+// checkClaims checks whether the claims grant a request of service.
+func checkClaims(c *auth.Claims, serviceName string, req interface{}) *authError {
+	if ae := checkRevoked(c); ae != nil {
+		return ae
+	}
+
+	op := serviceOp(serviceName)
+	if domainlessServices[serviceName] {
+		if !c.HasOp(op) {
+			return &authError{codes.PermissionDenied, fmt.Sprintf("%s denied", op)}
+		}
+		return nil
+	}
+
+	// A request without domain, such as PutFile of a session without
+	// info, is denied, since Allows never grants domain 0.
+	var domains []int64
+	switch r := req.(type) {
+	case *transfer.BatchStatReq:
+		for _, item := range r.Items {
+			domains = append(domains, item.Domain)
+		}
+	case *transfer.BatchExistReq:
+		for _, item := range r.Items {
+			domains = append(domains, item.Domain)
+		}
+	case *transfer.CopyReq:
+		if !c.Allows(auth.Read, r.SrcDomain) {
+			return &authError{codes.PermissionDenied, fmt.Sprintf("%s denied on domain %d", auth.Read, r.SrcDomain)}
+		}
+		domains = append(domains, r.DstDomain)
+	default:
+		domains = append(domains, requestDomain(req))
+	}
+
+	for _, d := range domains {
+		if !c.Allows(op, d) {
+			return &authError{codes.PermissionDenied, fmt.Sprintf("%s denied on domain %d", op, d)}
+		}
+	}
+
+	return nil
+}
+
+// authorize authenticates the token of a request, and checks whether
+// it grants the request. Requests of admin service need op admin.
+func authorize(ctx context.Context, method string, req interface{}) (*auth.Claims, *authError) {
+	token, ok := bearerToken(ctx)
+	if !ok {
+		return nil, &authError{codes.Unauthenticated, "token required"}
+	}
+
+	c, err := auth.Parse(token, authKeys.Get)
+	if err != nil {
+		return nil, &authError{codes.Unauthenticated, err.Error()}
+	}
+
+	if strings.HasPrefix(method, adminServicePrefix) {
+		if ae := checkRevoked(c); ae != nil {
+			return c, ae
+		}
+		if !c.HasOp(auth.Admin) {
+			return c, &authError{codes.PermissionDenied, fmt.Sprintf("%s denied", auth.Admin)}
+		}
+		return c, nil
+	}
+
+	if ae := checkClaims(c, path.Base(method), req); ae != nil {
+		return c, ae
+	}
+
+	return c, nil
+}
+
+// tokenSubject returns the subject of token in ctx, or empty if the
+// token is absent or invalid.
+func tokenSubject(ctx context.Context) string {
+	token, ok := bearerToken(ctx)
+	if !ok {
+		return ""
+	}
+	c, err := auth.Parse(token, authKeys.Get)
+	if err != nil {
+		return ""
+	}
+	return c.Subject
+}
+
+// Authorize rejects a request of file transfer or admin if its token
+// is invalid, with code Unauthenticated, or the token does not grant the
+// operation on domains of request, with code PermissionDenied. Every
+// rejection is saved as an event. It implements util.LimitFunc.
+func (s *DFSServer) Authorize(ctx context.Context, method string, req interface{}) error {
+	if !*AuthEnabled {
+		return nil
+	}
+	if !strings.HasPrefix(method, transferServicePrefix) && !strings.HasPrefix(method, adminServicePrefix) {
+		return nil
+	}
+
+	serviceName := path.Base(method)
+	c, ae := authorize(ctx, method, req)
+	if ae == nil {
+		return nil
+	}
+
+	peerAddr := getPeerAddressString(ctx)
+	subject := ""
+	if c != nil {
+		subject = c.Subject
+	}
+
+	event := &metadata.Event{
+		EType:     metadata.Unauthorized,
+		Timestamp: util.GetTimeInMilliSecond(),
+		Domain:    requestDomain(req),
+		Description: fmt.Sprintf("%s, %s, client %s, subject %s, %s",
+			metadata.Unauthorized.String(), serviceName, peerAddr, subject, ae.reason),
+	}
+	if er := s.eventOp.SaveEvent(event); er != nil {
+		glog.Warningf("%s, error: %v", event.String(), er)
+	}
+	glog.Warningf("%s unauthorized, client %s, subject %s, %s", serviceName, peerAddr, subject, ae.reason)
+
+	return transport.StreamError{
+		Code: ae.code,
+		Desc: ae.reason,
+	}
+}
+
+// rateLimitedError is a request to http gateways rate limited, to tell
+// it from the quota exceeded, both with code ResourceExhausted.
+type rateLimitedError struct {
+	error
+}
+
+// isRateLimited returns true if err is a request rate limited.
+func isRateLimited(err error) bool {
+	_, ok := err.(*rateLimitedError)
+	return ok
+}
+
+// authorizeHTTP applies the same token and rate limits of gRPC to a
+// request of http gateways, whose token is carried by header Authorization
+// in the form of "Bearer token". The request is taken as GetFile if it
+// reads, RemoveFile if it deletes, otherwise PutFile, on domain. It
+// returns ctx with the peer of request, for biz functions.
+func (s *DFSServer) authorizeHTTP(ctx context.Context, r *http.Request, domain int64) (context.Context, error) {
+	var serviceName string
+	var req interface{}
+	switch r.Method {
+	case "GET", "HEAD":
+		serviceName, req = "GetFile", &transfer.GetFileReq{Domain: domain}
+	case "DELETE":
+		serviceName, req = "RemoveFile", &transfer.RemoveFileReq{Domain: domain}
+	default:
+		serviceName, req = "PutFile", &transfer.PutFileReq{Info: &transfer.FileInfo{Domain: domain}}
+	}
+
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: addr})
+	}
+	if v := r.Header.Get("Authorization"); len(v) > 0 {
+		ctx = grpcmd.NewContext(ctx, grpcmd.Pairs(authorizationKey, v))
+	}
+
+	method := transferServicePrefix + serviceName
+	if err := s.Authorize(ctx, method, req); err != nil {
+		return ctx, err
+	}
+	if err := LimitRequest(ctx, method, req); err != nil {
+		return ctx, &rateLimitedError{err}
+	}
+
+	return ctx, nil
+}
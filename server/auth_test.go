@@ -0,0 +1,144 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/transport"
+
+	"jingoal.com/dfs/auth"
+	"jingoal.com/dfs/proto/transfer"
+)
+
+func TestServiceOp(t *testing.T) {
+	cases := map[string]auth.Op{
+		"GetFile":    auth.Read,
+		"BatchStat":  auth.Read,
+		"PutFile":    auth.Write,
+		"Copy":       auth.Write,
+		"RemoveFile": auth.Delete,
+	}
+
+	for name, op := range cases {
+		if o := serviceOp(name); o != op {
+			t.Errorf("%s, expected %s, got %s", name, op, o)
+		}
+	}
+}
+
+func TestCheckClaims(t *testing.T) {
+	c := &auth.Claims{
+		Id:      "t1",
+		Ops:     []auth.Op{auth.Read},
+		Domains: []int64{2},
+	}
+
+	cases := []struct {
+		serviceName string
+		req         interface{}
+		code        codes.Code // OK for granted.
+	}{
+		{"GetFile", &transfer.GetFileReq{Domain: 2}, codes.OK},
+		{"GetFile", &transfer.GetFileReq{Domain: 3}, codes.PermissionDenied},
+		{"RemoveFile", &transfer.RemoveFileReq{Domain: 2}, codes.PermissionDenied},
+		{"NegotiateChunkSize", &transfer.NegotiateChunkSizeReq{Size: 7}, codes.OK},
+		{"GetUsage", &transfer.GetUsageReq{}, codes.PermissionDenied},
+		{"BatchStat", &transfer.BatchStatReq{Items: []*transfer.GetFileReq{{Domain: 2}, {Domain: 3}}}, codes.PermissionDenied},
+		{"BatchExist", &transfer.BatchExistReq{Items: []*transfer.ExistReq{{Domain: 2}}}, codes.OK},
+	}
+
+	for i, cs := range cases {
+		code := codes.OK
+		if ae := checkClaims(c, cs.serviceName, cs.req); ae != nil {
+			code = ae.code
+		}
+		if code != cs.code {
+			t.Errorf("case %d, expected %v, got %v", i, cs.code, code)
+		}
+	}
+
+	// Copy needs read on source domain and write on destination domain.
+	c.Ops = []auth.Op{auth.Write}
+	if ae := checkClaims(c, "Copy", &transfer.CopyReq{SrcDomain: 2, DstDomain: 2}); ae == nil {
+		t.Errorf("expected copy denied without read")
+	}
+	c.Ops = []auth.Op{auth.Read, auth.Write}
+	if ae := checkClaims(c, "Copy", &transfer.CopyReq{SrcDomain: 2, DstDomain: 2}); ae != nil {
+		t.Errorf("expected copy granted, got %v", ae)
+	}
+
+	// PutFile of a session is granted on the domain of its info,
+	// which must be the session's.
+	if ae := checkClaims(c, "PutFile", &transfer.PutFileReq{Session: "s1"}); ae == nil {
+		t.Errorf("expected session put without info denied")
+	}
+	if ae := checkClaims(c, "PutFile", &transfer.PutFileReq{Session: "s1", Info: &transfer.FileInfo{Domain: 2}}); ae != nil {
+		t.Errorf("expected session put granted, got %v", ae)
+	}
+
+	authRevoked.Set("t1")
+	defer authRevoked.Set("")
+	if ae := checkClaims(c, "GetFile", &transfer.GetFileReq{Domain: 2}); ae == nil || ae.code != codes.Unauthenticated {
+		t.Errorf("expected revoked token unauthenticated, got %v", ae)
+	}
+}
+
+func TestAuthorizeHTTP(t *testing.T) {
+	s := newTestServer(t)
+
+	*AuthEnabled = true
+	defer func() { *AuthEnabled = false }()
+	authKeys.Set("k1=secret-1")
+	defer authKeys.Set("")
+
+	token, err := auth.Sign(&auth.Claims{
+		Id:      "t2",
+		KeyId:   "k1",
+		Ops:     []auth.Op{auth.Read},
+		Domains: []int64{2},
+	}, []byte("secret-1"))
+	if err != nil {
+		t.Fatalf("Sign error %v", err)
+	}
+
+	cases := []struct {
+		method string
+		domain int64
+		token  string
+		code   codes.Code // OK for granted.
+	}{
+		{"GET", 2, token, codes.OK},
+		{"HEAD", 2, token, codes.OK},
+		{"GET", 3, token, codes.PermissionDenied},
+		{"PUT", 2, token, codes.PermissionDenied},
+		{"DELETE", 2, token, codes.PermissionDenied},
+		{"GET", 2, "", codes.Unauthenticated},
+		{"GET", 2, "bad", codes.Unauthenticated},
+	}
+
+	for i, cs := range cases {
+		r := httptest.NewRequest(cs.method, "/2/59828e534ec50300d2891b33", nil)
+		if len(cs.token) > 0 {
+			r.Header.Set("Authorization", bearerPrefix+cs.token)
+		}
+
+		code := codes.OK
+		ctx, err := s.authorizeHTTP(context.Background(), r, cs.domain)
+		if err != nil {
+			se, ok := err.(transport.StreamError)
+			if !ok {
+				t.Errorf("case %d, unexpected error %v", i, err)
+				continue
+			}
+			code = se.Code
+		}
+		if code != cs.code {
+			t.Errorf("case %d, expected %v, got %v", i, cs.code, code)
+		}
+		if getPeerAddressString(ctx) != r.RemoteAddr {
+			t.Errorf("case %d, expected peer %s, got %s", i, r.RemoteAddr, getPeerAddressString(ctx))
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"flag"
+	"fmt"
+	"sync"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+
+	"jingoal.com/dfs/fileop"
+	"jingoal.com/dfs/meta"
+	"jingoal.com/dfs/metadata"
+	"jingoal.com/dfs/proto/transfer"
+)
+
+var (
+	batchMaxItems    = flag.Int("batch-max-items", 1000, "max number of items in a batch request.")
+	batchConcurrency = flag.Int("batch-concurrency", 16, "number of routines to process a batch request.")
+)
+
+// fileKey represents a file in batch.
+type fileKey struct {
+	id     string
+	domain int64
+}
+
+// BatchStat gets file info of many files.
+func (s *DFSServer) BatchStat(ctx context.Context, req *transfer.BatchStatReq) (*transfer.BatchStatRep, error) {
+	serviceName := "BatchStat"
+	peerAddr := getPeerAddressString(ctx)
+	glog.V(3).Infof("%s, client: %s, %d items", serviceName, peerAddr, len(req.Items))
+
+	if len(req.Items) == 0 || len(req.Items) > *batchMaxItems {
+		return nil, fmt.Errorf("invalid request, %d items", len(req.Items))
+	}
+
+	t, err := bizFunc(s.batchStatBiz).withDeadline(serviceName, ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	result, ok := t.(*transfer.BatchStatRep)
+	if ok {
+		return result, nil
+	}
+
+	return nil, AssertionError
+}
+
+func (s *DFSServer) batchStatBiz(c interface{}, r interface{}, args []interface{}) (interface{}, error) {
+	req, ok := r.(*transfer.BatchStatReq)
+	if !ok {
+		return nil, AssertionError
+	}
+
+	keys := make([]fileKey, len(req.Items))
+	for i, item := range req.Items {
+		keys[i] = fileKey{item.Id, item.Domain}
+	}
+
+	items := make([]*transfer.StatItem, len(keys))
+	s.batchFind(keys, func(i int, fid string, info *transfer.FileInfo, err error) {
+		item := &transfer.StatItem{
+			Id:     keys[i].id,
+			Domain: keys[i].domain,
+		}
+		if err == nil && info == nil {
+			err = meta.FileNotFound
+		}
+		if err != nil {
+			item.Error = err.Error()
+		} else {
+			item.File = info
+		}
+		items[i] = item
+	})
+
+	var mf msgFunc
+	mf = func() (interface{}, string) {
+		return &transfer.BatchStatRep{
+				Items: items,
+			},
+			fmt.Sprintf("batchstat, %d items", len(items))
+	}
+
+	return mf, nil
+}
+
+// BatchExist checks existentiality of many files.
+func (s *DFSServer) BatchExist(ctx context.Context, req *transfer.BatchExistReq) (*transfer.BatchExistRep, error) {
+	serviceName := "BatchExist"
+	peerAddr := getPeerAddressString(ctx)
+	glog.V(3).Infof("%s, client: %s, %d items", serviceName, peerAddr, len(req.Items))
+
+	if len(req.Items) == 0 || len(req.Items) > *batchMaxItems {
+		return nil, fmt.Errorf("invalid request, %d items", len(req.Items))
+	}
+
+	t, err := bizFunc(s.batchExistBiz).withDeadline(serviceName, ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	result, ok := t.(*transfer.BatchExistRep)
+	if ok {
+		return result, nil
+	}
+
+	return nil, AssertionError
+}
+
+func (s *DFSServer) batchExistBiz(c interface{}, r interface{}, args []interface{}) (interface{}, error) {
+	req, ok := r.(*transfer.BatchExistReq)
+	if !ok {
+		return nil, AssertionError
+	}
+
+	keys := make([]fileKey, len(req.Items))
+	for i, item := range req.Items {
+		keys[i] = fileKey{item.Id, item.Domain}
+	}
+
+	items := make([]*transfer.ExistItem, len(keys))
+	s.batchFind(keys, func(i int, fid string, info *transfer.FileInfo, err error) {
+		item := &transfer.ExistItem{
+			Id:     keys[i].id,
+			Domain: keys[i].domain,
+		}
+		switch {
+		case err == meta.FileNotFound:
+		case err != nil:
+			item.Error = err.Error()
+		default:
+			item.Result = fid != ""
+		}
+		items[i] = item
+	})
+
+	var mf msgFunc
+	mf = func() (interface{}, string) {
+		return &transfer.BatchExistRep{
+				Items: items,
+			},
+			fmt.Sprintf("batchexist, %d items", len(items))
+	}
+
+	return mf, nil
+}
+
+// batchFind finds files concurrently, and calls found with the index
+// of each key. Keys are grouped by segment, so the handlers are
+// selected only once for every segment.
+func (s *DFSServer) batchFind(keys []fileKey, found func(int, string, *transfer.FileInfo, error)) {
+	trashed, terr := s.trashedFiles(keys)
+
+	groups := make(map[*metadata.Segment][]int)
+	for i, k := range keys {
+		if len(k.id) == 0 || k.domain <= 0 {
+			found(i, "", nil, fmt.Errorf("invalid item [%s, %d]", k.id, k.domain))
+			continue
+		}
+		if terr != nil {
+			found(i, "", nil, terr)
+			continue
+		}
+		if trashed[k.id] {
+			found(i, "", nil, meta.FileNotFound)
+			continue
+		}
+
+		seg := s.selector.FindPerfectSegment(k.domain)
+		groups[seg] = append(groups[seg], i)
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, *batchConcurrency)
+
+	for _, indexes := range groups {
+		var n, m fileop.DFSFileHandler
+		nh, mh, err := s.selector.getDFSFileHandlerForRead(keys[indexes[0]].domain)
+		if err == nil {
+			if nh != nil {
+				n = *nh
+			}
+			if mh != nil {
+				m = *mh
+			}
+		}
+
+		for _, i := range indexes {
+			if err != nil {
+				found(i, "", nil, err)
+				continue
+			}
+
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int) {
+				defer func() {
+					if r := recover(); r != nil {
+						glog.Warningf("%v\n%s", r, getStack())
+						found(i, "", nil, fmt.Errorf("%v", r))
+					}
+					<-sem
+					wg.Done()
+				}()
+
+				_, fid, info, err := findFile(keys[i].id, n, m)
+				if err == nil && info != nil {
+					if err = checkDomain(info, keys[i].domain); err != nil {
+						fid, info = "", nil
+					}
+				}
+				found(i, fid, info, err)
+			}(i)
+		}
+	}
+
+	wg.Wait()
+}
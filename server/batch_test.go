@@ -0,0 +1,84 @@
+package server
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2/bson"
+
+	"jingoal.com/dfs/proto/transfer"
+)
+
+func TestBatchStatAndExist(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+
+	// Domains of a batch are served by different shards.
+	domain1 := testDomain()
+	domain2 := domain1 + 1000
+	addTestShard(t, s, testShardName+"-2", domain2)
+
+	inf1, err := putFile(s, &transfer.FileInfo{Domain: domain1, Name: "a.txt", Biz: "unit-test"}, []byte("batch one"), 1024)
+	if err != nil {
+		t.Fatalf("PutFile error %v", err)
+	}
+	inf2, err := putFile(s, &transfer.FileInfo{Domain: domain2, Name: "b.txt", Biz: "unit-test"}, []byte("batch two"), 1024)
+	if err != nil {
+		t.Fatalf("PutFile error %v", err)
+	}
+
+	items := []*transfer.GetFileReq{
+		{Id: inf1.Id, Domain: domain1},
+		{Id: inf2.Id, Domain: domain2},
+		{Id: bson.NewObjectId().Hex(), Domain: domain1},
+		{Id: "", Domain: domain1},
+		{Id: inf1.Id, Domain: 0},
+	}
+
+	srep, err := s.BatchStat(ctx, &transfer.BatchStatReq{Items: items})
+	if err != nil {
+		t.Fatalf("BatchStat error %v", err)
+	}
+	if len(srep.Items) != len(items) {
+		t.Fatalf("expected %d items, got %d", len(items), len(srep.Items))
+	}
+	for i, item := range srep.Items {
+		if item.Id != items[i].Id || item.Domain != items[i].Domain {
+			t.Errorf("item %d out of order, %v", i, item)
+		}
+	}
+	if f := srep.Items[0].File; f == nil || f.Name != "a.txt" || f.Size != 9 {
+		t.Errorf("unexpected item 0, %v", srep.Items[0])
+	}
+	if f := srep.Items[1].File; f == nil || f.Name != "b.txt" || f.Domain != domain2 {
+		t.Errorf("unexpected item 1, %v", srep.Items[1])
+	}
+	for i := 2; i < len(items); i++ {
+		if srep.Items[i].File != nil || srep.Items[i].Error == "" {
+			t.Errorf("expected error of item %d, got %v", i, srep.Items[i])
+		}
+	}
+
+	erep, err := s.BatchExist(ctx, &transfer.BatchExistReq{Items: items})
+	if err != nil {
+		t.Fatalf("BatchExist error %v", err)
+	}
+	if len(erep.Items) != len(items) {
+		t.Fatalf("expected %d items, got %d", len(items), len(erep.Items))
+	}
+	if !erep.Items[0].Result || !erep.Items[1].Result {
+		t.Errorf("expected files exist, got %v, %v", erep.Items[0], erep.Items[1])
+	}
+	if erep.Items[2].Result || erep.Items[2].Error != "" {
+		t.Errorf("expected file not exist without error, got %v", erep.Items[2])
+	}
+	for i := 3; i < len(items); i++ {
+		if erep.Items[i].Result || erep.Items[i].Error == "" {
+			t.Errorf("expected error of item %d, got %v", i, erep.Items[i])
+		}
+	}
+
+	if _, err := s.BatchStat(ctx, &transfer.BatchStatReq{}); err == nil {
+		t.Errorf("expected error of empty batch")
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"github.com/golang/glog"
 	"golang.org/x/net/context"
 
-	"jingoal.com/dfs/fileop"
 	"jingoal.com/dfs/proto/transfer"
 )
 
@@ -40,9 +39,10 @@ func (s *DFSServer) NegotiateChunkSize(ctx context.Context, req *transfer.Negoti
 
 func (s *DFSServer) negotiateBiz(ctx interface{}, req interface{}, args []interface{}) (interface{}, error) {
 	if r, ok := req.(*transfer.NegotiateChunkSizeReq); ok {
-		fileop.NegotiatedChunkSize = sanitizeChunkSize(r.Size)
+		// The negotiated size is stateless, client should carry it
+		// in the following GetFile or PutFile request.
 		rep := &transfer.NegotiateChunkSizeRep{
-			Size: fileop.NegotiatedChunkSize,
+			Size: sanitizeChunkSize(r.Size),
 		}
 
 		var mf msgFunc
@@ -56,6 +56,26 @@ func (s *DFSServer) negotiateBiz(ctx interface{}, req interface{}, args []interf
 	return nil, AssertionError
 }
 
+// requestChunkSize returns the chunk size given by client to store
+// a file, or 0 if not given, which leaves it to the handler's default.
+func requestChunkSize(size int64) int64 {
+	if size <= 0 {
+		return 0
+	}
+
+	return sanitizeChunkSize(size)
+}
+
+// transferChunkSize returns the chunk size given by client to
+// transfer content, or the default one if not given.
+func transferChunkSize(size int64) int64 {
+	if size <= 0 {
+		return sanitizeChunkSize(*DefaultChunkSizeInBytes)
+	}
+
+	return sanitizeChunkSize(size)
+}
+
 func sanitizeChunkSize(size int64) int64 {
 	if size < MinChunkSize {
 		return MinChunkSize
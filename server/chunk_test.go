@@ -0,0 +1,28 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestRequestChunkSize(t *testing.T) {
+	cases := []struct {
+		size     int64
+		request  int64
+		transfer int64
+	}{
+		{0, 0, *DefaultChunkSizeInBytes},
+		{-1, 0, *DefaultChunkSizeInBytes},
+		{10, MinChunkSize, MinChunkSize},
+		{4096, 4096, 4096},
+		{MaxChunkSize * 2, MaxChunkSize, MaxChunkSize},
+	}
+
+	for _, c := range cases {
+		if r := requestChunkSize(c.size); r != c.request {
+			t.Errorf("requestChunkSize(%d), expected %d, got %d", c.size, c.request, r)
+		}
+		if r := transferChunkSize(c.size); r != c.transfer {
+			t.Errorf("transferChunkSize(%d), expected %d, got %d", c.size, c.transfer, r)
+		}
+	}
+}
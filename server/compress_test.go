@@ -0,0 +1,147 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"jingoal.com/dfs/conf"
+	"jingoal.com/dfs/proto/transfer"
+)
+
+// enableCompress enables compression for domain, returns a function
+// to restore the flag.
+func enableCompress(t *testing.T, domain int64) func() {
+	old, err := conf.GetFlag(conf.FlagKeyCompress)
+	if err != nil {
+		t.Fatalf("GetFlag error %v", err)
+	}
+
+	if err := conf.UpdateFlag(&conf.FeatureFlag{
+		Key:     conf.FlagKeyCompress,
+		Domains: []uint32{uint32(domain)},
+		Groups:  []string{},
+	}); err != nil {
+		t.Fatalf("UpdateFlag error %v", err)
+	}
+
+	return func() {
+		conf.UpdateFlag(old)
+	}
+}
+
+// storedEntity returns the codec and the number of bytes stored
+// of a file in the test shard.
+func storedEntity(t *testing.T, id string) (string, int) {
+	session, err := mgo.Dial(testDbUri)
+	if err != nil {
+		t.Fatalf("Dial error %v", err)
+	}
+	defer session.Close()
+
+	fs := session.DB(testShardName).GridFS("fs")
+	var doc struct {
+		Codec string "codec"
+	}
+	if err := fs.Files.FindId(bson.ObjectIdHex(id)).One(&doc); err != nil {
+		t.Fatalf("find file %s error %v", id, err)
+	}
+
+	stored := 0
+	var chunk struct {
+		Data []byte "data"
+	}
+	iter := fs.Chunks.Find(bson.M{"files_id": bson.ObjectIdHex(id)}).Iter()
+	for iter.Next(&chunk) {
+		stored += len(chunk.Data)
+	}
+	if err := iter.Close(); err != nil {
+		t.Fatalf("find chunks of %s error %v", id, err)
+	}
+
+	return doc.Codec, stored
+}
+
+func TestCompressedFile(t *testing.T) {
+	s := newTestServer(t)
+	domain := testDomain()
+	defer enableCompress(t, domain)()
+
+	content := bytes.Repeat([]byte("compressible content "), 20000)
+	inf, err := putFile(s, &transfer.FileInfo{Domain: domain, Name: "compressed.txt", Biz: "unit-test"}, content, 64*1024)
+	if err != nil {
+		t.Fatalf("PutFile error %v", err)
+	}
+
+	codec, stored := storedEntity(t, inf.Id)
+	if codec != "gzip" || stored >= len(content) {
+		t.Errorf("expected entity compressed, codec %q, %d bytes stored", codec, stored)
+	}
+
+	rep, err := s.Stat(context.Background(), &transfer.GetFileReq{Id: inf.Id, Domain: domain})
+	if err != nil {
+		t.Fatalf("Stat error %v", err)
+	}
+	if rep.File.Size != int64(len(content)) || rep.File.Md5 != inf.Md5 {
+		t.Errorf("expected size and md5 of content, got %d %s", rep.File.Size, rep.File.Md5)
+	}
+
+	_, got, err := getFile(s, &transfer.GetFileReq{Id: inf.Id, Domain: domain})
+	if err != nil {
+		t.Fatalf("GetFile error %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("expected content decompressed, got %d bytes", len(got))
+	}
+
+	// Seek on compressed content.
+	for _, off := range []int64{1, 255 * 1024, int64(len(content)) - 1} {
+		_, got, err := getFile(s, &transfer.GetFileReq{Id: inf.Id, Domain: domain, Offset: off, Length: 100})
+		if err != nil {
+			t.Fatalf("GetFile from %d error %v", off, err)
+		}
+		end := off + 100
+		if end > int64(len(content)) {
+			end = int64(len(content))
+		}
+		if !bytes.Equal(got, content[off:end]) {
+			t.Errorf("expected content from %d, got %q", off, got)
+		}
+	}
+}
+
+func TestUncompressedFileWithCompression(t *testing.T) {
+	s := newTestServer(t)
+	domain := testDomain()
+
+	// A file stored before compression enabled.
+	content := bytes.Repeat([]byte("legacy content "), 1000)
+	inf, err := putFile(s, &transfer.FileInfo{Domain: domain, Name: "legacy.txt", Biz: "unit-test"}, content, 1024)
+	if err != nil {
+		t.Fatalf("PutFile error %v", err)
+	}
+	if codec, stored := storedEntity(t, inf.Id); codec != "" || stored != len(content) {
+		t.Errorf("expected entity raw, codec %q, %d bytes stored", codec, stored)
+	}
+
+	defer enableCompress(t, domain)()
+
+	_, got, err := getFile(s, &transfer.GetFileReq{Id: inf.Id, Domain: domain})
+	if err != nil {
+		t.Fatalf("GetFile error %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("expected content of uncompressed file, got %d bytes", len(got))
+	}
+
+	_, got, err = getFile(s, &transfer.GetFileReq{Id: inf.Id, Domain: domain, Offset: 15, Length: 15})
+	if err != nil {
+		t.Fatalf("GetFile error %v", err)
+	}
+	if !bytes.Equal(got, content[15:30]) {
+		t.Errorf("expected content from 15, got %q", got)
+	}
+}
@@ -79,6 +79,10 @@ func (s *DFSServer) copyBiz(c interface{}, r interface{}, args []interface{}) (i
 	}
 	defer rf.Close()
 
+	if err := s.checkQuota(req.DstDomain, rf.GetFileInfo().Size); err != nil {
+		return mf, err
+	}
+
 	// open destination file.
 	handler, err := s.selector.getDFSFileHandlerForWrite(req.DstDomain)
 	if err != nil {
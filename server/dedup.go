@@ -0,0 +1,117 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+
+	"jingoal.com/dfs/fileop"
+	"jingoal.com/dfs/metadata"
+	"jingoal.com/dfs/proto/transfer"
+	"jingoal.com/dfs/util"
+)
+
+// dedupPutFile looks for an entity identical to a file just received.
+// If found, a duplication of that entity is created and the file is
+// dropped, so no new content is stored. It returns the info of the
+// duplication, and false if no identical entity exists.
+// Entities are matched by md5 and size, and the sha256 of an entity
+// must be the same if it was recorded. A duplication shares expiry
+// with its entity, so only an entity expiring at the same time matches.
+func (s *DFSServer) dedupPutFile(file fileop.DFSFile, handler *fileop.DFSFileHandler, md5 string, sha256 string, startTime time.Time, serviceName string, peerAddr string) (*transfer.FileInfo, bool) {
+	inf := file.GetFileInfo()
+
+	p, oid, err := s.findByMd5(md5, inf.Domain, inf.Size)
+	if err != nil || oid == "" || oid == inf.Id {
+		return nil, false
+	}
+
+	// Some handlers ignore size on finding by md5.
+	_, _, found, err := p.Find(oid)
+	if err != nil || found == nil || found.Size != inf.Size {
+		return nil, false
+	}
+	if len(found.Sha256) > 0 && found.Sha256 != sha256 {
+		glog.Warningf("Dedup skipped, %s has the same md5 %s but sha256 %s, not %s", oid, md5, found.Sha256, sha256)
+		return nil, false
+	}
+	if found.ExpireTime != inf.ExpireTime {
+		glog.V(3).Infof("Dedup skipped, %s expires at %d, not %d", oid, found.ExpireTime, inf.ExpireTime)
+		return nil, false
+	}
+
+	did, err := p.Duplicate(oid, inf.Domain)
+	if err != nil {
+		glog.Warningf("Failed to duplicate %s for dedup, %v", oid, err)
+		return nil, false
+	}
+
+	// Attributes of the duplication are the ones put.
+	if update := attrsUpdate(found.Attrs, inf.Attrs); len(update) > 0 {
+		if err := fileop.UpdateAttrs(p, did, inf.Domain, update); err != nil {
+			glog.Warningf("Failed to update attributes of %s for dedup, %v", did, err)
+		}
+	}
+
+	_, _, result, err := p.Find(did)
+	if err != nil || result == nil {
+		glog.Warningf("Failed to find %s for dedup, %v", did, err)
+		if _, _, er := p.Remove(did, inf.Domain); er != nil {
+			glog.Warningf("remove error: %v, fid %s, client %s", er, did, peerAddr)
+		}
+		return nil, false
+	}
+	result.Domain = inf.Domain
+
+	if err := file.Close(); err != nil {
+		glog.Warningf("close error: %v, fid %s, client %s", err, inf.Id, peerAddr)
+	}
+	if _, _, err := (*handler).Remove(inf.Id, inf.Domain); err != nil {
+		glog.Warningf("remove error: %v, fid %s, client %s", err, inf.Id, peerAddr)
+	}
+
+	nsecs := time.Since(startTime).Nanoseconds() + 1
+	event := &metadata.Event{
+		EType:     metadata.SucDedup,
+		Timestamp: util.GetTimeInMilliSecond(),
+		Domain:    inf.Domain,
+		Fid:       oid,
+		Elapse:    nsecs,
+		Description: fmt.Sprintf("%s, client %s, did %s, dropped %s, size %d",
+			metadata.SucDedup.String(), peerAddr, did, inf.Id, inf.Size),
+	}
+	if er := s.eventOp.SaveEvent(event); er != nil {
+		// log into file instead return.
+		glog.Warningf("%s, error: %v", event.String(), er)
+	}
+
+	s.saveCreateEvent(result, p.Name(), nsecs, serviceName, peerAddr)
+
+	// Space is accounted to the user who put the file.
+	slogInf := *result
+	slogInf.User = inf.User
+	s.saveCreateSpaceLog(&slogInf)
+
+	instrumentPutFile(result.Size, result.Size*8*1e6/nsecs, serviceName, result.Biz)
+
+	return result, true
+}
+
+// attrsUpdate returns the update of attributes, which turns the
+// attributes from into to. A removed attribute has an empty value.
+func attrsUpdate(from map[string]string, to map[string]string) map[string]string {
+	update := make(map[string]string, len(to))
+	for k := range from {
+		if _, ok := to[k]; !ok {
+			update[k] = ""
+		}
+	}
+	for k, v := range to {
+		if from[k] != v {
+			update[k] = v
+		}
+	}
+
+	return update
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"jingoal.com/dfs/conf"
+	"jingoal.com/dfs/proto/transfer"
+	"jingoal.com/dfs/util"
+)
+
+func TestAttrsUpdate(t *testing.T) {
+	cases := []struct {
+		from   map[string]string
+		to     map[string]string
+		update map[string]string
+	}{
+		{nil, nil, map[string]string{}},
+		{map[string]string{"a": "1"}, map[string]string{"a": "1"}, map[string]string{}},
+		{map[string]string{"a": "1"}, nil, map[string]string{"a": ""}},
+		{nil, map[string]string{"a": "1"}, map[string]string{"a": "1"}},
+		{map[string]string{"a": "1", "b": "2"}, map[string]string{"b": "3", "c": "4"}, map[string]string{"a": "", "b": "3", "c": "4"}},
+	}
+
+	for i, c := range cases {
+		if update := attrsUpdate(c.from, c.to); !reflect.DeepEqual(update, c.update) {
+			t.Errorf("case %d, expected %v, got %v", i, c.update, update)
+		}
+	}
+}
+
+// enableDedup enables deduplication for domain, returns a function
+// to restore the flag.
+func enableDedup(t *testing.T, domain int64) func() {
+	old, err := conf.GetFlag(conf.FlagKeyDedup)
+	if err != nil {
+		t.Fatalf("GetFlag error %v", err)
+	}
+
+	if err := conf.UpdateFlag(&conf.FeatureFlag{
+		Key:     conf.FlagKeyDedup,
+		Domains: []uint32{uint32(domain)},
+		Groups:  []string{},
+	}); err != nil {
+		t.Fatalf("UpdateFlag error %v", err)
+	}
+
+	return func() {
+		conf.UpdateFlag(old)
+	}
+}
+
+func TestDedupPutFile(t *testing.T) {
+	s := newTestServer(t)
+	domain := testDomain()
+	defer enableDedup(t, domain)()
+
+	content := []byte("content to be deduplicated")
+	first, err := putFile(s, &transfer.FileInfo{
+		Domain: domain,
+		Name:   "first.txt",
+		Biz:    "unit-test",
+		Attrs:  map[string]string{"k": "first"},
+	}, content, 8)
+	if err != nil {
+		t.Fatalf("PutFile error %v", err)
+	}
+	if util.IsDuplId(first.Id) {
+		t.Fatalf("expected an entity, got %s", first.Id)
+	}
+
+	second, err := putFile(s, &transfer.FileInfo{
+		Domain: domain,
+		Name:   "second.txt",
+		Biz:    "unit-test",
+		Attrs:  map[string]string{"other": "second"},
+	}, content, 8)
+	if err != nil {
+		t.Fatalf("PutFile error %v", err)
+	}
+
+	// The reply is the info stored for the duplication.
+	if !util.IsDuplId(second.Id) {
+		t.Fatalf("expected a duplication, got %s", second.Id)
+	}
+	if second.Name != first.Name || second.Md5 != first.Md5 || second.Sha256 != first.Sha256 || second.Size != first.Size {
+		t.Errorf("expected info of %v, got %v", first, second)
+	}
+	if !reflect.DeepEqual(second.Attrs, map[string]string{"other": "second"}) {
+		t.Errorf("expected attributes put, got %v", second.Attrs)
+	}
+
+	info, got, err := getFile(s, &transfer.GetFileReq{Id: second.Id, Domain: domain})
+	if err != nil {
+		t.Fatalf("GetFile error %v", err)
+	}
+	if info == nil || string(got) != string(content) {
+		t.Errorf("expected content of duplication, got %q", got)
+	}
+
+	// The same size but different content is not deduplicated.
+	other := []byte("content to be deduplicatee")
+	third, err := putFile(s, &transfer.FileInfo{Domain: domain, Name: "third.txt", Biz: "unit-test"}, other, 8)
+	if err != nil {
+		t.Fatalf("PutFile error %v", err)
+	}
+	if util.IsDuplId(third.Id) {
+		t.Errorf("expected an entity, got %s", third.Id)
+	}
+
+	// A duplication expires with its entity, so content expiring at
+	// another time is not deduplicated.
+	expireTime := time.Now().Add(time.Hour).UnixNano() / 1e6
+	fourth, err := putFile(s, &transfer.FileInfo{Domain: domain, Name: "fourth.txt", Biz: "unit-test", ExpireTime: expireTime}, content, 8)
+	if err != nil {
+		t.Fatalf("PutFile error %v", err)
+	}
+	if util.IsDuplId(fourth.Id) {
+		t.Errorf("expected an entity, got %s", fourth.Id)
+	}
+	fifth, err := putFile(s, &transfer.FileInfo{Domain: domain, Name: "fifth.txt", Biz: "unit-test", ExpireTime: expireTime}, content, 8)
+	if err != nil {
+		t.Fatalf("PutFile error %v", err)
+	}
+	if !util.IsDuplId(fifth.Id) {
+		t.Fatalf("expected a duplication, got %s", fifth.Id)
+	}
+
+	// Stat replies the same expiry as put.
+	rep, err := s.Stat(context.Background(), &transfer.GetFileReq{Id: fifth.Id, Domain: domain})
+	if err != nil {
+		t.Fatalf("Stat error %v", err)
+	}
+	if fifth.ExpireTime != expireTime || rep.File.ExpireTime != fifth.ExpireTime {
+		t.Errorf("expected expire time %d, put %d, stat %d", expireTime, fifth.ExpireTime, rep.File.ExpireTime)
+	}
+}
@@ -55,10 +55,16 @@ type DFSServer struct {
 	spaceOp  *metadata.SpaceLogOp
 	eventOp  *metadata.EventOp
 	cacheOp  *metadata.CacheLogOp
+	uploadOp *metadata.UploadSessionOp
+	trashOp  *metadata.TrashOp
+	expireOp *metadata.ExpireOp
+	objectOp *metadata.ObjectOp
+	partOp   *metadata.MultipartOp
 	reOp     *recovery.RecoveryEventOp
 	register disc.Register
 	notice   notice.Notice
 	selector *HandlerSelector
+	draining int32 // 1 for draining, accessed atomically.
 }
 
 // Unregister closes connection of registered client
@@ -95,6 +101,21 @@ func (s *DFSServer) Close() {
 	if s.cacheOp != nil {
 		s.cacheOp.Close()
 	}
+	if s.uploadOp != nil {
+		s.uploadOp.Close()
+	}
+	if s.trashOp != nil {
+		s.trashOp.Close()
+	}
+	if s.expireOp != nil {
+		s.expireOp.Close()
+	}
+	if s.objectOp != nil {
+		s.objectOp.Close()
+	}
+	if s.partOp != nil {
+		s.partOp.Close()
+	}
 	if s.notice != nil {
 		s.notice.CloseZk()
 	}
@@ -179,6 +200,39 @@ func NewDFSServer(lsnAddr net.Addr, name string, dbAddr *DBAddr, zk *notice.DfsZ
 	}
 	server.cacheOp = cacheOp
 
+	uploadOp, err := metadata.NewUploadSessionOp(dbAddr.EventDbName, dbAddr.EventDbUri)
+	if err != nil {
+		return nil, fmt.Errorf("%v, %s %s", err, dbAddr.EventDbName, dbAddr.EventDbUri)
+	}
+	if err := uploadOp.EnsurePieceIndex(); err != nil {
+		glog.Warningf("Failed to ensure index of upload piece, %v.", err)
+	}
+	server.uploadOp = uploadOp
+
+	trashOp, err := metadata.NewTrashOp(dbAddr.EventDbName, dbAddr.EventDbUri)
+	if err != nil {
+		return nil, fmt.Errorf("%v, %s %s", err, dbAddr.EventDbName, dbAddr.EventDbUri)
+	}
+	server.trashOp = trashOp
+
+	expireOp, err := metadata.NewExpireOp(dbAddr.EventDbName, dbAddr.EventDbUri)
+	if err != nil {
+		return nil, fmt.Errorf("%v, %s %s", err, dbAddr.EventDbName, dbAddr.EventDbUri)
+	}
+	server.expireOp = expireOp
+
+	objectOp, err := metadata.NewObjectOp(dbAddr.EventDbName, dbAddr.EventDbUri)
+	if err != nil {
+		return nil, fmt.Errorf("%v, %s %s", err, dbAddr.EventDbName, dbAddr.EventDbUri)
+	}
+	server.objectOp = objectOp
+
+	partOp, err := metadata.NewMultipartOp(dbAddr.EventDbName, dbAddr.EventDbUri)
+	if err != nil {
+		return nil, fmt.Errorf("%v, %s %s", err, dbAddr.EventDbName, dbAddr.EventDbUri)
+	}
+	server.partOp = partOp
+
 	// Create NewMongoMetaOp
 	mop, err := metadata.NewMongoMetaOp(dbAddr.ShardDbName, dbAddr.ShardDbUri)
 	if err != nil {
@@ -193,8 +247,15 @@ func NewDFSServer(lsnAddr net.Addr, name string, dbAddr *DBAddr, zk *notice.DfsZ
 	server.reOp = reop
 
 	server.selector, err = NewHandlerSelector(server)
+	if err != nil {
+		return nil, err
+	}
 	glog.Infof("Succeeded to initialize storage servers.")
 
+	if *rebuildUsage {
+		server.rebuildUsages()
+	}
+
 	// Register self.
 	regAddr := *RegisterAddr
 	if regAddr == "" {
@@ -213,6 +274,9 @@ func NewDFSServer(lsnAddr net.Addr, name string, dbAddr *DBAddr, zk *notice.DfsZ
 
 	server.selector.startRecoveryDispatchRoutine()
 	server.selector.startShardNoticeRoutine()
+	server.selector.startUploadSessionCleanRoutine()
+	server.selector.startTrashPurgeRoutine()
+	server.selector.startExpireRoutine()
 	startRateCheckRoutine()
 
 	glog.Infof("Succeeded to start DFS server '%s'.", name)
@@ -267,9 +331,14 @@ func sanitizeLsnAddr(lsnAddr string) (string, error) {
 	return fmt.Sprintf("%s:%s", registerIp, lstPort), nil
 }
 
+// getPeerAddressString returns the address of peer, in the form of
+// "identity@address" if the peer is verified by mutual TLS.
 func getPeerAddressString(ctx context.Context) (peerAddr string) {
 	if per, ok := peer.FromContext(ctx); ok {
 		peerAddr = per.Addr.String()
+		if id := peerIdentity(per); len(id) > 0 {
+			peerAddr = id + "@" + peerAddr
+		}
 	}
 
 	return
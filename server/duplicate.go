@@ -7,6 +7,7 @@ import (
 	"github.com/golang/glog"
 	"golang.org/x/net/context"
 
+	"jingoal.com/dfs/meta"
 	"jingoal.com/dfs/metadata"
 	"jingoal.com/dfs/proto/transfer"
 	"jingoal.com/dfs/util"
@@ -95,11 +96,20 @@ func (s *DFSServer) duplicateBiz(c interface{}, r interface{}, args []interface{
 	return mf, nil
 }
 
+// duplicate duplicates a file, and charges the duplication as the
+// content, the same as GetByMd5.
 func (s *DFSServer) duplicate(oid string, domain int64) (string, error) {
-	h, _, _, err := s.findFileForRead(oid, domain)
+	h, _, info, err := s.findFileForRead(oid, domain)
 	if err != nil {
 		return "", err
 	}
+	if info == nil {
+		return "", meta.FileNotFound
+	}
+
+	if err := s.checkQuota(domain, info.Size); err != nil {
+		return "", err
+	}
 
 	// duplicate file from proper handler.
 	did, err := h.Duplicate(oid, domain)
@@ -107,5 +117,13 @@ func (s *DFSServer) duplicate(oid string, domain int64) (string, error) {
 		return "", err
 	}
 
+	s.saveCreateSpaceLog(&transfer.FileInfo{
+		Id:     did,
+		Domain: domain,
+		User:   info.User,
+		Biz:    info.Biz,
+		Size:   info.Size,
+	})
+
 	return did, nil
 }
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"flag"
+
+	"github.com/golang/glog"
+
+	"jingoal.com/dfs/fileop"
+)
+
+var (
+	encryptKeyFile = flag.String("encrypt-key-file", "", "file of data keys for encryption at rest, empty for no encryption.")
+)
+
+// createKeyProvider creates the provider of data keys for encryption
+// at rest. It returns nil if no key file is given.
+func createKeyProvider() (fileop.KeyProvider, error) {
+	if *encryptKeyFile == "" {
+		return nil, nil
+	}
+
+	p, err := fileop.NewFileKeyProvider(*encryptKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	glog.Infof("Succeeded to load data keys from %s.", *encryptKeyFile)
+
+	return p, nil
+}
+
+// unwrapEncryptHandler returns the handler wrapped by an EncryptHandler,
+// or the handler itself if it is not an EncryptHandler.
+func unwrapEncryptHandler(handler fileop.DFSFileHandler) fileop.DFSFileHandler {
+	if eh, ok := handler.(*fileop.EncryptHandler); ok {
+		return eh.DFSFileHandler
+	}
+
+	return handler
+}
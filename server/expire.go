@@ -0,0 +1,51 @@
+package server
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+
+	"jingoal.com/dfs/metadata"
+	"jingoal.com/dfs/proto/transfer"
+	"jingoal.com/dfs/util"
+)
+
+var (
+	expireCheckInterval = flag.Duration("expire-check-interval", time.Minute, "interval to remove the expired files.")
+)
+
+// checkExpireTime checks the expire time of a file. If ttl in seconds
+// is given, the expire time is set from it.
+func checkExpireTime(info *transfer.FileInfo, ttl int64) error {
+	if ttl < 0 || info.ExpireTime < 0 {
+		return fmt.Errorf("invalid ttl %d or expire time %d", ttl, info.ExpireTime)
+	}
+
+	now := util.GetTimeInMilliSecond()
+	if ttl > 0 {
+		info.ExpireTime = now + ttl*1000
+	}
+	if info.ExpireTime > 0 && info.ExpireTime <= now {
+		return fmt.Errorf("expire time %d has passed", info.ExpireTime)
+	}
+
+	return nil
+}
+
+// saveExpiry saves the expiry of a file which has an expire time.
+func (s *DFSServer) saveExpiry(inf *transfer.FileInfo) {
+	if inf.ExpireTime <= 0 {
+		return
+	}
+
+	e := &metadata.Expiry{
+		Id:         inf.Id,
+		Domain:     inf.Domain,
+		ExpireTime: inf.ExpireTime,
+	}
+	if er := s.expireOp.SaveExpiry(e); er != nil {
+		glog.Warningf("%s, error: %v", e.String(), er)
+	}
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"testing"
+
+	"jingoal.com/dfs/proto/transfer"
+	"jingoal.com/dfs/util"
+)
+
+func TestCheckExpireTime(t *testing.T) {
+	now := util.GetTimeInMilliSecond()
+	cases := []struct {
+		expireTime int64
+		ttl        int64
+		ok         bool
+	}{
+		{0, 0, true},
+		{now + 60000, 0, true},
+		{now - 60000, 0, false},
+		{-1, 0, false},
+		{0, -1, false},
+		{0, 60, true},
+		{now - 60000, 60, true},
+	}
+
+	for i, c := range cases {
+		info := &transfer.FileInfo{ExpireTime: c.expireTime}
+		err := checkExpireTime(info, c.ttl)
+		if (err == nil) != c.ok {
+			t.Errorf("case %d, expected ok %t, got %v", i, c.ok, err)
+			continue
+		}
+		if err == nil && c.ttl > 0 && info.ExpireTime < now+c.ttl*1000 {
+			t.Errorf("case %d, expire time %d not set from ttl %d", i, info.ExpireTime, c.ttl)
+		}
+	}
+}
@@ -3,11 +3,11 @@ package server
 import (
 	"fmt"
 	"io"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
 
-	"jingoal.com/dfs/fileop"
 	"jingoal.com/dfs/instrument"
 	"jingoal.com/dfs/meta"
 	"jingoal.com/dfs/metadata"
@@ -21,7 +21,7 @@ func (s *DFSServer) GetFile(req *transfer.GetFileReq, stream transfer.FileTransf
 	peerAddr := getPeerAddressString(stream.Context())
 	glog.V(3).Infof("%s start, client: %s, %v", serviceName, peerAddr, req)
 
-	if len(req.Id) == 0 || req.Domain <= 0 {
+	if len(req.Id) == 0 || req.Domain <= 0 || req.Offset < 0 || req.Length < 0 {
 		return fmt.Errorf("invalid request [%v]", req)
 	}
 
@@ -66,11 +66,23 @@ func (s *DFSServer) getFileStream(request interface{}, grpcStream interface{}, a
 	defer file.Close()
 
 	fi := file.GetFileInfo()
-	fi.Domain = req.Domain
 	mf = func() (interface{}, string) {
 		return nil, fmt.Sprintf("getfile, fid %s, domain %d, size %d, biz %s, name %s", fi.Id, fi.Domain, fi.Size, fi.Biz, fi.Name)
 	}
 
+	// Client has the same content, no need to transfer it.
+	if len(req.Md5) > 0 && strings.EqualFold(req.Md5, fi.Md5) {
+		mf = func() (interface{}, string) {
+			return nil, fmt.Sprintf("getfile not modified, fid %s, domain %d, md5 %s", fi.Id, fi.Domain, fi.Md5)
+		}
+
+		return mf, stream.Send(&transfer.GetFileRep{
+			Result: &transfer.GetFileRep_Info{
+				Info: fi,
+			},
+		})
+	}
+
 	// check timeout, for test.
 	if *enablePreJudge {
 		if dl, ok := getDeadline(stream); ok {
@@ -87,6 +99,10 @@ func (s *DFSServer) getFileStream(request interface{}, grpcStream interface{}, a
 		}
 	}
 
+	if req.Offset > fi.Size {
+		return mf, fmt.Errorf("offset %d out of range, size %d", req.Offset, fi.Size)
+	}
+
 	// First, we send file info.
 	err = stream.Send(&transfer.GetFileRep{
 		Result: &transfer.GetFileRep_Info{
@@ -97,18 +113,40 @@ func (s *DFSServer) getFileStream(request interface{}, grpcStream interface{}, a
 		return mf, err
 	}
 
-	// Second, we send file content in a loop.
-	var off int64
-	b := make([]byte, fileop.NegotiatedChunkSize)
+	// Second, we seek to the beginning of the requested range.
+	off := req.Offset
+	if off > 0 {
+		if _, err = file.Seek(off, io.SeekStart); err != nil {
+			_, desc := mf()
+			glog.Warningf("GetFile, seek to %d error %v, %s", off, err, desc)
+			return mf, err
+		}
+	}
+
+	// Third, we send file content in a loop.
+	throttle := newStreamThrottle(stream.Context(), serviceName, req.Domain, fi.Biz)
+	defer throttle.done()
+
+	remain := req.Length
+	b := make([]byte, transferChunkSize(req.ChunkSize))
 	for {
-		length, err := file.Read(b)
+		buf := b
+		if req.Length > 0 && remain < int64(len(buf)) {
+			buf = b[:remain]
+		}
+
+		length, err := file.Read(buf)
 		if length > 0 {
+			if er := throttle.wait(length); er != nil {
+				return mf, er
+			}
+
 			err = stream.Send(&transfer.GetFileRep{
 				Result: &transfer.GetFileRep_Chunk{
 					Chunk: &transfer.Chunk{
 						Pos:     off,
 						Length:  int64(length),
-						Payload: b[:length],
+						Payload: buf[:length],
 					},
 				},
 			})
@@ -117,14 +155,17 @@ func (s *DFSServer) getFileStream(request interface{}, grpcStream interface{}, a
 				glog.Warningf("GetFile, send to client error %v, %s", err, desc)
 				return mf, err
 			}
+			off += int64(length)
+			remain -= int64(length)
 		}
 
-		if err == io.EOF || (err == nil && length == 0) {
+		if err == io.EOF || (err == nil && length == 0) || (req.Length > 0 && remain <= 0) {
+			sent := off - req.Offset
 			nsecs := time.Since(startTime).Nanoseconds() + 1
-			rate := off * 8 * 1e6 / nsecs // in kbit/s
+			rate := sent * 8 * 1e6 / nsecs // in kbit/s
 
-			instrumentGetFile(off, rate, serviceName, fi.Biz)
-			glog.V(3).Infof("GetFile ok, %s, length %d, elapse %d, rate %d kbit/s", req, off, nsecs, rate)
+			instrumentGetFile(sent, rate, serviceName, fi.Biz)
+			glog.V(3).Infof("GetFile ok, %s, length %d, elapse %d, rate %d kbit/s", req, sent, nsecs, rate)
 
 			return mf, nil
 		}
@@ -133,8 +174,6 @@ func (s *DFSServer) getFileStream(request interface{}, grpcStream interface{}, a
 			glog.Warningf("GetFile, read source error %v, %s", err, desc)
 			return mf, err
 		}
-
-		off += int64(length)
 	}
 }
 
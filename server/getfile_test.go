@@ -0,0 +1,149 @@
+package server
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"jingoal.com/dfs/proto/transfer"
+)
+
+func TestGetFileNotModified(t *testing.T) {
+	s := newTestServer(t)
+	domain := testDomain()
+
+	content := []byte("content client has")
+	inf, err := putFile(s, &transfer.FileInfo{Domain: domain, Name: "md5.txt", Biz: "unit-test"}, content, 8)
+	if err != nil {
+		t.Fatalf("PutFile error %v", err)
+	}
+
+	// Only info is replied for the md5 client has, in any case.
+	for _, md5 := range []string{inf.Md5, strings.ToUpper(inf.Md5)} {
+		info, got, err := getFile(s, &transfer.GetFileReq{Id: inf.Id, Domain: domain, Md5: md5})
+		if err != nil {
+			t.Fatalf("GetFile error %v", err)
+		}
+		if info == nil || info.Id != inf.Id || info.Md5 != inf.Md5 || info.Size != int64(len(content)) {
+			t.Errorf("expected info of %v, got %v", inf, info)
+		}
+		if len(got) != 0 {
+			t.Errorf("expected no content for md5 %s, got %q", md5, got)
+		}
+	}
+
+	// Content is replied for another md5.
+	info, got, err := getFile(s, &transfer.GetFileReq{Id: inf.Id, Domain: domain, Md5: "d41d8cd98f00b204e9800998ecf8427e"})
+	if err != nil {
+		t.Fatalf("GetFile error %v", err)
+	}
+	if info == nil || string(got) != string(content) {
+		t.Errorf("expected content of file, got %q", got)
+	}
+}
+
+func TestFileOfAnotherDomain(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	domain := testDomain()
+	other := domain + 1
+
+	inf, err := putFile(s, &transfer.FileInfo{Domain: domain, Name: "owned.txt", Biz: "unit-test"}, []byte("content of domain"), 1024)
+	if err != nil {
+		t.Fatalf("PutFile error %v", err)
+	}
+
+	// A file is invisible to another domain.
+	if _, _, err := getFile(s, &transfer.GetFileReq{Id: inf.Id, Domain: other}); err == nil {
+		t.Errorf("expected error of getting in another domain")
+	}
+	if _, err := s.Stat(ctx, &transfer.GetFileReq{Id: inf.Id, Domain: other}); err == nil {
+		t.Errorf("expected error of stat in another domain")
+	}
+	if rep, err := s.Exist(ctx, &transfer.ExistReq{Id: inf.Id, Domain: other}); err != nil || rep.Result {
+		t.Errorf("expected not exist in another domain, %v", err)
+	}
+	if _, err := s.UpdateAttributes(ctx, &transfer.UpdateAttributesReq{Id: inf.Id, Domain: other, Attrs: map[string]string{"k": "v"}}); err == nil {
+		t.Errorf("expected error of updating attributes in another domain")
+	}
+	if _, err := s.Duplicate(ctx, &transfer.DuplicateReq{Id: inf.Id, Domain: other}); err == nil {
+		t.Errorf("expected error of duplicating in another domain")
+	}
+	if _, err := s.Copy(ctx, &transfer.CopyReq{SrcFid: inf.Id, SrcDomain: other, DstDomain: domain}); err == nil {
+		t.Errorf("expected error of copying from another domain")
+	}
+	if _, err := s.RemoveFile(ctx, &transfer.RemoveFileReq{Id: inf.Id, Domain: other}); err == nil {
+		t.Errorf("expected error of removing in another domain")
+	}
+
+	info, _, err := getFile(s, &transfer.GetFileReq{Id: inf.Id, Domain: domain})
+	if err != nil {
+		t.Fatalf("GetFile error %v", err)
+	}
+	if info.Domain != domain {
+		t.Errorf("expected domain %d, got %d", domain, info.Domain)
+	}
+}
+
+func TestGetFileRange(t *testing.T) {
+	s := newTestServer(t)
+	domain := testDomain()
+
+	content := make([]byte, 5000)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	inf, err := putFile(s, &transfer.FileInfo{Domain: domain, Name: "range.txt", Biz: "unit-test"}, content, 1024)
+	if err != nil {
+		t.Fatalf("PutFile error %v", err)
+	}
+	size := int64(len(content))
+
+	cases := []struct {
+		offset int64
+		length int64
+		want   []byte
+	}{
+		{0, 0, content},
+		{100, 0, content[100:]},
+		{100, 2000, content[100:2100]},
+		{1024, 1024, content[1024:2048]},
+		{4000, 2000, content[4000:]},
+		{size, 0, nil},
+	}
+
+	for _, c := range cases {
+		stream := &getFileStream{}
+		req := &transfer.GetFileReq{Id: inf.Id, Domain: domain, Offset: c.offset, Length: c.length, ChunkSize: 1024}
+		if err := s.GetFile(req, stream); err != nil {
+			t.Fatalf("GetFile [%d, %d) error %v", c.offset, c.length, err)
+		}
+
+		// Chunks are contiguous from the offset requested.
+		var got []byte
+		pos := c.offset
+		for _, rep := range stream.reps {
+			if info := rep.GetInfo(); info != nil && info.Size != size {
+				t.Errorf("expected size %d, got %d", size, info.Size)
+			}
+			chunk := rep.GetChunk()
+			if chunk == nil {
+				continue
+			}
+			if chunk.Pos != pos || chunk.Length != int64(len(chunk.Payload)) {
+				t.Errorf("offset %d, expected chunk at %d, got %d length %d", c.offset, pos, chunk.Pos, chunk.Length)
+			}
+			pos += chunk.Length
+			got = append(got, chunk.Payload...)
+		}
+		if !bytes.Equal(got, c.want) {
+			t.Errorf("offset %d length %d, expected %d bytes, got %d", c.offset, c.length, len(c.want), len(got))
+		}
+	}
+
+	if _, _, err := getFile(s, &transfer.GetFileReq{Id: inf.Id, Domain: domain, Offset: size + 1}); err == nil {
+		t.Errorf("expected error of offset out of range")
+	}
+}
@@ -21,6 +21,8 @@ import (
 	"jingoal.com/dfs/instrument"
 	"jingoal.com/dfs/metadata"
 	"jingoal.com/dfs/notice"
+	"jingoal.com/dfs/proto/transfer"
+	"jingoal.com/dfs/util"
 )
 
 var (
@@ -66,6 +68,7 @@ type HandlerSelector struct {
 
 	backStoreShard *metadata.Shard
 	minorHandler   fileop.DFSFileMinorHandler
+	keyProvider    fileop.KeyProvider
 }
 
 func (hs *HandlerSelector) addRecovery(name string, rInfo chan *FileRecoveryInfo) {
@@ -189,7 +192,10 @@ func (hs *HandlerSelector) addHandler(shard *metadata.Shard) (err error) {
 			return
 		}
 
-		dh := fileop.NewDegradeHandler(handler, hs.dfsServer.reOp)
+		var dh fileop.DFSFileHandler = fileop.NewDegradeHandler(handler, hs.dfsServer.reOp)
+		if hs.keyProvider != nil {
+			dh = fileop.NewEncryptHandler(dh, hs.keyProvider)
+		}
 		hs.degradeShardHandler = NewShardHandler(dh, statusOk, hs)
 		glog.Infof("Succeeded to create degrade handler '%s'.", shard.Name)
 		return
@@ -212,6 +218,11 @@ func (hs *HandlerSelector) addHandler(shard *metadata.Shard) (err error) {
 		glog.Infof("Succeeded to attach handler '%s' with bs '%s'.", handler.Name(), hs.backStoreShard.Name)
 	}
 
+	if hs.keyProvider != nil {
+		handler = fileop.NewEncryptHandler(handler, hs.keyProvider)
+		glog.Infof("Succeeded to attach handler '%s' with encryption.", handler.Name())
+	}
+
 	if sh, ok := hs.getShardHandler(handler.Name()); ok {
 		if err := sh.Shutdown(); err != nil {
 			glog.Warningf("Failed to shutdown old handler, shard: '%s'.", sh.handler.Name())
@@ -315,15 +326,21 @@ func (hs *HandlerSelector) updateHandlerStatus(h fileop.DFSFileHandler, status h
 }
 
 func (hs *HandlerSelector) getHandlerStatus(h fileop.DFSFileHandler) (handlerStatus, bool) {
-	if *HealthCheckManually {
-		// TODO(hanyh): update status from db.
-		return statusOk, true
-	}
-
 	hs.handlerLock.RLock()
 	defer hs.handlerLock.RUnlock()
 
 	sh, ok := hs.shardHandlers[h.Name()]
+	if *HealthCheckManually {
+		// Status is only changed by admin if checking manually.
+		if !ok {
+			return statusOk, true
+		}
+		return sh.status, true
+	}
+
+	if !ok {
+		return statusFailure, false
+	}
 	return sh.status, ok
 }
 
@@ -491,7 +508,7 @@ func (hs *HandlerSelector) startCachedFileRecoveryRoutine() {
 							continue
 						}
 
-						backstoreHandler, ok := interface{}(*handler).(*fileop.BackStoreHandler)
+						backstoreHandler, ok := unwrapEncryptHandler(*handler).(*fileop.BackStoreHandler)
 						if !ok {
 							glog.Warningf("Not a BackStoreHandler%T, %s", *handler, cachelog.String())
 							continue
@@ -538,6 +555,151 @@ func (hs *HandlerSelector) startCachedFileRecoveryRoutine() {
 	}()
 }
 
+// startUploadSessionCleanRoutine starts a routine to clean abandoned upload sessions.
+func (hs *HandlerSelector) startUploadSessionCleanRoutine() {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		glog.Infof("A routine is ready for upload session cleaning.")
+
+		for {
+			select {
+			case <-ticker.C:
+				hs.cleanUploadSessions(time.Now().Add(-*uploadSessionTimeout).Unix())
+				hs.cleanMultiparts(time.Now().Add(-*uploadSessionTimeout).Unix())
+			}
+		}
+	}()
+}
+
+// cleanUploadSessions removes upload sessions which have not
+// been updated since timestamp, and their content.
+func (hs *HandlerSelector) cleanUploadSessions(timestamp int64) {
+	sessions, err := hs.dfsServer.uploadOp.GetExpiredUploadSessions(timestamp, 1000 /* limit */)
+	if err != nil {
+		glog.Warningf("Failed to fetch expired upload sessions, %v", err)
+		return
+	}
+
+	for _, u := range sessions {
+		if err := hs.dfsServer.uploadOp.RemoveUploadSessionById(u.Id); err != nil {
+			glog.Warningf("Failed to remove %s, %v", u.String(), err)
+			continue
+		}
+		glog.Infof("Succeeded to clean %s", u.String())
+	}
+}
+
+// cleanMultiparts aborts multipart uploads created before timestamp.
+func (hs *HandlerSelector) cleanMultiparts(timestamp int64) {
+	uploads, err := hs.dfsServer.partOp.GetExpiredMultiparts(timestamp, 1000 /* limit */)
+	if err != nil {
+		glog.Warningf("Failed to fetch expired multipart uploads, %v", err)
+		return
+	}
+
+	for i := range uploads {
+		m := &uploads[i]
+		if err := hs.dfsServer.abortMultipart(m, transfer.NodeName); err != nil {
+			glog.Warningf("Failed to clean %s, %v", m.String(), err)
+			continue
+		}
+		glog.Infof("Succeeded to clean %s", m.String())
+	}
+}
+
+// startTrashPurgeRoutine starts a routine to purge expired files in trash bin.
+func (hs *HandlerSelector) startTrashPurgeRoutine() {
+	go func() {
+		ticker := time.NewTicker(*trashPurgeInterval)
+		defer ticker.Stop()
+		glog.Infof("A routine is ready for trash purging.")
+
+		for {
+			select {
+			case <-ticker.C:
+				hs.purgeTrashes(time.Now().Unix())
+			}
+		}
+	}()
+}
+
+// purgeTrashes removes files in trash bin which expired before timestamp.
+func (hs *HandlerSelector) purgeTrashes(timestamp int64) {
+	trashes, err := hs.dfsServer.trashOp.GetExpiredTrashes(timestamp, 1000 /* limit */)
+	if err != nil {
+		glog.Warningf("Failed to fetch expired trashes, %v", err)
+		return
+	}
+
+	for _, t := range trashes {
+		// Take the trash out first, so that only one server purges
+		// it, and a file restored concurrently is not purged.
+		if err := hs.dfsServer.trashOp.RemoveTrashById(t.Id); err != nil {
+			if err != mgo.ErrNotFound {
+				glog.Warningf("Failed to take out %s, %v", t.String(), err)
+			}
+			continue
+		}
+
+		result, handlerName, err := hs.dfsServer.removeFile(t.Id, t.Domain, t.Client, time.Now())
+		if err != nil {
+			glog.Warningf("Failed to purge %s, %v", t.String(), err)
+			if er := hs.dfsServer.trashOp.SaveTrash(&t); er != nil {
+				glog.Warningf("Failed to put back %s, %v", t.String(), er)
+			}
+			continue
+		}
+		glog.Infof("Succeeded to purge %s from %s, entity removed %t", t.String(), handlerName, result)
+	}
+}
+
+// startExpireRoutine starts a routine to remove expired files.
+func (hs *HandlerSelector) startExpireRoutine() {
+	go func() {
+		ticker := time.NewTicker(*expireCheckInterval)
+		defer ticker.Stop()
+		glog.Infof("A routine is ready for file expiring.")
+
+		for {
+			select {
+			case <-ticker.C:
+				hs.removeExpiredFiles(util.GetTimeInMilliSecond())
+			}
+		}
+	}()
+}
+
+// removeExpiredFiles removes files which expired before timestamp
+// in milliseconds.
+func (hs *HandlerSelector) removeExpiredFiles(timestamp int64) {
+	expiries, err := hs.dfsServer.expireOp.GetExpiries(timestamp, 1000 /* limit */)
+	if err != nil {
+		glog.Warningf("Failed to fetch expiries, %v", err)
+		return
+	}
+
+	for _, e := range expiries {
+		// Take the expiry out first, so that only one server removes it.
+		if err := hs.dfsServer.expireOp.RemoveExpiryById(e.Id); err != nil {
+			if err != mgo.ErrNotFound {
+				glog.Warningf("Failed to take out %s, %v", e.String(), err)
+			}
+			continue
+		}
+
+		result, handlerName, err := hs.dfsServer.removeFile(e.Id, e.Domain, "expiry", time.Now())
+		if err != nil {
+			glog.Warningf("Failed to remove expired file %s, %v", e.String(), err)
+			if er := hs.dfsServer.expireOp.SaveExpiry(&e); er != nil {
+				glog.Warningf("Failed to put back %s, %v", e.String(), er)
+			}
+			continue
+		}
+		glog.Infof("Succeeded to remove expired file %s from %s, entity removed %t", e.String(), handlerName, result)
+	}
+}
+
 // dispachRecoveryEvent dispatches recovery events.
 func (hs *HandlerSelector) dispatchRecoveryEvent(batchSize int, timeout int64) error {
 	events, err := hs.dfsServer.reOp.GetEventsInBatch(batchSize, timeout)
@@ -709,6 +871,12 @@ func NewHandlerSelector(dfsServer *DFSServer) (*HandlerSelector, error) {
 	hs.recoveries = make(map[string]chan *FileRecoveryInfo)
 	hs.shardHandlers = make(map[string]*ShardHandler)
 
+	kp, err := createKeyProvider()
+	if err != nil {
+		return nil, err
+	}
+	hs.keyProvider = kp
+
 	// Fill segment data.
 	hs.backfillSegment()
 
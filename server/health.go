@@ -0,0 +1,142 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/transport"
+)
+
+const (
+	transferServiceName  = "transfer.FileTransfer"
+	discoveryServiceName = "discovery.DiscoveryService"
+
+	// Prefix of the service name for the status of a shard,
+	// such as "shard/shard1".
+	shardServicePrefix = "shard/"
+)
+
+// Drain marks the server as draining, after which the health service
+// reports NOT_SERVING for all services. It is called before the
+// server stops gracefully.
+func (s *DFSServer) Drain() {
+	atomic.StoreInt32(&s.draining, 1)
+}
+
+func (s *DFSServer) isDraining() bool {
+	return atomic.LoadInt32(&s.draining) == 1
+}
+
+// Check implements grpc_health_v1.HealthServer. An empty service is
+// for the server as a whole, which is the same as file transfer.
+func (s *DFSServer) Check(ctx context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	serving, err := s.serving(req.Service)
+	if err != nil {
+		return nil, err
+	}
+
+	status := grpc_health_v1.HealthCheckResponse_NOT_SERVING
+	if serving {
+		status = grpc_health_v1.HealthCheckResponse_SERVING
+	}
+	glog.V(5).Infof("Health check, service %q, %s", req.Service, status)
+
+	return &grpc_health_v1.HealthCheckResponse{
+		Status: status,
+	}, nil
+}
+
+// serving returns true if service is serving,
+// an error with code NotFound for unknown service.
+func (s *DFSServer) serving(service string) (bool, error) {
+	var check func() bool
+
+	switch {
+	case service == "" || service == transferServiceName:
+		check = func() bool {
+			return s.selector.serving() && s.metadataReachable()
+		}
+	case service == discoveryServiceName:
+		check = func() bool {
+			return true
+		}
+	case strings.HasPrefix(service, shardServicePrefix):
+		sh, ok := s.selector.getShardHandler(strings.TrimPrefix(service, shardServicePrefix))
+		if !ok {
+			return false, unknownServiceError(service)
+		}
+		check = func() bool {
+			return s.selector.shardServing(sh)
+		}
+	default:
+		return false, unknownServiceError(service)
+	}
+
+	return !s.isDraining() && check(), nil
+}
+
+func unknownServiceError(service string) error {
+	return transport.StreamError{
+		Code: codes.NotFound,
+		Desc: fmt.Sprintf("unknown service %s", service),
+	}
+}
+
+// metadataReachable returns true if the metadata database
+// responds within HealthCheckTimeout.
+func (s *DFSServer) metadataReachable() bool {
+	result := make(chan error, 1)
+	go func() {
+		result <- s.mOp.Ping()
+	}()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			glog.Warningf("Health check, metadata unreachable, %v", err)
+			return false
+		}
+		return true
+	case <-time.After(time.Duration(*HealthCheckTimeout) * time.Second):
+		glog.Warningf("Health check, metadata unreachable, timeout")
+		return false
+	}
+}
+
+// serving returns true if all shard handlers are ok, or the
+// degrade handler is ok to take over the failed ones.
+func (hs *HandlerSelector) serving() bool {
+	hs.handlerLock.RLock()
+	defer hs.handlerLock.RUnlock()
+
+	if hs.degradeShardHandler != nil && hs.degradeShardHandler.status == statusOk {
+		return true
+	}
+
+	count := 0
+	for _, sh := range hs.shardHandlers {
+		if sh == hs.degradeShardHandler {
+			continue
+		}
+		if sh.status != statusOk {
+			return false
+		}
+		count++
+	}
+
+	return count > 0
+}
+
+// shardServing returns the status of a shard handler.
+func (hs *HandlerSelector) shardServing(sh *ShardHandler) bool {
+	hs.handlerLock.RLock()
+	defer hs.handlerLock.RUnlock()
+
+	return sh.status == statusOk
+}
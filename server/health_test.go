@@ -0,0 +1,79 @@
+package server
+
+import (
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc/health/grpc_health_v1"
+
+	"jingoal.com/dfs/metadata"
+)
+
+type pingMetaOp struct {
+	metadata.MetaOp
+	err error
+}
+
+func (op *pingMetaOp) Ping() error {
+	return op.err
+}
+
+func TestHealthCheck(t *testing.T) {
+	shard1 := &ShardHandler{status: statusOk}
+	shard2 := &ShardHandler{status: statusOk}
+	degrade := &ShardHandler{status: statusFailure}
+
+	mOp := &pingMetaOp{}
+	s := &DFSServer{
+		mOp: mOp,
+		selector: &HandlerSelector{
+			shardHandlers: map[string]*ShardHandler{
+				"shard1":  shard1,
+				"shard2":  shard2,
+				"degrade": degrade,
+			},
+			degradeShardHandler: degrade,
+		},
+	}
+
+	check := func(service string, expected grpc_health_v1.HealthCheckResponse_ServingStatus) {
+		rep, err := s.Check(nil, &grpc_health_v1.HealthCheckRequest{Service: service})
+		if err != nil {
+			t.Errorf("service %q, unexpected error %v", service, err)
+			return
+		}
+		if rep.Status != expected {
+			t.Errorf("service %q, expected %s, got %s", service, expected, rep.Status)
+		}
+	}
+
+	check("", grpc_health_v1.HealthCheckResponse_SERVING)
+	check(transferServiceName, grpc_health_v1.HealthCheckResponse_SERVING)
+	check("shard/degrade", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+
+	// A failed shard without degrade handler.
+	shard2.status = statusFailure
+	check("", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	check("shard/shard1", grpc_health_v1.HealthCheckResponse_SERVING)
+	check("shard/shard2", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+
+	// Degrade handler takes over.
+	degrade.status = statusOk
+	check("", grpc_health_v1.HealthCheckResponse_SERVING)
+
+	// Metadata unreachable.
+	mOp.err = errors.New("no reachable servers")
+	check(transferServiceName, grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	check(discoveryServiceName, grpc_health_v1.HealthCheckResponse_SERVING)
+	mOp.err = nil
+
+	s.Drain()
+	check("", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	check(discoveryServiceName, grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+
+	for _, service := range []string{"unknown", "shard/none"} {
+		if _, err := s.Check(nil, &grpc_health_v1.HealthCheckRequest{Service: service}); err == nil {
+			t.Errorf("service %q, expected error", service)
+		}
+	}
+}
@@ -0,0 +1,482 @@
+package server
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	grpcmd "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/transport"
+
+	"jingoal.com/dfs/meta"
+	"jingoal.com/dfs/proto/transfer"
+)
+
+var (
+	httpTimeout  = flag.Duration("http-timeout", 10*time.Minute, "deadline of a request to http gateway, 0 for none.")
+	HTTPWritable = flag.Bool("http-writable", false, "true for serving PUT and DELETE of http gateway, which requires auth-enabled.")
+)
+
+var (
+	errUnsatisfiableRange = errors.New("unsatisfiable range")
+	errNotSupported       = errors.New("not supported")
+)
+
+// HTTPGateway serves files over http for the clients which can not
+// speak gRPC, with the same biz functions of DFSServer.
+//
+//	GET/HEAD /{domain}/{fid}  reads a file, supports Range and ETag.
+//	PUT      /{domain}/{name} creates a file with the request body,
+//	         the new fid is returned in header Location. Query
+//	         parameters biz, user, md5 and ttl are optional.
+//	DELETE   /{domain}/{fid}  removes a file.
+//
+// Requests are authorized with the bearer token in header Authorization
+// and rate limited, the same as gRPC. PUT and DELETE are served only
+// if flag http-writable is set, the gateway is read-only by default.
+type HTTPGateway struct {
+	s *DFSServer
+
+	// writeError writes an error into response.
+	writeError func(http.ResponseWriter, error)
+}
+
+// ServeHTTP implements interface http.Handler.
+func (g *HTTPGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	domain, id, err := parseHTTPPath(r.URL.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := httpContext(r)
+	defer cancel()
+
+	peerAddr := r.RemoteAddr
+	glog.V(3).Infof("HTTP %s %s, client: %s", r.Method, r.URL, peerAddr)
+
+	if ctx, err = g.s.authorizeHTTP(ctx, r, domain); err != nil {
+		g.writeError(w, err)
+		return
+	}
+
+	switch {
+	case r.Method == "GET" || r.Method == "HEAD":
+		g.getFile(ctx, w, r, domain, id, peerAddr)
+	case r.Method == "PUT" && *HTTPWritable:
+		g.putFile(ctx, w, r, domain, id, peerAddr)
+	case r.Method == "DELETE" && *HTTPWritable:
+		g.removeFile(ctx, w, domain, id, peerAddr)
+	default:
+		w.Header().Set("Allow", httpAllowedMethods())
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (g *HTTPGateway) getFile(ctx context.Context, w http.ResponseWriter, r *http.Request, domain int64, id string, peerAddr string) {
+	t, err := bizFunc(g.s.statBiz).withDeadline("HTTPStat", ctx, &transfer.GetFileReq{
+		Id:     id,
+		Domain: domain,
+	})
+	if err != nil {
+		g.writeError(w, err)
+		return
+	}
+	rep, ok := t.(*transfer.PutFileRep)
+	if !ok || rep.File == nil {
+		g.writeError(w, AssertionError)
+		return
+	}
+	info := rep.File
+
+	etag := ""
+	if len(info.Md5) > 0 {
+		etag = strconv.Quote(info.Md5)
+		w.Header().Set("ETag", etag)
+	}
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	if len(etag) > 0 && r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	status := http.StatusOK
+	offset, length := int64(0), info.Size
+	if rh := r.Header.Get("Range"); len(rh) > 0 {
+		if ir := r.Header.Get("If-Range"); len(ir) == 0 || ir == etag {
+			offset, length, err = parseRange(rh, info.Size)
+			if err == errUnsatisfiableRange {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", info.Size))
+				g.writeError(w, err)
+				return
+			}
+			if err != nil { // ignore an invalid range.
+				offset, length = 0, info.Size
+			} else {
+				status = http.StatusPartialContent
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, info.Size))
+			}
+		}
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+
+	if r.Method == "HEAD" || length == 0 {
+		w.WriteHeader(status)
+		return
+	}
+
+	serviceName := "HTTPGetFile"
+	stream := &httpGetFileStream{
+		httpStream: httpStream{ctx: ctx},
+		w:          w,
+		status:     status,
+	}
+	req := &transfer.GetFileReq{
+		Id:     id,
+		Domain: domain,
+		Offset: offset,
+		Length: length,
+	}
+	err = streamFunc(g.s.getFileStream).withStreamDeadline(serviceName, req, stream, serviceName, peerAddr, g.s)
+	if err != nil {
+		if !stream.sent {
+			g.writeError(w, err)
+			return
+		}
+		// Response has been started, nothing to tell client.
+		glog.Warningf("%s, fid %s, domain %d, client %s, error %v", serviceName, id, domain, peerAddr, err)
+	}
+}
+
+func (g *HTTPGateway) putFile(ctx context.Context, w http.ResponseWriter, r *http.Request, domain int64, name string, peerAddr string) {
+	q := r.URL.Query()
+	info := &transfer.FileInfo{
+		Name:   name,
+		Domain: domain,
+		Biz:    q.Get("biz"),
+		Md5:    q.Get("md5"),
+	}
+	if r.ContentLength > 0 {
+		info.Size = r.ContentLength
+	}
+
+	var ttl int64
+	var err error
+	if v := q.Get("user"); len(v) > 0 {
+		if info.User, err = strconv.ParseInt(v, 10, 64); err != nil {
+			http.Error(w, fmt.Sprintf("invalid user %s", v), http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("ttl"); len(v) > 0 {
+		if ttl, err = strconv.ParseInt(v, 10, 64); err != nil {
+			http.Error(w, fmt.Sprintf("invalid ttl %s", v), http.StatusBadRequest)
+			return
+		}
+	}
+
+	inf, err := g.putStream(ctx, r.Body, info, ttl, "HTTPPutFile", peerAddr)
+	if err != nil {
+		g.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/%d/%s", inf.Domain, inf.Id))
+	if len(inf.Md5) > 0 {
+		w.Header().Set("ETag", strconv.Quote(inf.Md5))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(inf); err != nil {
+		glog.Warningf("HTTPPutFile, failed to write receipt of %s, %v", inf.Id, err)
+	}
+}
+
+// putStream creates a file with the content read from body, returns
+// the info of file with the md5 of content.
+func (g *HTTPGateway) putStream(ctx context.Context, body io.Reader, info *transfer.FileInfo, ttl int64, serviceName string, peerAddr string) (*transfer.FileInfo, error) {
+	stream := &httpPutFileStream{
+		httpStream: httpStream{ctx: ctx},
+		body:       body,
+		info:       info,
+		ttl:        ttl,
+		md5:        md5.New(),
+	}
+	err := streamFunc(g.s.putFileStream).withStreamDeadline(serviceName, nil, stream, serviceName, peerAddr)
+	if err != nil {
+		return nil, err
+	}
+	if stream.rep == nil || stream.rep.File == nil {
+		return nil, AssertionError
+	}
+
+	inf := *stream.rep.File
+	inf.Md5 = hex.EncodeToString(stream.md5.Sum(nil))
+	return &inf, nil
+}
+
+func (g *HTTPGateway) removeFile(ctx context.Context, w http.ResponseWriter, domain int64, id string, peerAddr string) {
+	req := &transfer.RemoveFileReq{
+		Id:     id,
+		Domain: domain,
+	}
+	_, err := bizFunc(g.s.removeBiz).withDeadline("HTTPRemoveFile", ctx, req, peerAddr, "http gateway")
+	if err != nil {
+		g.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// NewHTTPGateway creates an http gateway of DFSServer.
+func NewHTTPGateway(s *DFSServer) *HTTPGateway {
+	return &HTTPGateway{
+		s:          s,
+		writeError: writeHTTPError,
+	}
+}
+
+// httpAllowedMethods returns the methods served by http gateway.
+func httpAllowedMethods() string {
+	if *HTTPWritable {
+		return "GET, HEAD, PUT, DELETE"
+	}
+
+	return "GET, HEAD"
+}
+
+// httpContext returns the context of an http request, with the
+// deadline of http gateway.
+func httpContext(r *http.Request) (context.Context, context.CancelFunc) {
+	ctx := context.Context(r.Context())
+	if *httpTimeout > 0 {
+		return context.WithTimeout(ctx, *httpTimeout)
+	}
+
+	return context.WithCancel(ctx)
+}
+
+// parseHTTPPath parses domain and fid from a path like /{domain}/{fid}.
+func parseHTTPPath(path string) (int64, string, error) {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(parts) != 2 || len(parts[1]) == 0 {
+		return 0, "", fmt.Errorf("invalid path %s", path)
+	}
+
+	domain, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || domain <= 0 {
+		return 0, "", fmt.Errorf("invalid domain %s", parts[0])
+	}
+
+	return domain, parts[1], nil
+}
+
+// parseRange parses a single byte range of header Range, returns its
+// offset and length. Multiple ranges are not supported.
+func parseRange(s string, size int64) (int64, int64, error) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(s, prefix) {
+		return 0, 0, fmt.Errorf("invalid range %s", s)
+	}
+	spec := strings.TrimSpace(s[len(prefix):])
+	if strings.Contains(spec, ",") {
+		return 0, 0, fmt.Errorf("multiple ranges %s", s)
+	}
+
+	i := strings.Index(spec, "-")
+	if i < 0 {
+		return 0, 0, fmt.Errorf("invalid range %s", s)
+	}
+	first, last := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+
+	if len(first) == 0 { // suffix range, the last n bytes.
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("invalid range %s", s)
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, errUnsatisfiableRange
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, nil
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, fmt.Errorf("invalid range %s", s)
+	}
+	if start >= size {
+		return 0, 0, errUnsatisfiableRange
+	}
+
+	end := size - 1
+	if len(last) > 0 {
+		e, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || e < start {
+			return 0, 0, fmt.Errorf("invalid range %s", s)
+		}
+		if e < end {
+			end = e
+		}
+	}
+
+	return start, end - start + 1, nil
+}
+
+// writeHTTPError writes an error with the status code of it.
+func writeHTTPError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case isRateLimited(err):
+		status = http.StatusTooManyRequests
+	case err == meta.FileNotFound:
+		status = http.StatusNotFound
+	case err == errUnsatisfiableRange:
+		status = http.StatusRequestedRangeNotSatisfiable
+	case strings.HasPrefix(err.Error(), "invalid request"):
+		status = http.StatusBadRequest
+	default:
+		if se, ok := err.(transport.StreamError); ok {
+			switch se.Code {
+			case codes.DeadlineExceeded:
+				status = http.StatusGatewayTimeout
+			case codes.Canceled:
+				status = http.StatusRequestTimeout
+			case codes.ResourceExhausted:
+				status = http.StatusInsufficientStorage
+			case codes.Unauthenticated:
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				status = http.StatusUnauthorized
+			case codes.PermissionDenied:
+				status = http.StatusForbidden
+			}
+		}
+	}
+
+	// Details of an internal error are only logged, not to expose
+	// the storage to clients.
+	if status == http.StatusInternalServerError {
+		glog.Warningf("HTTP gateway internal error, %v", err)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	http.Error(w, err.Error(), status)
+}
+
+// httpStream adapts an http request to grpc.ServerStream, so that
+// the stream biz functions can serve it.
+type httpStream struct {
+	ctx context.Context
+}
+
+func (st *httpStream) SetHeader(grpcmd.MD) error {
+	return nil
+}
+
+func (st *httpStream) SendHeader(grpcmd.MD) error {
+	return nil
+}
+
+func (st *httpStream) SetTrailer(grpcmd.MD) {
+}
+
+func (st *httpStream) Context() context.Context {
+	return st.ctx
+}
+
+func (st *httpStream) SendMsg(m interface{}) error {
+	return errNotSupported
+}
+
+func (st *httpStream) RecvMsg(m interface{}) error {
+	return errNotSupported
+}
+
+// httpGetFileStream implements transfer.FileTransfer_GetFileServer,
+// which writes file content into an http response.
+type httpGetFileStream struct {
+	httpStream
+
+	w      http.ResponseWriter
+	status int
+	sent   bool // true if the status has been written.
+}
+
+func (st *httpGetFileStream) Send(rep *transfer.GetFileRep) error {
+	if !st.sent {
+		st.w.WriteHeader(st.status)
+		st.sent = true
+	}
+
+	if chunk := rep.GetChunk(); chunk != nil {
+		_, err := st.w.Write(chunk.Payload)
+		return err
+	}
+
+	return nil
+}
+
+// httpPutFileStream implements transfer.FileTransfer_PutFileServer,
+// which reads file content from an http request.
+type httpPutFileStream struct {
+	httpStream
+
+	body io.Reader
+	info *transfer.FileInfo
+	ttl  int64
+	buf  []byte
+	md5  hash.Hash // md5 of content read.
+	rep  *transfer.PutFileRep
+}
+
+func (st *httpPutFileStream) Recv() (*transfer.PutFileReq, error) {
+	if st.buf == nil {
+		st.buf = make([]byte, transferChunkSize(0))
+	}
+
+	n, err := io.ReadFull(st.body, st.buf)
+	if err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	if err != nil && (err != io.EOF || st.info == nil) {
+		return nil, err
+	}
+	st.md5.Write(st.buf[:n])
+
+	req := &transfer.PutFileReq{
+		Chunk: &transfer.Chunk{
+			Length:  int64(n),
+			Payload: st.buf[:n],
+		},
+	}
+	if st.info != nil { // the first request carries file info.
+		req.Info = st.info
+		req.Ttl = st.ttl
+		st.info = nil
+	}
+
+	return req, nil
+}
+
+func (st *httpPutFileStream) SendAndClose(rep *transfer.PutFileRep) error {
+	st.rep = rep
+	return nil
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"jingoal.com/dfs/meta"
+)
+
+func TestParseHTTPPath(t *testing.T) {
+	cases := []struct {
+		path   string
+		domain int64
+		id     string
+		ok     bool
+	}{
+		{"/2/59828e534ec50300d2891b33", 2, "59828e534ec50300d2891b33", true},
+		{"/2/", 0, "", false},
+		{"/0/59828e534ec50300d2891b33", 0, "", false},
+		{"/x/59828e534ec50300d2891b33", 0, "", false},
+		{"/2/a/b", 0, "", false},
+		{"/", 0, "", false},
+	}
+
+	for i, c := range cases {
+		domain, id, err := parseHTTPPath(c.path)
+		if (err == nil) != c.ok {
+			t.Errorf("case %d, expected ok %t, got %v", i, c.ok, err)
+			continue
+		}
+		if domain != c.domain || id != c.id {
+			t.Errorf("case %d, expected %d %s, got %d %s", i, c.domain, c.id, domain, id)
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	cases := []struct {
+		header string
+		size   int64
+		offset int64
+		length int64
+		err    error
+	}{
+		{"bytes=0-99", 1000, 0, 100, nil},
+		{"bytes=100-", 1000, 100, 900, nil},
+		{"bytes=900-1999", 1000, 900, 100, nil},
+		{"bytes=-100", 1000, 900, 100, nil},
+		{"bytes=-2000", 1000, 0, 1000, nil},
+		{"bytes=1000-", 1000, 0, 0, errUnsatisfiableRange},
+		{"bytes=-0", 1000, 0, 0, errUnsatisfiableRange},
+		{"bytes=0-", 0, 0, 0, errUnsatisfiableRange},
+	}
+
+	for i, c := range cases {
+		offset, length, err := parseRange(c.header, c.size)
+		if err != c.err {
+			t.Errorf("case %d, expected error %v, got %v", i, c.err, err)
+			continue
+		}
+		if offset != c.offset || length != c.length {
+			t.Errorf("case %d, expected %d %d, got %d %d", i, c.offset, c.length, offset, length)
+		}
+	}
+
+	for i, h := range []string{"items=0-1", "bytes=0-1,5-6", "bytes=5-1", "bytes=a-", "bytes=5"} {
+		if _, _, err := parseRange(h, 1000); err == nil || err == errUnsatisfiableRange {
+			t.Errorf("case %d, expected invalid range %s, got %v", i, h, err)
+		}
+	}
+}
+
+func TestHTTPGatewayReadOnly(t *testing.T) {
+	g := NewHTTPGateway(&DFSServer{})
+
+	for _, method := range []string{"PUT", "DELETE", "POST"} {
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, httptest.NewRequest(method, "/2/59828e534ec50300d2891b33", nil))
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s, expected status %d, got %d", method, http.StatusMethodNotAllowed, w.Code)
+		}
+		if allow := w.Header().Get("Allow"); allow != "GET, HEAD" {
+			t.Errorf("%s, expected read-only methods allowed, got %s", method, allow)
+		}
+	}
+}
+
+func TestWriteHTTPError(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+		body   string
+	}{
+		{meta.FileNotFound, http.StatusNotFound, meta.FileNotFound.Error()},
+		{errors.New("no reachable servers"), http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)},
+	}
+
+	for i, c := range cases {
+		w := httptest.NewRecorder()
+		writeHTTPError(w, c.err)
+		if w.Code != c.status || strings.TrimSpace(w.Body.String()) != c.body {
+			t.Errorf("case %d, expected %d %s, got %d %s", i, c.status, c.body, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package server
+
+import (
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// peerIdentity returns the identity of a peer verified by mutual TLS,
+// which is the common name of its certificate, or the first dns name
+// if no common name. It returns empty string for a peer not verified.
+func peerIdentity(p *peer.Peer) string {
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return ""
+	}
+
+	cert := info.State.VerifiedChains[0][0]
+	if len(cert.Subject.CommonName) > 0 {
+		return cert.Subject.CommonName
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+
+	return ""
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+func TestPeerIdentity(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 3456}
+
+	p := &peer.Peer{Addr: addr}
+	if id := peerIdentity(p); id != "" {
+		t.Errorf("expected no identity without tls, got %s", id)
+	}
+
+	p.AuthInfo = credentials.TLSInfo{
+		State: tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{
+				{{Subject: pkix.Name{CommonName: "client-a"}}},
+			},
+		},
+	}
+	id := peerIdentity(p)
+	if id != "client-a" {
+		t.Errorf("expected client-a, got %s", id)
+	}
+
+	if host := peerHost(id + "@" + addr.String()); host != "10.0.0.1" {
+		t.Errorf("expected 10.0.0.1, got %s", host)
+	}
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+
+	"jingoal.com/dfs/fileop"
+	"jingoal.com/dfs/meta"
+	"jingoal.com/dfs/proto/transfer"
+)
+
+var (
+	listMaxLimit = flag.Int("list-max-limit", 1000, "max number of files in a page of ListFiles.")
+)
+
+const (
+	listStageNormal  = "n" // listing on normal handler
+	listStageMigrate = "m" // listing on migrate handler
+)
+
+// ListFiles lists files of a domain page by page.
+func (s *DFSServer) ListFiles(ctx context.Context, req *transfer.ListFilesReq) (*transfer.ListFilesRep, error) {
+	serviceName := "ListFiles"
+	peerAddr := getPeerAddressString(ctx)
+	glog.V(3).Infof("%s, client: %s, %v", serviceName, peerAddr, req)
+
+	if req.Domain <= 0 || req.Limit < 0 || req.StartDate < 0 || req.EndDate < 0 {
+		return nil, fmt.Errorf("invalid request [%v]", req)
+	}
+
+	t, err := bizFunc(s.listFilesBiz).withDeadline(serviceName, ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	result, ok := t.(*transfer.ListFilesRep)
+	if ok {
+		return result, nil
+	}
+
+	return nil, AssertionError
+}
+
+func (s *DFSServer) listFilesBiz(c interface{}, r interface{}, args []interface{}) (interface{}, error) {
+	req, ok := r.(*transfer.ListFilesReq)
+	if !ok {
+		return nil, AssertionError
+	}
+
+	var mf msgFunc
+	mf = func() (interface{}, string) {
+		return nil, fmt.Sprintf("listfiles, domain %d, cursor %s", req.Domain, req.Cursor)
+	}
+
+	stage, cursor, err := parseListCursor(req.Cursor)
+	if err != nil {
+		return mf, err
+	}
+
+	limit := int(req.Limit)
+	if limit == 0 || limit > *listMaxLimit {
+		limit = *listMaxLimit
+	}
+
+	filter := &meta.FileFilter{
+		Domain: req.Domain,
+		Biz:    req.Biz,
+	}
+	if req.User > 0 {
+		filter.UserId = strconv.FormatInt(req.User, 10)
+	}
+	if req.StartDate > 0 {
+		filter.Start = time.Unix(0, req.StartDate*1e6)
+	}
+	if req.EndDate > 0 {
+		filter.End = time.Unix(0, req.EndDate*1e6)
+	}
+
+	// Listing involves metadata only, so the handler is not degraded.
+	nh, mh, err := s.selector.getDFSFileHandler(req.Domain)
+	if err != nil {
+		return mf, err
+	}
+	if mh != nil && (*mh).Name() == (*nh).Name() {
+		mh = nil
+	}
+
+	files := make([]*transfer.FileInfo, 0, limit)
+	next := ""
+
+	// Files on normal handler are listed first, and then the files
+	// on migrate handler.
+	if stage == listStageNormal {
+		fs, nc, err := fileop.ListFiles(*nh, filter, cursor, limit)
+		if err != nil {
+			return mf, err
+		}
+		files = append(files, fs...)
+
+		switch {
+		case len(nc) > 0:
+			next = listStageNormal + ":" + nc
+		case mh != nil:
+			stage, cursor = listStageMigrate, ""
+		}
+	}
+
+	if stage == listStageMigrate && mh != nil && len(files) < limit {
+		fs, nc, err := fileop.ListFiles(*mh, filter, cursor, limit-len(files))
+		if err != nil {
+			return mf, err
+		}
+		files = append(files, fs...)
+
+		if len(nc) > 0 {
+			next = listStageMigrate + ":" + nc
+		}
+	} else if stage == listStageMigrate && mh != nil {
+		next = listStageMigrate + ":" + cursor
+	}
+
+	// Files in trash bin are invisible, so a page may be shorter
+	// than limit even if there are more files.
+	keys := make([]fileKey, 0, len(files))
+	for _, f := range files {
+		keys = append(keys, fileKey{id: f.Id, domain: req.Domain})
+	}
+	trashed, err := s.trashedFiles(keys)
+	if err != nil {
+		return mf, err
+	}
+
+	visible := files[:0]
+	for _, f := range files {
+		if trashed[f.Id] {
+			continue
+		}
+		f.Domain = req.Domain
+		visible = append(visible, f)
+	}
+	files = visible
+
+	mf = func() (interface{}, string) {
+		return &transfer.ListFilesRep{
+				Files:  files,
+				Cursor: next,
+			},
+			fmt.Sprintf("listfiles, domain %d, %d files, cursor %s", req.Domain, len(files), next)
+	}
+
+	return mf, nil
+}
+
+// parseListCursor parses a cursor of ListFiles into the stage
+// and the cursor of handler.
+func parseListCursor(cursor string) (string, string, error) {
+	if len(cursor) == 0 {
+		return listStageNormal, "", nil
+	}
+
+	parts := strings.SplitN(cursor, ":", 2)
+	if len(parts) != 2 || (parts[0] != listStageNormal && parts[0] != listStageMigrate) {
+		return "", "", fmt.Errorf("invalid cursor %s", cursor)
+	}
+
+	return parts[0], parts[1], nil
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"jingoal.com/dfs/proto/transfer"
+	"jingoal.com/dfs/util"
+)
+
+func TestParseListCursor(t *testing.T) {
+	cases := []struct {
+		cursor string
+		stage  string
+		inner  string
+		ok     bool
+	}{
+		{"", listStageNormal, "", true},
+		{"n:59828e534ec50300d2891b33", listStageNormal, "59828e534ec50300d2891b33", true},
+		{"m:", listStageMigrate, "", true},
+		{"m:AAEC:Aw==", listStageMigrate, "AAEC:Aw==", true},
+		{"x:abc", "", "", false},
+		{"abc", "", "", false},
+	}
+
+	for i, c := range cases {
+		stage, inner, err := parseListCursor(c.cursor)
+		if (err == nil) != c.ok {
+			t.Errorf("case %d, expected ok %t, got %v", i, c.ok, err)
+			continue
+		}
+		if stage != c.stage || inner != c.inner {
+			t.Errorf("case %d, expected %s %s, got %s %s", i, c.stage, c.inner, stage, inner)
+		}
+	}
+}
+
+func TestListFilesWithDuplicates(t *testing.T) {
+	s := newTestServer(t)
+	domain := testDomain()
+
+	files := make(map[string]bool)
+	for _, content := range []string{"list entity 1", "list entity 2"} {
+		f, err := putFile(s, &transfer.FileInfo{
+			Name:   "list.txt",
+			Domain: domain,
+			User:   1,
+			Biz:    "list",
+		}, []byte(content), 4)
+		if err != nil {
+			t.Fatalf("PutFile error %v", err)
+		}
+		files[f.Id] = true
+	}
+
+	for id := range files {
+		did, err := s.duplicate(id, domain)
+		if err != nil {
+			t.Fatalf("Duplicate %s error %v", id, err)
+		}
+		if !util.IsDuplId(did) {
+			t.Fatalf("expected a dupl id, got %s", did)
+		}
+		files[did] = true
+		break
+	}
+
+	// Pages of one file cover entities and duplications, each once.
+	listed := make(map[string]bool)
+	cursor := ""
+	for i := 0; i < 10; i++ {
+		rep, err := s.ListFiles(context.Background(), &transfer.ListFilesReq{
+			Domain: domain,
+			Cursor: cursor,
+			Limit:  1,
+		})
+		if err != nil {
+			t.Fatalf("ListFiles error %v", err)
+		}
+		for _, f := range rep.Files {
+			if listed[f.Id] {
+				t.Errorf("file %s listed twice", f.Id)
+			}
+			listed[f.Id] = true
+		}
+		if cursor = rep.Cursor; len(cursor) == 0 {
+			break
+		}
+	}
+
+	if len(listed) != len(files) {
+		t.Errorf("expected %d files, got %d", len(files), len(listed))
+	}
+	for id := range files {
+		if !listed[id] {
+			t.Errorf("file %s not listed", id)
+		}
+	}
+}
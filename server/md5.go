@@ -66,6 +66,12 @@ func (s *DFSServer) getByMd5Biz(c interface{}, r interface{}, args []interface{}
 		return rep, fmt.Sprintf("getbymd5, md5 %s, domain %d", req.Md5, req.Domain)
 	}
 
+	// A duplication stores no content, but it is charged as the content
+	// here, the same as PutFile which clients fall back to.
+	if err := s.checkQuota(req.Domain, req.Size); err != nil {
+		return mf, err
+	}
+
 	p, oid, err := s.findByMd5(req.Md5, req.Domain, req.Size)
 	if err != nil {
 		glog.V(3).Infof("Failed to find file by md5 [%s, %d, %d], error: %v", req.Md5, req.Domain, req.Size, err)
@@ -101,6 +107,13 @@ func (s *DFSServer) getByMd5Biz(c interface{}, r interface{}, args []interface{}
 		glog.Warningf("%s, error: %v", event.String(), er)
 	}
 
+	// Charged as the content, the same as checked above.
+	s.saveCreateSpaceLog(&transfer.FileInfo{
+		Id:     did,
+		Domain: req.Domain,
+		Size:   req.Size,
+	})
+
 	glog.V(3).Infof("Succeeded to get file by md5, fid %v, md5 %v, domain %d, length %d",
 		oid, req.Md5, req.Domain, req.Size)
 
@@ -71,3 +71,11 @@ func startRateCheckRoutine() {
 		}
 	}()
 }
+
+func instrumentThrottled(throttled time.Duration, serviceName string, biz string) {
+	instrument.ThrottledTime <- &instrument.Measurements{
+		Name:  serviceName,
+		Biz:   biz,
+		Value: float64(throttled.Nanoseconds()),
+	}
+}
@@ -0,0 +1,557 @@
+package server
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"jingoal.com/dfs/fileop"
+	"jingoal.com/dfs/metadata"
+	"jingoal.com/dfs/proto/transfer"
+)
+
+const (
+	maxPartNumber = 10000
+)
+
+var (
+	errNoSuchUpload     = errors.New("no such multipart upload")
+	errUploadCompleting = errors.New("multipart upload is completing")
+)
+
+// InitiateMultipart starts a multipart upload.
+func (s *DFSServer) InitiateMultipart(ctx context.Context, req *transfer.InitiateMultipartReq) (*transfer.InitiateMultipartRep, error) {
+	serviceName := "InitiateMultipart"
+	peerAddr := getPeerAddressString(ctx)
+	glog.V(3).Infof("%s, client: %s, %v", serviceName, peerAddr, req)
+
+	if req.Info == nil || req.Info.Domain <= 0 {
+		return nil, fmt.Errorf("invalid request [%v]", req)
+	}
+	if err := checkAttributes(req.Info.Attrs, false); err != nil {
+		return nil, err
+	}
+	if err := checkExpireTime(req.Info, req.Ttl); err != nil {
+		return nil, err
+	}
+
+	t, err := bizFunc(s.initiateMultipartBiz).withDeadline(serviceName, ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	result, ok := t.(*transfer.InitiateMultipartRep)
+	if ok {
+		return result, nil
+	}
+
+	return nil, AssertionError
+}
+
+func (s *DFSServer) initiateMultipartBiz(c interface{}, r interface{}, args []interface{}) (interface{}, error) {
+	req, ok := r.(*transfer.InitiateMultipartReq)
+	if !ok {
+		return nil, AssertionError
+	}
+
+	inf := req.Info
+	m := &metadata.Multipart{
+		Domain:     inf.Domain,
+		User:       inf.User,
+		Biz:        inf.Biz,
+		Name:       inf.Name,
+		Md5:        inf.Md5,
+		Size:       inf.Size,
+		Attrs:      inf.Attrs,
+		ExpireTime: inf.ExpireTime,
+		CreateTime: time.Now().Unix(),
+	}
+
+	var mf msgFunc
+	mf = func() (interface{}, string) {
+		return nil, fmt.Sprintf("initiatemultipart, domain %d, biz %s, user %d, name %s", inf.Domain, inf.Biz, inf.User, inf.Name)
+	}
+
+	if err := s.partOp.SaveMultipart(m); err != nil {
+		return mf, err
+	}
+
+	mf = func() (interface{}, string) {
+		return &transfer.InitiateMultipartRep{
+				Upload: m.Id.Hex(),
+			},
+			fmt.Sprintf("initiatemultipart, %s", m.String())
+	}
+	return mf, nil
+}
+
+// UploadPart puts a part of a multipart upload. Parts of an upload
+// are independent files until completion, so they can be uploaded
+// in parallel.
+func (s *DFSServer) UploadPart(stream transfer.FileTransfer_UploadPartServer) error {
+	serviceName := "UploadPart"
+	peerAddr := getPeerAddressString(stream.Context())
+
+	return streamFunc(s.uploadPartStream).withStreamDeadline(serviceName, nil, stream, serviceName, peerAddr)
+}
+
+// uploadPartStream receives the content of a part and saves it as a file.
+func (s *DFSServer) uploadPartStream(r interface{}, grpcStream interface{}, args []interface{}) (msgFunc, error) {
+	stream, ok := grpcStream.(transfer.FileTransfer_UploadPartServer)
+	if !ok {
+		return nil, AssertionError
+	}
+
+	serviceName, peerAddr, err := extractStreamFuncParams(args)
+	if err != nil {
+		return nil, err
+	}
+
+	startTime := time.Now()
+
+	req, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	var mf msgFunc
+	mf = func() (interface{}, string) {
+		return nil, fmt.Sprintf("uploadpart, upload %s, domain %d, part %d", req.Upload, req.Domain, req.Number)
+	}
+
+	if req.Domain <= 0 || req.Number < 1 || req.Number > maxPartNumber {
+		return mf, fmt.Errorf("invalid request [%v]", req)
+	}
+	glog.V(3).Infof("%s start, upload %s, part %d, client: %s", serviceName, req.Upload, req.Number, peerAddr)
+
+	m, err := s.lookupMultipart(req.Upload, req.Domain)
+	if err != nil {
+		return mf, err
+	}
+	if len(m.Fid) > 0 {
+		return mf, errUploadCompleting
+	}
+
+	// Size of part is unknown, reject it only if quota used up,
+	// and check again with the real one at the end.
+	if err := s.checkQuota(m.Domain, 0); err != nil {
+		return mf, err
+	}
+
+	number := int(req.Number)
+	info := &transfer.FileInfo{
+		Name:   fmt.Sprintf("%s.part%d", m.Name, number),
+		Domain: m.Domain,
+		User:   m.User,
+		Biz:    m.Biz,
+	}
+	file, handler, err := s.createFile(info, requestChunkSize(req.ChunkSize), stream, startTime)
+	if err != nil {
+		return mf, err
+	}
+
+	throttle := newStreamThrottle(stream.Context(), serviceName, m.Domain, m.Biz)
+	defer throttle.done()
+
+	md5sum := md5.New()
+	sha256sum := sha256.New()
+	var length int64
+	for part := req; ; {
+		if chunk := part.GetChunk(); chunk != nil {
+			if err := throttle.wait(len(chunk.Payload)); err != nil {
+				discardFile(file, handler, peerAddr)
+				return mf, err
+			}
+
+			n, err := file.Write(chunk.Payload)
+			md5sum.Write(chunk.Payload[:n])
+			sha256sum.Write(chunk.Payload[:n])
+			length += int64(n)
+			if err != nil {
+				discardFile(file, handler, peerAddr)
+				return mf, err
+			}
+		}
+
+		part, err = stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			glog.Warningf("UploadPart error, upload %s, part %d, %v", m.Id.Hex(), number, err)
+			discardFile(file, handler, peerAddr)
+			return mf, err
+		}
+	}
+
+	if err := s.checkQuota(m.Domain, length); err != nil {
+		discardFile(file, handler, peerAddr)
+		return mf, err
+	}
+
+	inf := file.GetFileInfo()
+	inf.Size = length
+	inf.Md5 = hex.EncodeToString(md5sum.Sum(nil))
+	inf.Sha256 = hex.EncodeToString(sha256sum.Sum(nil))
+	if err := file.Close(); err != nil {
+		if _, _, er := (*handler).Remove(inf.Id, inf.Domain); er != nil {
+			glog.Warningf("remove error: %v, fid %s, client %s", er, inf.Id, peerAddr)
+		}
+		return mf, err
+	}
+
+	nsecs := time.Since(startTime).Nanoseconds() + 1
+	rate := inf.Size * 8 * 1e6 / nsecs // in kbit/s
+
+	s.saveCreateEvent(inf, (*handler).Name(), nsecs, serviceName, peerAddr)
+	s.saveCreateSpaceLog(inf)
+	instrumentPutFile(inf.Size, rate, serviceName, inf.Biz)
+
+	if err := s.savePart(m, number, inf, peerAddr); err != nil {
+		return mf, err
+	}
+
+	mf = func() (interface{}, string) {
+		return nil, fmt.Sprintf("uploadpart, upload %s, part %d, fid %s, size %d", m.Id.Hex(), number, inf.Id, inf.Size)
+	}
+
+	return mf, stream.SendAndClose(
+		&transfer.UploadPartRep{
+			Number: int32(number),
+			Size:   inf.Size,
+			Md5:    inf.Md5,
+			Sha256: inf.Sha256,
+		})
+}
+
+// CompleteMultipart composes the parts of a multipart upload into one
+// file within the deadline of request, and replies the info of file
+// with md5 and sha256 of the whole content. The upload is being
+// completed by only one request, and can be completed again if failed.
+func (s *DFSServer) CompleteMultipart(ctx context.Context, req *transfer.CompleteMultipartReq) (*transfer.PutFileRep, error) {
+	serviceName := "CompleteMultipart"
+	peerAddr := getPeerAddressString(ctx)
+	glog.V(3).Infof("%s, client: %s, %v", serviceName, peerAddr, req)
+
+	if len(req.Upload) == 0 || req.Domain <= 0 {
+		return nil, fmt.Errorf("invalid request [%v]", req)
+	}
+
+	t, err := bizFunc(s.completeMultipartBiz).withDeadline(serviceName, ctx, req, serviceName, peerAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	result, ok := t.(*transfer.PutFileRep)
+	if ok {
+		return result, nil
+	}
+
+	return nil, AssertionError
+}
+
+func (s *DFSServer) completeMultipartBiz(c interface{}, r interface{}, args []interface{}) (interface{}, error) {
+	req, ok := r.(*transfer.CompleteMultipartReq)
+	if !ok {
+		return nil, AssertionError
+	}
+
+	serviceName, peerAddr, err := extractStreamFuncParams(args)
+	if err != nil {
+		return nil, err
+	}
+
+	var mf msgFunc
+	mf = func() (interface{}, string) {
+		return nil, fmt.Sprintf("completemultipart, upload %s, domain %d", req.Upload, req.Domain)
+	}
+
+	m, err := s.lookupMultipart(req.Upload, req.Domain)
+	if err != nil {
+		return mf, err
+	}
+
+	numbers := make([]int, 0, len(req.Numbers))
+	for _, n := range req.Numbers {
+		numbers = append(numbers, int(n))
+	}
+	parts, err := selectParts(m, numbers)
+	if err != nil {
+		return mf, err
+	}
+
+	fid := bson.NewObjectId().Hex()
+	claimed, err := s.claimMultipart(m, fid, parts)
+	if err == nil && claimed.Fid != fid {
+		err = errUploadCompleting
+	}
+	if err != nil {
+		return mf, err
+	}
+
+	inf, err := s.completeMultipart(c, claimed, parts, serviceName, peerAddr)
+	if err != nil {
+		return mf, err
+	}
+
+	mf = func() (interface{}, string) {
+		return &transfer.PutFileRep{
+				File: inf,
+			},
+			fmt.Sprintf("completemultipart, upload %s, fid %s, domain %d, size %d, biz %s, user %d, name %s", req.Upload, inf.Id, inf.Domain, inf.Size, inf.Biz, inf.User, inf.Name)
+	}
+
+	return mf, nil
+}
+
+// lookupMultipart finds a multipart upload of domain by its id.
+func (s *DFSServer) lookupMultipart(id string, domain int64) (*metadata.Multipart, error) {
+	if !bson.IsObjectIdHex(id) {
+		return nil, errNoSuchUpload
+	}
+
+	m, err := s.partOp.LookupMultipartById(bson.ObjectIdHex(id))
+	if err != nil {
+		return nil, err
+	}
+	if m == nil || m.Domain != domain {
+		return nil, errNoSuchUpload
+	}
+
+	return m, nil
+}
+
+// claimMultipart claims a multipart upload to complete parts into
+// file fid. If it has been claimed, the upload claimed is returned
+// with the fid claimed before.
+func (s *DFSServer) claimMultipart(m *metadata.Multipart, fid string, parts []metadata.Part) (*metadata.Multipart, error) {
+	numbers := make([]int, 0, len(parts))
+	for _, p := range parts {
+		numbers = append(numbers, p.Number)
+	}
+
+	claimed, err := s.partOp.ClaimMultipart(m.Id, fid, numbers)
+	if err == mgo.ErrNotFound {
+		return nil, errNoSuchUpload
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return claimed, nil
+}
+
+// completingFileInfo returns the info of file which parts of
+// a multipart upload are completing into.
+func completingFileInfo(m *metadata.Multipart, parts []metadata.Part) *transfer.FileInfo {
+	var size int64
+	for _, p := range parts {
+		size += p.Size
+	}
+
+	return &transfer.FileInfo{
+		Id:         m.Fid,
+		Name:       m.Name,
+		Domain:     m.Domain,
+		User:       m.User,
+		Biz:        m.Biz,
+		Size:       size,
+		Md5:        m.Md5,
+		Attrs:      m.Attrs,
+		ExpireTime: m.ExpireTime,
+	}
+}
+
+// savePart saves a part stored in file inf into a multipart upload.
+// The file of part replaced is removed.
+func (s *DFSServer) savePart(m *metadata.Multipart, number int, inf *transfer.FileInfo, peerAddr string) error {
+	p := &metadata.Part{
+		Number: number,
+		Fid:    inf.Id,
+		Size:   inf.Size,
+		Md5:    inf.Md5,
+		Sha256: inf.Sha256,
+	}
+
+	old, err := s.partOp.SavePart(m.Id, p)
+	if err != nil {
+		// The upload has been completed, aborted or is completing.
+		s.removePartFile(inf.Id, m.Domain, peerAddr)
+		if err == mgo.ErrNotFound {
+			return errNoSuchUpload
+		}
+		return err
+	}
+
+	if old != nil && old.Fid != p.Fid {
+		s.removePartFile(old.Fid, m.Domain, peerAddr)
+	}
+
+	return nil
+}
+
+// selectParts returns the parts of a multipart upload with the given
+// numbers, which must be in ascending order. If no number given, all
+// the parts are returned.
+func selectParts(m *metadata.Multipart, numbers []int) ([]metadata.Part, error) {
+	if len(numbers) == 0 {
+		parts := m.SortedParts()
+		if len(parts) == 0 {
+			return nil, fmt.Errorf("no part in %s", m.Id.Hex())
+		}
+		return parts, nil
+	}
+
+	parts := make([]metadata.Part, 0, len(numbers))
+	for i, n := range numbers {
+		if i > 0 && n <= numbers[i-1] {
+			return nil, fmt.Errorf("part %d out of order", n)
+		}
+		p, ok := m.Parts[fmt.Sprintf("%d", n)]
+		if !ok {
+			return nil, fmt.Errorf("part %d not found", n)
+		}
+		parts = append(parts, p)
+	}
+
+	return parts, nil
+}
+
+// completeMultipart concatenates the given parts of a multipart upload
+// claimed into file m.Fid, then removes the upload and all its parts.
+// It returns the info of new file with the md5 of whole content. The
+// upload is released on failure, to be completed again.
+func (s *DFSServer) completeMultipart(env interface{}, m *metadata.Multipart, parts []metadata.Part, serviceName string, peerAddr string) (result *transfer.FileInfo, err error) {
+	startTime := time.Now()
+
+	defer func() {
+		if err != nil && err != errNoSuchUpload {
+			if er := s.partOp.ReleaseMultipart(m.Id, m.Fid); er != nil {
+				glog.Warningf("Failed to release %s, %v", m.String(), er)
+			}
+		}
+	}()
+
+	info := completingFileInfo(m, parts)
+	info.Md5 = ""
+	file, handler, err := s.createFile(info, requestChunkSize(0), env, startTime)
+	if err != nil {
+		return nil, err
+	}
+
+	md5sum := md5.New()
+	sha256sum := sha256.New()
+	var length int64
+	for _, p := range parts {
+		n, err := s.copyPart(io.MultiWriter(file, md5sum, sha256sum), p, m.Domain)
+		length += n
+		if err == nil && n != p.Size {
+			err = fmt.Errorf("size of part %d mismatch, %d != %d", p.Number, n, p.Size)
+		}
+		if err != nil {
+			discardFile(file, handler, peerAddr)
+			return nil, err
+		}
+	}
+	file.GetFileInfo().Size = length
+
+	md5hex := hex.EncodeToString(md5sum.Sum(nil))
+	if err := verifyContent(m.Size, m.Md5, length, md5hex); err != nil {
+		s.rollbackPutFile(file, handler, err, peerAddr)
+		return nil, err
+	}
+
+	inf := file.GetFileInfo()
+	removeNewFile := func() {
+		if _, _, er := (*handler).Remove(inf.Id, inf.Domain); er != nil {
+			glog.Warningf("remove error: %v, fid %s, client %s", er, inf.Id, peerAddr)
+		}
+	}
+
+	if err := file.Close(); err != nil {
+		removeNewFile()
+		return nil, err
+	}
+
+	// Remove the upload, which is completed only once.
+	if err := s.partOp.RemoveMultipartById(m.Id); err != nil {
+		removeNewFile()
+		if err == mgo.ErrNotFound {
+			return nil, errNoSuchUpload
+		}
+		return nil, err
+	}
+
+	inf.Md5 = md5hex
+	inf.Sha256 = hex.EncodeToString(sha256sum.Sum(nil))
+	nsecs := time.Since(startTime).Nanoseconds() + 1
+	rate := inf.Size * 8 * 1e6 / nsecs // in kbit/s
+
+	s.saveCreateEvent(inf, (*handler).Name(), nsecs, serviceName, peerAddr)
+	s.saveCreateSpaceLog(inf)
+	s.saveExpiry(inf)
+	instrumentPutFile(inf.Size, rate, serviceName, inf.Biz)
+
+	for _, p := range m.Parts {
+		s.removePartFile(p.Fid, m.Domain, peerAddr)
+	}
+
+	glog.V(3).Infof("%s, succeeded to complete %s into %s", serviceName, m.String(), inf.Id)
+	return inf, nil
+}
+
+// abortMultipart removes a multipart upload and all its parts.
+func (s *DFSServer) abortMultipart(m *metadata.Multipart, peerAddr string) error {
+	if err := s.partOp.RemoveMultipartById(m.Id); err != nil {
+		if err == mgo.ErrNotFound {
+			return errNoSuchUpload
+		}
+		return err
+	}
+
+	for _, p := range m.Parts {
+		s.removePartFile(p.Fid, m.Domain, peerAddr)
+	}
+
+	glog.V(3).Infof("Succeeded to abort %s", m.String())
+	return nil
+}
+
+// copyPart copies the content of a part into w.
+func (s *DFSServer) copyPart(w io.Writer, p metadata.Part, domain int64) (int64, error) {
+	_, file, err := s.openFileForRead(p.Fid, domain)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	return io.Copy(w, file)
+}
+
+// removePartFile removes the file of a part, bypassing trash bin.
+func (s *DFSServer) removePartFile(fid string, domain int64, peerAddr string) {
+	if _, _, err := s.removeFile(fid, domain, peerAddr, time.Now()); err != nil {
+		glog.Warningf("Failed to remove part file %s, domain %d, %v", fid, domain, err)
+	}
+}
+
+// discardFile closes a file being written and removes it.
+func discardFile(file fileop.DFSFile, handler *fileop.DFSFileHandler, peerAddr string) {
+	inf := file.GetFileInfo()
+
+	if err := file.Close(); err != nil {
+		glog.Warningf("close error: %v, fid %s, client %s", err, inf.Id, peerAddr)
+	}
+	if _, _, err := (*handler).Remove(inf.Id, inf.Domain); err != nil {
+		glog.Warningf("remove error: %v, fid %s, client %s", err, inf.Id, peerAddr)
+	}
+}
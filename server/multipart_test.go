@@ -0,0 +1,289 @@
+package server
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"gopkg.in/mgo.v2/bson"
+
+	"jingoal.com/dfs/metadata"
+	"jingoal.com/dfs/proto/transfer"
+)
+
+func TestSelectParts(t *testing.T) {
+	m := &metadata.Multipart{
+		Parts: map[string]metadata.Part{
+			"3": {Number: 3, Fid: "c"},
+			"1": {Number: 1, Fid: "a"},
+			"2": {Number: 2, Fid: "b"},
+		},
+	}
+
+	cases := []struct {
+		numbers []int
+		fids    string
+		ok      bool
+	}{
+		{nil, "abc", true},
+		{[]int{1, 3}, "ac", true},
+		{[]int{2}, "b", true},
+		{[]int{3, 1}, "", false},
+		{[]int{1, 1}, "", false},
+		{[]int{1, 4}, "", false},
+	}
+
+	for i, c := range cases {
+		parts, err := selectParts(m, c.numbers)
+		if (err == nil) != c.ok {
+			t.Errorf("case %d, expected ok %t, got %v", i, c.ok, err)
+			continue
+		}
+
+		fids := ""
+		for _, p := range parts {
+			fids += p.Fid
+		}
+		if fids != c.fids {
+			t.Errorf("case %d, expected %s, got %s", i, c.fids, fids)
+		}
+	}
+
+	if _, err := selectParts(&metadata.Multipart{}, nil); err == nil {
+		t.Errorf("expected error for upload without part")
+	}
+}
+
+type uploadPartStream struct {
+	grpc.ServerStream
+	reqs []*transfer.UploadPartReq
+	rep  *transfer.UploadPartRep
+}
+
+func (s *uploadPartStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *uploadPartStream) Recv() (*transfer.UploadPartReq, error) {
+	if len(s.reqs) == 0 {
+		return nil, io.EOF
+	}
+	req := s.reqs[0]
+	s.reqs = s.reqs[1:]
+	return req, nil
+}
+
+func (s *uploadPartStream) SendAndClose(rep *transfer.UploadPartRep) error {
+	s.rep = rep
+	return nil
+}
+
+// uploadPart uploads content as part number of upload in two chunks.
+func uploadPart(s *DFSServer, upload string, domain int64, number int32, content []byte) (*transfer.UploadPartRep, error) {
+	half := len(content) / 2
+	stream := &uploadPartStream{
+		reqs: []*transfer.UploadPartReq{
+			{
+				Upload: upload,
+				Domain: domain,
+				Number: number,
+				Chunk:  &transfer.Chunk{Pos: 0, Length: int64(half), Payload: content[:half]},
+			},
+			{
+				Chunk: &transfer.Chunk{Pos: int64(half), Length: int64(len(content) - half), Payload: content[half:]},
+			},
+		},
+	}
+	if err := s.UploadPart(stream); err != nil {
+		return nil, err
+	}
+
+	return stream.rep, nil
+}
+
+func initiateMultipart(t *testing.T, s *DFSServer, info *transfer.FileInfo) string {
+	rep, err := s.InitiateMultipart(context.Background(), &transfer.InitiateMultipartReq{Info: info})
+	if err != nil {
+		t.Fatalf("InitiateMultipart error %v", err)
+	}
+
+	return rep.Upload
+}
+
+// fileExists returns true if the file of fid is found in the test shard.
+func fileExists(t *testing.T, s *DFSServer, fid string) bool {
+	h := s.selector.shardHandlers[testShardName].handler
+	id, _, _, err := h.Find(fid)
+	if err != nil {
+		t.Fatalf("Find error %v", err)
+	}
+
+	return id != ""
+}
+
+func TestUploadPartReplacement(t *testing.T) {
+	s := newTestServer(t)
+	domain := testDomain()
+	upload := initiateMultipart(t, s, &transfer.FileInfo{Domain: domain, Name: "replace.txt", Biz: "unit-test"})
+
+	first, err := uploadPart(s, upload, domain, 1, []byte("first content"))
+	if err != nil {
+		t.Fatalf("UploadPart error %v", err)
+	}
+	if first.Number != 1 || first.Size != 13 || len(first.Md5) == 0 || len(first.Sha256) == 0 {
+		t.Errorf("unexpected reply %v", first)
+	}
+	m, err := s.lookupMultipart(upload, domain)
+	if err != nil {
+		t.Fatalf("lookupMultipart error %v", err)
+	}
+	oldFid := m.Parts["1"].Fid
+
+	second, err := uploadPart(s, upload, domain, 1, []byte("second content"))
+	if err != nil {
+		t.Fatalf("UploadPart error %v", err)
+	}
+	if second.Md5 == first.Md5 {
+		t.Errorf("expected md5 of the second part")
+	}
+
+	m, err = s.lookupMultipart(upload, domain)
+	if err != nil {
+		t.Fatalf("lookupMultipart error %v", err)
+	}
+	p := m.Parts["1"]
+	if len(m.Parts) != 1 || p.Fid == oldFid || p.Md5 != second.Md5 || p.Sha256 != second.Sha256 {
+		t.Errorf("expected part replaced, got %v", m.Parts)
+	}
+	if fileExists(t, s, oldFid) {
+		t.Errorf("expected file of replaced part %s removed", oldFid)
+	}
+
+	// A part of another domain is rejected.
+	if _, err := uploadPart(s, upload, domain+1, 2, []byte("content")); err == nil {
+		t.Errorf("expected error of uploading part to another domain")
+	}
+}
+
+func TestCompleteMultipart(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	domain := testDomain()
+	upload := initiateMultipart(t, s, &transfer.FileInfo{Domain: domain, Name: "complete.txt", Biz: "unit-test"})
+
+	contents := [][]byte{[]byte("part one, "), []byte("part two, "), []byte("part three")}
+	for i := len(contents) - 1; i >= 0; i-- { // parts in any order.
+		if _, err := uploadPart(s, upload, domain, int32(i+1), contents[i]); err != nil {
+			t.Fatalf("UploadPart error %v", err)
+		}
+	}
+	m, err := s.lookupMultipart(upload, domain)
+	if err != nil {
+		t.Fatalf("lookupMultipart error %v", err)
+	}
+
+	rep, err := s.CompleteMultipart(ctx, &transfer.CompleteMultipartReq{Upload: upload, Domain: domain, Numbers: []int32{1, 3}})
+	if err != nil {
+		t.Fatalf("CompleteMultipart error %v", err)
+	}
+	content := append(append([]byte{}, contents[0]...), contents[2]...)
+	md5sum := md5.Sum(content)
+	if rep.File.Size != int64(len(content)) || rep.File.Name != "complete.txt" || rep.File.Md5 != hex.EncodeToString(md5sum[:]) || len(rep.File.Sha256) == 0 {
+		t.Errorf("unexpected reply %v", rep.File)
+	}
+
+	// The file is found once replied.
+	info, got, err := getFile(s, &transfer.GetFileReq{Id: rep.File.Id, Domain: domain})
+	if err != nil {
+		t.Fatalf("GetFile error %v", err)
+	}
+	if !bytes.Equal(got, content) || info.Size != int64(len(content)) {
+		t.Errorf("expected content of parts 1 and 3, got %q", got)
+	}
+
+	// The upload and all its parts are removed.
+	if _, err := s.lookupMultipart(upload, domain); err != errNoSuchUpload {
+		t.Errorf("expected upload removed, got %v", err)
+	}
+	for _, p := range m.Parts {
+		if fileExists(t, s, p.Fid) {
+			t.Errorf("expected file of part %d removed", p.Number)
+		}
+	}
+	if _, err := s.CompleteMultipart(ctx, &transfer.CompleteMultipartReq{Upload: upload, Domain: domain}); err == nil {
+		t.Errorf("expected error of completing an upload completed")
+	}
+}
+
+func TestClaimMultipart(t *testing.T) {
+	s := newTestServer(t)
+	domain := testDomain()
+	upload := initiateMultipart(t, s, &transfer.FileInfo{Domain: domain, Name: "claim.txt", Biz: "unit-test"})
+	if _, err := uploadPart(s, upload, domain, 1, []byte("content")); err != nil {
+		t.Fatalf("UploadPart error %v", err)
+	}
+	m, err := s.lookupMultipart(upload, domain)
+	if err != nil {
+		t.Fatalf("lookupMultipart error %v", err)
+	}
+	parts := m.SortedParts()
+
+	fid := bson.NewObjectId().Hex()
+	claimed, err := s.claimMultipart(m, fid, parts)
+	if err != nil || claimed.Fid != fid {
+		t.Fatalf("expected upload claimed, %v", err)
+	}
+
+	// Claimed only once, and no part is accepted then.
+	again, err := s.claimMultipart(m, bson.NewObjectId().Hex(), parts)
+	if err != nil || again.Fid != fid {
+		t.Errorf("expected upload claimed before, got %v", err)
+	}
+	if _, err := uploadPart(s, upload, domain, 2, []byte("content")); err != errUploadCompleting {
+		t.Errorf("expected errUploadCompleting, got %v", err)
+	}
+	if _, err := s.CompleteMultipart(context.Background(), &transfer.CompleteMultipartReq{Upload: upload, Domain: domain}); err == nil {
+		t.Errorf("expected error of completing an upload being completed")
+	}
+
+	// Released to be completed again.
+	if err := s.partOp.ReleaseMultipart(m.Id, fid); err != nil {
+		t.Fatalf("ReleaseMultipart error %v", err)
+	}
+	if _, err := uploadPart(s, upload, domain, 2, []byte("content")); err != nil {
+		t.Errorf("UploadPart error %v", err)
+	}
+}
+
+func TestAbortMultipart(t *testing.T) {
+	s := newTestServer(t)
+	domain := testDomain()
+	upload := initiateMultipart(t, s, &transfer.FileInfo{Domain: domain, Name: "abort.txt", Biz: "unit-test"})
+	if _, err := uploadPart(s, upload, domain, 1, []byte("content to abort")); err != nil {
+		t.Fatalf("UploadPart error %v", err)
+	}
+	m, err := s.lookupMultipart(upload, domain)
+	if err != nil {
+		t.Fatalf("lookupMultipart error %v", err)
+	}
+
+	if err := s.abortMultipart(m, "unit-test"); err != nil {
+		t.Fatalf("abortMultipart error %v", err)
+	}
+	if fileExists(t, s, m.Parts["1"].Fid) {
+		t.Errorf("expected file of part removed")
+	}
+	if err := s.abortMultipart(m, "unit-test"); err != errNoSuchUpload {
+		t.Errorf("expected errNoSuchUpload, got %v", err)
+	}
+	if _, err := uploadPart(s, upload, domain, 2, []byte("content")); err != errNoSuchUpload {
+		t.Errorf("expected errNoSuchUpload, got %v", err)
+	}
+	if _, err := s.CompleteMultipart(context.Background(), &transfer.CompleteMultipartReq{Upload: upload, Domain: domain}); err == nil {
+		t.Errorf("expected error of completing an upload aborted")
+	}
+}
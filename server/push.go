@@ -11,11 +11,15 @@ import (
 
 // GetDfsServers gets a list of DfsServer from server.
 func (s *DFSServer) GetDfsServers(req *discovery.GetDfsServersReq, stream discovery.DiscoveryService_GetDfsServersServer) error {
-	clientId := strings.Join([]string{req.GetClient().Id, getPeerAddressString(stream.Context())}, "/")
+	peerAddr := getPeerAddressString(stream.Context())
+	clientId := strings.Join([]string{req.GetClient().Id, peerAddr}, "/")
 
 	observer := make(chan struct{}, 100)
 	s.register.AddObserver(observer, clientId)
 
+	peerClients.add(peerAddr, req.GetClient().Id)
+	defer peerClients.remove(peerAddr, req.GetClient().Id)
+
 	glog.Infof("Client %s connected.", clientId)
 
 	ticker := time.NewTicker(time.Duration(*heartbeatInterval) * time.Second)
@@ -1,6 +1,9 @@
 package server
 
 import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -8,6 +11,7 @@ import (
 
 	"github.com/golang/glog"
 
+	"jingoal.com/dfs/conf"
 	"jingoal.com/dfs/fileop"
 	"jingoal.com/dfs/instrument"
 	"jingoal.com/dfs/metadata"
@@ -29,6 +33,12 @@ func (s *DFSServer) putFileStream(r interface{}, grpcStream interface{}, args []
 	var file fileop.DFSFile
 	var length int
 	var handler *fileop.DFSFileHandler
+	var declaredSize int64
+	var declaredMd5 string
+	var throttle *streamThrottle
+
+	md5sum := md5.New()
+	sha256sum := sha256.New()
 
 	stream, ok := grpcStream.(transfer.FileTransfer_PutFileServer)
 	if !ok {
@@ -58,6 +68,42 @@ func (s *DFSServer) putFileStream(r interface{}, grpcStream interface{}, args []
 					})
 			}
 
+			md5hex := hex.EncodeToString(md5sum.Sum(nil))
+			if err := verifyContent(declaredSize, declaredMd5, int64(length), md5hex); err != nil {
+				s.rollbackPutFile(file, handler, err, peerAddr)
+				file = nil // closed by rollback.
+				return mf, err
+			}
+
+			// Size declared may be absent, check quota with the real one.
+			if int64(length) > declaredSize {
+				if err := s.checkQuota(reqInfo.Domain, int64(length)); err != nil {
+					discardFile(file, handler, peerAddr)
+					file = nil // closed by discard.
+					return mf, err
+				}
+			}
+
+			sha256hex := hex.EncodeToString(sha256sum.Sum(nil))
+			file.GetFileInfo().Md5 = md5hex
+			file.GetFileInfo().Sha256 = sha256hex
+
+			if length > 0 && conf.IsDedupEnabled(reqInfo.Domain) {
+				if inf, ok := s.dedupPutFile(file, handler, md5hex, sha256hex, startTime, serviceName, peerAddr); ok {
+					file = nil // closed by dedup.
+					s.saveExpiry(inf)
+
+					mf = func() (interface{}, string) {
+						return nil, fmt.Sprintf("putfile dedup, fid %s, domain %d, size %d, biz %s, user %d, name %s", inf.Id, inf.Domain, inf.Size, inf.Biz, inf.User, inf.Name)
+					}
+
+					return mf, stream.SendAndClose(
+						&transfer.PutFileRep{
+							File: inf,
+						})
+				}
+			}
+
 			err := s.finishPutFile(file, handler, stream, startTime, serviceName, peerAddr)
 			if err != nil {
 				glog.Warningf("PutFile error, %v", err)
@@ -80,31 +126,61 @@ func (s *DFSServer) putFileStream(r interface{}, grpcStream interface{}, args []
 			return mf, err
 		}
 
+		if file == nil && len(req.Session) > 0 {
+			return s.putUploadStream(req, stream, startTime, serviceName, peerAddr)
+		}
+
 		if file == nil {
 			reqInfo = req.GetInfo()
 			if reqInfo == nil {
 				glog.Warningf("PutFile error, no file info")
 				return mf, errors.New("PutFile error: no file info")
 			}
+			if err = checkAttributes(reqInfo.Attrs, false); err != nil {
+				return mf, err
+			}
+			if err = checkExpireTime(reqInfo, req.Ttl); err != nil {
+				return mf, err
+			}
+			if err = s.checkQuota(reqInfo.Domain, reqInfo.Size); err != nil {
+				return mf, err
+			}
 			glog.V(3).Infof("%s start, file info: %v, client: %s", serviceName, reqInfo, peerAddr)
 
+			// Keep what client declared, since reqInfo may be
+			// updated by the file during writing.
+			declaredSize = reqInfo.Size
+			declaredMd5 = reqInfo.Md5
+
 			mf = func() (interface{}, string) {
 				return nil, fmt.Sprintf("putfile, name %s, domain %d, size %d, biz %s, user %d", reqInfo.Name, reqInfo.Domain, reqInfo.Size, reqInfo.Biz, reqInfo.User)
 			}
 
-			file, handler, err = s.createFile(reqInfo, stream, startTime)
+			file, handler, err = s.createFile(reqInfo, requestChunkSize(req.ChunkSize), stream, startTime)
 			if err != nil {
 				return mf, err
 			}
 			defer func() {
-				er = file.Close()
+				if file != nil {
+					er = file.Close()
+				}
 			}()
+
+			throttle = newStreamThrottle(stream.Context(), serviceName, reqInfo.Domain, reqInfo.Biz)
+			defer throttle.done()
 		}
 
-		csize, err = file.Write(req.GetChunk().Payload[:])
+		payload := req.GetChunk().Payload
+		csize, err = file.Write(payload[:])
 		if err != nil {
 			return mf, err
 		}
+		md5sum.Write(payload[:csize])
+		sha256sum.Write(payload[:csize])
+
+		if err = throttle.wait(csize); err != nil {
+			return mf, err
+		}
 
 		length += csize
 		file.GetFileInfo().Size = int64(length)
@@ -127,30 +203,43 @@ func (s *DFSServer) finishPutFile(file fileop.DFSFile, handler *fileop.DFSFileHa
 		glog.V(3).Infof("PutFile, succeeded to finish file: %s, elapse %d, rate %d kbit/s\n", inf, nsecs, rate)
 	}()
 
-	// save a event for create file ok.
+	s.saveCreateEvent(inf, (*handler).Name(), nsecs, serviceName, peerAddr)
+
+	err = stream.SendAndClose(
+		&transfer.PutFileRep{
+			File: inf,
+		})
+	if err != nil {
+		err = fmt.Errorf("send receipt error: %v, client %s", err, peerAddr)
+		return
+	}
+
+	s.saveCreateSpaceLog(inf)
+	s.saveExpiry(inf)
+
+	instrumentPutFile(inf.Size, rate, serviceName, inf.Biz)
+	return
+}
+
+// saveCreateEvent saves a event for create file ok.
+func (s *DFSServer) saveCreateEvent(inf *transfer.FileInfo, handlerName string, nsecs int64, serviceName string, peerAddr string) {
 	event := &metadata.Event{
 		EType:     metadata.SucCreate,
 		Timestamp: util.GetTimeInMilliSecond(),
 		Domain:    inf.Domain,
 		Fid:       inf.Id,
 		Elapse:    nsecs,
-		Description: fmt.Sprintf("%s[PutFile], client: %s, dst: %s, size: %d",
-			metadata.SucCreate.String(), peerAddr, (*handler).Name(), inf.Size),
+		Description: fmt.Sprintf("%s[%s], client: %s, dst: %s, size: %d",
+			metadata.SucCreate.String(), serviceName, peerAddr, handlerName, inf.Size),
 	}
 	if er := s.eventOp.SaveEvent(event); er != nil {
 		// log into file instead return.
 		glog.Warningf("%s, error: %v", event.String(), er)
 	}
+}
 
-	err = stream.SendAndClose(
-		&transfer.PutFileRep{
-			File: inf,
-		})
-	if err != nil {
-		err = fmt.Errorf("send receipt error: %v, client %s", err, peerAddr)
-		return
-	}
-
+// saveCreateSpaceLog saves a space log for create file ok.
+func (s *DFSServer) saveCreateSpaceLog(inf *transfer.FileInfo) {
 	slog := &metadata.SpaceLog{
 		Domain:    inf.Domain,
 		Uid:       fmt.Sprintf("%d", inf.User),
@@ -163,15 +252,12 @@ func (s *DFSServer) finishPutFile(file fileop.DFSFile, handler *fileop.DFSFileHa
 	if er := s.spaceOp.SaveSpaceLog(slog); er != nil {
 		glog.Warningf("%s, error: %v", slog.String(), er)
 	}
-
-	instrumentPutFile(inf.Size, rate, serviceName, inf.Biz)
-	return
 }
 
-func (s *DFSServer) createFile(reqInfo *transfer.FileInfo, stream transfer.FileTransfer_PutFileServer, startTime time.Time) (fileop.DFSFile, *fileop.DFSFileHandler, error) {
+func (s *DFSServer) createFile(reqInfo *transfer.FileInfo, chunkSize int64, env interface{}, startTime time.Time) (fileop.DFSFile, *fileop.DFSFileHandler, error) {
 	// check timeout, for test.
 	if *enablePreJudge {
-		if dl, ok := getDeadline(stream); ok {
+		if dl, ok := getDeadline(env); ok {
 			given := dl.Sub(startTime)
 			expected, err := checkTimeout(reqInfo.Size, wRate, given)
 			if err != nil {
@@ -190,7 +276,7 @@ func (s *DFSServer) createFile(reqInfo *transfer.FileInfo, stream transfer.FileT
 		return nil, nil, err
 	}
 
-	file, err := (*handler).Create(reqInfo)
+	file, err := fileop.CreateWithChunkSize(*handler, reqInfo, chunkSize)
 	if err != nil {
 		return nil, nil, err
 	}
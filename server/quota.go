@@ -0,0 +1,124 @@
+package server
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/transport"
+
+	"jingoal.com/dfs/conf"
+	"jingoal.com/dfs/proto/transfer"
+)
+
+var (
+	domainQuota  conf.DomainSize
+	rebuildUsage = flag.Bool("rebuild-usage", false, "true for rebuilding usages of domains with quota from space logs at start, once when files of them are not being stored.")
+)
+
+func init() {
+	flag.Var(&domainQuota, "domain-quota", "quota of storage per domain, in the form of 'domain:size,domain:size', such as '1001:500G', a domain not set is unlimited.")
+}
+
+// rebuildUsages rebuilds usages of the domains with quota from their
+// space logs, failures are only logged.
+func (s *DFSServer) rebuildUsages() {
+	for _, domain := range domainQuota.Domains() {
+		if _, err := s.spaceOp.RebuildUsage(domain); err != nil {
+			glog.Warningf("Failed to rebuild usage of domain %d, %v", domain, err)
+		}
+	}
+}
+
+// quotaExceededError returns an error with code ResourceExhausted.
+func quotaExceededError(domain int64, usage int64, quota int64, size int64) error {
+	return transport.StreamError{
+		Code: codes.ResourceExhausted,
+		Desc: fmt.Sprintf("quota of domain %d exceeded, usage %d, quota %d, size %d", domain, usage, quota, size),
+	}
+}
+
+// isQuotaExceeded returns true if err is caused by quota exceeded.
+func isQuotaExceeded(err error) bool {
+	se, ok := err.(transport.StreamError)
+	return ok && se.Code == codes.ResourceExhausted
+}
+
+// checkQuota returns an error with code ResourceExhausted if storing
+// size bytes more would exceed the quota of domain. Usage failed to
+// look up does not block storing, it is only logged.
+func (s *DFSServer) checkQuota(domain int64, size int64) error {
+	quota, ok := domainQuota.Get(domain)
+	if !ok {
+		return nil
+	}
+
+	u, err := s.spaceOp.LookupUsage(domain)
+	if err != nil {
+		glog.Warningf("Failed to lookup usage of domain %d, %v", domain, err)
+		return nil
+	}
+
+	if u.Size+size > quota {
+		glog.Warningf("Quota of domain %d exceeded, usage %d, quota %d, size %d", domain, u.Size, quota, size)
+		return quotaExceededError(domain, u.Size, quota, size)
+	}
+
+	return nil
+}
+
+// GetUsage returns the storage usage and quota of a domain.
+func (s *DFSServer) GetUsage(ctx context.Context, req *transfer.GetUsageReq) (*transfer.GetUsageRep, error) {
+	serviceName := "GetUsage"
+	peerAddr := getPeerAddressString(ctx)
+	glog.V(3).Infof("%s, client: %s, %v", serviceName, peerAddr, req)
+
+	if req.Domain <= 0 {
+		return nil, fmt.Errorf("invalid request [%v]", req)
+	}
+
+	t, err := bizFunc(s.getUsageBiz).withDeadline(serviceName, ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	result, ok := t.(*transfer.GetUsageRep)
+	if ok {
+		return result, nil
+	}
+
+	return nil, AssertionError
+}
+
+func (s *DFSServer) getUsageBiz(c interface{}, r interface{}, args []interface{}) (interface{}, error) {
+	req, ok := r.(*transfer.GetUsageReq)
+	if !ok {
+		return nil, AssertionError
+	}
+
+	var rep *transfer.GetUsageRep
+	var mf msgFunc
+	mf = func() (interface{}, string) {
+		return rep, fmt.Sprintf("getusage, domain %d", req.Domain)
+	}
+
+	u, err := s.spaceOp.LookupUsage(req.Domain)
+	if err != nil {
+		return mf, err
+	}
+
+	quota, _ := domainQuota.Get(req.Domain)
+	rep = &transfer.GetUsageRep{
+		Domain: u.Domain,
+		Size:   u.Size,
+		Files:  u.Files,
+		Quota:  quota,
+	}
+	mf = func() (interface{}, string) {
+		return rep, fmt.Sprintf("getusage, %s, quota %d", u.String(), quota)
+	}
+
+	return mf, nil
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"jingoal.com/dfs/proto/transfer"
+)
+
+func TestIsQuotaExceeded(t *testing.T) {
+	if !isQuotaExceeded(quotaExceededError(2, 100, 120, 30)) {
+		t.Errorf("expected quota exceeded")
+	}
+	if isQuotaExceeded(errors.New("quota exceeded")) {
+		t.Errorf("expected plain error not quota exceeded")
+	}
+}
+
+// waitUsage waits for the usage of domain to be size, since space
+// logs may be saved asynchronously.
+func waitUsage(t *testing.T, s *DFSServer, domain int64, size int64) {
+	var got int64
+	for i := 0; i < 50; i++ {
+		u, err := s.spaceOp.LookupUsage(domain)
+		if err != nil {
+			t.Fatalf("LookupUsage error %v", err)
+		}
+		if got = u.Size; got == size {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Errorf("expected usage %d, got %d", size, got)
+}
+
+func TestDuplicationUsage(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	domain := testDomain()
+
+	content := []byte("content charged for every duplication")
+	size := int64(len(content))
+	inf, err := putFile(s, &transfer.FileInfo{Domain: domain, Name: "usage.txt", Biz: "unit-test"}, content, 1024)
+	if err != nil {
+		t.Fatalf("PutFile error %v", err)
+	}
+	waitUsage(t, s, domain, size)
+
+	if _, err := s.GetByMd5(ctx, &transfer.GetByMd5Req{Md5: inf.Md5, Domain: domain, Size: size}); err != nil {
+		t.Fatalf("GetByMd5 error %v", err)
+	}
+	waitUsage(t, s, domain, 2*size)
+
+	if _, err := s.GetBySha256(ctx, &transfer.GetBySha256Req{Sha256: inf.Sha256, Domain: domain, Size: size}); err != nil {
+		t.Fatalf("GetBySha256 error %v", err)
+	}
+	waitUsage(t, s, domain, 3*size)
+}
+
+func TestRemoveUsage(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	domain := testDomain()
+	defer enableDedup(t, domain)()
+
+	content := []byte("content given back on every removal")
+	size := int64(len(content))
+	first, err := putFile(s, &transfer.FileInfo{Domain: domain, Name: "first.txt", Biz: "unit-test"}, content, 1024)
+	if err != nil {
+		t.Fatalf("PutFile error %v", err)
+	}
+	second, err := putFile(s, &transfer.FileInfo{Domain: domain, Name: "second.txt", Biz: "unit-test"}, content, 1024)
+	if err != nil {
+		t.Fatalf("PutFile error %v", err)
+	}
+	if second.Id == first.Id {
+		t.Fatalf("expected a duplication of %s", first.Id)
+	}
+	waitUsage(t, s, domain, 2*size)
+
+	dupl, err := s.Duplicate(ctx, &transfer.DuplicateReq{Id: first.Id, Domain: domain})
+	if err != nil {
+		t.Fatalf("Duplicate error %v", err)
+	}
+	waitUsage(t, s, domain, 3*size)
+
+	// The entity is removed first, which is kept for its duplications.
+	for _, id := range []string{first.Id, second.Id, dupl.Id} {
+		if _, err := s.RemoveFile(ctx, &transfer.RemoveFileReq{Id: id, Domain: domain}); err != nil {
+			t.Fatalf("RemoveFile %s error %v", id, err)
+		}
+	}
+	waitUsage(t, s, domain, 0)
+}
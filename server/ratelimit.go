@@ -0,0 +1,200 @@
+package server
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/transport"
+
+	"jingoal.com/dfs/conf"
+	"jingoal.com/dfs/instrument"
+	"jingoal.com/dfs/proto/transfer"
+	"jingoal.com/dfs/util"
+)
+
+var (
+	rateLimitPeer   conf.RateLimit
+	rateLimitClient conf.RateLimit
+	rateLimitDomain conf.RateLimit
+
+	peerLimiter   = util.NewRateLimiter(limitOf(&rateLimitPeer))
+	clientLimiter = util.NewRateLimiter(limitOf(&rateLimitClient))
+	domainLimiter = util.NewRateLimiter(limitOf(&rateLimitDomain))
+
+	peerClients = &clientRegistry{
+		m: make(map[string]string),
+	}
+)
+
+func init() {
+	flag.Var(&rateLimitPeer, "rate-limit-peer", "requests per second by peer ip, in the form of 'rate:burst,ip=rate:burst', empty for unlimited.")
+	flag.Var(&rateLimitClient, "rate-limit-client", "requests per second by client id, in the form of 'rate:burst,id=rate:burst', empty for unlimited.")
+	flag.Var(&rateLimitDomain, "rate-limit-domain", "requests per second by domain, in the form of 'rate:burst,domain=rate:burst', empty for unlimited.")
+}
+
+func limitOf(r *conf.RateLimit) func(string) (float64, int) {
+	return func(key string) (float64, int) {
+		l := r.Get(key)
+		return l.Rate, l.Burst
+	}
+}
+
+// clientRegistry holds the client ids of peers, which are learned
+// from the clients connected to discovery service.
+type clientRegistry struct {
+	lock sync.RWMutex
+	m    map[string]string // peer ip -> client id
+}
+
+func (r *clientRegistry) add(peerAddr string, id string) {
+	if len(id) == 0 {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.m[peerHost(peerAddr)] = id
+}
+
+func (r *clientRegistry) remove(peerAddr string, id string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	host := peerHost(peerAddr)
+	if r.m[host] == id {
+		delete(r.m, host)
+	}
+}
+
+func (r *clientRegistry) get(peerAddr string) string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.m[peerHost(peerAddr)]
+}
+
+// peerHost returns the ip of a peer address, since a client
+// connects from different ports.
+func peerHost(peerAddr string) string {
+	if i := strings.LastIndex(peerAddr, "@"); i >= 0 {
+		peerAddr = peerAddr[i+1:]
+	}
+
+	host, _, err := net.SplitHostPort(peerAddr)
+	if err != nil {
+		return peerAddr
+	}
+
+	return host
+}
+
+// LimitRequest rejects a request with code ResourceExhausted if it
+// exceeds the rate limit of its peer, client or domain.
+// It implements util.LimitFunc.
+func LimitRequest(ctx context.Context, method string, req interface{}) error {
+	peerAddr := getPeerAddressString(ctx)
+	host := peerHost(peerAddr)
+
+	if !peerLimiter.Allow(host) {
+		return rateLimited(method, "peer", host, peerAddr)
+	}
+
+	clientId := requestClient(req)
+	if len(clientId) == 0 {
+		clientId = peerClients.get(peerAddr)
+	}
+	if len(clientId) > 0 && !clientLimiter.Allow(clientId) {
+		return rateLimited(method, "client", clientId, peerAddr)
+	}
+
+	if domain := requestDomain(req); domain > 0 {
+		d := strconv.FormatInt(domain, 10)
+		if !domainLimiter.Allow(d) {
+			return rateLimited(method, "domain", d, peerAddr)
+		}
+	}
+
+	return nil
+}
+
+func rateLimited(method string, kind string, key string, peerAddr string) error {
+	serviceName := path.Base(method)
+
+	instrument.RateLimited <- &instrument.Measurements{
+		Name:  serviceName,
+		Biz:   kind,
+		Value: 1.0,
+	}
+	glog.Warningf("%s rate limited, %s %s, client %s", serviceName, kind, key, peerAddr)
+
+	return transport.StreamError{
+		Code: codes.ResourceExhausted,
+		Desc: fmt.Sprintf("rate limit of %s %s exceeded", kind, key),
+	}
+}
+
+// requestClient returns the client id carried by request, if any.
+func requestClient(req interface{}) string {
+	if r, ok := req.(*transfer.RemoveFileReq); ok && r.GetDesc() != nil {
+		return r.GetDesc().Desc
+	}
+
+	return ""
+}
+
+// requestDomain returns the domain a request works on,
+// 0 for the requests without domain.
+func requestDomain(req interface{}) int64 {
+	switch r := req.(type) {
+	case *transfer.PutFileReq:
+		if r.GetInfo() != nil {
+			return r.GetInfo().Domain
+		}
+	case *transfer.GetFileReq:
+		return r.Domain
+	case *transfer.RemoveFileReq:
+		return r.Domain
+	case *transfer.DuplicateReq:
+		return r.Domain
+	case *transfer.ExistReq:
+		return r.Domain
+	case *transfer.GetByMd5Req:
+		return r.Domain
+	case *transfer.GetBySha256Req:
+		return r.Domain
+	case *transfer.CopyReq:
+		return r.DstDomain
+	case *transfer.StartUploadReq:
+		if r.GetInfo() != nil {
+			return r.GetInfo().Domain
+		}
+	case *transfer.CommitUploadReq:
+		return r.Domain
+	case *transfer.ListFilesReq:
+		return r.Domain
+	case *transfer.UpdateAttributesReq:
+		return r.Domain
+	case *transfer.RestoreFileReq:
+		return r.Domain
+	case *transfer.InitiateMultipartReq:
+		if r.GetInfo() != nil {
+			return r.GetInfo().Domain
+		}
+	case *transfer.UploadPartReq:
+		return r.Domain
+	case *transfer.CompleteMultipartReq:
+		return r.Domain
+	case *transfer.GetUsageReq:
+		return r.Domain
+	}
+
+	return 0
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"testing"
+
+	"jingoal.com/dfs/proto/transfer"
+)
+
+func TestRequestDomain(t *testing.T) {
+	cases := []struct {
+		req    interface{}
+		domain int64
+	}{
+		{&transfer.PutFileReq{Info: &transfer.FileInfo{Domain: 2}}, 2},
+		{&transfer.PutFileReq{}, 0},
+		{&transfer.GetFileReq{Domain: 3}, 3},
+		{&transfer.CopyReq{SrcDomain: 4, DstDomain: 5}, 5},
+		{&transfer.UploadPartReq{Domain: 6}, 6},
+		{&transfer.NegotiateChunkSizeReq{Size: 7}, 0},
+	}
+
+	for i, c := range cases {
+		if d := requestDomain(c.req); d != c.domain {
+			t.Errorf("case %d, expected %d, got %d", i, c.domain, d)
+		}
+	}
+}
+
+func TestClientRegistry(t *testing.T) {
+	r := &clientRegistry{
+		m: make(map[string]string),
+	}
+
+	r.add("10.0.0.1:3456", "client-a")
+	if id := r.get("10.0.0.1:4567"); id != "client-a" {
+		t.Errorf("expected client-a from another port, got %s", id)
+	}
+
+	r.add("10.0.0.1:5678", "client-b")
+	r.remove("10.0.0.1:3456", "client-a")
+	if id := r.get("10.0.0.1:3456"); id != "client-b" {
+		t.Errorf("expected client-b kept, got %s", id)
+	}
+
+	r.remove("10.0.0.1:5678", "client-b")
+	if id := r.get("10.0.0.1:3456"); id != "" {
+		t.Errorf("expected no client, got %s", id)
+	}
+}
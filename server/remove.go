@@ -7,7 +7,9 @@ import (
 
 	"github.com/golang/glog"
 	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2"
 
+	"jingoal.com/dfs/conf"
 	"jingoal.com/dfs/fileop"
 	"jingoal.com/dfs/meta"
 	"jingoal.com/dfs/metadata"
@@ -83,38 +85,100 @@ func (s *DFSServer) removeBiz(c interface{}, r interface{}, args []interface{})
 		return rep, fmt.Sprintf("remove, fid %s, domain %d", req.Id, req.Domain)
 	}
 
+	// A file of another domain is neither trashed nor removed.
+	if _, _, _, err := s.findFileInDomain(req.Id, req.Domain); err != nil {
+		return mf, err
+	}
+
+	if conf.IsTrashEnabled(req.Domain) {
+		t, err := s.trashFile(req.Id, req.Domain, peerAddr)
+		if err != nil {
+			return mf, err
+		}
+
+		// A file put into trash bin is removed for client.
+		rep = &transfer.RemoveFileRep{
+			Result: true,
+		}
+		mf = func() (interface{}, string) {
+			return rep, fmt.Sprintf("remove into trash, %s", t.String())
+		}
+
+		return mf, nil
+	}
+
+	result, handlerName, err := s.removeFile(req.Id, req.Domain, peerAddr, startTime)
+	if err != nil {
+		return mf, err
+	}
+
+	rep = &transfer.RemoveFileRep{
+		Result: result,
+	}
+	mf = func() (interface{}, string) {
+		return rep, fmt.Sprintf("remove entity %t, fid %s, domain %d, from %v", rep.Result, req.Id, req.Domain, handlerName)
+	}
+
+	return mf, nil
+}
+
+// removeFile removes a file from storage, and saves the space log
+// and the event of removing. It returns true when an entity removed.
+func (s *DFSServer) removeFile(id string, domain int64, peerAddr string, startTime time.Time) (bool, string, error) {
 	var p fileop.DFSFileHandler
-	var fm *meta.File
 
-	nh, mh, err := s.selector.getDFSFileHandlerForRead(req.Domain)
+	nh, mh, err := s.selector.getDFSFileHandlerForRead(domain)
 	if err != nil {
 		glog.Warningf("RemoveFile, failed to get handler for read, error: %v", err)
-		return mf, err
+		return false, "", err
+	}
+
+	// Info is found before removing, since the meta of a duplication
+	// is not returned by removing.
+	var info *transfer.FileInfo
+	if nh != nil {
+		var m fileop.DFSFileHandler
+		if mh != nil {
+			m = *mh
+		}
+		_, _, info, _ = findFile(id, *nh, m)
 	}
 
 	var dr DeleteResult
 	if nh != nil {
 		p = *nh
-		dr.nresult, dr.nMeta, dr.nerr = p.Remove(req.Id, req.Domain)
+		dr.nresult, dr.nMeta, dr.nerr = p.Remove(id, domain)
 	}
 	if mh != nil {
 		p = *mh
-		dr.mresult, dr.mMeta, dr.merr = p.Remove(req.Id, req.Domain)
+		dr.mresult, dr.mMeta, dr.merr = p.Remove(id, domain)
 	}
 
 	result, fm, err := dr.result()
 
-	// space log.
-	if err == nil && result {
+	// A removed file needs neither purging nor expiring.
+	if err == nil {
+		if er := s.trashOp.RemoveTrashById(id); er != nil && er != mgo.ErrNotFound {
+			glog.Warningf("Failed to remove trash of %s, %v", id, er)
+		}
+		if er := s.expireOp.RemoveExpiryById(id); er != nil && er != mgo.ErrNotFound {
+			glog.Warningf("Failed to remove expiry of %s, %v", id, er)
+		}
+	}
+
+	// space log, every file removed was charged when created.
+	if err == nil && (info != nil || fm != nil) {
 		slog := &metadata.SpaceLog{
-			Fid:       fm.Id,
-			Domain:    fm.Domain,
-			Uid:       fm.UserId,
-			Biz:       fm.Biz,
-			Size:      fm.Size,
+			Fid:       id,
+			Domain:    domain,
 			Timestamp: time.Now(),
 			Type:      metadata.DeleteType.String(),
 		}
+		if info != nil {
+			slog.Uid, slog.Biz, slog.Size = fmt.Sprintf("%d", info.User), info.Biz, info.Size
+		} else {
+			slog.Uid, slog.Biz, slog.Size = fm.UserId, fm.Biz, fm.Size
+		}
 		if er := s.spaceOp.SaveSpaceLog(slog); er != nil {
 			glog.Warningf("%s, error: %v", slog.String(), er)
 		}
@@ -124,8 +188,8 @@ func (s *DFSServer) removeBiz(c interface{}, r interface{}, args []interface{})
 	resultEvent := &metadata.Event{
 		EType:     metadata.SucDelete,
 		Timestamp: util.GetTimeInMilliSecond(),
-		Domain:    req.Domain,
-		Fid:       req.Id,
+		Domain:    domain,
+		Fid:       id,
 		Elapse:    time.Since(startTime).Nanoseconds(),
 		Description: fmt.Sprintf("%s, client %s, result %t, from %v, err %v",
 			metadata.SucDelete.String(), peerAddr, result, p.Name(), err),
@@ -136,19 +200,12 @@ func (s *DFSServer) removeBiz(c interface{}, r interface{}, args []interface{})
 	}
 
 	if result {
-		glog.V(3).Infof("RemoveFile, succeeded to remove entity %s from %v, err %v.", req.Id, p.Name(), err)
+		glog.V(3).Infof("RemoveFile, succeeded to remove entity %s from %v, err %v.", id, p.Name(), err)
 	} else {
-		glog.V(3).Infof("RemoveFile, succeeded to remove reference %s from %v, err %v.", req.Id, p.Name(), err)
-	}
-
-	rep = &transfer.RemoveFileRep{
-		Result: result,
-	}
-	mf = func() (interface{}, string) {
-		return rep, fmt.Sprintf("remove entity %t, fid %s, domain %d, from %v", rep.Result, req.Id, req.Domain, p.Name())
+		glog.V(3).Infof("RemoveFile, succeeded to remove reference %s from %v, err %v.", id, p.Name(), err)
 	}
 
-	return mf, nil
+	return result, p.Name(), nil
 }
 
 type DeleteResult struct {
@@ -0,0 +1,607 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/transport"
+	"gopkg.in/mgo.v2/bson"
+
+	"jingoal.com/dfs/meta"
+	"jingoal.com/dfs/metadata"
+	"jingoal.com/dfs/proto/transfer"
+	"jingoal.com/dfs/util"
+)
+
+const (
+	s3Biz        = "s3"     // biz of objects
+	s3PartBiz    = "s3part" // biz of files of multipart upload parts
+	s3MaxKeys    = 1000
+	s3XMLNS      = "http://s3.amazonaws.com/doc/2006-03-01/"
+	s3TimeFormat = "2006-01-02T15:04:05.000Z"
+)
+
+// s3Error represents an error of S3 API.
+type s3Error struct {
+	status int
+	code   string
+	msg    string
+}
+
+func (e *s3Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.code, e.msg)
+}
+
+var (
+	errS3NoSuchBucket     = &s3Error{http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist."}
+	errS3NoSuchKey        = &s3Error{http.StatusNotFound, "NoSuchKey", "The specified key does not exist."}
+	errS3NoSuchUpload     = &s3Error{http.StatusNotFound, "NoSuchUpload", "The specified multipart upload does not exist."}
+	errS3InvalidPart      = &s3Error{http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found."}
+	errS3MalformedXML     = &s3Error{http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed."}
+	errS3InvalidArgument  = &s3Error{http.StatusBadRequest, "InvalidArgument", "Invalid argument."}
+	errS3InvalidDigest    = &s3Error{http.StatusBadRequest, "InvalidDigest", "The Content-MD5 you specified is not valid."}
+	errS3MethodNotAllowed = &s3Error{http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource."}
+	errS3InternalError    = &s3Error{http.StatusInternalServerError, "InternalError", "We encountered an internal error. Please try again."}
+)
+
+// S3Gateway serves a subset of S3 API, in which a bucket is a domain
+// and an object key is the name of a file. Only path style requests
+// are supported, which are authorized with the bearer token and rate
+// limited the same as gRPC, but signatures of S3 are not supported.
+//
+//	PUT    /{bucket}/{key}                          PutObject
+//	GET    /{bucket}/{key}                          GetObject
+//	HEAD   /{bucket}/{key}                          HeadObject
+//	DELETE /{bucket}/{key}                          DeleteObject
+//	GET    /{bucket}?list-type=2                    ListObjectsV2
+//	POST   /{bucket}/{key}?uploads                  CreateMultipartUpload
+//	PUT    /{bucket}/{key}?partNumber=n&uploadId=id UploadPart
+//	POST   /{bucket}/{key}?uploadId=id              CompleteMultipartUpload
+//	DELETE /{bucket}/{key}?uploadId=id              AbortMultipartUpload
+//
+// ETag of an object is the md5 of its whole content, even if it was
+// uploaded part by part.
+type S3Gateway struct {
+	s *DFSServer
+	g *HTTPGateway
+}
+
+// ServeHTTP implements interface http.Handler.
+func (sg *S3Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key := splitS3Path(r.URL.Path)
+	domain, err := strconv.ParseInt(bucket, 10, 64)
+	if err != nil || domain <= 0 {
+		writeS3Error(w, errS3NoSuchBucket)
+		return
+	}
+
+	ctx, cancel := httpContext(r)
+	defer cancel()
+
+	peerAddr := r.RemoteAddr
+	glog.V(3).Infof("S3 %s %s, client: %s", r.Method, r.URL, peerAddr)
+
+	if ctx, err = sg.s.authorizeHTTP(ctx, r, domain); err != nil {
+		writeS3Error(w, err)
+		return
+	}
+
+	q := r.URL.Query()
+	uploadId := q.Get("uploadId")
+
+	switch {
+	case len(key) == 0 && r.Method == "GET":
+		sg.listObjects(ctx, w, r, domain, bucket)
+	case len(key) == 0:
+		writeS3Error(w, errS3MethodNotAllowed)
+	case r.Method == "GET" || r.Method == "HEAD":
+		sg.getObject(ctx, w, r, domain, key, peerAddr)
+	case r.Method == "PUT" && len(uploadId) > 0:
+		sg.uploadPart(ctx, w, r, domain, key, uploadId, peerAddr)
+	case r.Method == "PUT":
+		sg.putObject(ctx, w, r, domain, key, peerAddr)
+	case r.Method == "POST" && len(uploadId) > 0:
+		sg.completeMultipartUpload(ctx, w, r, domain, bucket, key, uploadId, peerAddr)
+	case r.Method == "POST" && hasQuery(q, "uploads"):
+		sg.createMultipartUpload(w, domain, bucket, key)
+	case r.Method == "DELETE" && len(uploadId) > 0:
+		sg.abortMultipartUpload(w, domain, uploadId, peerAddr)
+	case r.Method == "DELETE":
+		sg.deleteObject(ctx, w, domain, key, peerAddr)
+	default:
+		writeS3Error(w, errS3MethodNotAllowed)
+	}
+}
+
+func (sg *S3Gateway) getObject(ctx context.Context, w http.ResponseWriter, r *http.Request, domain int64, key string, peerAddr string) {
+	o, err := sg.s.objectOp.LookupObject(domain, key)
+	if err != nil {
+		writeS3Error(w, err)
+		return
+	}
+	if o == nil {
+		writeS3Error(w, errS3NoSuchKey)
+		return
+	}
+
+	w.Header().Set("Last-Modified", time.Unix(0, o.Modified*1e6).UTC().Format(http.TimeFormat))
+	sg.g.getFile(ctx, w, r, domain, o.Fid, peerAddr)
+}
+
+func (sg *S3Gateway) putObject(ctx context.Context, w http.ResponseWriter, r *http.Request, domain int64, key string, peerAddr string) {
+	info, err := s3FileInfo(r, domain, key, s3Biz)
+	if err != nil {
+		writeS3Error(w, err)
+		return
+	}
+
+	inf, err := sg.g.putStream(ctx, r.Body, info, 0, "S3PutObject", peerAddr)
+	if err != nil {
+		writeS3Error(w, err)
+		return
+	}
+
+	if err := sg.saveObject(ctx, domain, key, inf, peerAddr); err != nil {
+		writeS3Error(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", strconv.Quote(inf.Md5))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (sg *S3Gateway) deleteObject(ctx context.Context, w http.ResponseWriter, domain int64, key string, peerAddr string) {
+	o, err := sg.s.objectOp.RemoveObject(domain, key)
+	if err != nil {
+		writeS3Error(w, err)
+		return
+	}
+
+	if o != nil {
+		if err := sg.removeFile(ctx, domain, o.Fid, peerAddr); err != nil {
+			glog.Warningf("S3DeleteObject, failed to remove %s, %v", o.String(), err)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type s3Object struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type s3ListBucketResult struct {
+	XMLName               xml.Name   `xml:"ListBucketResult"`
+	Xmlns                 string     `xml:"xmlns,attr"`
+	Name                  string     `xml:"Name"`
+	Prefix                string     `xml:"Prefix"`
+	StartAfter            string     `xml:"StartAfter,omitempty"`
+	ContinuationToken     string     `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string     `xml:"NextContinuationToken,omitempty"`
+	KeyCount              int        `xml:"KeyCount"`
+	MaxKeys               int        `xml:"MaxKeys"`
+	IsTruncated           bool       `xml:"IsTruncated"`
+	Contents              []s3Object `xml:"Contents"`
+}
+
+func (sg *S3Gateway) listObjects(ctx context.Context, w http.ResponseWriter, r *http.Request, domain int64, bucket string) {
+	q := r.URL.Query()
+	result := &s3ListBucketResult{
+		Xmlns:             s3XMLNS,
+		Name:              bucket,
+		Prefix:            q.Get("prefix"),
+		StartAfter:        q.Get("start-after"),
+		ContinuationToken: q.Get("continuation-token"),
+		MaxKeys:           s3MaxKeys,
+	}
+
+	if v := q.Get("max-keys"); len(v) > 0 {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeS3Error(w, errS3InvalidArgument)
+			return
+		}
+		if n < result.MaxKeys {
+			result.MaxKeys = n
+		}
+	}
+
+	after := result.StartAfter
+	if len(result.ContinuationToken) > 0 {
+		b, err := base64.URLEncoding.DecodeString(result.ContinuationToken)
+		if err != nil {
+			writeS3Error(w, errS3InvalidArgument)
+			return
+		}
+		after = string(b)
+	}
+
+	bf := func(c interface{}, r interface{}, args []interface{}) (interface{}, error) {
+		var mf msgFunc
+		mf = func() (interface{}, string) {
+			return nil, fmt.Sprintf("s3 list objects, domain %d, prefix %s, after %s", domain, result.Prefix, after)
+		}
+
+		// One more object to know if the result is truncated.
+		objects, err := sg.s.objectOp.ListObjects(domain, result.Prefix, after, result.MaxKeys+1)
+		if err != nil {
+			return mf, err
+		}
+
+		mf = func() (interface{}, string) {
+			return objects, fmt.Sprintf("s3 list objects, domain %d, prefix %s, after %s, %d objects", domain, result.Prefix, after, len(objects))
+		}
+		return mf, nil
+	}
+	t, err := bizFunc(bf).withDeadline("S3ListObjects", ctx, nil)
+	if err != nil {
+		writeS3Error(w, err)
+		return
+	}
+	objects, ok := t.([]metadata.Object)
+	if !ok && t != nil {
+		writeS3Error(w, AssertionError)
+		return
+	}
+
+	if len(objects) > result.MaxKeys {
+		objects = objects[:result.MaxKeys]
+		result.IsTruncated = true
+		result.NextContinuationToken = base64.URLEncoding.EncodeToString([]byte(objects[len(objects)-1].Key))
+	}
+
+	result.KeyCount = len(objects)
+	for _, o := range objects {
+		result.Contents = append(result.Contents, s3Object{
+			Key:          o.Key,
+			LastModified: time.Unix(0, o.Modified*1e6).UTC().Format(s3TimeFormat),
+			ETag:         strconv.Quote(o.Md5),
+			Size:         o.Size,
+			StorageClass: "STANDARD",
+		})
+	}
+
+	writeS3XML(w, http.StatusOK, result)
+}
+
+type s3InitiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadId string   `xml:"UploadId"`
+}
+
+func (sg *S3Gateway) createMultipartUpload(w http.ResponseWriter, domain int64, bucket string, key string) {
+	m := &metadata.Multipart{
+		Domain:     domain,
+		Biz:        s3Biz,
+		Name:       key,
+		Key:        key,
+		CreateTime: time.Now().Unix(),
+	}
+	if err := sg.s.partOp.SaveMultipart(m); err != nil {
+		writeS3Error(w, err)
+		return
+	}
+
+	writeS3XML(w, http.StatusOK, &s3InitiateMultipartUploadResult{
+		Xmlns:    s3XMLNS,
+		Bucket:   bucket,
+		Key:      key,
+		UploadId: m.Id.Hex(),
+	})
+}
+
+func (sg *S3Gateway) uploadPart(ctx context.Context, w http.ResponseWriter, r *http.Request, domain int64, key string, uploadId string, peerAddr string) {
+	number, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || number < 1 || number > maxPartNumber {
+		writeS3Error(w, errS3InvalidArgument)
+		return
+	}
+
+	m, err := sg.s.lookupMultipart(uploadId, domain)
+	if err == nil && m.Key != key {
+		err = errNoSuchUpload
+	}
+	if err != nil {
+		writeS3Error(w, err)
+		return
+	}
+
+	info, err := s3FileInfo(r, domain, fmt.Sprintf("%s.part%d", key, number), s3PartBiz)
+	if err != nil {
+		writeS3Error(w, err)
+		return
+	}
+
+	inf, err := sg.g.putStream(ctx, r.Body, info, 0, "S3UploadPart", peerAddr)
+	if err != nil {
+		writeS3Error(w, err)
+		return
+	}
+
+	if err := sg.s.savePart(m, number, inf, peerAddr); err != nil {
+		writeS3Error(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", strconv.Quote(inf.Md5))
+	w.WriteHeader(http.StatusOK)
+}
+
+type s3CompleteMultipartUpload struct {
+	Parts []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+type s3CompleteMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+func (sg *S3Gateway) completeMultipartUpload(ctx context.Context, w http.ResponseWriter, r *http.Request, domain int64, bucket string, key string, uploadId string, peerAddr string) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeS3Error(w, err)
+		return
+	}
+	req := &s3CompleteMultipartUpload{}
+	if err := xml.Unmarshal(body, req); err != nil || len(req.Parts) == 0 {
+		writeS3Error(w, errS3MalformedXML)
+		return
+	}
+
+	m, err := sg.s.lookupMultipart(uploadId, domain)
+	if err == nil && m.Key != key {
+		err = errNoSuchUpload
+	}
+	if err != nil {
+		writeS3Error(w, err)
+		return
+	}
+
+	numbers := make([]int, 0, len(req.Parts))
+	for _, p := range req.Parts {
+		part, ok := m.Parts[strconv.Itoa(p.PartNumber)]
+		if !ok || strings.Trim(p.ETag, "\"") != part.Md5 {
+			writeS3Error(w, errS3InvalidPart)
+			return
+		}
+		numbers = append(numbers, p.PartNumber)
+	}
+	parts, err := selectParts(m, numbers)
+	if err != nil {
+		writeS3Error(w, errS3InvalidPart)
+		return
+	}
+
+	fid := bson.NewObjectId().Hex()
+	if m, err = sg.s.claimMultipart(m, fid, parts); err == nil && m.Fid != fid {
+		err = errUploadCompleting
+	}
+	if err != nil {
+		writeS3Error(w, err)
+		return
+	}
+
+	serviceName := "S3CompleteMultipartUpload"
+	bf := func(c interface{}, r interface{}, args []interface{}) (interface{}, error) {
+		var mf msgFunc
+		mf = func() (interface{}, string) {
+			return nil, fmt.Sprintf("s3 complete %s", m.String())
+		}
+
+		inf, err := sg.s.completeMultipart(c, m, parts, serviceName, peerAddr)
+		if err != nil {
+			return mf, err
+		}
+
+		mf = func() (interface{}, string) {
+			return inf, fmt.Sprintf("s3 complete %s, fid %s, size %d", m.String(), inf.Id, inf.Size)
+		}
+		return mf, nil
+	}
+	t, err := bizFunc(bf).withDeadline(serviceName, ctx, nil)
+	if err != nil {
+		writeS3Error(w, err)
+		return
+	}
+	inf, ok := t.(*transfer.FileInfo)
+	if !ok {
+		writeS3Error(w, AssertionError)
+		return
+	}
+
+	if err := sg.saveObject(ctx, domain, key, inf, peerAddr); err != nil {
+		writeS3Error(w, err)
+		return
+	}
+
+	writeS3XML(w, http.StatusOK, &s3CompleteMultipartUploadResult{
+		Xmlns:    s3XMLNS,
+		Location: fmt.Sprintf("/%s/%s", bucket, key),
+		Bucket:   bucket,
+		Key:      key,
+		ETag:     strconv.Quote(inf.Md5),
+	})
+}
+
+func (sg *S3Gateway) abortMultipartUpload(w http.ResponseWriter, domain int64, uploadId string, peerAddr string) {
+	m, err := sg.s.lookupMultipart(uploadId, domain)
+	if err != nil {
+		writeS3Error(w, err)
+		return
+	}
+
+	if err := sg.s.abortMultipart(m, peerAddr); err != nil {
+		writeS3Error(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// saveObject maps key to the file just created, the file which was
+// mapped to the key before is removed.
+func (sg *S3Gateway) saveObject(ctx context.Context, domain int64, key string, inf *transfer.FileInfo, peerAddr string) error {
+	old, err := sg.s.objectOp.SaveObject(&metadata.Object{
+		Domain:   domain,
+		Key:      key,
+		Fid:      inf.Id,
+		Size:     inf.Size,
+		Md5:      inf.Md5,
+		Modified: util.GetTimeInMilliSecond(),
+	})
+	if err != nil {
+		if er := sg.removeFile(ctx, domain, inf.Id, peerAddr); er != nil {
+			glog.Warningf("Failed to remove file %s of key %s, %v", inf.Id, key, er)
+		}
+		return err
+	}
+
+	if old != nil && old.Fid != inf.Id {
+		if err := sg.removeFile(ctx, domain, old.Fid, peerAddr); err != nil {
+			glog.Warningf("Failed to remove replaced %s, %v", old.String(), err)
+		}
+	}
+
+	return nil
+}
+
+// removeFile removes a file with the same biz function of RemoveFile.
+func (sg *S3Gateway) removeFile(ctx context.Context, domain int64, fid string, peerAddr string) error {
+	req := &transfer.RemoveFileReq{
+		Id:     fid,
+		Domain: domain,
+	}
+	_, err := bizFunc(sg.s.removeBiz).withDeadline("S3RemoveFile", ctx, req, peerAddr, "s3 gateway")
+	return err
+}
+
+// NewS3Gateway creates an S3 gateway of DFSServer.
+func NewS3Gateway(s *DFSServer) *S3Gateway {
+	return &S3Gateway{
+		s: s,
+		g: &HTTPGateway{
+			s:          s,
+			writeError: writeS3Error,
+		},
+	}
+}
+
+// s3FileInfo returns the info of file to create by a PUT request.
+func s3FileInfo(r *http.Request, domain int64, name string, biz string) (*transfer.FileInfo, error) {
+	info := &transfer.FileInfo{
+		Name:   name,
+		Domain: domain,
+		Biz:    biz,
+	}
+	if r.ContentLength > 0 {
+		info.Size = r.ContentLength
+	}
+
+	if v := r.Header.Get("Content-MD5"); len(v) > 0 {
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err != nil || len(b) != 16 {
+			return nil, errS3InvalidDigest
+		}
+		info.Md5 = hex.EncodeToString(b)
+	}
+
+	return info, nil
+}
+
+// splitS3Path splits a path into bucket and key.
+func splitS3Path(path string) (string, string) {
+	path = strings.TrimPrefix(path, "/")
+	if i := strings.Index(path, "/"); i >= 0 {
+		return path[:i], path[i+1:]
+	}
+
+	return path, ""
+}
+
+func hasQuery(q map[string][]string, name string) bool {
+	_, ok := q[name]
+	return ok
+}
+
+func writeS3XML(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	if err := xml.NewEncoder(w).Encode(v); err != nil {
+		glog.Warningf("Failed to write S3 response, %v", err)
+	}
+}
+
+type s3ErrorResponse struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+// writeS3Error writes an error in form of S3 API.
+func writeS3Error(w http.ResponseWriter, err error) {
+	e, ok := err.(*s3Error)
+	if !ok {
+		e = errS3InternalError
+		switch {
+		case err == meta.FileNotFound:
+			e = errS3NoSuchKey
+		case err == errNoSuchUpload:
+			e = errS3NoSuchUpload
+		case err == errUploadCompleting:
+			e = &s3Error{http.StatusConflict, "OperationAborted", err.Error()}
+		case err == errUnsatisfiableRange:
+			e = &s3Error{http.StatusRequestedRangeNotSatisfiable, "InvalidRange", err.Error()}
+		case isRateLimited(err):
+			e = &s3Error{http.StatusServiceUnavailable, "SlowDown", err.Error()}
+		case strings.HasPrefix(err.Error(), "invalid request"):
+			e = &s3Error{http.StatusBadRequest, "InvalidRequest", err.Error()}
+		case isQuotaExceeded(err):
+			e = &s3Error{http.StatusForbidden, "QuotaExceeded", err.Error()}
+		default:
+			if se, ok := err.(transport.StreamError); ok {
+				switch se.Code {
+				case codes.DeadlineExceeded:
+					e = &s3Error{http.StatusServiceUnavailable, "SlowDown", err.Error()}
+				case codes.Unauthenticated, codes.PermissionDenied:
+					e = &s3Error{http.StatusForbidden, "AccessDenied", err.Error()}
+				}
+			}
+		}
+	}
+
+	// Details of an internal error are only logged, not to expose
+	// the storage to clients.
+	if e == errS3InternalError {
+		glog.Warningf("S3 gateway internal error, %v", err)
+	}
+
+	writeS3XML(w, e.status, &s3ErrorResponse{
+		Code:    e.code,
+		Message: e.msg,
+	})
+}
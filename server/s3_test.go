@@ -0,0 +1,98 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/transport"
+)
+
+func TestSplitS3Path(t *testing.T) {
+	cases := []struct {
+		path   string
+		bucket string
+		key    string
+	}{
+		{"/2/a.txt", "2", "a.txt"},
+		{"/2/dir/a.txt", "2", "dir/a.txt"},
+		{"/2/", "2", ""},
+		{"/2", "2", ""},
+		{"/", "", ""},
+	}
+
+	for i, c := range cases {
+		bucket, key := splitS3Path(c.path)
+		if bucket != c.bucket || key != c.key {
+			t.Errorf("case %d, expected %s %s, got %s %s", i, c.bucket, c.key, bucket, key)
+		}
+	}
+}
+
+func TestS3FileInfo(t *testing.T) {
+	cases := []struct {
+		contentMd5 string
+		md5        string
+		ok         bool
+	}{
+		{"", "", true},
+		{"XrY7u+Ae7tCTyyK7j1rNww==", "5eb63bbbe01eeed093cb22bb8f5acdc3", true},
+		{"XrY7u+Ae7tCTyyK7", "", false},
+		{"not base64", "", false},
+	}
+
+	for i, c := range cases {
+		r := &http.Request{
+			Header:        http.Header{},
+			ContentLength: 11,
+		}
+		if len(c.contentMd5) > 0 {
+			r.Header.Set("Content-MD5", c.contentMd5)
+		}
+
+		info, err := s3FileInfo(r, 2, "a.txt", s3Biz)
+		if (err == nil) != c.ok {
+			t.Errorf("case %d, expected ok %t, got %v", i, c.ok, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if info.Md5 != c.md5 || info.Size != 11 || info.Domain != 2 || info.Name != "a.txt" {
+			t.Errorf("case %d, unexpected info %v", i, info)
+		}
+	}
+}
+
+func TestWriteS3Error(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{transport.StreamError{Code: codes.Unauthenticated, Desc: "token required"}, http.StatusForbidden, "AccessDenied"},
+		{transport.StreamError{Code: codes.PermissionDenied, Desc: "read denied on domain 2"}, http.StatusForbidden, "AccessDenied"},
+		{&rateLimitedError{transport.StreamError{Code: codes.ResourceExhausted, Desc: "rate limit"}}, http.StatusServiceUnavailable, "SlowDown"},
+		{quotaExceededError(2, 100, 120, 30), http.StatusForbidden, "QuotaExceeded"},
+		{errUploadCompleting, http.StatusConflict, "OperationAborted"},
+		{errors.New("no reachable servers"), http.StatusInternalServerError, "InternalError"},
+	}
+
+	for i, c := range cases {
+		w := httptest.NewRecorder()
+		writeS3Error(w, c.err)
+		if w.Code != c.status || !strings.Contains(w.Body.String(), "<Code>"+c.code+"</Code>") {
+			t.Errorf("case %d, expected %d %s, got %d %s", i, c.status, c.code, w.Code, w.Body.String())
+		}
+	}
+
+	// Details of an internal error are not replied.
+	w := httptest.NewRecorder()
+	writeS3Error(w, errors.New("no reachable servers"))
+	if strings.Contains(w.Body.String(), "no reachable servers") {
+		t.Errorf("expected internal error hidden, got %s", w.Body.String())
+	}
+}
@@ -4,10 +4,15 @@ import (
 	"fmt"
 
 	"jingoal.com/dfs/fileop"
+	"jingoal.com/dfs/meta"
 	"jingoal.com/dfs/proto/transfer"
 )
 
 func (s *DFSServer) openFileForRead(id string, domain int64) (fileop.DFSFileHandler, fileop.DFSFile, error) {
+	if err := s.checkTrash(id, domain); err != nil {
+		return nil, nil, err
+	}
+
 	nh, mh, err := s.selector.getDFSFileHandlerForRead(domain)
 	if err != nil {
 		return nil, nil, err
@@ -18,7 +23,16 @@ func (s *DFSServer) openFileForRead(id string, domain int64) (fileop.DFSFileHand
 		m = *mh
 	}
 
-	return openFile(id, domain, *nh, m)
+	h, file, err := openFile(id, domain, *nh, m)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkDomain(file.GetFileInfo(), domain); err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	return h, file, nil
 }
 
 func openFile(id string, domain int64, nh fileop.DFSFileHandler, mh fileop.DFSFileHandler) (fileop.DFSFileHandler, fileop.DFSFile, error) {
@@ -42,6 +56,16 @@ func openFile(id string, domain int64, nh fileop.DFSFileHandler, mh fileop.DFSFi
 }
 
 func (s *DFSServer) findFileForRead(id string, domain int64) (fileop.DFSFileHandler, string, *transfer.FileInfo, error) {
+	if err := s.checkTrash(id, domain); err != nil {
+		return nil, "", nil, err
+	}
+
+	return s.findFileInDomain(id, domain)
+}
+
+// findFileInDomain finds a file of domain, a file found in another
+// domain is taken as not found.
+func (s *DFSServer) findFileInDomain(id string, domain int64) (fileop.DFSFileHandler, string, *transfer.FileInfo, error) {
 	nh, mh, err := s.selector.getDFSFileHandlerForRead(domain)
 	if err != nil {
 		return nil, "", nil, err
@@ -52,7 +76,29 @@ func (s *DFSServer) findFileForRead(id string, domain int64) (fileop.DFSFileHand
 		m = *mh
 	}
 
-	return findFile(id, *nh, m)
+	h, fid, info, err := findFile(id, *nh, m)
+	if err != nil || info == nil {
+		return h, fid, info, err
+	}
+	if err := checkDomain(info, domain); err != nil {
+		return nil, "", nil, err
+	}
+
+	return h, fid, info, nil
+}
+
+// checkDomain returns meta.FileNotFound if the file of info is stored
+// in another domain, not to expose files across domains. A legacy file
+// stored without domain is taken as of the domain given.
+func checkDomain(info *transfer.FileInfo, domain int64) error {
+	if info.Domain == 0 {
+		info.Domain = domain
+	}
+	if info.Domain != domain {
+		return meta.FileNotFound
+	}
+
+	return nil
 }
 
 func findFile(id string, nh fileop.DFSFileHandler, mh fileop.DFSFileHandler) (fileop.DFSFileHandler, string, *transfer.FileInfo, error) {
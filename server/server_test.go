@@ -0,0 +1,166 @@
+package server
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"gopkg.in/mgo.v2"
+
+	"jingoal.com/dfs/fileop"
+	"jingoal.com/dfs/metadata"
+	"jingoal.com/dfs/proto/transfer"
+)
+
+const (
+	testDbUri     = "mongodb://127.0.0.1:27017"
+	testEventDb   = "dfs-server-test"
+	testShardName = "dfs-server-test-shard"
+)
+
+// newTestServer returns a server storing files into a gridfs shard
+// of the local mongodb, the test is skipped if it is not reachable.
+func newTestServer(t *testing.T) *DFSServer {
+	session, err := mgo.DialWithTimeout(testDbUri, time.Second)
+	if err != nil {
+		t.Skipf("mongodb %s not reachable, %v", testDbUri, err)
+	}
+	session.Close()
+
+	s := &DFSServer{}
+	s.spaceOp, _ = metadata.NewSpaceLogOp(testEventDb, testDbUri)
+	s.eventOp, _ = metadata.NewEventOp(testEventDb, testDbUri)
+	s.uploadOp, _ = metadata.NewUploadSessionOp(testEventDb, testDbUri)
+	s.trashOp, _ = metadata.NewTrashOp(testEventDb, testDbUri)
+	s.expireOp, _ = metadata.NewExpireOp(testEventDb, testDbUri)
+	s.objectOp, _ = metadata.NewObjectOp(testEventDb, testDbUri)
+	s.partOp, _ = metadata.NewMultipartOp(testEventDb, testDbUri)
+	s.selector = &HandlerSelector{
+		dfsServer:     s,
+		shardHandlers: make(map[string]*ShardHandler),
+	}
+	addTestShard(t, s, testShardName, 1)
+
+	return s
+}
+
+// addTestShard adds a gridfs shard serving domains from domain on,
+// domain must be greater than the ones added before.
+func addTestShard(t *testing.T, s *DFSServer, name string, domain int64) fileop.DFSFileHandler {
+	handler, err := fileop.NewGridFsHandler(&metadata.Shard{
+		Name:    name,
+		Uri:     testDbUri,
+		ShdType: metadata.Gridgo,
+	})
+	if err != nil {
+		t.Fatalf("NewGridFsHandler error %v", err)
+	}
+
+	s.selector.shardHandlers[name] = &ShardHandler{
+		status:  statusOk,
+		handler: handler,
+	}
+	s.selector.segments = append(s.selector.segments, &metadata.Segment{
+		Domain:       domain,
+		NormalServer: name,
+	})
+
+	return handler
+}
+
+// testDomain returns a domain not used by other tests.
+func testDomain() int64 {
+	return time.Now().UnixNano() / 1000
+}
+
+type putFileStream struct {
+	grpc.ServerStream
+	reqs []*transfer.PutFileReq
+	rep  *transfer.PutFileRep
+}
+
+func (s *putFileStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *putFileStream) Recv() (*transfer.PutFileReq, error) {
+	if len(s.reqs) == 0 {
+		return nil, io.EOF
+	}
+
+	req := s.reqs[0]
+	s.reqs = s.reqs[1:]
+	return req, nil
+}
+
+func (s *putFileStream) SendAndClose(rep *transfer.PutFileRep) error {
+	s.rep = rep
+	return nil
+}
+
+// putFile puts content by chunks of chunkSize, info is
+// carried in the first request.
+func putFile(s *DFSServer, info *transfer.FileInfo, content []byte, chunkSize int) (*transfer.FileInfo, error) {
+	stream := &putFileStream{}
+	for pos := 0; pos == 0 || pos < len(content); pos += chunkSize {
+		end := pos + chunkSize
+		if end > len(content) {
+			end = len(content)
+		}
+
+		req := &transfer.PutFileReq{
+			Chunk: &transfer.Chunk{
+				Pos:     int64(pos),
+				Length:  int64(end - pos),
+				Payload: content[pos:end],
+			},
+		}
+		if pos == 0 {
+			req.Info = info
+		}
+		stream.reqs = append(stream.reqs, req)
+	}
+
+	if err := s.PutFile(stream); err != nil {
+		return nil, err
+	}
+
+	return stream.rep.File, nil
+}
+
+type getFileStream struct {
+	grpc.ServerStream
+	reps []*transfer.GetFileRep
+}
+
+func (s *getFileStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *getFileStream) Send(rep *transfer.GetFileRep) error {
+	s.reps = append(s.reps, rep)
+	return nil
+}
+
+// getFile gets a file, returns the info and content received.
+func getFile(s *DFSServer, req *transfer.GetFileReq) (*transfer.FileInfo, []byte, error) {
+	stream := &getFileStream{}
+	if err := s.GetFile(req, stream); err != nil {
+		return nil, nil, err
+	}
+
+	var info *transfer.FileInfo
+	var content []byte
+	for _, rep := range stream.reps {
+		if inf := rep.GetInfo(); inf != nil {
+			info = inf
+		}
+		if chunk := rep.GetChunk(); chunk != nil {
+			content = append(content, chunk.Payload...)
+		}
+	}
+
+	return info, content, nil
+}
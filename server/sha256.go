@@ -0,0 +1,231 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+
+	"jingoal.com/dfs/fileop"
+	"jingoal.com/dfs/meta"
+	"jingoal.com/dfs/metadata"
+	"jingoal.com/dfs/proto/transfer"
+	"jingoal.com/dfs/util"
+)
+
+// GetBySha256 gets a file by its sha256. Files stored before sha256
+// was kept have an empty one, which never matches.
+func (s *DFSServer) GetBySha256(ctx context.Context, req *transfer.GetBySha256Req) (*transfer.GetBySha256Rep, error) {
+	serviceName := "GetBySha256"
+	peerAddr := getPeerAddressString(ctx)
+	glog.V(3).Infof("%s, client: %s, %v", serviceName, peerAddr, req)
+
+	if len(req.Sha256) == 0 || req.Domain <= 0 || req.Size < 0 {
+		return nil, fmt.Errorf("invalid request [%v]", req)
+	}
+
+	var t interface{}
+	var err error
+
+	if *shieldEnabled {
+		bf := func(c interface{}, r interface{}, args []interface{}) (interface{}, error) {
+			key := fmt.Sprintf("%s-%d", req.Sha256, req.Domain)
+			return shield(serviceName, key, *shieldTimeout, bizFunc(s.getBySha256Biz), c, r, args)
+		}
+
+		t, err = bizFunc(bf).withDeadline(serviceName, ctx, req, peerAddr)
+	} else {
+		t, err = bizFunc(s.getBySha256Biz).withDeadline(serviceName, ctx, req, peerAddr)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if result, ok := t.(*transfer.GetBySha256Rep); ok {
+		return result, nil
+	}
+
+	return nil, AssertionError
+}
+
+// getBySha256Biz implements an instance of type bizFunc
+// to process biz logic for getBySha256.
+func (s *DFSServer) getBySha256Biz(c interface{}, r interface{}, args []interface{}) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("parameter number %d", len(args))
+	}
+	peerAddr, ok := args[0].(string)
+	req, ok := r.(*transfer.GetBySha256Req)
+	if !ok {
+		return nil, AssertionError
+	}
+
+	var rep *transfer.GetBySha256Rep
+	var mf msgFunc
+	mf = func() (interface{}, string) {
+		return rep, fmt.Sprintf("getbysha256, sha256 %s, domain %d", req.Sha256, req.Domain)
+	}
+
+	// A duplication stores no content, but it is charged as the content
+	// here, the same as PutFile which clients fall back to.
+	if err := s.checkQuota(req.Domain, req.Size); err != nil {
+		return mf, err
+	}
+
+	p, oid, err := s.findBySha256(req.Sha256, req.Domain, req.Size)
+	if err != nil {
+		glog.V(3).Infof("Failed to find file by sha256 [%s, %d, %d], error: %v", req.Sha256, req.Domain, req.Size, err)
+		return mf, err
+	}
+
+	did, err := p.Duplicate(oid, req.Domain)
+	if err != nil {
+		event := &metadata.Event{
+			EType:       metadata.FailSha256,
+			Timestamp:   util.GetTimeInMilliSecond(),
+			Domain:      req.Domain,
+			Fid:         oid,
+			Description: fmt.Sprintf("%s, client %s", metadata.FailSha256.String(), peerAddr),
+		}
+		if er := s.eventOp.SaveEvent(event); er != nil {
+			// log into file instead return.
+			glog.Warningf("%s, error: %v", event.String(), er)
+		}
+
+		return mf, err
+	}
+
+	event := &metadata.Event{
+		EType:       metadata.SucSha256,
+		Timestamp:   util.GetTimeInMilliSecond(),
+		Domain:      req.Domain,
+		Fid:         oid,
+		Description: fmt.Sprintf("%s, client %s, did %s", metadata.SucSha256.String(), peerAddr, did),
+	}
+	if er := s.eventOp.SaveEvent(event); er != nil {
+		// log into file instead return.
+		glog.Warningf("%s, error: %v", event.String(), er)
+	}
+
+	// Charged as the content, the same as checked above.
+	s.saveCreateSpaceLog(&transfer.FileInfo{
+		Id:     did,
+		Domain: req.Domain,
+		Size:   req.Size,
+	})
+
+	glog.V(3).Infof("Succeeded to get file by sha256, fid %v, sha256 %v, domain %d, length %d",
+		oid, req.Sha256, req.Domain, req.Size)
+
+	rep = &transfer.GetBySha256Rep{
+		Fid: did,
+	}
+
+	mf = func() (interface{}, string) {
+		return rep, fmt.Sprintf("getbysha256 new fid %s, sha256 %s, domain %d", did, req.Sha256, req.Domain)
+	}
+
+	return mf, nil
+}
+
+// ExistBySha256 checks existentiality of a file.
+func (s *DFSServer) ExistBySha256(ctx context.Context, req *transfer.GetBySha256Req) (*transfer.ExistRep, error) {
+	serviceName := "ExistBySha256"
+	peerAddr := getPeerAddressString(ctx)
+	glog.V(3).Infof("%s, client: %s, %v", serviceName, peerAddr, req)
+
+	if len(req.Sha256) == 0 || req.Domain <= 0 || req.Size < 0 {
+		return nil, fmt.Errorf("invalid request [%v]", req)
+	}
+
+	var t interface{}
+	var err error
+
+	if *shieldEnabled {
+		bf := func(c interface{}, r interface{}, args []interface{}) (interface{}, error) {
+			key := fmt.Sprintf("%s-%d", req.Sha256, req.Domain)
+			return shield(serviceName, key, *shieldTimeout, bizFunc(s.existBySha256Biz), c, r, args)
+		}
+
+		t, err = bizFunc(bf).withDeadline(serviceName, ctx, req, peerAddr)
+	} else {
+		t, err = bizFunc(s.existBySha256Biz).withDeadline(serviceName, ctx, req, peerAddr)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if result, ok := t.(*transfer.ExistRep); ok {
+		return result, nil
+	}
+
+	return nil, AssertionError
+}
+
+// existBySha256Biz implements an instance of type bizFunc
+// to process biz logic for existBySha256.
+func (s *DFSServer) existBySha256Biz(c interface{}, r interface{}, args []interface{}) (interface{}, error) {
+	req, ok := r.(*transfer.GetBySha256Req)
+	if !ok {
+		return nil, AssertionError
+	}
+
+	var rep *transfer.ExistRep
+	var mf msgFunc
+	mf = func() (interface{}, string) {
+		return rep, fmt.Sprintf("existbysha256, sha256 %s, domain %d", req.Sha256, req.Domain)
+	}
+
+	_, _, err := s.findBySha256(req.Sha256, req.Domain, req.Size)
+	if err != nil {
+		glog.V(3).Infof("Failed to find file by sha256 [%s, %d, %d], error: %v", req.Sha256, req.Domain, req.Size, err)
+		return mf, err
+	}
+
+	rep = &transfer.ExistRep{
+		Result: true,
+	}
+	mf = func() (interface{}, string) {
+		return rep, fmt.Sprintf("existbysha256 %t, sha256 %s, domain %d", rep.Result, req.Sha256, req.Domain)
+	}
+
+	return mf, nil
+}
+
+func (s *DFSServer) findBySha256(sha256 string, domain int64, size int64) (fileop.DFSFileHandler, string, error) {
+	var err error
+	nh, mh, err := s.selector.getDFSFileHandlerForRead(domain)
+	if err != nil {
+		glog.Warningf("Failed to get handler for read, error: %v", err)
+		return nil, "", err
+	}
+
+	var p fileop.DFSFileHandler
+	var oid string
+
+	if mh != nil {
+		p = *mh
+		oid, err = p.FindBySha256(sha256, domain, size)
+		if err != nil {
+			if nh != nil {
+				p = *nh
+				oid, err = p.FindBySha256(sha256, domain, size)
+				if err != nil {
+					return nil, "", err // Not found in m and n.
+				}
+			} else {
+				return nil, "", meta.FileNotFound // Never reachs this line.
+			}
+		}
+	} else if nh != nil {
+		p = *nh
+		oid, err = p.FindBySha256(sha256, domain, size)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	return p, oid, nil
+}
@@ -65,7 +65,6 @@ func (s *DFSServer) statBiz(c interface{}, r interface{}, args []interface{}) (i
 		return mf, meta.FileNotFound
 	}
 
-	info.Domain = req.Domain
 	mf = func() (interface{}, string) {
 		return &transfer.PutFileRep{
 				File: info,
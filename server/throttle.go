@@ -0,0 +1,77 @@
+package server
+
+import (
+	"flag"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"jingoal.com/dfs/conf"
+	"jingoal.com/dfs/util"
+)
+
+var (
+	bandwidthDomain conf.RateLimit
+	bandwidthBiz    conf.RateLimit
+
+	domainBandwidth = util.NewRateLimiter(limitOf(&bandwidthDomain))
+	bizBandwidth    = util.NewRateLimiter(limitOf(&bandwidthBiz))
+)
+
+func init() {
+	flag.Var(&bandwidthDomain, "bandwidth-domain", "bytes per second of file streams by domain, in the form of 'rate:burst,domain=rate:burst', empty for unlimited.")
+	flag.Var(&bandwidthBiz, "bandwidth-biz", "bytes per second of file streams by biz, in the form of 'rate:burst,biz=rate:burst', empty for unlimited.")
+}
+
+// streamThrottle shapes the bytes rate of a file stream, with the
+// bandwidth of its domain and biz, which are shared by all streams
+// of the same domain or biz.
+type streamThrottle struct {
+	ctx         context.Context
+	serviceName string
+	domain      string
+	biz         string
+
+	throttled time.Duration // total time throttled.
+}
+
+func newStreamThrottle(ctx context.Context, serviceName string, domain int64, biz string) *streamThrottle {
+	return &streamThrottle{
+		ctx:         ctx,
+		serviceName: serviceName,
+		domain:      strconv.FormatInt(domain, 10),
+		biz:         biz,
+	}
+}
+
+// wait blocks until n bytes are allowed to be transferred,
+// or the stream is done.
+func (t *streamThrottle) wait(n int) error {
+	d := domainBandwidth.Reserve(t.domain, n)
+	if b := bizBandwidth.Reserve(t.biz, n); b > d {
+		d = b
+	}
+	if d <= 0 {
+		return nil
+	}
+
+	t.throttled += d
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-t.ctx.Done():
+		return t.ctx.Err()
+	}
+}
+
+// done reports the time throttled of stream.
+func (t *streamThrottle) done() {
+	if t.throttled > 0 {
+		instrumentThrottled(t.throttled, t.serviceName, t.biz)
+	}
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestStreamThrottle(t *testing.T) {
+	if err := bandwidthBiz.Set("throttle-test=1000:1000"); err != nil {
+		t.Fatalf("set bandwidth error %v", err)
+	}
+	defer bandwidthBiz.Set("")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	throttle := newStreamThrottle(ctx, "GetFile", 2, "throttle-test")
+
+	if err := throttle.wait(1000); err != nil || throttle.throttled != 0 {
+		t.Errorf("expected no throttle within burst, %v, %v", err, throttle.throttled)
+	}
+
+	cancel()
+	if err := throttle.wait(60000); err != context.Canceled {
+		t.Errorf("expected canceled, got %v", err)
+	}
+	if throttle.throttled <= 0 {
+		t.Errorf("expected time throttled, got %v", throttle.throttled)
+	}
+
+	unlimited := newStreamThrottle(context.Background(), "GetFile", 2, "other")
+	if err := unlimited.wait(1 << 30); err != nil || unlimited.throttled != 0 {
+		t.Errorf("expected unlimited, %v, %v", err, unlimited.throttled)
+	}
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+
+	"jingoal.com/dfs/conf"
+	"jingoal.com/dfs/meta"
+	"jingoal.com/dfs/metadata"
+	"jingoal.com/dfs/proto/transfer"
+	"jingoal.com/dfs/util"
+)
+
+var (
+	trashRetention       = flag.Duration("trash-retention", 7*24*time.Hour, "duration to keep a removed file in trash bin.")
+	trashPurgeInterval   = flag.Duration("trash-purge-interval", 10*time.Minute, "interval to purge the expired files in trash bin.")
+	trashDomainRetention conf.DomainDuration
+)
+
+func init() {
+	flag.Var(&trashDomainRetention, "trash-domain-retention", "retention of trash bin per domain, in the form of 'domain:duration,domain:duration'.")
+}
+
+// getTrashRetention returns the duration to keep a removed file
+// of the domain in trash bin.
+func getTrashRetention(domain int64) time.Duration {
+	if d, ok := trashDomainRetention.Get(domain); ok {
+		return d
+	}
+
+	return *trashRetention
+}
+
+// checkTrash returns meta.FileNotFound if the file is in trash bin.
+// Trash bin is looked up only for a domain with trash enabled, files
+// left in it after disabled are visible until purged.
+func (s *DFSServer) checkTrash(id string, domain int64) error {
+	if !conf.IsTrashEnabled(domain) {
+		return nil
+	}
+
+	t, err := s.trashOp.LookupTrashById(id)
+	if err != nil {
+		return err
+	}
+	if t != nil {
+		return meta.FileNotFound
+	}
+
+	return nil
+}
+
+// trashedFiles returns the set of fids which are in trash bin, only
+// the files of domains with trash enabled are looked up, as checkTrash.
+func (s *DFSServer) trashedFiles(keys []fileKey) (map[string]bool, error) {
+	result := make(map[string]bool)
+
+	ids := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if len(k.id) > 0 && conf.IsTrashEnabled(k.domain) {
+			ids = append(ids, k.id)
+		}
+	}
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	trashes, err := s.trashOp.LookupTrashes(ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range trashes {
+		result[t.Id] = true
+	}
+
+	return result, nil
+}
+
+// trashFile puts a file into trash bin instead of removing it.
+func (s *DFSServer) trashFile(id string, domain int64, peerAddr string) (*metadata.Trash, error) {
+	startTime := time.Now()
+
+	_, fid, _, err := s.findFileForRead(id, domain)
+	if err != nil {
+		return nil, err
+	}
+	if fid == "" {
+		return nil, meta.FileNotFound
+	}
+
+	t := &metadata.Trash{
+		Id:        id,
+		Domain:    domain,
+		TrashTime: startTime.Unix(),
+		PurgeTime: startTime.Add(getTrashRetention(domain)).Unix(),
+		Client:    peerAddr,
+	}
+	if err := s.trashOp.SaveTrash(t); err != nil {
+		return nil, err
+	}
+
+	event := &metadata.Event{
+		EType:     metadata.SucTrash,
+		Timestamp: util.GetTimeInMilliSecond(),
+		Domain:    domain,
+		Fid:       id,
+		Elapse:    time.Since(startTime).Nanoseconds(),
+		Description: fmt.Sprintf("%s, client %s, %s",
+			metadata.SucTrash.String(), peerAddr, t.String()),
+	}
+	if er := s.eventOp.SaveEvent(event); er != nil {
+		glog.Warningf("%s, error: %v", event.String(), er)
+	}
+
+	return t, nil
+}
+
+// RestoreFile restores a removed file from trash bin.
+func (s *DFSServer) RestoreFile(ctx context.Context, req *transfer.RestoreFileReq) (*transfer.PutFileRep, error) {
+	serviceName := "RestoreFile"
+	peerAddr := getPeerAddressString(ctx)
+	glog.V(3).Infof("%s, client: %s, %v", serviceName, peerAddr, req)
+
+	if len(req.Id) == 0 || req.Domain <= 0 {
+		return nil, fmt.Errorf("invalid request [%v]", req)
+	}
+
+	t, err := bizFunc(s.restoreFileBiz).withDeadline(serviceName, ctx, req, serviceName, peerAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	result, ok := t.(*transfer.PutFileRep)
+	if ok {
+		return result, nil
+	}
+
+	return nil, AssertionError
+}
+
+func (s *DFSServer) restoreFileBiz(c interface{}, r interface{}, args []interface{}) (interface{}, error) {
+	startTime := time.Now()
+
+	req, ok := r.(*transfer.RestoreFileReq)
+	if !ok {
+		return nil, AssertionError
+	}
+
+	_, peerAddr, err := extractStreamFuncParams(args)
+	if err != nil {
+		return nil, err
+	}
+
+	var mf msgFunc
+	mf = func() (interface{}, string) {
+		return nil, fmt.Sprintf("restorefile, fid %s, domain %d", req.Id, req.Domain)
+	}
+
+	t, err := s.trashOp.LookupTrashById(req.Id)
+	if err != nil {
+		return mf, err
+	}
+	if t == nil || t.Domain != req.Domain {
+		return mf, meta.FileNotFound
+	}
+
+	// Removing from trash bin also prevents the purger from
+	// deleting the file concurrently.
+	if err := s.trashOp.RemoveTrashById(req.Id); err != nil {
+		return mf, err
+	}
+
+	_, _, info, err := s.findFileForRead(req.Id, req.Domain)
+	if err == nil && info == nil {
+		err = meta.FileNotFound
+	}
+	if err != nil {
+		if er := s.trashOp.SaveTrash(t); er != nil {
+			glog.Warningf("Failed to put back %s, %v", t.String(), er)
+		}
+		return mf, err
+	}
+
+	event := &metadata.Event{
+		EType:     metadata.SucRestore,
+		Timestamp: util.GetTimeInMilliSecond(),
+		Domain:    req.Domain,
+		Fid:       req.Id,
+		Elapse:    time.Since(startTime).Nanoseconds(),
+		Description: fmt.Sprintf("%s, client %s, %s",
+			metadata.SucRestore.String(), peerAddr, t.String()),
+	}
+	if er := s.eventOp.SaveEvent(event); er != nil {
+		glog.Warningf("%s, error: %v", event.String(), er)
+	}
+
+	mf = func() (interface{}, string) {
+		return &transfer.PutFileRep{
+				File: info,
+			},
+			fmt.Sprintf("restorefile, fid %s, domain %d, size %d, biz %s, name %s", info.Id, info.Domain, info.Size, info.Biz, info.Name)
+	}
+
+	return mf, nil
+}
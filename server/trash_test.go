@@ -0,0 +1,140 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"jingoal.com/dfs/conf"
+	"jingoal.com/dfs/proto/transfer"
+)
+
+// enableTrash enables trash bin for domain, returns a function
+// to restore the flag.
+func enableTrash(t *testing.T, domain int64) func() {
+	old, err := conf.GetFlag(conf.FlagKeyTrash)
+	if err != nil {
+		t.Fatalf("GetFlag error %v", err)
+	}
+
+	if err := conf.UpdateFlag(&conf.FeatureFlag{
+		Key:     conf.FlagKeyTrash,
+		Domains: []uint32{uint32(domain)},
+		Groups:  []string{},
+	}); err != nil {
+		t.Fatalf("UpdateFlag error %v", err)
+	}
+
+	return func() {
+		conf.UpdateFlag(old)
+	}
+}
+
+func TestTrashAndRestore(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	domain := testDomain()
+	defer enableTrash(t, domain)()
+
+	content := []byte("file in trash bin")
+	inf, err := putFile(s, &transfer.FileInfo{Domain: domain, Name: "trash.txt", Biz: "unit-test"}, content, 1024)
+	if err != nil {
+		t.Fatalf("PutFile error %v", err)
+	}
+
+	rep, err := s.RemoveFile(ctx, &transfer.RemoveFileReq{Id: inf.Id, Domain: domain})
+	if err != nil {
+		t.Fatalf("RemoveFile error %v", err)
+	}
+	if !rep.Result {
+		t.Errorf("expected result true for a file put into trash bin")
+	}
+
+	// A file in trash bin is invisible.
+	if _, _, err := getFile(s, &transfer.GetFileReq{Id: inf.Id, Domain: domain}); err == nil {
+		t.Errorf("expected error of getting a file in trash bin")
+	}
+	if _, err := s.Stat(ctx, &transfer.GetFileReq{Id: inf.Id, Domain: domain}); err == nil {
+		t.Errorf("expected error of stat a file in trash bin")
+	}
+	erep, err := s.Exist(ctx, &transfer.ExistReq{Id: inf.Id, Domain: domain})
+	if err != nil {
+		t.Fatalf("Exist error %v", err)
+	}
+	if erep.Result {
+		t.Errorf("expected a file in trash bin not exist")
+	}
+	lrep, err := s.ListFiles(ctx, &transfer.ListFilesReq{Domain: domain})
+	if err != nil {
+		t.Fatalf("ListFiles error %v", err)
+	}
+	if len(lrep.Files) != 0 {
+		t.Errorf("expected no file listed, got %d", len(lrep.Files))
+	}
+
+	// A file is restored only in its domain.
+	if _, err := s.RestoreFile(ctx, &transfer.RestoreFileReq{Id: inf.Id, Domain: domain + 1}); err == nil {
+		t.Errorf("expected error of restoring in another domain")
+	}
+
+	if _, err := s.RestoreFile(ctx, &transfer.RestoreFileReq{Id: inf.Id, Domain: domain}); err != nil {
+		t.Fatalf("RestoreFile error %v", err)
+	}
+
+	info, got, err := getFile(s, &transfer.GetFileReq{Id: inf.Id, Domain: domain})
+	if err != nil {
+		t.Fatalf("GetFile error %v", err)
+	}
+	if info == nil || info.Id != inf.Id || string(got) != string(content) {
+		t.Errorf("expected the restored file, got %v %q", info, got)
+	}
+
+	if _, err := s.RestoreFile(ctx, &transfer.RestoreFileReq{Id: inf.Id, Domain: domain}); err == nil {
+		t.Errorf("expected error of restoring a file not in trash bin")
+	}
+}
+
+func TestPurgeTrashes(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	domain := testDomain()
+	defer enableTrash(t, domain)()
+
+	inf, err := putFile(s, &transfer.FileInfo{Domain: domain, Name: "purge.txt", Biz: "unit-test"}, []byte("file to purge"), 1024)
+	if err != nil {
+		t.Fatalf("PutFile error %v", err)
+	}
+	if _, err := s.RemoveFile(ctx, &transfer.RemoveFileReq{Id: inf.Id, Domain: domain}); err != nil {
+		t.Fatalf("RemoveFile error %v", err)
+	}
+
+	h := s.selector.shardHandlers[testShardName].handler
+
+	// Not purged before retention.
+	s.selector.purgeTrashes(time.Now().Unix())
+	tr, err := s.trashOp.LookupTrashById(inf.Id)
+	if err != nil || tr == nil {
+		t.Fatalf("expected trash kept before retention, %v", err)
+	}
+	if fid, _, _, err := h.Find(inf.Id); err != nil || fid == "" {
+		t.Fatalf("expected file kept before retention, %v", err)
+	}
+
+	s.selector.purgeTrashes(time.Now().Add(getTrashRetention(domain) + time.Minute).Unix())
+
+	tr, err = s.trashOp.LookupTrashById(inf.Id)
+	if err != nil {
+		t.Fatalf("LookupTrashById error %v", err)
+	}
+	if tr != nil {
+		t.Errorf("expected trash purged, got %s", tr.String())
+	}
+	fid, _, _, err := h.Find(inf.Id)
+	if err != nil {
+		t.Fatalf("Find error %v", err)
+	}
+	if fid != "" {
+		t.Errorf("expected file removed after retention, got %s", fid)
+	}
+}
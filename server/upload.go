@@ -0,0 +1,392 @@
+package server
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"jingoal.com/dfs/fileop"
+	"jingoal.com/dfs/metadata"
+	"jingoal.com/dfs/proto/transfer"
+)
+
+var (
+	uploadSessionTimeout = flag.Duration("upload-session-timeout", 24*time.Hour, "duration to keep an abandoned upload session.")
+	uploadSessionMaxSize = flag.Int64("upload-session-max-size", 1<<30, "max size in bytes of the content of an upload session.")
+)
+
+// StartUpload starts a new upload session or resumes an existing one.
+// Content of session is kept in database, so any node can resume it.
+func (s *DFSServer) StartUpload(ctx context.Context, req *transfer.StartUploadReq) (*transfer.StartUploadRep, error) {
+	serviceName := "StartUpload"
+	peerAddr := getPeerAddressString(ctx)
+	glog.V(3).Infof("%s, client: %s, %v", serviceName, peerAddr, req)
+
+	// Info is required to resume too, its domain must be the session's.
+	if req.Info == nil || req.Info.Domain <= 0 {
+		return nil, fmt.Errorf("invalid request [%v]", req)
+	}
+	if len(req.Session) == 0 {
+		if err := checkAttributes(req.Info.Attrs, false); err != nil {
+			return nil, err
+		}
+		if err := checkExpireTime(req.Info, req.Ttl); err != nil {
+			return nil, err
+		}
+	}
+
+	t, err := bizFunc(s.startUploadBiz).withDeadline(serviceName, ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	result, ok := t.(*transfer.StartUploadRep)
+	if ok {
+		return result, nil
+	}
+
+	return nil, AssertionError
+}
+
+func (s *DFSServer) startUploadBiz(c interface{}, r interface{}, args []interface{}) (interface{}, error) {
+	req, ok := r.(*transfer.StartUploadReq)
+	if !ok {
+		return nil, AssertionError
+	}
+
+	var mf msgFunc
+	mf = func() (interface{}, string) {
+		return nil, fmt.Sprintf("startupload, session %s", req.Session)
+	}
+
+	if len(req.Session) > 0 {
+		u, err := s.lookupUploadSession(req.Session)
+		if err != nil {
+			return mf, err
+		}
+		if err := checkUploadSession(u, req.Info); err != nil {
+			return mf, err
+		}
+
+		mf = func() (interface{}, string) {
+			return &transfer.StartUploadRep{
+					Session: req.Session,
+					Offset:  u.Offset,
+				},
+				fmt.Sprintf("startupload resume, %s", u.String())
+		}
+		return mf, nil
+	}
+
+	inf := req.Info
+	if inf.Size > *uploadSessionMaxSize {
+		return mf, fmt.Errorf("upload session size %d, beyond max size %d", inf.Size, *uploadSessionMaxSize)
+	}
+	if err := s.checkQuota(inf.Domain, inf.Size); err != nil {
+		return mf, err
+	}
+
+	now := time.Now().Unix()
+	u := &metadata.UploadSession{
+		Id:         bson.NewObjectId(),
+		Domain:     inf.Domain,
+		User:       inf.User,
+		Biz:        inf.Biz,
+		Name:       inf.Name,
+		Md5:        inf.Md5,
+		Size:       inf.Size,
+		Attrs:      inf.Attrs,
+		ExpireTime: inf.ExpireTime,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+
+	if err := s.uploadOp.SaveUploadSession(u); err != nil {
+		return mf, err
+	}
+
+	mf = func() (interface{}, string) {
+		return &transfer.StartUploadRep{
+				Session: u.Id.Hex(),
+			},
+			fmt.Sprintf("startupload new, %s", u.String())
+	}
+	return mf, nil
+}
+
+// putUploadStream receives file content of an upload session from client
+// and appends it to the content of session. The first request must carry
+// info of file whose domain is the session's.
+func (s *DFSServer) putUploadStream(req *transfer.PutFileReq, stream transfer.FileTransfer_PutFileServer, startTime time.Time, serviceName string, peerAddr string) (msgFunc, error) {
+	glog.V(3).Infof("%s start, session: %s, client: %s", serviceName, req.Session, peerAddr)
+
+	var mf msgFunc
+	mf = func() (interface{}, string) {
+		return nil, fmt.Sprintf("putfile, session %s", req.Session)
+	}
+
+	u, err := s.lookupUploadSession(req.Session)
+	if err != nil {
+		return mf, err
+	}
+	// The domain of info is authorized, so it must be the session's.
+	if err := checkUploadSession(u, req.GetInfo()); err != nil {
+		return mf, err
+	}
+
+	mf = func() (interface{}, string) {
+		return nil, fmt.Sprintf("putfile, session %s, domain %d, offset %d, biz %s, user %d, name %s", req.Session, u.Domain, u.Offset, u.Biz, u.User, u.Name)
+	}
+
+	throttle := newStreamThrottle(stream.Context(), serviceName, u.Domain, u.Biz)
+	defer throttle.done()
+
+	for {
+		chunk := req.GetChunk()
+		if chunk != nil && len(chunk.Payload) > 0 {
+			// Overlapped chunk is allowed for a client retransmitting
+			// after an interruption, but a gap is not.
+			if chunk.Pos < 0 || chunk.Pos > u.Offset {
+				return mf, fmt.Errorf("upload session %s, invalid chunk pos %d, expected %d", req.Session, chunk.Pos, u.Offset)
+			}
+
+			end := chunk.Pos + int64(len(chunk.Payload))
+			if u.Size > 0 && end > u.Size {
+				return mf, fmt.Errorf("upload session %s, chunk ends at %d, beyond size %d", req.Session, end, u.Size)
+			}
+			// Size declared may be absent, the content is limited anyway.
+			if end > *uploadSessionMaxSize {
+				return mf, fmt.Errorf("upload session %s, chunk ends at %d, beyond max size %d", req.Session, end, *uploadSessionMaxSize)
+			}
+
+			if end > u.Offset {
+				piece := chunk.Payload[u.Offset-chunk.Pos:]
+				if err := throttle.wait(len(piece)); err != nil {
+					return mf, err
+				}
+
+				err := s.uploadOp.AppendPiece(u, piece)
+				if err == mgo.ErrNotFound {
+					return mf, fmt.Errorf("upload session %s removed or written by another stream", req.Session)
+				}
+				if err != nil {
+					return mf, err
+				}
+			}
+		}
+
+		req, err = stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			glog.Warningf("PutFile error, session %s, offset %d, %v", u.Id.Hex(), u.Offset, err)
+			return mf, err
+		}
+	}
+
+	return mf, stream.SendAndClose(
+		&transfer.PutFileRep{
+			File: &transfer.FileInfo{
+				Name:   u.Name,
+				Size:   u.Offset,
+				Domain: u.Domain,
+				User:   u.User,
+				Md5:    u.Md5,
+				Biz:    u.Biz,
+			},
+		})
+}
+
+// checkUploadSession returns an error if the info given by client
+// on resuming or uploading does not match the upload session.
+func checkUploadSession(u *metadata.UploadSession, inf *transfer.FileInfo) error {
+	if inf == nil {
+		return fmt.Errorf("upload session %s, no file info", u.Id.Hex())
+	}
+	if inf.Domain != u.Domain {
+		return fmt.Errorf("upload session %s not in domain %d", u.Id.Hex(), inf.Domain)
+	}
+	if inf.Size > 0 && inf.Size != u.Size {
+		return fmt.Errorf("upload session %s, size %d mismatch, expected %d", u.Id.Hex(), inf.Size, u.Size)
+	}
+
+	return nil
+}
+
+// CommitUpload saves the content of an upload session as a file.
+func (s *DFSServer) CommitUpload(ctx context.Context, req *transfer.CommitUploadReq) (*transfer.PutFileRep, error) {
+	serviceName := "CommitUpload"
+	peerAddr := getPeerAddressString(ctx)
+	glog.V(3).Infof("%s, client: %s, %v", serviceName, peerAddr, req)
+
+	if len(req.Session) == 0 || req.Domain <= 0 {
+		return nil, fmt.Errorf("invalid request [%v]", req)
+	}
+
+	t, err := bizFunc(s.commitUploadBiz).withDeadline(serviceName, ctx, req, serviceName, peerAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	result, ok := t.(*transfer.PutFileRep)
+	if ok {
+		return result, nil
+	}
+
+	return nil, AssertionError
+}
+
+func (s *DFSServer) commitUploadBiz(c interface{}, r interface{}, args []interface{}) (interface{}, error) {
+	req, ok := r.(*transfer.CommitUploadReq)
+	if !ok {
+		return nil, AssertionError
+	}
+
+	serviceName, peerAddr, err := extractStreamFuncParams(args)
+	if err != nil {
+		return nil, err
+	}
+
+	var mf msgFunc
+	mf = func() (interface{}, string) {
+		return nil, fmt.Sprintf("commitupload, session %s, domain %d", req.Session, req.Domain)
+	}
+
+	u, err := s.lookupUploadSession(req.Session)
+	if err != nil {
+		return mf, err
+	}
+	if u.Domain != req.Domain {
+		return mf, fmt.Errorf("upload session %s not in domain %d", req.Session, req.Domain)
+	}
+	if u.Size > 0 && u.Offset != u.Size {
+		return mf, fmt.Errorf("upload session %s incomplete, received %d of %d", req.Session, u.Offset, u.Size)
+	}
+	// Size declared may be absent, check quota with the real one.
+	if u.Offset > u.Size {
+		if err := s.checkQuota(u.Domain, u.Offset); err != nil {
+			return mf, err
+		}
+	}
+
+	startTime := time.Now()
+	reqInfo := &transfer.FileInfo{
+		Name:       u.Name,
+		Size:       u.Offset,
+		Domain:     u.Domain,
+		User:       u.User,
+		Md5:        u.Md5,
+		Biz:        u.Biz,
+		Attrs:      u.Attrs,
+		ExpireTime: u.ExpireTime,
+	}
+
+	inf, handler, err := s.copyUploadContent(u, reqInfo, c, startTime, peerAddr)
+	if err != nil {
+		return mf, err
+	}
+
+	// Session removed means committed, only one of concurrent
+	// commits succeeds, the others remove their copy.
+	if err := s.uploadOp.RemoveUploadSessionById(u.Id); err != nil {
+		if _, _, er := (*handler).Remove(inf.Id, inf.Domain); er != nil {
+			glog.Warningf("remove error: %v, upload session %s", er, req.Session)
+		}
+		if err == mgo.ErrNotFound {
+			return mf, fmt.Errorf("upload session %s not found", req.Session)
+		}
+		return mf, err
+	}
+
+	nsecs := time.Since(startTime).Nanoseconds() + 1
+	rate := inf.Size * 8 * 1e6 / nsecs // in kbit/s
+
+	s.saveCreateEvent(inf, (*handler).Name(), nsecs, serviceName, peerAddr)
+	s.saveCreateSpaceLog(inf)
+	s.saveExpiry(inf)
+	instrumentPutFile(inf.Size, rate, serviceName, inf.Biz)
+
+	mf = func() (interface{}, string) {
+		return &transfer.PutFileRep{
+				File: inf,
+			},
+			fmt.Sprintf("commitupload, session %s, fid %s, domain %d, size %d, biz %s, user %d, name %s", req.Session, inf.Id, inf.Domain, inf.Size, inf.Biz, inf.User, inf.Name)
+	}
+
+	return mf, nil
+}
+
+// copyUploadContent copies the content of an upload session into storage.
+func (s *DFSServer) copyUploadContent(u *metadata.UploadSession, reqInfo *transfer.FileInfo, env interface{}, startTime time.Time, peerAddr string) (*transfer.FileInfo, *fileop.DFSFileHandler, error) {
+	chunkSize := requestChunkSize(0)
+	file, handler, err := s.createFile(reqInfo, chunkSize, env, startTime)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inf := file.GetFileInfo()
+	md5sum := md5.New()
+	sha256sum := sha256.New()
+	var n int64
+	err = s.uploadOp.ReadPieces(u, func(data []byte) error {
+		md5sum.Write(data)
+		sha256sum.Write(data)
+		m, er := file.Write(data)
+		n += int64(m)
+		return er
+	})
+	if err == nil {
+		md5hex := hex.EncodeToString(md5sum.Sum(nil))
+		err = verifyContent(u.Size, u.Md5, n, md5hex)
+		if err != nil {
+			s.rollbackPutFile(file, handler, err, peerAddr)
+			return nil, nil, err
+		}
+
+		inf.Size = n
+		inf.Md5 = md5hex
+		inf.Sha256 = hex.EncodeToString(sha256sum.Sum(nil))
+	}
+
+	if err != nil {
+		file.Close()
+	} else {
+		err = file.Close()
+	}
+
+	if err != nil {
+		if _, _, er := (*handler).Remove(inf.Id, inf.Domain); er != nil {
+			glog.Warningf("remove error: %v, upload session %s", er, u.Id.Hex())
+		}
+		return nil, nil, err
+	}
+
+	return inf, handler, nil
+}
+
+// lookupUploadSession finds an upload session.
+func (s *DFSServer) lookupUploadSession(session string) (*metadata.UploadSession, error) {
+	if !bson.IsObjectIdHex(session) {
+		return nil, fmt.Errorf("invalid upload session %s", session)
+	}
+
+	u, err := s.uploadOp.LookupUploadSessionById(bson.ObjectIdHex(session))
+	if err == mgo.ErrNotFound {
+		return nil, fmt.Errorf("upload session %s not found", session)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
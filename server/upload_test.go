@@ -0,0 +1,164 @@
+package server
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"jingoal.com/dfs/proto/transfer"
+)
+
+// putUpload puts chunks of an upload session, info is
+// carried in the first request.
+func putUpload(s *DFSServer, session string, info *transfer.FileInfo, chunks ...*transfer.Chunk) error {
+	stream := &putFileStream{}
+	for i, c := range chunks {
+		req := &transfer.PutFileReq{
+			Session: session,
+			Chunk:   c,
+		}
+		if i == 0 {
+			req.Info = info
+		}
+		stream.reqs = append(stream.reqs, req)
+	}
+
+	return s.PutFile(stream)
+}
+
+func chunkOf(pos int64, payload string) *transfer.Chunk {
+	return &transfer.Chunk{
+		Pos:     pos,
+		Length:  int64(len(payload)),
+		Payload: []byte(payload),
+	}
+}
+
+func TestUploadSession(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	domain := testDomain()
+
+	info := &transfer.FileInfo{
+		Domain: domain,
+		Name:   "upload.txt",
+		Size:   10,
+		Biz:    "unit-test",
+	}
+	rep, err := s.StartUpload(ctx, &transfer.StartUploadReq{Info: info})
+	if err != nil {
+		t.Fatalf("StartUpload error %v", err)
+	}
+	session := rep.Session
+
+	// Domain and size must be the session's.
+	if _, err := s.StartUpload(ctx, &transfer.StartUploadReq{Session: session, Info: &transfer.FileInfo{Domain: domain + 1}}); err == nil {
+		t.Errorf("expected error of resuming in another domain")
+	}
+	if _, err := s.StartUpload(ctx, &transfer.StartUploadReq{Session: session, Info: &transfer.FileInfo{Domain: domain, Size: 11}}); err == nil {
+		t.Errorf("expected error of resuming with another size")
+	}
+	if err := putUpload(s, session, &transfer.FileInfo{Domain: domain + 1}, chunkOf(0, "0123")); err == nil {
+		t.Errorf("expected error of uploading in another domain")
+	}
+	if err := putUpload(s, session, nil, chunkOf(0, "0123")); err == nil {
+		t.Errorf("expected error of uploading without info")
+	}
+
+	// An overlapped chunk is accepted, a gap is not.
+	if err := putUpload(s, session, &transfer.FileInfo{Domain: domain}, chunkOf(0, "0123"), chunkOf(2, "2345")); err != nil {
+		t.Errorf("PutFile of session error %v", err)
+	}
+	if err := putUpload(s, session, &transfer.FileInfo{Domain: domain}, chunkOf(8, "89")); err == nil {
+		t.Errorf("expected error of chunk with gap")
+	}
+	if err := putUpload(s, session, &transfer.FileInfo{Domain: domain}, chunkOf(6, "6789ab")); err == nil {
+		t.Errorf("expected error of chunk beyond size")
+	}
+
+	// Resume on another server, content is not kept by node.
+	other := newTestServer(t)
+	rep, err = other.StartUpload(ctx, &transfer.StartUploadReq{Session: session, Info: &transfer.FileInfo{Domain: domain}})
+	if err != nil {
+		t.Fatalf("StartUpload resume error %v", err)
+	}
+	if rep.Offset != 6 {
+		t.Errorf("expected offset 6, got %d", rep.Offset)
+	}
+	if err := putUpload(other, session, &transfer.FileInfo{Domain: domain}, chunkOf(6, "6789")); err != nil {
+		t.Errorf("PutFile of session error %v", err)
+	}
+
+	if _, err := s.CommitUpload(ctx, &transfer.CommitUploadReq{Session: session, Domain: domain + 1}); err == nil {
+		t.Errorf("expected error of committing in another domain")
+	}
+	prep, err := s.CommitUpload(ctx, &transfer.CommitUploadReq{Session: session, Domain: domain})
+	if err != nil {
+		t.Fatalf("CommitUpload error %v", err)
+	}
+	if prep.File.Size != 10 {
+		t.Errorf("expected size 10, got %d", prep.File.Size)
+	}
+	// Hashes are computed on commit, though no md5 declared.
+	md5sum := md5.Sum([]byte("0123456789"))
+	sha256sum := sha256.Sum256([]byte("0123456789"))
+	if prep.File.Md5 != hex.EncodeToString(md5sum[:]) || prep.File.Sha256 != hex.EncodeToString(sha256sum[:]) {
+		t.Errorf("unexpected hashes, md5 %s, sha256 %s", prep.File.Md5, prep.File.Sha256)
+	}
+	if _, err := s.CommitUpload(ctx, &transfer.CommitUploadReq{Session: session, Domain: domain}); err == nil {
+		t.Errorf("expected error of committing twice")
+	}
+
+	h, _, err := s.selector.getDFSFileHandlerForRead(domain)
+	if err != nil {
+		t.Fatalf("get handler error %v", err)
+	}
+	f, err := (*h).Open(prep.File.Id, domain)
+	if err != nil {
+		t.Fatalf("Open error %v", err)
+	}
+	defer f.Close()
+
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Errorf("read error %v", err)
+	}
+	if string(b) != "0123456789" {
+		t.Errorf("expected 0123456789, got %s", b)
+	}
+}
+
+func TestUploadSessionWithoutSize(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	domain := testDomain()
+
+	old := domainQuota.String()
+	defer domainQuota.Set(old)
+	if err := domainQuota.Set(fmt.Sprintf("%d:8", domain)); err != nil {
+		t.Fatalf("Set quota error %v", err)
+	}
+	defer func(size int64) { *uploadSessionMaxSize = size }(*uploadSessionMaxSize)
+	*uploadSessionMaxSize = 12
+
+	rep, err := s.StartUpload(ctx, &transfer.StartUploadReq{Info: &transfer.FileInfo{Domain: domain, Name: "unsized.txt", Biz: "unit-test"}})
+	if err != nil {
+		t.Fatalf("StartUpload error %v", err)
+	}
+
+	// Content is limited by max size, quota is checked on commit.
+	if err := putUpload(s, rep.Session, &transfer.FileInfo{Domain: domain}, chunkOf(0, "0123456789abc")); err == nil {
+		t.Errorf("expected error of chunk beyond max size")
+	}
+	if err := putUpload(s, rep.Session, &transfer.FileInfo{Domain: domain}, chunkOf(0, "0123456789")); err != nil {
+		t.Fatalf("PutFile of session error %v", err)
+	}
+	if _, err := s.CommitUpload(ctx, &transfer.CommitUploadReq{Session: rep.Session, Domain: domain}); !isQuotaExceeded(err) {
+		t.Errorf("expected quota exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+
+	"jingoal.com/dfs/fileop"
+	"jingoal.com/dfs/metadata"
+	"jingoal.com/dfs/util"
+)
+
+// verifyContent checks the size and md5 computed on receiving against
+// those declared by client. Zero size or empty md5 means not declared.
+func verifyContent(declaredSize int64, declaredMd5 string, size int64, md5 string) error {
+	if declaredSize > 0 && declaredSize != size {
+		return fmt.Errorf("size mismatch, declared %d, received %d", declaredSize, size)
+	}
+
+	if len(declaredMd5) > 0 && !strings.EqualFold(declaredMd5, md5) {
+		return fmt.Errorf("md5 mismatch, declared %s, received %s", declaredMd5, md5)
+	}
+
+	return nil
+}
+
+// rollbackPutFile closes a file failed in verification,
+// removes it from storage and saves a event.
+func (s *DFSServer) rollbackPutFile(file fileop.DFSFile, handler *fileop.DFSFileHandler, cause error, peerAddr string) {
+	inf := file.GetFileInfo()
+
+	if err := file.Close(); err != nil {
+		glog.Warningf("close error: %v, fid %s, client %s", err, inf.Id, peerAddr)
+	}
+
+	if _, _, err := (*handler).Remove(inf.Id, inf.Domain); err != nil {
+		glog.Warningf("remove error: %v, fid %s, client %s", err, inf.Id, peerAddr)
+	}
+
+	event := &metadata.Event{
+		EType:       metadata.FailVerify,
+		Timestamp:   util.GetTimeInMilliSecond(),
+		Domain:      inf.Domain,
+		Fid:         inf.Id,
+		Description: fmt.Sprintf("%s, client %s, %v", metadata.FailVerify.String(), peerAddr, cause),
+	}
+	if er := s.eventOp.SaveEvent(event); er != nil {
+		// log into file instead return.
+		glog.Warningf("%s, error: %v", event.String(), er)
+	}
+}
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestVerifyContent(t *testing.T) {
+	md5 := "d41d8cd98f00b204e9800998ecf8427e"
+
+	cases := []struct {
+		declaredSize int64
+		declaredMd5  string
+		size         int64
+		ok           bool
+	}{
+		{0, "", 100, true},
+		{100, "", 100, true},
+		{100, md5, 100, true},
+		{0, "D41D8CD98F00B204E9800998ECF8427E", 100, true},
+		{99, md5, 100, false},
+		{100, "0123456789abcdef0123456789abcdef", 100, false},
+	}
+
+	for i, c := range cases {
+		err := verifyContent(c.declaredSize, c.declaredMd5, c.size, md5)
+		if (err == nil) != c.ok {
+			t.Errorf("case %d, expected ok %t, got %v", i, c.ok, err)
+		}
+	}
+}
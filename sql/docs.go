@@ -10,6 +10,7 @@
 | name        | varchar(255)  | YES  |     | NULL              |                             |
 | biz         | varchar(50)   | NO   |     | NULL              |                             |
 | md5         | varchar(50)   | NO   |     | NULL              |                             |
+| sha256      | varchar(64)   | NO   |     |                   |                             |
 | user_id     | varchar(30)   | NO   |     | NULL              |                             |
 | domain      | bigint        | NO   | MUL | NULL              |                             |
 | size        | int(11)       | NO   |     | NULL              |                             |
@@ -24,6 +25,7 @@ id : fileId , 长度为50个数字字母的组合，如“597edb8e4ec50300d28915
 name ： 文件名称，可为空，最大可以存储60个字母，数字或汉字，实际占用存储空间会按照字符串的大小计算
 biz ：模块名称，最大长度50
 md5 : md5字符串，长度为50个数字字母的组合，如“5e90fb4a95b33de2bfadd2ed8b4aa357”
+sha256 : sha256字符串，64个十六进制字符，旧数据为空串
 user_id : 用户id，最大长度为30
 domian ：公司id，bigint,最大值为2的64次方
 size ： 文件大小，单位字节，最大可以存储4096M文件大小
@@ -32,6 +34,7 @@ upload_time : 上传时间，格式yyyy-mm-dd HH:MM:SS
 entity_type : 文件存储类型，每种类型用一个整数表示，最大值为255
 ref_cnt : 使用次数，默认值是1,表示文件本身；当文件被一次引用时，值加1
 对（domian，md5）建立复合索引
+对（domian，sha256）建立复合索引
 
 
 
@@ -66,8 +69,11 @@ sql:
 create database file character set = utf8;
 
 create table file_metadata (id varchar(50) primary key,name varchar(255),biz varchar(50) not null,
-md5 varchar(50) not null, user_id varchar(30) not null, domain bigint unsigned not null,size int unsigned not null,
-chun_size int unsigned not null,ref_cnt int unsigned not null,upload_time timestamp,entity_type tinyint not null,index (domain,md5)) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+md5 varchar(50) not null, sha256 varchar(64) not null default '', user_id varchar(30) not null, domain bigint unsigned not null,size int unsigned not null,
+chun_size int unsigned not null,ref_cnt int unsigned not null,upload_time timestamp,entity_type tinyint not null,index (domain,md5),index (domain,sha256)) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- 已有的表
+alter table file_metadata add column sha256 varchar(64) not null default '' after md5, add index (domain,sha256);
 
 create table duplicate_info(dId varchar(50) primary key,fId varchar(50) not null,created_time timestamp,constraint fk_df_id foreign key(fId) references file_metadata(id) ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 
@@ -97,7 +103,10 @@ func Find(fid string)(*FileMetadata, error)
 根据domain，md5获得所有元数据对象，并按上传时间排序，获取最新时间对象返回
 
 
-（5）func Delete(fid string)(bool, entityIdToBeDeleted string, error)
+（5）func FindBySha256(sha256 string, domain int64)(*FileMetadata, error)
+同FindByMD5，按sha256查询
+
+（6）func Delete(fid string)(bool, entityIdToBeDeleted string, error)
 如果fid不带下划线，在表file_metadata中查找记录，如果used_times>=2,对字段used_times值进行减一操作更新记录并返回false和空串，
 否则删除此条记录，并返回true和fid值（非引用id）；
 如果fid带下划线，在表duplicate_info和表file_metadata中查找记录，如果used_times>=2,
@@ -122,6 +131,7 @@ type FileMetadataDAO interface {
 	FindFileMeta(fId string) (*FileMetadataDO, error)                               //查询记录
 	FindFileMetaWithExtAttr(fId string) (*FileMetadataDO, error)                    //查询表file_metadata和ext_attr
 	FindFileMetaByMD5WithExtAttr(md5 string, domain int64) (*FileMetadataDO, error) //查询表file_metadata和ext_attr
+	FindFileMetaBySha256WithExtAttr(sha256 string, domain int64) (*FileMetadataDO, error) //查询表file_metadata和ext_attr
 
 	AddExtAttr(fId string, extAttr string) (int, error)                         //在表ext_attr插入一条数据
 	DeleteExtAttr(fId string) (int, error)                                      //根据fId删除所有扩展属性
@@ -143,6 +153,7 @@ CREATE TABLE file (
   name varchar(255) DEFAULT NULL,
   biz varchar(50) NOT NULL,
   md5 varchar(50) NOT NULL,
+  sha256 varchar(64) NOT NULL DEFAULT '',
   uid varchar(30) NOT NULL,
   domain bigint(20) NOT NULL,
   size int(10) NOT NULL,
@@ -152,9 +163,15 @@ CREATE TABLE file (
   entitytype tinyint(4) NOT NULL,
   PRIMARY KEY (id),
   KEY idx_md5_domain_uploadtime (md5, domain, uploadtime),
-  KEY idx_domain (domain)
+  KEY idx_sha256_domain_uploadtime (sha256, domain, uploadtime),
+  KEY idx_domain (domain),
+  KEY idx_domain_id (domain, id)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_bin;
 
+-- For an existing table:
+-- ALTER TABLE file ADD COLUMN sha256 varchar(64) NOT NULL DEFAULT '' AFTER md5,
+--   ADD KEY idx_sha256_domain_uploadtime (sha256, domain, uploadtime);
+
 CREATE TABLE dupl (
   did varchar(50) NOT NULL,
   fid varchar(50) NOT NULL,
@@ -163,6 +180,8 @@ CREATE TABLE dupl (
   KEY idx_dupl_fid (fid)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_bin;
 
+-- fid of attr is the id of a file, or the did of a duplication,
+-- which has its own attributes.
 CREATE TABLE attr (
   id bigint UNSIGNED NOT NULL AUTO_INCREMENT,
   fid varchar(50) NOT NULL,
@@ -97,6 +97,23 @@ func (mi *MetaImpl) FindByMd5(md5 string, domain int64) (*meta.File, error) {
 	return fm, err
 }
 
+// FindBySha256 looks up the metadata of a file by its sha256 and domain.
+func (mi *MetaImpl) FindBySha256(sha256 string, domain int64) (*meta.File, error) {
+	if sha256 == "" || domain == 0 {
+		return nil, InputArgsNull
+	}
+
+	fmdo, err := mi.FindFileMetaBySha256WithExtAttr(sha256, domain)
+
+	if err != nil || fmdo == nil {
+		return nil, err
+	}
+
+	fm := MetaFile(fmdo)
+
+	return fm, err
+}
+
 // DuplicateWithId duplicates a given file by its fid.
 func (mi *MetaImpl) DuplicateWithId(fid string, did string, createDate time.Time) (string, error) {
 	if fid == "" {
@@ -16,6 +16,7 @@ import (
 var (
 	id            = "597edb8f4ec50300d28915f6"
 	fmd5          = "a94bd72069b8ced73f94667de235d04f8"
+	fsha256       = "4f2b8d3c1e6a9b7d0c5e8f1a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c4d5e"
 	fdomain int64 = 666
 
 	ExtAttr1, ExtAttr2 string
@@ -26,6 +27,7 @@ var (
 		Biz:        "TEST-NORMAL",
 		Name:       "我是测试.txt",
 		Md5:        fmd5,
+		Sha256:     fsha256,
 		UserId:     "jg",
 		Domain:     fdomain,
 		Size:       2048,
@@ -105,6 +107,23 @@ func TestFindByMd5(t *testing.T) {
 	})
 }
 
+func TestFindBySha256(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDao := NewMockFileMetadataDAO(mockCtrl)
+	mockMetaImpl := NewMetaImpl(mockDao)
+	mockDao.EXPECT().FindFileMetaBySha256WithExtAttr(gomock.Eq(fsha256), gomock.Eq(fdomain)).Return(fileDo, nil)
+
+	Convey("Find file by sha256 and domain ok.", t, func() {
+		fm, err := mockMetaImpl.FindBySha256(fsha256, fdomain)
+		So(err, ShouldBeNil)
+		So(fm, ShouldNotBeNil)
+		So(fm.Sha256, ShouldEqual, fsha256)
+		So(fm.Md5, ShouldEqual, fmd5)
+	})
+}
+
 func TestDuplicateWithId(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -111,6 +111,19 @@ func (_mr *MockFileMetadataDAOMockRecorder) FindFileMetaByMD5WithExtAttr(arg0, a
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "FindFileMetaByMD5WithExtAttr", reflect.TypeOf((*MockFileMetadataDAO)(nil).FindFileMetaByMD5WithExtAttr), arg0, arg1)
 }
 
+// FindFileMetaBySha256WithExtAttr mocks base method
+func (_m *MockFileMetadataDAO) FindFileMetaBySha256WithExtAttr(sha256 string, domain int64) (*FileMetadataDO, error) {
+	ret := _m.ctrl.Call(_m, "FindFileMetaBySha256WithExtAttr", sha256, domain)
+	ret0, _ := ret[0].(*FileMetadataDO)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindFileMetaBySha256WithExtAttr indicates an expected call of FindFileMetaBySha256WithExtAttr
+func (_mr *MockFileMetadataDAOMockRecorder) FindFileMetaBySha256WithExtAttr(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "FindFileMetaBySha256WithExtAttr", reflect.TypeOf((*MockFileMetadataDAO)(nil).FindFileMetaBySha256WithExtAttr), arg0, arg1)
+}
+
 // AddExtAttr mocks base method
 func (_m *MockFileMetadataDAO) AddExtAttr(fId string, extAttr string) (int, error) {
 	ret := _m.ctrl.Call(_m, "AddExtAttr", fId, extAttr)
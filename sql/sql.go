@@ -11,10 +11,10 @@ import (
 )
 
 const (
-	fm_insert           = "INSERT INTO file_metadata (id,name,biz,md5,user_id,domain,size,chun_size,entity_type,ref_cnt,upload_time) VALUES (?,?,?,?,?,?,?,?,?,?,?)"
+	fm_insert           = "INSERT INTO file_metadata (id,name,biz,md5,sha256,user_id,domain,size,chun_size,entity_type,ref_cnt,upload_time) VALUES (?,?,?,?,?,?,?,?,?,?,?,?)"
 	fm_delete           = "DELETE FROM file_metadata WHERE id=?"
 	fm_update_refcnt    = "UPDATE file_metadata set ref_cnt = ? WHERE id=?"
-	fm_select           = "SELECT id,name,biz,md5,user_id,domain,size,chun_size,entity_type,ref_cnt,upload_time FROM file_metadata WHERE id = ?"
+	fm_select           = "SELECT id,name,biz,md5,sha256,user_id,domain,size,chun_size,entity_type,ref_cnt,upload_time FROM file_metadata WHERE id = ?"
 	ea_insert           = "INSERT INTO ext_attr (fId,attr) VALUES (?,?)"
 	ea_delete           = "DELETE FROM ext_attr WHERE fId=?"
 	ea_select           = "SELECT attr from ext_attr WHERE fId = ?"
@@ -22,7 +22,8 @@ const (
 	di_delete_bydid     = "DELETE FROM duplicate_info WHERE dId=?"
 	di_delete_byfid     = "DELETE FROM duplicate_info WHERE fId=?"
 	di_select           = "SELECT fId,created_time from duplicate_info WHERE dId = ?"
-	fm_sel_bydomainmd5  = "SELECT id,name,biz,user_id,size,chun_size,entity_type,ref_cnt,upload_time FROM file_metadata WHERE domain = ? AND md5 = ? ORDER BY upload_time DESC"
+	fm_sel_bydomainmd5  = "SELECT id,name,biz,md5,sha256,user_id,domain,size,chun_size,entity_type,ref_cnt,upload_time FROM file_metadata WHERE domain = ? AND md5 = ? ORDER BY upload_time DESC"
+	fm_sel_bydomainsha  = "SELECT id,name,biz,md5,sha256,user_id,domain,size,chun_size,entity_type,ref_cnt,upload_time FROM file_metadata WHERE domain = ? AND sha256 = ? ORDER BY upload_time DESC"
 	fm_sel_withextattr  = "SELECT id,name,biz,user_id,domain,size,chun_size,entity_type,ref_cnt,upload_time FROM file_metadata WHERE id = ? "
 	fm_refcnt_incre_one = "UPDATE file_metadata SET ref_cnt=ref_cnt+1 WHERE id =?"
 )
@@ -32,6 +33,7 @@ type FileMetadataDO struct {
 	Name       string
 	Biz        string
 	Md5        string
+	Sha256     string
 	UserId     string
 	ExtAttr    map[string]string
 	Domain     int64
@@ -55,7 +57,7 @@ func (operator FMOperator) AddFileMeta(fm *FileMetadataDO) (int, error) {
 	}
 
 	defer stmt.Close()
-	res, err := stmt.Exec(fm.FId, fm.Name, fm.Biz, fm.Md5, fm.UserId, fm.Domain, fm.Size, fm.ChunkSize, fm.EntityType, fm.RefCount, fm.UploadTime)
+	res, err := stmt.Exec(fm.FId, fm.Name, fm.Biz, fm.Md5, fm.Sha256, fm.UserId, fm.Domain, fm.Size, fm.ChunkSize, fm.EntityType, fm.RefCount, fm.UploadTime)
 	if err != nil {
 		return 0, err
 	}
@@ -123,7 +125,7 @@ func (operator FMOperator) FindFileMeta(fId string) (*FileMetadataDO, error) {
 	var fm = new(FileMetadataDO)
 	var upload_time string
 
-	err = rows.Scan(&fm.FId, &fm.Name, &fm.Biz, &fm.Md5, &fm.UserId, &fm.Domain, &fm.Size, &fm.ChunkSize, &fm.EntityType, &fm.RefCount, &upload_time)
+	err = rows.Scan(&fm.FId, &fm.Name, &fm.Biz, &fm.Md5, &fm.Sha256, &fm.UserId, &fm.Domain, &fm.Size, &fm.ChunkSize, &fm.EntityType, &fm.RefCount, &upload_time)
 	if err != nil {
 		return nil, err
 	}
@@ -282,13 +284,23 @@ func (operator FMOperator) FindDupInfoByDId(dId string) (string, time.Time, erro
 }
 
 func (operator FMOperator) FindFileMetaByMD5WithExtAttr(md5 string, domain int64) (*FileMetadataDO, error) {
-	stmt, err := operator.db.Prepare(fm_sel_bydomainmd5)
+	return operator.findLatestFileMetaWithExtAttr(fm_sel_bydomainmd5, md5, domain)
+}
+
+func (operator FMOperator) FindFileMetaBySha256WithExtAttr(sha256 string, domain int64) (*FileMetadataDO, error) {
+	return operator.findLatestFileMetaWithExtAttr(fm_sel_bydomainsha, sha256, domain)
+}
+
+// findLatestFileMetaWithExtAttr finds the latest uploaded file of domain
+// by a content hash, with the given query.
+func (operator FMOperator) findLatestFileMetaWithExtAttr(query string, hash string, domain int64) (*FileMetadataDO, error) {
+	stmt, err := operator.db.Prepare(query)
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	rows, err := stmt.Query(domain, md5)
+	rows, err := stmt.Query(domain, hash)
 	if err != nil {
 		return nil, err
 	}
@@ -301,7 +313,7 @@ func (operator FMOperator) FindFileMetaByMD5WithExtAttr(md5 string, domain int64
 		return nil, nil
 	}
 
-	err = rows.Scan(&fm.FId, &fm.Name, &fm.Biz, &fm.UserId, &fm.Size, &fm.ChunkSize, &fm.EntityType, &fm.RefCount, &upload_time)
+	err = rows.Scan(&fm.FId, &fm.Name, &fm.Biz, &fm.Md5, &fm.Sha256, &fm.UserId, &fm.Domain, &fm.Size, &fm.ChunkSize, &fm.EntityType, &fm.RefCount, &upload_time)
 
 	if err != nil {
 		return nil, err
@@ -137,6 +137,8 @@ func TestFindFileMetaByMD5WithExtAttr(t *testing.T) {
 		So(err, ShouldBeNil)
 		So(fm, ShouldNotBeNil)
 		So(fId, ShouldEqual, fId)
+		So(fm.Md5, ShouldEqual, md5)
+		So(fm.Domain, ShouldEqual, domain)
 		So(fm.ExtAttr, ShouldNotBeNil)
 		So(fm.ExtAttr["color"], ShouldEqual, "green")
 	})
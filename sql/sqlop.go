@@ -24,6 +24,9 @@ type FileMetadataDAO interface {
 	// 根据md5,domain查询表file_metadata和ext_attr，返回带有extAttr属性的对象
 	FindFileMetaByMD5WithExtAttr(md5 string, domain int64) (*FileMetadataDO, error)
 
+	// 根据sha256,domain查询表file_metadata和ext_attr，返回带有extAttr属性的对象
+	FindFileMetaBySha256WithExtAttr(sha256 string, domain int64) (*FileMetadataDO, error)
+
 	// 添加表ext_attr记录
 	AddExtAttr(fId string, extAttr string) (int, error)
 
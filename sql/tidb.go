@@ -12,18 +12,22 @@ import (
 )
 
 const (
-	file_field      = "id, name, biz, md5, uid, domain, size, chunksize, entitytype, refcnt, uploadtime"
-	f_insert        = "INSERT INTO file (" + file_field + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	file_field      = "id, name, biz, md5, sha256, uid, domain, size, chunksize, entitytype, refcnt, uploadtime"
+	f_insert        = "INSERT INTO file (" + file_field + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
 	f_select        = "SELECT " + file_field + " FROM file WHERE id = ?"
 	f_sel_by_md5    = "SELECT " + file_field + " FROM file WHERE md5 = ? AND domain = ? ORDER BY uploadtime DESC"
+	f_sel_by_sha256 = "SELECT " + file_field + " FROM file WHERE sha256 = ? AND domain = ? ORDER BY uploadtime DESC"
 	f_sel_by_did    = "SELECT " + file_field + " FROM file as f JOIN dupl as d ON (f.id = d.fid) WHERE d.did = ?"
 	f_update_refcnt = "UPDATE file set refcnt = ? WHERE id=?"
 	f_ref_inc_one   = "UPDATE file SET refcnt=refcnt+1 WHERE id =?"
 	f_ref_dec_one   = "UPDATE file SET refcnt=refcnt-1 WHERE id =?"
 	f_delete        = "DELETE FROM file WHERE id=?"
+	f_list          = "SELECT " + file_field + " FROM file WHERE domain = ?"
+	f_list_dupl     = "SELECT d.did, f.name, f.biz, f.md5, f.sha256, f.uid, f.domain, f.size, f.chunksize, f.entitytype, f.refcnt, d.createdtime FROM dupl as d JOIN file as f ON (f.id = d.fid) WHERE f.domain = ?"
 	a_insert        = "INSERT INTO attr (fid, k, v) VALUES (?, ?, ?)"
 	a_select        = "SELECT k, v from attr WHERE fid = ?"
 	a_delete        = "DELETE FROM attr WHERE fid=?"
+	a_delete_key    = "DELETE FROM attr WHERE fid=? AND k=?"
 	d_insert        = "INSERT INTO dupl (did, fid, createdtime) VALUES (?, ?, ?)"
 	d_select        = "SELECT fid, createdtime from dupl WHERE did = ?"
 	d_delete_bydid  = "DELETE FROM dupl WHERE did=?"
@@ -41,6 +45,7 @@ type File struct {
 	Name       string
 	Biz        string
 	Md5        string
+	Sha256     string
 	UserId     string
 	ExtAttr    map[string]string
 	Domain     int64
@@ -69,7 +74,7 @@ func (operator *FOperator) LookupFile(ctx context.Context, fid string) (*File, e
 		fm := &File{}
 		var upload_time string
 
-		err = stmt.QueryRow(fid).Scan(&fm.FId, &fm.Name, &fm.Biz, &fm.Md5, &fm.UserId, &fm.Domain, &fm.Size, &fm.ChunkSize, &fm.EntityType, &fm.RefCount, &upload_time)
+		err = stmt.QueryRow(fid).Scan(&fm.FId, &fm.Name, &fm.Biz, &fm.Md5, &fm.Sha256, &fm.UserId, &fm.Domain, &fm.Size, &fm.ChunkSize, &fm.EntityType, &fm.RefCount, &upload_time)
 		if err != nil {
 			return err
 		}
@@ -90,6 +95,7 @@ func (operator *FOperator) LookupFile(ctx context.Context, fid string) (*File, e
 }
 
 // LookupFileByDid returns a file metadata and attributes by duplicate id.
+// The user attributes are the duplication's.
 func (operator *FOperator) LookupFileByDid(ctx context.Context, did string) (*File, error) {
 	var f *File
 	err := operator.Tx(func(tx *sql.Tx) error {
@@ -102,7 +108,7 @@ func (operator *FOperator) LookupFileByDid(ctx context.Context, did string) (*Fi
 		fm := &File{}
 		var upload_time string
 
-		err = stmt.QueryRow(did).Scan(&fm.FId, &fm.Name, &fm.Biz, &fm.Md5, &fm.UserId, &fm.Domain, &fm.Size, &fm.ChunkSize, &fm.EntityType, &fm.RefCount, &upload_time)
+		err = stmt.QueryRow(did).Scan(&fm.FId, &fm.Name, &fm.Biz, &fm.Md5, &fm.Sha256, &fm.UserId, &fm.Domain, &fm.Size, &fm.ChunkSize, &fm.EntityType, &fm.RefCount, &upload_time)
 		if err != nil {
 			return err
 		}
@@ -114,7 +120,13 @@ func (operator *FOperator) LookupFileByDid(ctx context.Context, did string) (*Fi
 			return err
 		}
 
-		fm.ExtAttr = attrs
+		// A duplication has its own user attributes, keyed by its id.
+		dattrs, err := operator.getFileAttrs(ctx, tx, did)
+		if err != nil {
+			return err
+		}
+
+		fm.ExtAttr = meta.DuplExtAttrs(attrs, dattrs)
 
 		f = fm
 		return nil
@@ -136,7 +148,34 @@ func (operator *FOperator) LookupFileByMD5(ctx context.Context, md5 string, doma
 		fm := &File{}
 		var upload_time string
 
-		err = stmt.QueryRow(md5, domain).Scan(&fm.FId, &fm.Name, &fm.Biz, &fm.Md5, &fm.UserId, &fm.Domain, &fm.Size, &fm.ChunkSize, &fm.EntityType, &fm.RefCount, &upload_time)
+		err = stmt.QueryRow(md5, domain).Scan(&fm.FId, &fm.Name, &fm.Biz, &fm.Md5, &fm.Sha256, &fm.UserId, &fm.Domain, &fm.Size, &fm.ChunkSize, &fm.EntityType, &fm.RefCount, &upload_time)
+		if err != nil {
+			return err
+		}
+
+		timeLayout := "2006-01-02 15:04:05"
+		fm.UploadTime, err = time.Parse(timeLayout, upload_time)
+
+		f = fm
+		return nil
+	})
+	return f, err
+}
+
+// LookupFileBySha256 returns file metadata without attributes by it's sha256.
+func (operator *FOperator) LookupFileBySha256(ctx context.Context, sha256 string, domain int64) (*File, error) {
+	var f *File
+	err := operator.Tx(func(tx *sql.Tx) error {
+		stmt, err := tx.Prepare(f_sel_by_sha256)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		fm := &File{}
+		var upload_time string
+
+		err = stmt.QueryRow(sha256, domain).Scan(&fm.FId, &fm.Name, &fm.Biz, &fm.Md5, &fm.Sha256, &fm.UserId, &fm.Domain, &fm.Size, &fm.ChunkSize, &fm.EntityType, &fm.RefCount, &upload_time)
 		if err != nil {
 			return err
 		}
@@ -150,6 +189,130 @@ func (operator *FOperator) LookupFileByMD5(ctx context.Context, md5 string, doma
 	return f, err
 }
 
+// ListFiles returns files without attributes which match the filter,
+// in ascending order of id, starts after the given id.
+func (operator *FOperator) ListFiles(ctx context.Context, filter *meta.FileFilter, after string, limit int) ([]*File, error) {
+	query := f_list
+	args := []interface{}{filter.Domain}
+	if len(filter.UserId) > 0 {
+		query += " AND uid = ?"
+		args = append(args, filter.UserId)
+	}
+	if len(filter.Biz) > 0 {
+		query += " AND biz = ?"
+		args = append(args, filter.Biz)
+	}
+	if !filter.Start.IsZero() {
+		query += " AND uploadtime >= ?"
+		args = append(args, filter.Start)
+	}
+	if !filter.End.IsZero() {
+		query += " AND uploadtime < ?"
+		args = append(args, filter.End)
+	}
+	query += " AND id > ? ORDER BY id LIMIT ?"
+	args = append(args, after, limit)
+
+	result := make([]*File, 0, limit)
+	err := operator.Tx(func(tx *sql.Tx) error {
+		stmt, err := tx.Prepare(query)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		rows, err := stmt.Query(args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			fm := &File{}
+			var upload_time string
+
+			err = rows.Scan(&fm.FId, &fm.Name, &fm.Biz, &fm.Md5, &fm.Sha256, &fm.UserId, &fm.Domain, &fm.Size, &fm.ChunkSize, &fm.EntityType, &fm.RefCount, &upload_time)
+			if err != nil {
+				return err
+			}
+
+			fm.UploadTime, err = time.Parse(TimeLayout, upload_time)
+			if err != nil {
+				return err
+			}
+
+			result = append(result, fm)
+		}
+
+		return rows.Err()
+	})
+
+	return result, err
+}
+
+// ListDupls returns duplications without attributes which match the
+// filter, in ascending order of duplication id, starts after the given
+// id. A duplication is returned as the file of its entity, but with
+// its own id and created time.
+func (operator *FOperator) ListDupls(ctx context.Context, filter *meta.FileFilter, after string, limit int) ([]*File, error) {
+	query := f_list_dupl
+	args := []interface{}{filter.Domain}
+	if len(filter.UserId) > 0 {
+		query += " AND f.uid = ?"
+		args = append(args, filter.UserId)
+	}
+	if len(filter.Biz) > 0 {
+		query += " AND f.biz = ?"
+		args = append(args, filter.Biz)
+	}
+	if !filter.Start.IsZero() {
+		query += " AND d.createdtime >= ?"
+		args = append(args, filter.Start)
+	}
+	if !filter.End.IsZero() {
+		query += " AND d.createdtime < ?"
+		args = append(args, filter.End)
+	}
+	query += " AND d.did > ? ORDER BY d.did LIMIT ?"
+	args = append(args, after, limit)
+
+	result := make([]*File, 0, limit)
+	err := operator.Tx(func(tx *sql.Tx) error {
+		stmt, err := tx.Prepare(query)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		rows, err := stmt.Query(args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			fm := &File{}
+			var created_time string
+
+			err = rows.Scan(&fm.FId, &fm.Name, &fm.Biz, &fm.Md5, &fm.Sha256, &fm.UserId, &fm.Domain, &fm.Size, &fm.ChunkSize, &fm.EntityType, &fm.RefCount, &created_time)
+			if err != nil {
+				return err
+			}
+
+			fm.UploadTime, err = time.Parse(TimeLayout, created_time)
+			if err != nil {
+				return err
+			}
+
+			result = append(result, fm)
+		}
+
+		return rows.Err()
+	})
+
+	return result, err
+}
+
 // SaveFile saves file metadata and it's attributes if any.
 func (operator *FOperator) SaveFile(ctx context.Context, fm *File) error {
 	return operator.Tx(func(tx *sql.Tx) error {
@@ -165,13 +328,18 @@ func (operator *FOperator) SaveFile(ctx context.Context, fm *File) error {
 	})
 }
 
-// DuplFile returns a reference for an entity file.
-func (operator *FOperator) DuplFile(ctx context.Context, fid string, did string, createDate time.Time) error {
+// DuplFile returns a reference for an entity file, attrs are the
+// attributes of the duplication.
+func (operator *FOperator) DuplFile(ctx context.Context, fid string, did string, createDate time.Time, attrs map[string]string) error {
 	return operator.Tx(func(tx *sql.Tx) error {
 		if err := operator.saveDupl(ctx, tx, fid, did, createDate); err != nil {
 			return err
 		}
 
+		if err := operator.saveAttrs(ctx, tx, did, attrs); err != nil {
+			return err
+		}
+
 		if err := operator.refInc(ctx, tx, fid); err != nil {
 			return err
 		}
@@ -187,6 +355,30 @@ func (operator *FOperator) AddAttrs(ctx context.Context, fid string, attrs map[s
 	})
 }
 
+// UpdateAttrs updates attributes of a file.
+// An attribute with empty value will be removed.
+func (operator *FOperator) UpdateAttrs(ctx context.Context, fid string, attrs map[string]string) error {
+	return operator.Tx(func(tx *sql.Tx) error {
+		stmt, err := tx.Prepare(a_delete_key)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		put := make(map[string]string)
+		for k, v := range attrs {
+			if _, err := stmt.Exec(fid, k); err != nil {
+				return err
+			}
+			if len(v) > 0 {
+				put[k] = v
+			}
+		}
+
+		return operator.saveAttrs(ctx, tx, fid, put)
+	})
+}
+
 // RemoveFile removes a file with attributes if any.
 func (operator *FOperator) RemoveFile(ctx context.Context, fid string) (bool, error) {
 	result := false
@@ -221,6 +413,10 @@ func (operator *FOperator) RemoveDupl(ctx context.Context, did string) (bool, st
 			return nil
 		}
 
+		if err := operator.removeAttrs(ctx, tx, did); err != nil {
+			return err
+		}
+
 		result, err = operator.removeFile(ctx, tx, f.FId)
 		return err
 	})
@@ -237,7 +433,7 @@ func (operator *FOperator) saveFile(ctx context.Context, tx *sql.Tx, fm *File) e
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(fm.FId, fm.Name, fm.Biz, fm.Md5, fm.UserId, fm.Domain, fm.Size, fm.ChunkSize, fm.EntityType, fm.RefCount, fm.UploadTime)
+	_, err = stmt.Exec(fm.FId, fm.Name, fm.Biz, fm.Md5, fm.Sha256, fm.UserId, fm.Domain, fm.Size, fm.ChunkSize, fm.EntityType, fm.RefCount, fm.UploadTime)
 	if err != nil {
 		return err
 	}
@@ -347,6 +543,20 @@ func (operator *FOperator) removeFileAndAttrs(ctx context.Context, tx *sql.Tx, f
 	return nil
 }
 
+func (operator *FOperator) removeAttrs(ctx context.Context, tx *sql.Tx, fid string) error {
+	stmt, err := tx.Prepare(a_delete)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	if _, err = stmt.Exec(fid); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (operator *FOperator) removeDupl(ctx context.Context, tx *sql.Tx, did string) (int64, error) {
 	stmt, err := tx.Prepare(d_delete_bydid)
 	if err != nil {
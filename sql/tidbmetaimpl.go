@@ -75,6 +75,22 @@ func (impl *TiDBMetaImpl) FindByMd5(md5 string, domain int64) (*meta.File, error
 	return ToMetaFile(tf), nil
 }
 
+// FindBySha256 looks up the metadata of a file by its sha256 and domain.
+func (impl *TiDBMetaImpl) FindBySha256(sha256 string, domain int64) (*meta.File, error) {
+	if sha256 == "" || domain == 0 {
+		return nil, InputArgsNull
+	}
+
+	ctx := context.Background()
+
+	tf, err := impl.Session(ctx).LookupFileBySha256(ctx, sha256, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	return ToMetaFile(tf), nil
+}
+
 // DuplicateWithId duplicates a given file by its fid.
 func (impl *TiDBMetaImpl) DuplicateWithId(fid string, did string, createDate time.Time) (string, error) {
 	if fid == "" {
@@ -91,16 +107,20 @@ func (impl *TiDBMetaImpl) DuplicateWithId(fid string, did string, createDate tim
 
 	ctx := context.Background()
 
+	var original *File
+	var err error
 	if util.IsDuplId(fid) {
-		original, err := impl.Session(ctx).LookupFileByDid(ctx, util.GetRealId(fid))
-		if err != nil {
-			return "", err
-		}
-
-		fid = original.FId
+		original, err = impl.Session(ctx).LookupFileByDid(ctx, util.GetRealId(fid))
+	} else {
+		original, err = impl.Session(ctx).LookupFile(ctx, fid)
+	}
+	if err != nil {
+		return "", err
 	}
 
-	if err := impl.Session(ctx).DuplFile(ctx, fid, util.GetRealId(did), createDate); err != nil {
+	// User attributes are copied from the file duplicated.
+	attrs := meta.DuplExtAttrs(nil, original.ExtAttr)
+	if err := impl.Session(ctx).DuplFile(ctx, original.FId, util.GetRealId(did), createDate, attrs); err != nil {
 		return "", err
 	}
 
@@ -127,12 +147,86 @@ func (impl *TiDBMetaImpl) Delete(fid string) (bool, string, error) {
 	return result, fid, nil
 }
 
+// UpdateAttrs updates ext attributes of a file by its fid.
+func (impl *TiDBMetaImpl) UpdateAttrs(fid string, attrs map[string]string) error {
+	if fid == "" {
+		return InputArgsNull
+	}
+
+	ctx := context.Background()
+
+	// Attributes of a duplication are its own, keyed by its id.
+	if util.IsDuplId(fid) {
+		did := util.GetRealId(fid)
+		if _, err := impl.Session(ctx).LookupFileByDid(ctx, did); err != nil {
+			return err
+		}
+
+		return impl.Session(ctx).UpdateAttrs(ctx, did, attrs)
+	}
+
+	f, err := impl.Session(ctx).LookupFile(ctx, fid)
+	if err != nil {
+		return err
+	}
+
+	return impl.Session(ctx).UpdateAttrs(ctx, f.FId, attrs)
+}
+
+// List lists files which match the filter, starts after cursor.
+// Both entities and duplications are listed, in ascending order
+// of id. The cursor is the id of the last file in previous page.
+func (impl *TiDBMetaImpl) List(filter *meta.FileFilter, cursor string, limit int) ([]*meta.File, string, error) {
+	if filter == nil || filter.Domain == 0 {
+		return nil, "", InputArgsNull
+	}
+
+	ctx := context.Background()
+
+	after := cursor
+	if len(after) > 0 {
+		after = util.GetRealId(after)
+	}
+
+	files, err := impl.Session(ctx).ListFiles(ctx, filter, after, limit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	dupls, err := impl.Session(ctx).ListDupls(ctx, filter, after, limit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Merge them in ascending order of id.
+	result := make([]*meta.File, 0, limit)
+	for len(result) < limit && (len(files) > 0 || len(dupls) > 0) {
+		if len(dupls) == 0 || (len(files) > 0 && files[0].FId < dupls[0].FId) {
+			result = append(result, ToMetaFile(files[0]))
+			files = files[1:]
+			continue
+		}
+		f := ToMetaFile(dupls[0])
+		f.Id = util.GetDuplId(dupls[0].FId)
+		result = append(result, f)
+		dupls = dupls[1:]
+	}
+
+	next := ""
+	if len(result) == limit {
+		next = util.GetRealId(result[len(result)-1].Id)
+	}
+
+	return result, next, nil
+}
+
 func ToMetaFile(f *File) *meta.File {
 	return &meta.File{
 		Id:         f.FId,
 		Biz:        f.Biz,
 		Name:       f.Name,
 		Md5:        f.Md5,
+		Sha256:     f.Sha256,
 		UserId:     f.UserId,
 		Domain:     f.Domain,
 		Size:       f.Size,
@@ -149,6 +243,7 @@ func ToTiDBFile(m *meta.File) *File {
 		Biz:        m.Biz,
 		Name:       m.Name,
 		Md5:        m.Md5,
+		Sha256:     m.Sha256,
 		UserId:     m.UserId,
 		Domain:     m.Domain,
 		Size:       m.Size,
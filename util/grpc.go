@@ -36,6 +36,92 @@ func StreamRecoverServerInterceptor(srv interface{}, stream grpc.ServerStream, i
 	return handler(srv, stream)
 }
 
+// LimitFunc checks a request before it is processed, a non-nil error
+// rejects the request.
+type LimitFunc func(ctx context.Context, method string, req interface{}) error
+
+// NewUnaryLimitServerInterceptor returns a grpc server-side unary
+// interceptor which rejects the requests limited by check.
+func NewUnaryLimitServerInterceptor(check LimitFunc) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := check(ctx, info.FullMethod, req); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// NewStreamLimitServerInterceptor returns a grpc server-side stream
+// interceptor which rejects the streams limited by check. Since a
+// stream carries no request before receiving, it is checked with the
+// first message received.
+func NewStreamLimitServerInterceptor(check LimitFunc) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &limitedServerStream{
+			ServerStream: stream,
+			check:        check,
+			method:       info.FullMethod,
+		})
+	}
+}
+
+// limitedServerStream checks the first message received with check.
+type limitedServerStream struct {
+	grpc.ServerStream
+
+	check   LimitFunc
+	method  string
+	checked bool
+}
+
+// RecvMsg receives a message, returns the error of check if the
+// message is the first one and limited.
+func (s *limitedServerStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	if !s.checked {
+		s.checked = true
+		return s.check(s.Context(), s.method, m)
+	}
+
+	return nil
+}
+
+// ChainUnaryServerInterceptors chains unary interceptors into one,
+// the first one is the outermost.
+func ChainUnaryServerInterceptors(interceptors ...grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		chained := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], chained
+			chained = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, next)
+			}
+		}
+
+		return chained(ctx, req)
+	}
+}
+
+// ChainStreamServerInterceptors chains stream interceptors into one,
+// the first one is the outermost.
+func ChainStreamServerInterceptors(interceptors ...grpc.StreamServerInterceptor) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		chained := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], chained
+			chained = func(srv interface{}, stream grpc.ServerStream) error {
+				return interceptor(srv, stream, info, next)
+			}
+		}
+
+		return chained(srv, stream)
+	}
+}
+
 func getStack() string {
 	stack := strings.Split(string(debug.Stack()), "\n")
 	stacks := make([]string, 0, len(stack))
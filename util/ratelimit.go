@@ -0,0 +1,150 @@
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// Buckets idle for so long are full again, they are removed to
+	// keep the number of buckets bounded.
+	bucketIdleTime = 10 * time.Minute
+)
+
+// tokenBucket is a bucket filled with rate tokens per second,
+// and holds at most burst tokens.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// fill fills the bucket with the tokens since last time.
+func (b *tokenBucket) fill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+}
+
+// take takes a token from bucket, returns false if no token left.
+func (b *tokenBucket) take(now time.Time) bool {
+	b.fill(now)
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+
+	return true
+}
+
+// reserve takes n tokens from bucket, even if not enough, and
+// returns the duration to wait until the tokens taken are filled.
+func (b *tokenBucket) reserve(now time.Time, n int) time.Duration {
+	b.fill(now)
+	b.tokens -= float64(n)
+
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// RateLimiter limits the rate of events by key, with a token bucket
+// for every key. The limit of key is got on every event, so it can
+// be changed at any time.
+type RateLimiter struct {
+	limit func(key string) (rate float64, burst int)
+
+	lock      sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// NewRateLimiter returns a RateLimiter, limit returns the rate and
+// burst of a key, rate of 0 means unlimited.
+func NewRateLimiter(limit func(key string) (float64, int)) *RateLimiter {
+	return &RateLimiter{
+		limit:     limit,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow returns true if an event of key is allowed now.
+func (l *RateLimiter) Allow(key string) bool {
+	rate, burst := l.limit(key)
+	if rate <= 0 {
+		return true
+	}
+
+	now := time.Now()
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.sweep(now)
+
+	b := l.bucket(key, rate, burst, now)
+	return b.take(now)
+}
+
+// Reserve takes n tokens of key, and returns the duration to wait
+// before the event of n tokens happens, for shaping a rate of bytes.
+func (l *RateLimiter) Reserve(key string, n int) time.Duration {
+	rate, burst := l.limit(key)
+	if rate <= 0 || n <= 0 {
+		return 0
+	}
+
+	now := time.Now()
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.sweep(now)
+
+	b := l.bucket(key, rate, burst, now)
+	return b.reserve(now, n)
+}
+
+// bucket returns the bucket of key, which is created again
+// if its limit changed.
+func (l *RateLimiter) bucket(key string, rate float64, burst int, now time.Time) *tokenBucket {
+	b, ok := l.buckets[key]
+	if !ok || b.rate != rate || b.burst != float64(burst) {
+		b = newTokenBucket(rate, burst, now)
+		l.buckets[key] = b
+	}
+
+	return b
+}
+
+// sweep removes the buckets idle for a long time.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < bucketIdleTime {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= bucketIdleTime {
+			delete(l.buckets, key)
+		}
+	}
+}
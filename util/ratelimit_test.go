@@ -0,0 +1,92 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(2, 3, now)
+
+	for i := 0; i < 3; i++ {
+		if !b.take(now) {
+			t.Errorf("token %d of burst not taken", i)
+		}
+	}
+	if b.take(now) {
+		t.Error("token taken from empty bucket")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if !b.take(now) {
+		t.Error("token not filled after 500ms")
+	}
+	if b.take(now) {
+		t.Error("token taken more than filled")
+	}
+
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if !b.take(now) {
+			t.Errorf("token %d not filled up to burst", i)
+		}
+	}
+	if b.take(now) {
+		t.Error("tokens filled beyond burst")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	rate := 0.0
+	l := NewRateLimiter(func(key string) (float64, int) {
+		if key == "limited" {
+			return rate, 1
+		}
+		return 0, 0
+	})
+
+	for i := 0; i < 10; i++ {
+		if !l.Allow("free") {
+			t.Error("unlimited key not allowed")
+		}
+		if !l.Allow("limited") {
+			t.Error("key limited with rate 0 not allowed")
+		}
+	}
+
+	rate = 0.001
+	if !l.Allow("limited") {
+		t.Error("first event not allowed")
+	}
+	if l.Allow("limited") {
+		t.Error("event allowed beyond limit")
+	}
+
+	// Changing limit takes effect at once.
+	rate = 0.002
+	if !l.Allow("limited") {
+		t.Error("event not allowed with new limit")
+	}
+}
+
+func TestTokenBucketReserve(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(1000, 1000, now)
+
+	if d := b.reserve(now, 600); d != 0 {
+		t.Errorf("expected no wait within burst, got %v", d)
+	}
+	if d := b.reserve(now, 900); d != 500*time.Millisecond {
+		t.Errorf("expected wait 500ms, got %v", d)
+	}
+
+	// The tokens reserved are paid before the next one.
+	now = now.Add(500 * time.Millisecond)
+	if d := b.reserve(now, 1000); d != time.Second {
+		t.Errorf("expected wait 1s, got %v", d)
+	}
+	if b.take(now) {
+		t.Error("token taken while in debt")
+	}
+}
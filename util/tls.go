@@ -0,0 +1,168 @@
+package util
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// Files are checked for changes at most once in so long.
+	fileCheckInterval = 10 * time.Second
+)
+
+// fileLoader holds a value loaded from files, and loads it again
+// when any of the files changed. A value failed to load again is
+// logged, and the previous one is kept.
+type fileLoader struct {
+	files []string
+	load  func() (interface{}, error)
+
+	lock      sync.Mutex
+	value     interface{}
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+func newFileLoader(load func() (interface{}, error), files ...string) *fileLoader {
+	return &fileLoader{
+		files: files,
+		load:  load,
+	}
+}
+
+// get returns the value, loads it again if files changed.
+func (l *fileLoader) get() (interface{}, error) {
+	now := time.Now()
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.value != nil && now.Sub(l.lastCheck) < fileCheckInterval {
+		return l.value, nil
+	}
+	l.lastCheck = now
+
+	modTime, err := latestModTime(l.files)
+	if err != nil {
+		return l.reloadFailed(err)
+	}
+	if l.value != nil && !modTime.After(l.modTime) {
+		return l.value, nil
+	}
+
+	v, err := l.load()
+	if err != nil {
+		return l.reloadFailed(err)
+	}
+
+	if l.value != nil {
+		glog.Infof("Reloaded %v", l.files)
+	}
+	l.value = v
+	l.modTime = modTime
+
+	return l.value, nil
+}
+
+func (l *fileLoader) reloadFailed(err error) (interface{}, error) {
+	if l.value == nil {
+		return nil, err
+	}
+
+	glog.Warningf("Failed to reload %v, keep the previous, %v", l.files, err)
+	return l.value, nil
+}
+
+func latestModTime(files []string) (time.Time, error) {
+	var latest time.Time
+	for _, f := range files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return latest, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate in %s", caFile)
+	}
+
+	return pool, nil
+}
+
+// NewServerTLSConfig returns a tls config for server with the
+// certificate in certFile and keyFile. If clientCAFile is not empty,
+// clients are required to present certificates signed by the CAs in it.
+// Files are loaded again once they changed, so renewed certificates
+// take effect without restarting.
+func NewServerTLSConfig(certFile string, keyFile string, clientCAFile string) (*tls.Config, error) {
+	certs := newFileLoader(func() (interface{}, error) {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		return &cert, err
+	}, certFile, keyFile)
+	if _, err := certs.get(); err != nil {
+		return nil, err
+	}
+
+	getCertificate := func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		v, err := certs.get()
+		if err != nil {
+			return nil, err
+		}
+		return v.(*tls.Certificate), nil
+	}
+
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: getCertificate,
+	}
+	if clientCAFile == "" {
+		return config, nil
+	}
+
+	cas := newFileLoader(func() (interface{}, error) {
+		return loadCertPool(clientCAFile)
+	}, clientCAFile)
+	pool, err := cas.get()
+	if err != nil {
+		return nil, err
+	}
+
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	config.ClientCAs = pool.(*x509.CertPool)
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		pool, err := cas.get()
+		if err != nil {
+			return nil, err
+		}
+
+		return &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			NextProtos:     []string{"h2"},
+			GetCertificate: getCertificate,
+			ClientAuth:     tls.RequireAndVerifyClientCert,
+			ClientCAs:      pool.(*x509.CertPool),
+		}, nil
+	}
+
+	return config, nil
+}
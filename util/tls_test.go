@@ -0,0 +1,148 @@
+package util
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate of cn and its key.
+func writeCert(t *testing.T, certFile string, keyFile string, cn string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	c, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.Subject.CommonName
+}
+
+func TestServerTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeCert(t, certFile, keyFile, "server-a")
+
+	if _, err := NewServerTLSConfig(certFile, filepath.Join(dir, "none.pem"), ""); err == nil {
+		t.Errorf("expected error of missing key")
+	}
+
+	config, err := NewServerTLSConfig(certFile, keyFile, certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ClientAuth != tls.RequireAndVerifyClientCert || config.ClientCAs == nil {
+		t.Errorf("expected client certificates required")
+	}
+
+	cert, err := config.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cn := commonName(t, cert); cn != "server-a" {
+		t.Errorf("expected server-a, got %s", cn)
+	}
+
+	if c, err := config.GetConfigForClient(nil); err != nil || c.ClientCAs == nil {
+		t.Errorf("expected config for client, got %v", err)
+	}
+}
+
+func TestFileLoaderReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeCert(t, certFile, keyFile, "server-a")
+
+	l := newFileLoader(func() (interface{}, error) {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		return &cert, err
+	}, certFile, keyFile)
+
+	v, err := l.get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cn := commonName(t, v.(*tls.Certificate)); cn != "server-a" {
+		t.Errorf("expected server-a, got %s", cn)
+	}
+
+	writeCert(t, certFile, keyFile, "server-b")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+
+	// Not checked again within the interval.
+	v, _ = l.get()
+	if cn := commonName(t, v.(*tls.Certificate)); cn != "server-a" {
+		t.Errorf("expected server-a within interval, got %s", cn)
+	}
+
+	l.lastCheck = time.Time{}
+	v, _ = l.get()
+	if cn := commonName(t, v.(*tls.Certificate)); cn != "server-b" {
+		t.Errorf("expected server-b reloaded, got %s", cn)
+	}
+
+	// A broken file keeps the previous certificate.
+	ioutil.WriteFile(keyFile, []byte("broken"), 0600)
+	later = later.Add(time.Minute)
+	os.Chtimes(keyFile, later, later)
+	l.lastCheck = time.Time{}
+	v, err = l.get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cn := commonName(t, v.(*tls.Certificate)); cn != "server-b" {
+		t.Errorf("expected server-b kept, got %s", cn)
+	}
+}